@@ -16,11 +16,19 @@ func main() {
 	fmt.Println("Version: ", version)
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: go run main.go <config-file-path>")
+		fmt.Println("       go run main.go <config-file-path> silence <add|list|expire> [options]")
 		os.Exit(1)
 	}
 
 	configPath := os.Args[1]
 
+	if len(os.Args) > 2 && os.Args[2] == "silence" {
+		if err := monitor.RunSilenceCommand(configPath, os.Args[3:]); err != nil {
+			log.Fatalf("Silence command failed: %v", err)
+		}
+		return
+	}
+
 	monitor, err := monitor.NewMonitor(configPath)
 	if err != nil {
 		log.Fatalf("Failed to create monitor: %v", err)
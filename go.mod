@@ -2,7 +2,6 @@ module github.com/warkanum/go-postgres-stat-alert
 
 go 1.24.3
 
-require (
-	github.com/lib/pq v1.10.9 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
-)
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/lib/pq v1.10.9 // indirect
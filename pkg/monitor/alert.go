@@ -3,6 +3,8 @@ package monitor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
@@ -14,13 +16,24 @@ import (
 // AlertTracker tracks last alert times to prevent spam
 type AlertTracker struct {
 	LastAlert map[string]map[string]time.Time // [queryName][channel] -> lastAlertTime
+	Firing    map[string]time.Time            // [alertKey] -> time the condition started firing
+	Incidents map[string]map[string]time.Time // [alertKey][channel] -> time the incident was opened
+	Values    map[string][]float64            // [queryName] -> recent values, oldest first
+	Acked     map[string]string               // [alertKey] -> who acknowledged the firing alert
 	mu        sync.RWMutex
 }
 
+// maxRecentValues is the number of recent values kept per query
+const maxRecentValues = 30
+
 // NewAlertTracker creates a new alert tracker
 func NewAlertTracker() *AlertTracker {
 	return &AlertTracker{
 		LastAlert: make(map[string]map[string]time.Time),
+		Firing:    make(map[string]time.Time),
+		Incidents: make(map[string]map[string]time.Time),
+		Values:    make(map[string][]float64),
+		Acked:     make(map[string]string),
 	}
 }
 
@@ -37,6 +50,36 @@ func (at *AlertTracker) CanSendAlert(queryName, channel string, interval time.Du
 	return true // No previous alert found, allow sending
 }
 
+// ClaimAlert records an alert of a query on a channel as sent when the interval since the last one has passed.
+// Checking and recording in one step keeps concurrent deliveries from both passing the check. It returns the
+// previous time, which ReleaseAlert restores when the delivery fails.
+func (at *AlertTracker) ClaimAlert(queryName, channel string, interval time.Duration) (time.Time, bool) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	previous := at.LastAlert[queryName][channel]
+	if !previous.IsZero() && time.Since(previous) < interval {
+		return previous, false
+	}
+	if at.LastAlert[queryName] == nil {
+		at.LastAlert[queryName] = make(map[string]time.Time)
+	}
+	at.LastAlert[queryName][channel] = time.Now()
+	return previous, true
+}
+
+// ReleaseAlert gives back an interval claimed by ClaimAlert for an alert that was not delivered
+func (at *AlertTracker) ReleaseAlert(queryName, channel string, previous time.Time) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if previous.IsZero() {
+		delete(at.LastAlert[queryName], channel)
+		return
+	}
+	at.LastAlert[queryName][channel] = previous
+}
+
 // RecordAlert records when an alert was sent
 func (at *AlertTracker) RecordAlert(queryName, channel string) {
 	at.mu.Lock()
@@ -48,8 +91,238 @@ func (at *AlertTracker) RecordAlert(queryName, channel string) {
 	at.LastAlert[queryName][channel] = time.Now()
 }
 
-// checkAlertRules evaluates alert rules against query results
-func (m *MonitorInstance) checkAlertRules(queryConfig QueryConfig, columns []string, values []interface{}) {
+// MarkFiring records that an alert condition is firing.
+// It returns the time the condition started firing and whether it was already firing.
+func (at *AlertTracker) MarkFiring(key string) (time.Time, bool) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if since, exists := at.Firing[key]; exists {
+		return since, true
+	}
+	now := time.Now()
+	at.Firing[key] = now
+	return now, false
+}
+
+// FiringSince returns the time an alert condition started firing and whether it is firing
+func (at *AlertTracker) FiringSince(key string) (time.Time, bool) {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	since, exists := at.Firing[key]
+	return since, exists
+}
+
+// ClearFiring removes the firing state of an alert condition.
+// It returns the time the condition started firing and whether it was firing at all.
+func (at *AlertTracker) ClearFiring(key string) (time.Time, bool) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	since, exists := at.Firing[key]
+	if exists {
+		delete(at.Firing, key)
+		delete(at.Acked, key)
+	}
+	return since, exists
+}
+
+// FiringAlerts returns the alert conditions that are firing and the time they started firing
+func (at *AlertTracker) FiringAlerts() map[string]time.Time {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	firing := make(map[string]time.Time, len(at.Firing))
+	for key, since := range at.Firing {
+		firing[key] = since
+	}
+	return firing
+}
+
+// Acknowledge marks a firing alert as acknowledged, stopping its repeat notifications until it resolves.
+// It reports whether the alert is firing.
+func (at *AlertTracker) Acknowledge(key, by string) bool {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if _, exists := at.Firing[key]; !exists {
+		return false
+	}
+	at.Acked[key] = by
+	return true
+}
+
+// Acknowledged returns who acknowledged an alert and whether it is acknowledged
+func (at *AlertTracker) Acknowledged(key string) (string, bool) {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	by, exists := at.Acked[key]
+	return by, exists
+}
+
+// IncidentOpen checks if an incident was opened on a channel for an alert
+func (at *AlertTracker) IncidentOpen(key, channel string) bool {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	_, exists := at.Incidents[key][channel]
+	return exists
+}
+
+// OpenIncident records that an alert was delivered to a channel, opening an incident there
+func (at *AlertTracker) OpenIncident(key, channel string) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if at.Incidents[key] == nil {
+		at.Incidents[key] = make(map[string]time.Time)
+	}
+	if _, exists := at.Incidents[key][channel]; !exists {
+		at.Incidents[key][channel] = time.Now()
+	}
+}
+
+// CloseIncident removes the incident of an alert on a channel and reports whether it was open
+func (at *AlertTracker) CloseIncident(key, channel string) bool {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if _, exists := at.Incidents[key][channel]; !exists {
+		return false
+	}
+	delete(at.Incidents[key], channel)
+	if len(at.Incidents[key]) == 0 {
+		delete(at.Incidents, key)
+	}
+	return true
+}
+
+// RecordValue records the value a query returned, if it is numeric
+func (at *AlertTracker) RecordValue(queryName string, value interface{}) {
+	f, ok := convertToFloat64(value)
+	if !ok {
+		return
+	}
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	values := append(at.Values[queryName], f)
+	if len(values) > maxRecentValues {
+		values = values[len(values)-maxRecentValues:]
+	}
+	at.Values[queryName] = values
+}
+
+// RecentValues returns the recent values of a query, oldest first
+func (at *AlertTracker) RecentValues(queryName string) []float64 {
+	at.mu.RLock()
+	defer at.mu.RUnlock()
+
+	return append([]float64(nil), at.Values[queryName]...)
+}
+
+// queryErrorRuleName is the rule name used for alerts raised when a query fails to execute
+const queryErrorRuleName = "query_error"
+
+// ruleID returns a stable identifier for a rule within a query. Rules without a name are identified by their
+// condition and value, loadConfig rejects queries where these are ambiguous.
+func ruleID(rule AlertRule) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("%s_%v", rule.Condition, rule.Value)
+}
+
+// alertKey returns a stable key for a rule on a query of this instance
+func (m *MonitorInstance) alertKey(queryName string, rule AlertRule) string {
+	return fmt.Sprintf("%s/%s/%s", m.dbConfig.Instance, queryName, ruleID(rule))
+}
+
+// alertID returns a short identifier of an alert, used to refer to it in chat commands
+func alertID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// alertSeverity returns the severity of a rule, derived from the category when not set
+func alertSeverity(rule AlertRule) string {
+	switch strings.ToLower(rule.Severity) {
+	case "critical", "error", "warning", "info":
+		return strings.ToLower(rule.Severity)
+	}
+
+	switch strings.ToLower(rule.Category) {
+	case "critical", "security":
+		return "critical"
+	case "performance", "storage":
+		return "warning"
+	case "maintenance":
+		return "info"
+	}
+	return "error"
+}
+
+// severityRank orders severities from info (0) to critical (3)
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 3
+	case "error":
+		return 2
+	case "warning":
+		return 1
+	}
+	return 0
+}
+
+// recordDigest adds a fired alert to the digest, if enabled
+func (m *MonitorInstance) recordDigest(event AlertEvent) {
+	if !m.monitor.config.Alerts.Digest.Enabled {
+		return
+	}
+	m.monitor.digest.Record(m.alertKey(event.Query, event.Rule), alertSummary{
+		Time:     time.Now(),
+		Instance: m.dbConfig.Instance,
+		Query:    event.Query,
+		Category: event.Rule.Category,
+		Message:  event.Rule.Message,
+		Value:    event.Comparison(),
+	})
+}
+
+// rowColumns returns the names of the columns of a result row of count values, in the order of the query.
+// Columns without a name are named after their position.
+func rowColumns(columns []string, count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("column%d", i+1)
+		if i < len(columns) {
+			names[i] = columns[i]
+		}
+	}
+	return names
+}
+
+// rowValues maps the columns of a result row to their values
+func rowValues(columns []string, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(values))
+	for i, name := range rowColumns(columns, len(values)) {
+		value := values[i]
+		// PostgreSQL numeric and text types may come as byte slices
+		if b, ok := value.([]uint8); ok {
+			value = string(b)
+		}
+		row[name] = value
+	}
+	return row
+}
+
+// checkAlertRules evaluates alert rules against query results.
+// The keys of the rules that fired are added to fired.
+func (m *MonitorInstance) checkAlertRules(queryConfig QueryConfig, columns []string, values []interface{}, fired map[string]bool) {
 	for _, rule := range queryConfig.AlertRules {
 		// For simplicity, assume the first column contains the value to check
 		// In a real implementation, you might want to specify which column to check
@@ -74,16 +347,47 @@ func (m *MonitorInstance) checkAlertRules(queryConfig QueryConfig, columns []str
 
 		value := values[0]
 		if m.evaluateCondition(value, rule.Condition, rule.Value) {
-			m.monitor.logger.Printf("Alert triggered for query %s: %s", queryConfig.Name, rule.Message)
+			event := AlertEvent{
+				Query:    queryConfig.Name,
+				Rule:     rule,
+				Observed: observedValue(value),
+				Row:      rowValues(columns, values),
+				Columns:  rowColumns(columns, len(values)),
+			}
+			m.monitor.logger.Printf("Alert triggered for query %s: %s (%s)", queryConfig.Name, rule.Message, event.Comparison())
+			key := m.alertKey(queryConfig.Name, rule)
+			if fired != nil {
+				fired[key] = true
+			}
+			m.recordDigest(event)
+
+			// Only alerts that are dispatched or held back for later delivery become firing, so suppressed and
+			// silenced alerts are neither listed as firing nor resolved later
 			if !m.isWithinAlertHours(rule) {
+				if rule.AlertHours.Defer {
+					m.alertTracker.MarkFiring(key)
+					if err := m.monitor.deferred.Add(key, m, event); err != nil {
+						m.monitor.logger.Printf("Error saving deferred alert for query %s: %v", queryConfig.Name, err)
+					}
+					m.monitor.logger.Printf("Alert for query %s deferred until alert hours begin", queryConfig.Name)
+					continue
+				}
 				m.monitor.logger.Printf("Alert for query %s suppressed due to time restrictions", queryConfig.Name)
 				continue
 			}
-			m.sendAlerts(queryConfig.Name, rule)
+			if m.monitor.deferred.Pending(key) {
+				// Alert hours began, the alert goes out with the summary of deferred alerts
+				continue
+			}
+			if m.isSilenced(queryConfig.Name, rule) {
+				continue
+			}
+			m.alertTracker.MarkFiring(key)
+			m.sendAlerts(event)
 
 			// Execute action if specified
 			if rule.ExecuteAction != "" {
-				m.executeAction(queryConfig.Name, rule)
+				m.executeAction(event)
 			}
 
 		}
@@ -91,9 +395,34 @@ func (m *MonitorInstance) checkAlertRules(queryConfig QueryConfig, columns []str
 	}
 }
 
-// sendAlerts sends alerts to all configured channels
-func (m *MonitorInstance) sendAlerts(queryName string, rule AlertRule) {
-	// Determine which channels to use
+// resolveClearedAlerts sends resolutions for rules of a query that were firing but did not fire anymore
+func (m *MonitorInstance) resolveClearedAlerts(queryConfig QueryConfig, fired map[string]bool) {
+	for _, rule := range queryConfig.AlertRules {
+		key := m.alertKey(queryConfig.Name, rule)
+		if fired[key] {
+			continue
+		}
+		if since, wasFiring := m.alertTracker.ClearFiring(key); wasFiring {
+			m.monitor.logger.Printf("Alert resolved for query %s: %s (firing since %s)", queryConfig.Name, rule.Message, since.Format(time.RFC3339))
+			m.sendResolved(queryConfig.Name, rule, since)
+		}
+	}
+
+	// The query executed, so resolve a previous execution error as well
+	if len(queryConfig.AlertRules) > 0 {
+		rule := queryConfig.AlertRules[0]
+		rule.Name = queryErrorRuleName
+		rule.Category = "error"
+		if since, wasFiring := m.alertTracker.ClearFiring(m.alertKey(queryConfig.Name, rule)); wasFiring {
+			m.monitor.logger.Printf("Query %s executes successfully again", queryConfig.Name)
+			rule.Message = fmt.Sprintf("Query %s executes successfully again", queryConfig.Name)
+			m.sendResolved(queryConfig.Name, rule, since)
+		}
+	}
+}
+
+// alertChannels returns the channels a rule should be sent to
+func (m *MonitorInstance) alertChannels(rule AlertRule) []string {
 	channels := rule.Channels
 	if len(rule.Channels) == 0 {
 		// If no specific channels specified, use all enabled channels
@@ -116,47 +445,391 @@ func (m *MonitorInstance) sendAlerts(queryName string, rule AlertRule) {
 		if m.monitor.config.Alerts.WhatsApp.Enabled {
 			channels = append(channels, "whatsapp")
 		}
+		if m.monitor.config.Alerts.SMS.Enabled {
+			channels = append(channels, "sms")
+		}
+		if m.monitor.config.Alerts.Voice.Enabled {
+			channels = append(channels, "voice")
+		}
+		if m.monitor.config.Alerts.Ntfy.Enabled {
+			channels = append(channels, "ntfy")
+		}
+		if m.monitor.config.Alerts.Gotify.Enabled {
+			channels = append(channels, "gotify")
+		}
+		if m.monitor.config.Alerts.Pushover.Enabled {
+			channels = append(channels, "pushover")
+		}
+		if m.monitor.config.Alerts.Matrix.Enabled {
+			channels = append(channels, "matrix")
+		}
+		if m.monitor.config.Alerts.Mattermost.Enabled {
+			channels = append(channels, "mattermost")
+		}
+		if m.monitor.config.Alerts.RocketChat.Enabled {
+			channels = append(channels, "rocketchat")
+		}
+		if m.monitor.config.Alerts.GoogleChat.Enabled {
+			channels = append(channels, "googlechat")
+		}
+		if m.monitor.config.Alerts.Syslog.Enabled {
+			channels = append(channels, "syslog")
+		}
+		if m.monitor.config.Alerts.Journald.Enabled {
+			channels = append(channels, "journald")
+		}
+		if m.monitor.config.Alerts.JSONLog.Enabled {
+			channels = append(channels, "jsonlog")
+		}
+		if m.monitor.config.Alerts.MQTT.Enabled {
+			channels = append(channels, "mqtt")
+		}
+		if m.monitor.config.Alerts.NATS.Enabled {
+			channels = append(channels, "nats")
+		}
+		if m.monitor.config.Alerts.Kafka.Enabled {
+			channels = append(channels, "kafka")
+		}
+		if m.monitor.config.Alerts.PagerDuty.Enabled {
+			channels = append(channels, "pagerduty")
+		}
+		if m.monitor.config.Alerts.Opsgenie.Enabled {
+			channels = append(channels, "opsgenie")
+		}
+		if m.monitor.config.Alerts.Alertmanager.Enabled {
+			channels = append(channels, "alertmanager")
+		}
 	}
+	return channels
+}
+
+// sendAlerts sends alerts to all configured channels
+func (m *MonitorInstance) sendAlerts(event AlertEvent) {
+	ackedBy, acked := m.alertTracker.Acknowledged(m.alertKey(event.Query, event.Rule))
 
 	// Send to each specified channel
-	for _, channel := range channels {
-		var err error
+	for _, channel := range m.alertChannels(event.Rule) {
+		n := m.newNotification(strings.ToLower(channel), event)
+		if acked && n.Repeat && !channelKeepsState(n.Channel) {
+			m.monitor.logger.Printf("%s alert for query %s skipped, acknowledged by %s", n.Channel, event.Query, ackedBy)
+			continue
+		}
+		if m.monitor.config.Alerts.Grouping.Enabled && channelBatches(n.Channel) {
+			m.monitor.grouper.Add(m, n)
+			continue
+		}
+		m.enqueue(n)
+	}
+}
 
-		switch strings.ToLower(channel) {
-		case "webhook":
-			if m.monitor.config.Alerts.Webhook.Enabled {
-				err = m.sendWebhookAlert(queryName, rule)
-			}
-		case "telegram":
-			if m.monitor.config.Alerts.Telegram.Enabled {
-				err = m.sendTelegramAlert(queryName, rule)
-			}
-		case "discord":
-			if m.monitor.config.Alerts.Discord.Enabled {
-				err = m.sendDiscordAlert(queryName, rule)
-			}
-		case "teams":
-			if m.monitor.config.Alerts.Teams.Enabled {
-				err = m.sendTeamsAlert(queryName, rule)
-			}
-		case "email":
-			if m.monitor.config.Alerts.Email.Enabled {
-				err = m.sendEmailAlert(queryName, rule)
-			}
-		case "whatsapp":
-			if m.monitor.config.Alerts.WhatsApp.Enabled {
-				err = m.sendWhatsAppAlert(queryName, rule)
-			}
+// sendResolved notifies the incident management, log and message bus channels that an alert has cleared.
+// Only channels on which an incident was opened for the alert are notified.
+func (m *MonitorInstance) sendResolved(queryName string, rule AlertRule, since time.Time) {
+	key := m.alertKey(queryName, rule)
+
+	for _, channel := range m.alertChannels(rule) {
+		channel = strings.ToLower(channel)
+		if !m.alertTracker.CloseIncident(key, channel) || !m.channelResolves(channel) {
+			continue
+		}
+
+		n := m.newNotification(channel, AlertEvent{Query: queryName, Rule: rule})
+		n.Since = since
+		n.Resolved = true
+		m.enqueue(n)
+	}
+}
+
+// channelResolves checks if a channel supports resolving alerts
+func (m *MonitorInstance) channelResolves(channel string) bool {
+	switch channel {
+	case "pagerduty", "opsgenie", "alertmanager", "pushover", "syslog", "journald", "jsonlog", "mqtt", "nats", "kafka":
+		return true
+	case "email":
+		return m.monitor.config.Alerts.Email.SendResolved
+	}
+	return false
+}
+
+// channelKeepsState checks if a channel keeps the state of alerts for incident management, refreshed by repeat
+// notifications. An acknowledgement only stops the repeats to people: Alertmanager resolves an alert that is not
+// re-sent, and PagerDuty and Opsgenie keep their own acknowledgements.
+func channelKeepsState(channel string) bool {
+	switch channel {
+	case "alertmanager", "pagerduty", "opsgenie":
+		return true
+	}
+	return false
+}
+
+// channelInterval returns the minimum time between alerts of a query on a channel
+func (m *MonitorInstance) channelInterval(channel string) time.Duration {
+	switch channel {
+	case "webhook":
+		return m.monitor.config.Alerts.Webhook.Interval
+	case "telegram":
+		return m.monitor.config.Alerts.Telegram.Interval
+	case "discord":
+		return m.monitor.config.Alerts.Discord.Interval
+	case "teams":
+		return m.monitor.config.Alerts.Teams.Interval
+	case "email":
+		return m.monitor.config.Alerts.Email.Interval
+	case "whatsapp":
+		return m.monitor.config.Alerts.WhatsApp.Interval
+	case "sms":
+		return m.monitor.config.Alerts.SMS.Interval
+	case "voice":
+		return m.monitor.config.Alerts.Voice.Interval
+	case "ntfy":
+		return m.monitor.config.Alerts.Ntfy.Interval
+	case "gotify":
+		return m.monitor.config.Alerts.Gotify.Interval
+	case "pushover":
+		return m.monitor.config.Alerts.Pushover.Interval
+	case "matrix":
+		return m.monitor.config.Alerts.Matrix.Interval
+	case "mattermost":
+		return m.monitor.config.Alerts.Mattermost.Interval
+	case "rocketchat":
+		return m.monitor.config.Alerts.RocketChat.Interval
+	case "googlechat":
+		return m.monitor.config.Alerts.GoogleChat.Interval
+	case "syslog":
+		return m.monitor.config.Alerts.Syslog.Interval
+	case "journald":
+		return m.monitor.config.Alerts.Journald.Interval
+	case "jsonlog":
+		return m.monitor.config.Alerts.JSONLog.Interval
+	case "mqtt":
+		return m.monitor.config.Alerts.MQTT.Interval
+	case "nats":
+		return m.monitor.config.Alerts.NATS.Interval
+	case "kafka":
+		return m.monitor.config.Alerts.Kafka.Interval
+	case "pagerduty":
+		return m.monitor.config.Alerts.PagerDuty.Interval
+	case "opsgenie":
+		return m.monitor.config.Alerts.Opsgenie.Interval
+	case "alertmanager":
+		return m.monitor.config.Alerts.Alertmanager.Interval
+	}
+	return 0
+}
+
+// channelEnabled checks if a channel is configured and enabled
+func (m *MonitorInstance) channelEnabled(channel string) bool {
+	switch channel {
+	case "webhook":
+		return m.monitor.config.Alerts.Webhook.Enabled
+	case "telegram":
+		return m.monitor.config.Alerts.Telegram.Enabled
+	case "discord":
+		return m.monitor.config.Alerts.Discord.Enabled
+	case "teams":
+		return m.monitor.config.Alerts.Teams.Enabled
+	case "email":
+		return m.monitor.config.Alerts.Email.Enabled
+	case "whatsapp":
+		return m.monitor.config.Alerts.WhatsApp.Enabled
+	case "sms":
+		return m.monitor.config.Alerts.SMS.Enabled
+	case "voice":
+		return m.monitor.config.Alerts.Voice.Enabled
+	case "ntfy":
+		return m.monitor.config.Alerts.Ntfy.Enabled
+	case "gotify":
+		return m.monitor.config.Alerts.Gotify.Enabled
+	case "pushover":
+		return m.monitor.config.Alerts.Pushover.Enabled
+	case "matrix":
+		return m.monitor.config.Alerts.Matrix.Enabled
+	case "mattermost":
+		return m.monitor.config.Alerts.Mattermost.Enabled
+	case "rocketchat":
+		return m.monitor.config.Alerts.RocketChat.Enabled
+	case "googlechat":
+		return m.monitor.config.Alerts.GoogleChat.Enabled
+	case "syslog":
+		return m.monitor.config.Alerts.Syslog.Enabled
+	case "journald":
+		return m.monitor.config.Alerts.Journald.Enabled
+	case "jsonlog":
+		return m.monitor.config.Alerts.JSONLog.Enabled
+	case "mqtt":
+		return m.monitor.config.Alerts.MQTT.Enabled
+	case "nats":
+		return m.monitor.config.Alerts.NATS.Enabled
+	case "kafka":
+		return m.monitor.config.Alerts.Kafka.Enabled
+	case "pagerduty":
+		return m.monitor.config.Alerts.PagerDuty.Enabled
+	case "opsgenie":
+		return m.monitor.config.Alerts.Opsgenie.Enabled
+	case "alertmanager":
+		return m.monitor.config.Alerts.Alertmanager.Enabled
+	}
+	return false
+}
+
+// sendNotification performs a single delivery attempt of a notification to its channel
+func (m *MonitorInstance) sendNotification(n *Notification) DeliveryResult {
+	if !m.channelEnabled(n.Channel) {
+		return newDeliveryResult(n, DeliverySkippedDisabled, nil)
+	}
+
+	claims := m.claimAlerts(n)
+	if claims == nil {
+		m.monitor.logger.Printf("%s alert for query %s skipped due to interval limit", n.Channel, n.Query)
+		return newDeliveryResult(n, DeliverySkippedRateLimit, nil)
+	}
+
+	start := time.Now()
+	var result DeliveryResult
+	if len(n.Batch) > 0 {
+		result = m.sendBatch(n)
+	} else {
+		result = m.sendAlert(n)
+	}
+	result.Duration = time.Since(start)
+	if result.Status != DeliverySent {
+		for _, claim := range claims {
+			claim.instance.alertTracker.ReleaseAlert(claim.query, claim.channel, claim.previous)
 		}
+	}
+	return result
+}
+
+// alertClaim is the channel interval taken by an alert being delivered
+type alertClaim struct {
+	instance *MonitorInstance
+	query    string
+	channel  string
+	previous time.Time
+}
 
-		if err == nil {
-			m.alertTracker.RecordAlert(queryName, channel)
+// claimAlerts claims the channel interval of the alerts of a notification. Alerts of a group whose interval has
+// not passed are removed from it. It returns nil when no alert may be sent, resolutions are always sent.
+func (m *MonitorInstance) claimAlerts(n *Notification) []alertClaim {
+	if n.Resolved {
+		return []alertClaim{}
+	}
+
+	var claims []alertClaim
+	var batch []*Notification
+	for _, alert := range n.alerts() {
+		instance := m.monitor.instanceFor(alert.Instance, alert.Database)
+		if instance == nil {
+			instance = m
+		}
+		previous, ok := instance.alertTracker.ClaimAlert(alert.Query, alert.Channel, instance.channelInterval(alert.Channel))
+		if !ok {
+			continue
 		}
+		claims = append(claims, alertClaim{instance: instance, query: alert.Query, channel: alert.Channel, previous: previous})
+		batch = append(batch, alert)
 	}
+	if len(n.Batch) > 0 && len(batch) > 0 {
+		n.Batch = batch
+	}
+	return claims
+}
+
+// sendAlert sends a single alert or resolution to its channel
+func (m *MonitorInstance) sendAlert(n *Notification) DeliveryResult {
+	switch n.Channel {
+	case "webhook":
+		return m.sendWebhookAlert(n)
+	case "telegram":
+		return m.sendTelegramAlert(n)
+	case "discord":
+		return m.sendDiscordAlert(n)
+	case "teams":
+		return m.sendTeamsAlert(n)
+	case "email":
+		if n.Resolved {
+			return m.sendEmailResolved(n)
+		}
+		return m.sendEmailAlert(n)
+	case "whatsapp":
+		return m.sendWhatsAppAlert(n)
+	case "sms":
+		return m.sendSMSAlert(n)
+	case "voice":
+		return m.sendVoiceAlert(n)
+	case "ntfy":
+		return m.sendNtfyAlert(n)
+	case "gotify":
+		return m.sendGotifyAlert(n)
+	case "pushover":
+		if n.Resolved {
+			return m.sendPushoverCancel(n)
+		}
+		return m.sendPushoverAlert(n)
+	case "matrix":
+		return m.sendMatrixAlert(n)
+	case "mattermost":
+		return m.sendMattermostAlert(n)
+	case "rocketchat":
+		return m.sendRocketChatAlert(n)
+	case "googlechat":
+		return m.sendGoogleChatAlert(n)
+	case "syslog":
+		return m.sendSyslogAlert(n)
+	case "journald":
+		return m.sendJournaldAlert(n)
+	case "jsonlog":
+		return m.sendJSONLogAlert(n)
+	case "mqtt", "nats", "kafka":
+		return m.sendBusAlert(n)
+	case "pagerduty":
+		if n.Resolved {
+			return m.sendPagerDutyResolve(n)
+		}
+		return m.sendPagerDutyAlert(n)
+	case "opsgenie":
+		if n.Resolved {
+			return m.sendOpsgenieClose(n)
+		}
+		return m.sendOpsgenieAlert(n)
+	case "alertmanager":
+		return m.sendAlertmanagerAlert(n)
+	}
+	return deliveryResult(n, fmt.Errorf("unknown channel %s", n.Channel))
+}
+
+// sendBatch sends a group of alerts to its channel
+func (m *MonitorInstance) sendBatch(n *Notification) DeliveryResult {
+	switch n.Channel {
+	case "telegram":
+		return m.sendTelegramBatch(n)
+	case "discord":
+		return m.sendDiscordBatch(n)
+	case "teams":
+		return m.sendTeamsBatch(n)
+	case "email":
+		return m.sendEmailBatch(n)
+	case "whatsapp":
+		return m.sendWhatsAppBatch(n)
+	case "sms":
+		return m.sendSMSBatch(n)
+	case "voice":
+		return m.sendVoiceBatch(n)
+	case "matrix":
+		return m.sendMatrixBatch(n)
+	case "mattermost":
+		return m.sendMattermostBatch(n)
+	case "rocketchat":
+		return m.sendRocketChatBatch(n)
+	case "googlechat":
+		return m.sendGoogleChatBatch(n)
+	}
+	return deliveryResult(n, fmt.Errorf("channel %s does not support grouped alerts", n.Channel))
 }
 
 // executeAction runs the specified command/script when an alert is triggered
-func (m *MonitorInstance) executeAction(queryName string, rule AlertRule) {
+func (m *MonitorInstance) executeAction(event AlertEvent) {
+	queryName, rule := event.Query, event.Rule
 	m.monitor.logger.Printf("Executing action for query %s: %s", queryName, rule.ExecuteAction)
 
 	// Parse command and arguments
@@ -181,8 +854,10 @@ func (m *MonitorInstance) executeAction(queryName string, rule AlertRule) {
 		fmt.Sprintf("MONITOR_QUERY=%s", queryName),
 		fmt.Sprintf("MONITOR_MESSAGE=%s", rule.Message),
 		fmt.Sprintf("MONITOR_CATEGORY=%s", rule.Category),
-		fmt.Sprintf("MONITOR_TO=%s", rule.To),
+		fmt.Sprintf("MONITOR_TO=%s", m.monitor.displayRecipients(rule, "action")),
 		fmt.Sprintf("MONITOR_VALUE=%s", fmt.Sprintf("%v", rule.Value)),
+		fmt.Sprintf("MONITOR_OBSERVED=%s", fmt.Sprintf("%v", event.Observed)),
+		fmt.Sprintf("MONITOR_CONDITION=%s", event.Comparison()),
 	)
 
 	// Capture output
@@ -210,72 +885,3 @@ func (m *MonitorInstance) executeAction(queryName string, rule AlertRule) {
 		m.monitor.logger.Printf("Action output: %s", strings.TrimSpace(stdout.String()))
 	}
 }
-
-// isWithinAlertHours checks if current time is within allowed alert hours
-func (m *MonitorInstance) isWithinAlertHours(rule AlertRule) bool {
-	// If no alert hours specified, always allow alerts
-	if rule.AlertHours == nil {
-		return true
-	}
-
-	alertHours := rule.AlertHours
-
-	// Parse timezone
-	var loc *time.Location
-	var err error
-	if alertHours.Timezone != "" {
-		loc, err = time.LoadLocation(alertHours.Timezone)
-		if err != nil {
-			m.monitor.logger.Printf("Invalid timezone '%s', using UTC: %v", alertHours.Timezone, err)
-			loc = time.UTC
-		}
-	} else {
-		loc = time.Local // Use system local time if not specified
-	}
-
-	now := time.Now().In(loc)
-
-	// Check day of week if specified
-	if len(alertHours.Days) > 0 {
-		dayOfWeek := strings.ToLower(now.Weekday().String()[:3]) // "mon", "tue", etc.
-		dayAllowed := false
-		for _, allowedDay := range alertHours.Days {
-			if strings.ToLower(allowedDay) == dayOfWeek {
-				dayAllowed = true
-				break
-			}
-		}
-		if !dayAllowed {
-			return false
-		}
-	}
-
-	// Parse start time
-	startTime, err := time.ParseInLocation("15:04", alertHours.Start, loc)
-	if err != nil {
-		m.monitor.logger.Printf("Invalid start time format '%s', expected HH:MM: %v", alertHours.Start, err)
-		return true // Allow alert if time format is invalid
-	}
-
-	// Parse end time
-	endTime, err := time.ParseInLocation("15:04", alertHours.End, loc)
-	if err != nil {
-		m.monitor.logger.Printf("Invalid end time format '%s', expected HH:MM: %v", alertHours.End, err)
-		return true // Allow alert if time format is invalid
-	}
-
-	// Set dates to today for comparison
-	today := now.Format("2006-01-02")
-	startTime, _ = time.ParseInLocation("2006-01-02 15:04", today+" "+alertHours.Start, loc)
-	endTime, _ = time.ParseInLocation("2006-01-02 15:04", today+" "+alertHours.End, loc)
-
-	// Handle overnight ranges (e.g., 22:00 to 06:00)
-	if endTime.Before(startTime) {
-		// If end time is before start time, it spans midnight
-		// Check if current time is after start OR before end
-		return now.After(startTime) || now.Before(endTime)
-	}
-
-	// Normal range (e.g., 08:00 to 21:00)
-	return now.After(startTime) && now.Before(endTime)
-}
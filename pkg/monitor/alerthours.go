@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// alertWeekdays are the day names of alert windows
+var alertWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// isWithinAlertHours checks if current time is within allowed alert hours
+func (m *MonitorInstance) isWithinAlertHours(rule AlertRule) bool {
+	// If no alert hours specified, always allow alerts
+	if rule.AlertHours == nil {
+		return true
+	}
+
+	allowed, reason, err := alertHoursAllow(rule.AlertHours, time.Now())
+	if err != nil {
+		m.monitor.logger.Printf("Invalid alert hours: %v", err)
+	}
+	if reason != "" {
+		m.monitor.logger.Printf("Alerts blocked by %s", reason)
+	}
+	return allowed
+}
+
+// alertHoursAllow checks if alert hours allow alerts at now. It returns what blocks alerts when that is an
+// exception, maintenance window or calendar event. Invalid settings are returned as an error and skipped, the
+// remaining ones are still checked.
+func alertHoursAllow(alertHours *AlertHours, now time.Time) (bool, string, error) {
+	// Parse timezone
+	var loc *time.Location
+	var err error
+	if alertHours.Timezone != "" {
+		loc, err = time.LoadLocation(alertHours.Timezone)
+		if err != nil {
+			err = fmt.Errorf("invalid timezone '%s', using UTC: %w", alertHours.Timezone, err)
+			loc = time.UTC
+		}
+	} else {
+		loc = time.Local // Use system local time if not specified
+	}
+
+	now = now.In(loc)
+
+	// Exceptions, maintenance windows and calendar events take precedence over the windows
+	reason, blocked, blockErr := alertHoursBlocked(alertHours, now)
+	if blockErr != nil {
+		err = blockErr
+	}
+	if blocked {
+		return false, reason, err
+	}
+
+	windows := alertHoursWindows(alertHours)
+	if len(windows) == 0 {
+		return true, "", err
+	}
+
+	valid := false
+	for _, window := range windows {
+		within, windowErr := withinAlertWindow(now, window)
+		if windowErr != nil {
+			err = errors.Join(err, windowErr)
+			continue
+		}
+		if within {
+			return true, "", err
+		}
+		valid = true
+	}
+	// Without a single valid window, alerts are allowed rather than never sent
+	return !valid, "", err
+}
+
+// validateAlertHours checks the settings of alert hours when loading the configuration, as invalid ones are
+// skipped when checking them and would let alerts through during planned maintenance
+func validateAlertHours(alertHours *AlertHours) error {
+	if alertHours.Timezone != "" {
+		if _, err := time.LoadLocation(alertHours.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone '%s': %w", alertHours.Timezone, err)
+		}
+	}
+	for _, window := range alertHoursWindows(alertHours) {
+		if (window.Start == "") != (window.End == "") {
+			return fmt.Errorf("window %s - %s needs both a start and an end time", window.Start, window.End)
+		}
+		for _, day := range window.Days {
+			if !slices.Contains(alertWeekdays, strings.ToLower(day)) {
+				return fmt.Errorf("invalid day '%s', expected mon, tue, wed, thu, fri, sat or sun", day)
+			}
+		}
+		if _, err := withinAlertWindow(time.Now(), AlertWindow{Start: window.Start, End: window.End}); err != nil {
+			return err
+		}
+	}
+	for _, exception := range alertHours.Exceptions {
+		if _, _, err := exceptionDates(exception); err != nil {
+			return err
+		}
+	}
+	for _, maintenance := range alertHours.Maintenance {
+		start, end, err := maintenancePeriod(maintenance, time.UTC)
+		if err != nil {
+			return err
+		}
+		if !end.After(start) {
+			return fmt.Errorf("maintenance end '%s' is not after its start '%s'", maintenance.End, maintenance.Start)
+		}
+	}
+	if alertHours.Calendar != "" {
+		if _, err := loadCalendar(alertHours.Calendar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alertHoursWindows returns the daily windows of alert hours, including the top level start, end and days.
+// Top level days without a start and end allow the whole day.
+func alertHoursWindows(alertHours *AlertHours) []AlertWindow {
+	var windows []AlertWindow
+	if alertHours.Start != "" || alertHours.End != "" || len(alertHours.Days) > 0 {
+		windows = append(windows, AlertWindow{Start: alertHours.Start, End: alertHours.End, Days: alertHours.Days})
+	}
+	return append(windows, alertHours.Windows...)
+}
+
+// withinAlertWindow checks if now falls inside a daily window, in the location of now.
+// A window whose end is before its start spans midnight.
+func withinAlertWindow(now time.Time, window AlertWindow) (bool, error) {
+	loc := now.Location()
+
+	// Check day of week if specified
+	if len(window.Days) > 0 {
+		dayOfWeek := strings.ToLower(now.Weekday().String()[:3]) // "mon", "tue", etc.
+		dayAllowed := false
+		for _, allowedDay := range window.Days {
+			if strings.ToLower(allowedDay) == dayOfWeek {
+				dayAllowed = true
+				break
+			}
+		}
+		if !dayAllowed {
+			return false, nil
+		}
+	}
+
+	// A window of days only lasts the whole day
+	if window.Start == "" && window.End == "" {
+		return true, nil
+	}
+
+	// Validate the times
+	if _, err := time.ParseInLocation("15:04", window.Start, loc); err != nil {
+		return false, fmt.Errorf("invalid start time format '%s', expected HH:MM: %w", window.Start, err)
+	}
+	if _, err := time.ParseInLocation("15:04", window.End, loc); err != nil {
+		return false, fmt.Errorf("invalid end time format '%s', expected HH:MM: %w", window.End, err)
+	}
+
+	// Set dates to today for comparison, so DST changes are taken into account
+	today := now.Format("2006-01-02")
+	startTime, _ := time.ParseInLocation("2006-01-02 15:04", today+" "+window.Start, loc)
+	endTime, _ := time.ParseInLocation("2006-01-02 15:04", today+" "+window.End, loc)
+
+	// Handle overnight ranges (e.g., 22:00 to 06:00)
+	if endTime.Before(startTime) {
+		// If end time is before start time, it spans midnight
+		// Check if current time is after start OR before end
+		return now.After(startTime) || now.Before(endTime), nil
+	}
+
+	// Normal range (e.g., 08:00 to 21:00)
+	return now.After(startTime) && now.Before(endTime), nil
+}
+
+// alertHoursBlocked checks if now falls on an exception date, in a maintenance window or during a calendar event.
+// It returns a description of what blocks alerts. Invalid entries are skipped and returned as an error.
+func alertHoursBlocked(alertHours *AlertHours, now time.Time) (string, bool, error) {
+	var errs error
+	today := now.Format("2006-01-02")
+	for _, exception := range alertHours.Exceptions {
+		startDate, endDate, err := exceptionDates(exception)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		// Dates in YYYY-MM-DD format compare chronologically as strings
+		if today >= startDate && today <= endDate {
+			return fmt.Sprintf("exception %s (%s)", exception.Date, exception.Name), true, errs
+		}
+	}
+
+	for _, maintenance := range alertHours.Maintenance {
+		start, end, err := maintenancePeriod(maintenance, now.Location())
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if !now.Before(start) && now.Before(end) {
+			return fmt.Sprintf("maintenance %s - %s (%s)", maintenance.Start, maintenance.End, maintenance.Name), true, errs
+		}
+	}
+
+	if alertHours.Calendar != "" {
+		// A calendar that can no longer be read is still checked as it was last loaded
+		calendar, err := loadCalendar(alertHours.Calendar)
+		errs = errors.Join(errs, err)
+		if calendar != nil {
+			if event, busy := calendar.busy(now); busy {
+				return fmt.Sprintf("calendar event %q", event), true, errs
+			}
+		}
+	}
+
+	return "", false, errs
+}
+
+// exceptionDates returns the first and last date of an exception
+func exceptionDates(exception DateException) (string, string, error) {
+	if _, err := time.Parse("2006-01-02", exception.Date); err != nil {
+		return "", "", fmt.Errorf("invalid exception date '%s', expected YYYY-MM-DD: %w", exception.Date, err)
+	}
+	if exception.EndDate == "" {
+		return exception.Date, exception.Date, nil
+	}
+	if _, err := time.Parse("2006-01-02", exception.EndDate); err != nil {
+		return "", "", fmt.Errorf("invalid exception end date '%s', expected YYYY-MM-DD: %w", exception.EndDate, err)
+	}
+	return exception.Date, exception.EndDate, nil
+}
+
+// maintenancePeriod returns the start and end of a maintenance window in loc
+func maintenancePeriod(maintenance MaintenanceWindow, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02 15:04", maintenance.Start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance start '%s', expected YYYY-MM-DD HH:MM: %w", maintenance.Start, err)
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04", maintenance.End, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance end '%s', expected YYYY-MM-DD HH:MM: %w", maintenance.End, err)
+	}
+	return start, end, nil
+}
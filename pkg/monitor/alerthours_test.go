@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertHoursAllow(t *testing.T) {
+	overnight := AlertHours{Start: "22:00", End: "06:00", Timezone: "Europe/Berlin"}
+	office := AlertHours{Start: "08:00", End: "18:00", Timezone: "Europe/London"}
+	weekdays := AlertHours{Timezone: "Europe/Paris", Days: []string{"mon", "tue", "wed", "thu", "fri"}}
+	utc := func(value string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name       string
+		alertHours AlertHours
+		now        time.Time
+		want       bool
+	}{
+		{"overnight before midnight", overnight, utc("2025-03-29 21:30"), true},
+		{"overnight after midnight", overnight, utc("2025-03-30 00:30"), true},
+		{"overnight after spring forward", overnight, utc("2025-03-30 03:30"), true},
+		{"after overnight on spring forward", overnight, utc("2025-03-30 04:30"), false},
+		{"overnight after fall back", overnight, utc("2025-10-26 04:30"), true},
+		{"after overnight on fall back", overnight, utc("2025-10-26 05:30"), false},
+		{"overnight outside", overnight, utc("2025-07-01 12:00"), false},
+		{"office in summer time", office, utc("2025-07-01 07:30"), true},
+		{"office before opening in winter", office, utc("2025-01-15 07:30"), false},
+		{"office on spring forward", office, utc("2025-03-30 07:30"), true},
+		{"office closed in summer time", office, utc("2025-07-01 17:30"), false},
+		{"days only on saturday", weekdays, utc("2025-06-07 12:00"), false},
+		{"days only on monday", weekdays, utc("2025-06-09 12:00"), true},
+		{"days only at local saturday", weekdays, utc("2025-06-06 22:30"), false},
+		{"days only at local friday", weekdays, utc("2025-06-06 21:30"), true},
+		{"extra window", AlertHours{Timezone: "Europe/Paris", Start: "08:00", End: "18:00", Days: []string{"mon"},
+			Windows: []AlertWindow{{Start: "09:00", End: "13:00", Days: []string{"sat"}}}}, utc("2025-06-07 09:30"), true},
+		{"exception", AlertHours{Timezone: "Europe/Dublin", Days: weekdays.Days,
+			Exceptions: []DateException{{Date: "2025-12-25", Name: "Christmas"}}}, utc("2025-12-25 12:00"), false},
+		{"exception range", AlertHours{Timezone: "Europe/Dublin",
+			Exceptions: []DateException{{Date: "2025-12-31", EndDate: "2026-01-02"}}}, utc("2026-01-01 12:00"), false},
+		{"maintenance across fall back", AlertHours{Timezone: "Europe/Amsterdam",
+			Maintenance: []MaintenanceWindow{{Start: "2025-10-25 22:00", End: "2025-10-26 04:00"}}}, utc("2025-10-26 02:30"), false},
+		{"after maintenance across fall back", AlertHours{Timezone: "Europe/Amsterdam",
+			Maintenance: []MaintenanceWindow{{Start: "2025-10-25 22:00", End: "2025-10-26 04:00"}}}, utc("2025-10-26 03:30"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, _, err := alertHoursAllow(&tt.alertHours, tt.now)
+			if err != nil {
+				t.Fatalf("alertHoursAllow() error: %v", err)
+			}
+			if allowed != tt.want {
+				t.Errorf("alertHoursAllow(%s) = %v, want %v", tt.now.In(time.UTC).Format(time.RFC3339), allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertHoursAllowInvalidSettings(t *testing.T) {
+	// An invalid time zone falls back to UTC
+	allowed, _, err := alertHoursAllow(&AlertHours{Start: "08:00", End: "18:00", Timezone: "Europe/Nowhere"}, time.Date(2025, 7, 1, 7, 30, 0, 0, time.UTC))
+	if err == nil || allowed {
+		t.Errorf("alertHoursAllow() = %v, %v, want blocked in UTC with an error", allowed, err)
+	}
+
+	// An invalid window never blocks alerts
+	allowed, _, err = alertHoursAllow(&AlertHours{Start: "8am", End: "18:00", Timezone: "UTC"}, time.Date(2025, 7, 1, 3, 0, 0, 0, time.UTC))
+	if err == nil || !allowed {
+		t.Errorf("alertHoursAllow() = %v, %v, want allowed with an error", allowed, err)
+	}
+}
+
+func TestAlertHoursSkipInvalidEntries(t *testing.T) {
+	now := time.Date(2025, 7, 1, 3, 0, 0, 0, time.UTC)
+
+	// An invalid exception does not disable the maintenance windows after it
+	allowed, reason, err := alertHoursAllow(&AlertHours{Timezone: "UTC",
+		Exceptions:  []DateException{{Date: "2025-7-1"}},
+		Maintenance: []MaintenanceWindow{{Start: "2025-07-01 02:00", End: "2025-07-01 04:00", Name: "upgrade"}}}, now)
+	if err == nil || allowed || reason != "maintenance 2025-07-01 02:00 - 2025-07-01 04:00 (upgrade)" {
+		t.Errorf("alertHoursAllow() = %v, %q, %v, want blocked by the maintenance with an error", allowed, reason, err)
+	}
+
+	// An invalid window does not allow alerts outside the valid ones
+	allowed, _, err = alertHoursAllow(&AlertHours{Timezone: "UTC", Start: "08:00", End: "18:00",
+		Windows: []AlertWindow{{Start: "8pm", End: "22:00"}}}, now)
+	if err == nil || allowed {
+		t.Errorf("alertHoursAllow() = %v, %v, want blocked outside the valid window with an error", allowed, err)
+	}
+}
+
+func TestValidateAlertHours(t *testing.T) {
+	tests := map[string]AlertHours{
+		"timezone":            {Timezone: "Europe/Nowhere"},
+		"start time":          {Start: "8am", End: "18:00"},
+		"window without end":  {Windows: []AlertWindow{{Start: "08:00"}}},
+		"day":                 {Days: []string{"monday"}},
+		"exception date":      {Exceptions: []DateException{{Date: "2025-12-25"}, {Date: "25.12.2025"}}},
+		"exception end date":  {Exceptions: []DateException{{Date: "2025-12-24", EndDate: "2025-12-32"}}},
+		"maintenance start":   {Maintenance: []MaintenanceWindow{{Start: "2025-07-01", End: "2025-07-01 04:00"}}},
+		"maintenance reverse": {Maintenance: []MaintenanceWindow{{Start: "2025-07-01 04:00", End: "2025-07-01 02:00"}}},
+		"missing calendar":    {Calendar: "/nonexistent/maintenance.ics"},
+	}
+	for name, alertHours := range tests {
+		if err := validateAlertHours(&alertHours); err == nil {
+			t.Errorf("%s: validateAlertHours() accepted invalid settings", name)
+		}
+	}
+
+	valid := AlertHours{Timezone: "Europe/Berlin", Start: "08:00", End: "18:00", Days: []string{"Mon", "fri"},
+		Exceptions:  []DateException{{Date: "2025-12-24", EndDate: "2025-12-26"}},
+		Maintenance: []MaintenanceWindow{{Start: "2025-07-01 02:00", End: "2025-07-01 04:00"}}}
+	if err := validateAlertHours(&valid); err != nil {
+		t.Errorf("validateAlertHours() = %v", err)
+	}
+
+	config := `
+queries:
+  - name: connections
+    sql: "SELECT 1"
+    alert_rules:
+      - condition: gt
+        value: 100
+        alert_hours:
+          maintenance:
+            - start: "2025-07-01 02:00"
+              end: "tomorrow"
+`
+	if _, err := loadConfig(writeTestConfig(t, config)); err == nil {
+		t.Error("loadConfig() accepted an invalid maintenance window")
+	}
+}
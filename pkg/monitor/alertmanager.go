@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AlertmanagerConfig holds Prometheus Alertmanager configuration
+type AlertmanagerConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	URL            string            `yaml:"url"`                       // Base URL of Alertmanager, e.g. http://alertmanager:9093
+	Username       string            `yaml:"username,omitempty"`        // Optional basic auth username
+	Password       string            `yaml:"password,omitempty"`        // Optional basic auth password
+	Labels         map[string]string `yaml:"labels,omitempty"`          // Extra labels added to every alert
+	GeneratorURL   string            `yaml:"generator_url,omitempty"`   // Optional link back to the monitor or a dashboard
+	ResolveTimeout time.Duration     `yaml:"resolve_timeout,omitempty"` // Time after which Alertmanager resolves an alert that is not re-sent
+	Interval       time.Duration     `yaml:"interval"`
+}
+
+// AlertmanagerAlert represents an alert in the Alertmanager API v2 format
+type AlertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// sendAlertmanagerAlert posts an alert to Alertmanager, a resolution ends the alert now
+func (m *MonitorInstance) sendAlertmanagerAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	startsAt, endsAt := n.Since, time.Time{}
+	if n.Resolved {
+		endsAt = time.Now()
+	}
+	queryName, rule := event.Query, event.Rule
+	config := m.monitor.config.Alerts.Alertmanager
+
+	labels := map[string]string{
+		"alertname": queryName,
+		"instance":  m.dbConfig.Instance,
+		"query":     queryName,
+		"category":  rule.Category,
+		"rule":      ruleID(rule),
+		"severity":  alertSeverity(rule),
+	}
+	for name, value := range config.Labels {
+		labels[name] = value
+	}
+
+	annotations := map[string]string{
+		"summary":   rule.Message,
+		"value":     event.Comparison(),
+		"condition": rule.Condition,
+	}
+	if rule.ResolutionNote != "" {
+		annotations["description"] = rule.ResolutionNote
+	}
+	if rule.To != "" || len(rule.Recipients) > 0 {
+		annotations["to"] = m.monitor.displayRecipients(rule, "alertmanager")
+	}
+
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+	if endsAt.IsZero() {
+		// Keep the alert active until it is re-sent or resolved
+		endsAt = time.Now().Add(m.alertmanagerTimeout(queryName))
+	}
+
+	alerts := []AlertmanagerAlert{{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     startsAt.Format(time.RFC3339),
+		EndsAt:       endsAt.Format(time.RFC3339),
+		GeneratorURL: config.GeneratorURL,
+	}}
+
+	jsonData, err := json.Marshal(alerts)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Alertmanager alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to marshal Alertmanager alert: %w", err))
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(config.URL, "/")+"/api/v2/alerts", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error creating Alertmanager request: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to create Alertmanager request: %w", err))
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if config.Username != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Alertmanager alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to send Alertmanager alert: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Alertmanager alert sent successfully for query: %s (ends at: %s)", queryName, alerts[0].EndsAt)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Alertmanager alert failed with status code: %d (%s) for query: %s", resp.StatusCode, string(respBody), queryName)
+		return deliveryResult(n, newHTTPStatusError(resp, respBody, "Alertmanager alert failed with status code: %d (%s) for query: %s", resp.StatusCode, string(respBody), queryName))
+	}
+
+	return deliveryResult(n, nil)
+}
+
+// alertmanagerTimeout returns how long Alertmanager keeps a firing alert of a query active. The alert is only
+// re-sent on the next check that passes the channel interval, so it is kept for at least two of these periods
+// to avoid resolving and re-firing it between checks.
+func (m *MonitorInstance) alertmanagerTimeout(queryName string) time.Duration {
+	config := m.monitor.config.Alerts.Alertmanager
+	period := config.Interval
+	for _, query := range m.monitor.config.Queries {
+		if query.Name == queryName && query.Interval > period {
+			period = query.Interval
+		}
+	}
+	return max(config.ResolveTimeout, 2*period)
+}
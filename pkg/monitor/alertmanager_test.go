@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// alertmanagerTestInstance returns an instance posting to an Alertmanager stub server
+func alertmanagerTestInstance(t *testing.T, extra string) (*MonitorInstance, func() []recordedRequest) {
+	server, requests := recordingServer(t, http.StatusOK, ``)
+	return newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  alertmanager:
+    enabled: true
+    url: %q
+    username: "monitor"
+    password: "secret"
+    labels:
+      team: dba
+%s`, server.URL, extra))), requests
+}
+
+// alertmanagerAlerts decodes the alerts posted in a request
+func alertmanagerAlerts(t *testing.T, r recordedRequest) []AlertmanagerAlert {
+	t.Helper()
+
+	var alerts []AlertmanagerAlert
+	if err := json.Unmarshal(r.Body, &alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("posted %d alerts, want 1", len(alerts))
+	}
+	return alerts
+}
+
+func TestAlertmanagerTimeout(t *testing.T) {
+	instance, _ := alertmanagerTestInstance(t, `    interval: 10m
+queries:
+  - name: connections
+    sql: "SELECT count(*) FROM pg_stat_activity"
+    interval: 30m
+  - name: locks
+    sql: "SELECT count(*) FROM pg_locks"
+    interval: 1m
+`)
+
+	// The alert stays active for two periods of the slower of the query and channel interval, at least the resolve timeout
+	tests := map[string]time.Duration{"connections": time.Hour, "locks": 20 * time.Minute, "unknown": 20 * time.Minute}
+	for query, want := range tests {
+		if got := instance.alertmanagerTimeout(query); got != want {
+			t.Errorf("alertmanagerTimeout(%s) = %v, want %v", query, got, want)
+		}
+	}
+
+	instance.monitor.config.Alerts.Alertmanager.Interval = 0
+	if got := instance.alertmanagerTimeout("locks"); got != 5*time.Minute {
+		t.Errorf("alertmanagerTimeout(locks) = %v, want the default resolve timeout", got)
+	}
+}
+
+func TestAlertmanagerFireAndResolve(t *testing.T) {
+	instance, requests := alertmanagerTestInstance(t, "")
+	event := testEvent()
+	event.Rule.ResolutionNote = "Check the pool"
+	key := instance.alertKey(event.Query, event.Rule)
+	since, _ := instance.alertTracker.MarkFiring(key)
+
+	before := time.Now().Truncate(time.Second)
+	if result := instance.sendAlertmanagerAlert(instance.newNotification("alertmanager", event)); result.Status != DeliverySent {
+		t.Fatalf("sendAlertmanagerAlert() = %+v", result)
+	}
+	fired := requests()[0]
+	if user, password, ok := (&http.Request{Header: fired.Header}).BasicAuth(); fired.Path != "/api/v2/alerts" || !ok || user != "monitor" || password != "secret" {
+		t.Errorf("posted to %s as %q, want /api/v2/alerts with basic auth", fired.Path, user)
+	}
+	alert := alertmanagerAlerts(t, fired)[0]
+	want := map[string]string{"alertname": "connections", "instance": "test", "query": "connections", "category": "performance", "rule": "too_many", "severity": "warning", "team": "dba"}
+	for name, value := range want {
+		if alert.Labels[name] != value {
+			t.Errorf("label %s = %q, want %q", name, alert.Labels[name], value)
+		}
+	}
+	if alert.Annotations["summary"] != "Too many connections" || alert.Annotations["description"] != "Check the pool" {
+		t.Errorf("annotations = %v, want the message and resolution note", alert.Annotations)
+	}
+	startsAt, _ := time.Parse(time.RFC3339, alert.StartsAt)
+	endsAt, _ := time.Parse(time.RFC3339, alert.EndsAt)
+	if !startsAt.Equal(since.Truncate(time.Second)) {
+		t.Errorf("startsAt = %s, want the time the alert started firing %s", alert.StartsAt, since)
+	}
+	if endsAt.Before(before.Add(5 * time.Minute)) {
+		t.Errorf("endsAt = %s, want the resolve timeout ahead", alert.EndsAt)
+	}
+
+	// A cleared alert is resolved by ending it now, with the same labels and start
+	instance.alertTracker.OpenIncident(key, "alertmanager")
+	instance.alertTracker.ClearFiring(key)
+	instance.sendResolved(event.Query, event.Rule, since)
+	waitFor(t, time.Second, func() bool { return len(requests()) == 2 })
+
+	resolved := alertmanagerAlerts(t, requests()[1])[0]
+	endsAt, _ = time.Parse(time.RFC3339, resolved.EndsAt)
+	if resolved.StartsAt != alert.StartsAt || resolved.Labels["rule"] != "too_many" || endsAt.After(time.Now()) {
+		t.Errorf("resolution = %+v, want the alert ended now", resolved)
+	}
+	if instance.alertTracker.IncidentOpen(key, "alertmanager") {
+		t.Error("incident still open after the resolution")
+	}
+}
+
+func TestAcknowledgedAlertRefreshesAlertmanager(t *testing.T) {
+	mattermost, chatRequests := recordingServer(t, http.StatusOK, ``)
+	instance, requests := alertmanagerTestInstance(t, fmt.Sprintf(`  mattermost:
+    enabled: true
+    webhook_url: %q
+`, mattermost.URL))
+	event := testEvent()
+	key := instance.alertKey(event.Query, event.Rule)
+	instance.alertTracker.MarkFiring(key)
+	instance.alertTracker.OpenIncident(key, "alertmanager")
+	instance.alertTracker.OpenIncident(key, "mattermost")
+	instance.alertTracker.Acknowledge(key, "@jane")
+
+	instance.sendAlerts(event)
+	waitFor(t, time.Second, func() bool { return len(requests()) == 1 })
+	if got := len(chatRequests()); got != 0 {
+		t.Errorf("Mattermost received %d repeats of an acknowledged alert, want none", got)
+	}
+}
@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIConfig holds the settings of the HTTP management API
+type APIConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`          // Listen address, e.g. "127.0.0.1:9187"
+	Token   string `yaml:"token,omitempty"` // Bearer token required on every request, optional only on a loopback address
+}
+
+// isLoopbackAddress checks if a listen address only accepts connections from the local host
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// silenceRequest is the body of a create silence request
+type silenceRequest struct {
+	Instance  string    `json:"instance"`
+	Query     string    `json:"query"`
+	Category  string    `json:"category"`
+	Duration  string    `json:"duration"` // e.g. "2h", alternative to ends_at
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+}
+
+// startAPI serves the HTTP management API
+func (m *Monitor) startAPI() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/silences", m.handleListSilences)
+	mux.HandleFunc("POST /api/silences", m.handleCreateSilence)
+	mux.HandleFunc("DELETE /api/silences/{id}", m.handleExpireSilence)
+	mux.HandleFunc("GET /api/silences/suppressed", m.handleSuppressedAlerts)
+	mux.HandleFunc("GET /api/deliveries", m.handleListDeliveries)
+	mux.HandleFunc("GET /api/deliveries/stats", m.handleDeliveryStats)
+
+	server := &http.Server{
+		Addr:              m.config.API.Listen,
+		Handler:           m.authorizeAPI(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	m.logger.Printf("Starting management API on %s", m.config.API.Listen)
+	if err := server.ListenAndServe(); err != nil {
+		m.logger.Printf("Management API stopped: %v", err)
+	}
+}
+
+// authorizeAPI requires the configured bearer token on every request
+func (m *Monitor) authorizeAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.config.API.Token != "" {
+			expected := "Bearer " + m.config.API.Token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleListSilences lists the active silences, or all of them with ?all=true
+func (m *Monitor) handleListSilences(w http.ResponseWriter, r *http.Request) {
+	silences, err := m.silences.List(r.URL.Query().Get("all") == "true")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, silences)
+}
+
+// handleCreateSilence creates a silence
+func (m *Monitor) handleCreateSilence(w http.ResponseWriter, r *http.Request) {
+	var req silenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	silence := Silence{
+		Instance:  req.Instance,
+		Query:     req.Query,
+		Category:  req.Category,
+		StartsAt:  time.Now(),
+		EndsAt:    req.EndsAt,
+		Comment:   req.Comment,
+		CreatedBy: req.CreatedBy,
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid duration: "+err.Error())
+			return
+		}
+		silence.EndsAt = silence.StartsAt.Add(duration)
+	}
+
+	silence, err := m.silences.Add(silence)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	m.logger.Printf("Silence %s created until %s by %s (%s)", silence.ID, silence.EndsAt.Format(time.RFC3339), silence.CreatedBy, silence.Comment)
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+// handleExpireSilence expires a silence
+func (m *Monitor) handleExpireSilence(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := m.silences.Expire(id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	m.logger.Printf("Silence %s expired", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSuppressedAlerts lists the alerts recently muted by silences
+func (m *Monitor) handleSuppressedAlerts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.silences.Suppressed())
+}
+
+// handleListDeliveries lists the recent delivery results, optionally filtered with ?channel= and ?status=
+func (m *Monitor) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := DeliveryStatus(r.URL.Query().Get("status"))
+	if status != "" && !slices.Contains(deliveryStatuses, status) {
+		writeJSONError(w, http.StatusBadRequest, "unknown status "+string(status))
+		return
+	}
+	writeJSON(w, http.StatusOK, m.deliveries.Results(r.URL.Query().Get("channel"), status))
+}
+
+// handleDeliveryStats returns the number of delivery results per channel and status since startup
+func (m *Monitor) handleDeliveryStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.deliveries.Counts())
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
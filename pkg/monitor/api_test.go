@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:9187", true},
+		{"[::1]:9187", true},
+		{"localhost:9187", true},
+		{":9187", false},
+		{"0.0.0.0:9187", false},
+		{"10.0.0.5:9187", false},
+		{"monitor.example.com:9187", false},
+		{"127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopbackAddress(tt.addr); got != tt.want {
+			t.Errorf("isLoopbackAddress(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestAPIConfigRequiresToken(t *testing.T) {
+	loadTestConfig(t, "api:\n  enabled: true\n")
+	loadTestConfig(t, "api:\n  enabled: true\n  listen: \":9187\"\n  token: secret\n")
+
+	if _, err := loadConfig(writeTestConfig(t, "api:\n  enabled: true\n  listen: \":9187\"\n")); err == nil || !strings.Contains(err.Error(), "api.token") {
+		t.Errorf("loadConfig() = %v, want an error requiring api.token", err)
+	}
+}
+
+func TestAuthorizeAPI(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, "api:\n  enabled: true\n  token: secret\n"))
+	handler := instance.monitor.authorizeAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for authorization, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/silences", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Authorization %q: status %d, want %d", authorization, rec.Code, want)
+		}
+	}
+}
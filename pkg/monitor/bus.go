@@ -0,0 +1,441 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// BusConfig holds the settings shared by the message bus channels
+type BusConfig struct {
+	Topic          string          `yaml:"topic,omitempty"`           // Go template of the topic or subject, rendered with BusTopicData
+	PublishResults bool            `yaml:"publish_results,omitempty"` // Also publish the result of every query check
+	BufferSize     int             `yaml:"buffer_size,omitempty"`     // Alerts and query results each kept while the broker is unreachable (default 1000)
+	BufferDir      string          `yaml:"buffer_dir,omitempty"`      // Directory persisting buffered messages (default bus in outbox_dir)
+	TLS            TLSClientConfig `yaml:"tls,omitempty"`
+	Interval       time.Duration   `yaml:"interval"`
+}
+
+// BusTopicData is the data of the topic templates. The characters a bus reserves for its topic syntax are
+// replaced in the values, so that they cannot add levels or wildcards.
+type BusTopicData struct {
+	Type     string // "alert" or "result"
+	Status   string // "firing" or "resolved", empty for query results
+	Instance string
+	Database string
+	Query    string
+	Category string
+	Severity string
+}
+
+// QueryResult is a query check as published to the message buses
+type QueryResult struct {
+	Time     time.Time                `json:"time"`
+	Instance string                   `json:"instance"`
+	Database string                   `json:"database"`
+	Query    string                   `json:"query"`
+	Columns  []string                 `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows"`
+}
+
+// busPublisher publishes a message and waits until the broker has accepted it, connecting on demand
+type busPublisher interface {
+	Publish(topic string, key, payload []byte) error
+}
+
+// busRejectedError is a message the broker refused and will refuse again, like one that is too large or
+// published to a topic the client may not use. Retrying it would block the messages behind it.
+type busRejectedError struct {
+	err error
+}
+
+func (e *busRejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *busRejectedError) Unwrap() error {
+	return e.err
+}
+
+// messageBus is an enabled message bus channel
+type messageBus struct {
+	name      string
+	config    BusConfig
+	publisher busPublisher
+	sanitize  func(string) string // Replaces the reserved characters of topic values
+	alerts    *busBuffer          // Alerts and resolutions waiting to be published
+	results   *busBuffer          // Query results waiting to be published, nil unless publish_results is set
+}
+
+// newMessageBuses creates the enabled message bus channels and loads their buffered messages
+func newMessageBuses(config *Config) (map[string]*messageBus, error) {
+	timeout := config.Alerts.Delivery.SendTimeout
+	buses := make(map[string]*messageBus)
+	if config.Alerts.MQTT.Enabled {
+		buses["mqtt"] = &messageBus{name: "mqtt", config: config.Alerts.MQTT.BusConfig, publisher: newMQTTClient(config.Alerts.MQTT, timeout), sanitize: mqttTopicValue}
+	}
+	if config.Alerts.NATS.Enabled {
+		buses["nats"] = &messageBus{name: "nats", config: config.Alerts.NATS.BusConfig, publisher: newNATSClient(config.Alerts.NATS, timeout), sanitize: natsSubjectValue}
+	}
+	if config.Alerts.Kafka.Enabled {
+		buses["kafka"] = &messageBus{name: "kafka", config: config.Alerts.Kafka.BusConfig, publisher: newKafkaClient(config.Alerts.Kafka, timeout), sanitize: kafkaTopicValue}
+	}
+
+	for name, bus := range buses {
+		alertDir, resultDir := "", ""
+		if bus.config.BufferDir != "" {
+			alertDir = filepath.Join(bus.config.BufferDir, name, "alerts")
+			resultDir = filepath.Join(bus.config.BufferDir, name, "results")
+		}
+		alerts, err := newBusBuffer(alertDir, bus.config.BufferSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s alert buffer: %w", name, err)
+		}
+		bus.alerts = alerts
+
+		if !bus.config.PublishResults {
+			continue
+		}
+		results, err := newBusBuffer(resultDir, bus.config.BufferSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s buffer: %w", name, err)
+		}
+		bus.results = results
+	}
+	return buses, nil
+}
+
+// validateBusTopic checks the topic template of a message bus
+func validateBusTopic(name, topic string) error {
+	if _, err := template.New(name).Parse(topic); err != nil {
+		return fmt.Errorf("invalid %s topic: %w", name, err)
+	}
+	return nil
+}
+
+// topic renders the topic of a message
+func (b *messageBus) topic(data BusTopicData) (string, error) {
+	data.Instance = b.sanitize(data.Instance)
+	data.Database = b.sanitize(data.Database)
+	data.Query = b.sanitize(data.Query)
+	data.Category = b.sanitize(data.Category)
+	data.Severity = b.sanitize(data.Severity)
+
+	tmpl, err := template.New(b.name).Parse(b.config.Topic)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s topic: %w", b.name, err)
+	}
+	var topic bytes.Buffer
+	if err := tmpl.Execute(&topic, data); err != nil {
+		return "", fmt.Errorf("failed to render %s topic: %w", b.name, err)
+	}
+	if topic.Len() == 0 {
+		return "", fmt.Errorf("%s topic is empty", b.name)
+	}
+	return topic.String(), nil
+}
+
+// sendBusAlert buffers an alert or resolution for publishing to a message bus, keyed by the alert ID. The
+// buffer publishes in order, so that a resolution never overtakes its alert.
+func (m *MonitorInstance) sendBusAlert(n *Notification) DeliveryResult {
+	bus := m.monitor.buses[n.Channel]
+	if bus == nil {
+		return deliveryResult(n, fmt.Errorf("%s is not enabled", n.Channel))
+	}
+	record := m.alertRecord(n, nil)
+	topic, err := bus.topic(BusTopicData{
+		Type:     "alert",
+		Status:   record.Status,
+		Instance: record.Instance,
+		Database: record.Database,
+		Query:    record.Query,
+		Category: record.Category,
+		Severity: record.Severity,
+	})
+	if err != nil {
+		m.monitor.logger.Printf("Error building %s topic: %v", n.Channel, err)
+		return deliveryResult(n, err)
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling %s alert: %v", n.Channel, err)
+		return deliveryResult(n, fmt.Errorf("failed to marshal %s alert: %w", n.Channel, err))
+	}
+
+	// An alert that could not be persisted stays in the outbox and is buffered again on retry
+	dropped, err := bus.alerts.Add(topic, record.AlertID, payload)
+	if err != nil {
+		m.monitor.logger.Printf("Error buffering %s alert for query %s: %v", n.Channel, record.Query, err)
+		return deliveryResult(n, fmt.Errorf("failed to buffer %s alert: %w", n.Channel, err))
+	}
+	if dropped {
+		m.monitor.logger.Printf("%s alert buffer full, dropped the oldest alert", n.Channel)
+	}
+	m.monitor.logger.Printf("%s alert buffered for query: %s to %s", n.Channel, record.Query, topic)
+	return deliveryResult(n, nil)
+}
+
+// publishesResults checks if a message bus publishes query results
+func (m *Monitor) publishesResults() bool {
+	for _, bus := range m.buses {
+		if bus.results != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// publishResults buffers the result of a query check on the message buses publishing query results
+func (m *MonitorInstance) publishResults(queryName string, columns []string, rows []map[string]interface{}) {
+	result := QueryResult{
+		Time:     time.Now(),
+		Instance: m.dbConfig.Instance,
+		Database: m.dbConfig.Database,
+		Query:    queryName,
+		Columns:  columns,
+		Rows:     rows,
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling result of query %s: %v", queryName, err)
+		return
+	}
+
+	for _, bus := range m.monitor.buses {
+		if bus.results == nil {
+			continue
+		}
+		topic, err := bus.topic(BusTopicData{Type: "result", Instance: result.Instance, Database: result.Database, Query: queryName})
+		if err != nil {
+			m.monitor.logger.Printf("Error building %s topic: %v", bus.name, err)
+			continue
+		}
+		dropped, err := bus.results.Add(topic, result.Instance+"/"+queryName, payload)
+		if err != nil {
+			m.monitor.logger.Printf("Error buffering %s result of query %s: %v", bus.name, queryName, err)
+		}
+		if dropped {
+			m.monitor.logger.Printf("%s buffer full, dropped the oldest query result", bus.name)
+		}
+	}
+}
+
+// publishBuffered publishes the buffered messages of a bus in order, retrying with backoff while the broker
+// is unreachable. Messages the broker rejected are set aside, so that they do not block the ones behind them.
+func (m *Monitor) publishBuffered(bus *messageBus, buffer *busBuffer, kind string) {
+	attempts := 0
+	for {
+		msg := buffer.Next()
+		err := bus.publisher.Publish(msg.Topic, []byte(msg.Key), msg.Payload)
+		var rejected *busRejectedError
+		switch {
+		case errors.As(err, &rejected):
+			attempts = 0
+			m.logger.Printf("%s rejected %s message to %s, dropping it: %v", bus.name, kind, msg.Topic, err)
+			if err := buffer.Reject(msg); err != nil {
+				m.logger.Printf("Error setting aside rejected %s message: %v", bus.name, err)
+			}
+		case err != nil:
+			attempts++
+			backoff := m.config.Alerts.Delivery.retryBackoff(attempts, 0)
+			m.logger.Printf("Publishing %s messages to %s failed (%d buffered), retrying in %v: %v", kind, bus.name, buffer.Len(), backoff, err)
+			time.Sleep(backoff)
+		default:
+			attempts = 0
+			if err := buffer.Remove(msg); err != nil {
+				m.logger.Printf("Error removing published %s message: %v", bus.name, err)
+			}
+		}
+	}
+}
+
+// busMessage is an alert or query result waiting to be published
+type busMessage struct {
+	Seq     uint64          `json:"seq"`
+	Topic   string          `json:"topic"`
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// busBuffer holds messages until the broker has accepted them, optionally persisted to disk.
+// When full, the oldest messages are dropped.
+type busBuffer struct {
+	dir     string
+	size    int
+	pending []*busMessage
+	seq     uint64
+	wake    chan struct{}
+	mu      sync.Mutex
+}
+
+// newBusBuffer creates a buffer and loads the messages persisted in dir
+func newBusBuffer(dir string, size int) (*busBuffer, error) {
+	buffer := &busBuffer{dir: dir, size: size, wake: make(chan struct{}, 1)}
+	if dir == "" {
+		return buffer, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buffer directory: %w", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read buffered message %s: %w", file, err)
+		}
+		var msg busMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("failed to parse buffered message %s: %w", file, err)
+		}
+		buffer.pending = append(buffer.pending, &msg)
+		buffer.seq = max(buffer.seq, msg.Seq)
+	}
+	if len(buffer.pending) > 0 {
+		buffer.wake <- struct{}{}
+	}
+	return buffer, nil
+}
+
+// Len returns the number of buffered messages
+func (b *busBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending)
+}
+
+// Add buffers a message, dropping the oldest one when the buffer is full.
+// A message that cannot be persisted is not buffered.
+func (b *busBuffer) Add(topic, key string, payload []byte) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	msg := &busMessage{Seq: b.seq, Topic: topic, Key: key, Payload: payload}
+	if err := b.persist(msg); err != nil {
+		return false, err
+	}
+	b.pending = append(b.pending, msg)
+
+	dropped := false
+	if len(b.pending) > b.size {
+		b.removeFile(b.pending[0])
+		b.pending = b.pending[1:]
+		dropped = true
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return dropped, nil
+}
+
+// persist writes a message to the buffer directory, if any
+func (b *busBuffer) persist(msg *busMessage) error {
+	if b.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal buffered message: %w", err)
+	}
+	// Write to a temporary file first so a crash never leaves a partial entry
+	path := b.path(msg)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write buffered message: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write buffered message: %w", err)
+	}
+	return nil
+}
+
+// Next returns the oldest buffered message, waiting until there is one
+func (b *busBuffer) Next() *busMessage {
+	for {
+		b.mu.Lock()
+		if len(b.pending) > 0 {
+			msg := b.pending[0]
+			b.mu.Unlock()
+			return msg
+		}
+		b.mu.Unlock()
+		<-b.wake
+	}
+}
+
+// Remove deletes a published message, unless it was already dropped
+func (b *busBuffer) Remove(msg *busMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) == 0 || b.pending[0] != msg {
+		return nil
+	}
+	b.pending = b.pending[1:]
+	return b.removeFile(msg)
+}
+
+// Reject removes a message the broker rejected, keeping its persisted copy in the rejected subdirectory
+func (b *busBuffer) Reject(msg *busMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) == 0 || b.pending[0] != msg {
+		return nil
+	}
+	b.pending = b.pending[1:]
+	if b.dir == "" {
+		return nil
+	}
+
+	rejectedDir := filepath.Join(b.dir, "rejected")
+	if err := os.MkdirAll(rejectedDir, 0700); err != nil {
+		return fmt.Errorf("failed to create rejected directory: %w", err)
+	}
+	if err := os.Rename(b.path(msg), filepath.Join(rejectedDir, filepath.Base(b.path(msg)))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move rejected message: %w", err)
+	}
+	return nil
+}
+
+// removeFile deletes the persisted copy of a message
+func (b *busBuffer) removeFile(msg *busMessage) error {
+	if b.dir == "" {
+		return nil
+	}
+	if err := os.Remove(b.path(msg)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove buffered message: %w", err)
+	}
+	return nil
+}
+
+// path returns the file of a persisted message, named so that files sort in publishing order
+func (b *busBuffer) path(msg *busMessage) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d.json", msg.Seq))
+}
+
+// replaceReserved replaces the given characters and control characters of a topic value with underscores
+func replaceReserved(value, reserved string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(reserved, r) {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPublisher records the topics it published to and rejects the messages to topic "rejected"
+type testPublisher struct {
+	published []string
+	mu        sync.Mutex
+}
+
+func (p *testPublisher) Publish(topic string, key, payload []byte) error {
+	if topic == "rejected" {
+		return &busRejectedError{err: fmt.Errorf("not authorized for %s", topic)}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, topic)
+	return nil
+}
+
+func TestSendBusAlertBuffers(t *testing.T) {
+	dir := t.TempDir()
+	config := loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  nats:
+    enabled: true
+    buffer_dir: %q
+`, dir))
+	instance := newTestInstance(t, config)
+	buses, err := newMessageBuses(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance.monitor.buses = buses
+
+	if result := instance.sendBusAlert(instance.newNotification("nats", testEvent())); result.Status != DeliverySent {
+		t.Fatalf("sendBusAlert() status = %v, want sent once buffered", result.Status)
+	}
+	msg := buses["nats"].alerts.Next()
+	if msg.Topic != "pgstat.alert.test.connections" || msg.Key == "" {
+		t.Errorf("buffered message to %q with key %q, want the alert topic keyed by the alert ID", msg.Topic, msg.Key)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "nats", "alerts", "*.json")); len(files) != 1 {
+		t.Errorf("persisted %v, want the alert in the alert buffer directory", files)
+	}
+	if buses["nats"].results != nil {
+		t.Error("query result buffer created without publish_results")
+	}
+
+	// An alert that cannot be persisted is retried through the outbox instead of being buffered
+	if err := os.RemoveAll(filepath.Join(dir, "nats")); err != nil {
+		t.Fatal(err)
+	}
+	result := instance.sendBusAlert(instance.newNotification("nats", testEvent()))
+	if result.Status == DeliverySent || result.Permanent {
+		t.Errorf("sendBusAlert() = %+v without a buffer directory, want a transient failure", result)
+	}
+	if buses["nats"].alerts.Len() != 1 {
+		t.Errorf("buffer holds %d alerts, want only the persisted one", buses["nats"].alerts.Len())
+	}
+}
+
+func TestMessageBusBufferDirectories(t *testing.T) {
+	outbox := t.TempDir()
+	config := loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  delivery:
+    outbox_dir: %q
+  kafka:
+    enabled: true
+    brokers: ["127.0.0.1:1"]
+    publish_results: true
+`, outbox))
+	buses, err := newMessageBuses(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alerts and query results have sibling directories in the outbox directory by default
+	buses["kafka"].alerts.Add("alerts", "a", []byte(`{}`))
+	buses["kafka"].results.Add("results", "r", []byte(`{}`))
+	for _, kind := range []string{"alerts", "results"} {
+		if files, _ := filepath.Glob(filepath.Join(outbox, "bus", "kafka", kind, "*.json")); len(files) != 1 {
+			t.Errorf("%s directory holds %v, want one message", kind, files)
+		}
+	}
+}
+
+func TestPublishBufferedSetsAsideRejected(t *testing.T) {
+	dir := t.TempDir()
+	buffer, err := newBusBuffer(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer.Add("rejected", "a", []byte(`{}`))
+	buffer.Add("accepted", "b", []byte(`{}`))
+
+	publisher := &testPublisher{}
+	m := &Monitor{config: loadTestConfig(t, ""), logger: log.New(io.Discard, "", 0)}
+	go m.publishBuffered(&messageBus{name: "test", publisher: publisher}, buffer, "alert")
+
+	waitFor(t, 5*time.Second, func() bool { return buffer.Len() == 0 })
+	publisher.mu.Lock()
+	published := publisher.published
+	publisher.mu.Unlock()
+	if len(published) != 1 || published[0] != "accepted" {
+		t.Fatalf("published %v, want the message behind the rejected one", published)
+	}
+
+	rejected, _ := filepath.Glob(filepath.Join(dir, "rejected", "*.json"))
+	if len(rejected) != 1 {
+		t.Errorf("rejected directory holds %v, want the rejected message", rejected)
+	}
+	if pending, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(pending) != 0 {
+		t.Errorf("buffer directory still holds %v", pending)
+	}
+
+	// Rejected messages are not loaded again
+	reloaded, err := newBusBuffer(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Len() != 0 {
+		t.Errorf("reloaded %d messages, want 0", reloaded.Len())
+	}
+}
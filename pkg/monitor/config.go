@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -25,13 +27,332 @@ func loadConfig(configPath string) (*Config, error) {
 	if config.Alerts.Email.Interval == 0 {
 		config.Alerts.Email.Interval = 3 * time.Minute
 	}
+	if config.Alerts.Email.StartTLS == "" {
+		config.Alerts.Email.StartTLS = "opportunistic"
+	}
+	if config.Alerts.Email.Auth == "" {
+		config.Alerts.Email.Auth = "plain"
+		if config.Alerts.Email.Username == "" {
+			config.Alerts.Email.Auth = "none"
+		}
+	}
+	if config.Alerts.Telegram.PollTimeout == 0 {
+		config.Alerts.Telegram.PollTimeout = 30 * time.Second
+	}
+	if config.Alerts.Telegram.APIURL == "" {
+		config.Alerts.Telegram.APIURL = "https://api.telegram.org"
+	}
+	if err := validateDiscordMentions(config.Alerts.Discord.Mentions); err != nil {
+		return nil, err
+	}
+	if config.Alerts.Discord.ThreadsFile == "" {
+		config.Alerts.Discord.ThreadsFile = "discord-threads.json"
+	}
+	switch config.Alerts.Teams.Format {
+	case "":
+		config.Alerts.Teams.Format = "messagecard"
+	case "messagecard", "adaptive":
+	default:
+		return nil, fmt.Errorf("invalid teams format %q, expected messagecard or adaptive", config.Alerts.Teams.Format)
+	}
+	if graph := config.Alerts.Teams.Graph; graph.Enabled && (graph.TenantID == "" || graph.ClientID == "" || graph.RefreshToken == "" || graph.TeamID == "" || graph.ChannelID == "") {
+		return nil, fmt.Errorf("teams graph requires tenant_id, client_id, refresh_token, team_id and channel_id")
+	}
+	if config.Alerts.Teams.Graph.TokenFile == "" {
+		config.Alerts.Teams.Graph.TokenFile = "teams-graph-token.json"
+	}
 	if config.Alerts.WhatsApp.Interval == 0 {
 		config.Alerts.WhatsApp.Interval = 2 * time.Minute
 	}
+	if config.Alerts.WhatsApp.APIBaseURL == "" {
+		config.Alerts.WhatsApp.APIBaseURL = "https://graph.facebook.com"
+	}
+	if config.Alerts.WhatsApp.APIVersion == "" {
+		config.Alerts.WhatsApp.APIVersion = "v22.0"
+	}
+	if config.Alerts.WhatsApp.Template.Name != "" && config.Alerts.WhatsApp.Template.Language == "" {
+		config.Alerts.WhatsApp.Template.Language = "en_US"
+	}
+	for i, parameter := range config.Alerts.WhatsApp.Template.Parameters {
+		if _, err := template.New("whatsapp").Parse(parameter); err != nil {
+			return nil, fmt.Errorf("invalid whatsapp template parameter %d: %w", i+1, err)
+		}
+	}
+	seenWebhooks := make(map[string]bool)
+	for _, target := range config.Alerts.Webhook.webhookTargets() {
+		if seenWebhooks[target.name()] {
+			return nil, fmt.Errorf("duplicate webhook target %q, give the targets distinct names", target.name())
+		}
+		seenWebhooks[target.name()] = true
+	}
+	if config.Alerts.Webhook.Enabled {
+		targets := []*WebhookTarget{&config.Alerts.Webhook.WebhookTarget}
+		for i := range config.Alerts.Webhook.Targets {
+			targets = append(targets, &config.Alerts.Webhook.Targets[i])
+		}
+		for _, target := range targets {
+			if err := target.parseBodyTemplate(); err != nil {
+				return nil, fmt.Errorf("invalid webhook %s body template: %w", target.name(), err)
+			}
+		}
+	}
+	for _, twilio := range []*TwilioConfig{&config.Alerts.SMS.TwilioConfig, &config.Alerts.Voice.TwilioConfig} {
+		if twilio.BaseURL == "" {
+			twilio.BaseURL = "https://api.twilio.com"
+		}
+	}
+	if config.Alerts.SMS.MaxSegments == 0 {
+		config.Alerts.SMS.MaxSegments = 2
+	}
+	if config.Alerts.Voice.Language == "" {
+		config.Alerts.Voice.Language = "en-US"
+	}
+	if config.Alerts.Voice.Repeat == 0 {
+		config.Alerts.Voice.Repeat = 2
+	}
+	if config.Alerts.Voice.RingTimeout == 0 {
+		config.Alerts.Voice.RingTimeout = 30 * time.Second
+	}
+	if config.Alerts.Ntfy.ServerURL == "" {
+		config.Alerts.Ntfy.ServerURL = "https://ntfy.sh"
+	}
+	if config.Alerts.Pushover.APIURL == "" {
+		config.Alerts.Pushover.APIURL = "https://api.pushover.net/1/messages.json"
+	}
+	if config.Alerts.Pushover.Retry == 0 {
+		config.Alerts.Pushover.Retry = time.Minute
+	}
+	if config.Alerts.Pushover.Expire == 0 {
+		config.Alerts.Pushover.Expire = time.Hour
+	}
+	if config.Alerts.Pushover.Enabled && (config.Alerts.Pushover.Retry < 30*time.Second || config.Alerts.Pushover.Expire > 3*time.Hour) {
+		return nil, fmt.Errorf("pushover retry must be at least 30s and expire at most 3h")
+	}
+	if err := validatePriorities("ntfy", config.Alerts.Ntfy.Priorities, 1, 5); err != nil {
+		return nil, err
+	}
+	if err := validatePriorities("gotify", config.Alerts.Gotify.Priorities, 0, 10); err != nil {
+		return nil, err
+	}
+	if err := validatePriorities("pushover", config.Alerts.Pushover.Priorities, -2, 2); err != nil {
+		return nil, err
+	}
+	if config.Alerts.Syslog.Network == "" {
+		config.Alerts.Syslog.Network = "udp"
+	}
+	if config.Alerts.Syslog.Address == "" {
+		switch config.Alerts.Syslog.Network {
+		case "tls":
+			config.Alerts.Syslog.Address = "localhost:6514"
+		case "unix", "unixgram":
+			config.Alerts.Syslog.Address = "/dev/log"
+		default:
+			config.Alerts.Syslog.Address = "localhost:514"
+		}
+	}
+	switch config.Alerts.Syslog.Network {
+	case "udp", "tcp", "tls", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("invalid syslog network %q, expected udp, tcp, tls, unix or unixgram", config.Alerts.Syslog.Network)
+	}
+	if config.Alerts.Syslog.Facility == "" {
+		config.Alerts.Syslog.Facility = "local0"
+	}
+	if _, exists := syslogFacilities[config.Alerts.Syslog.Facility]; !exists {
+		return nil, fmt.Errorf("invalid syslog facility %q", config.Alerts.Syslog.Facility)
+	}
+	if config.Alerts.Syslog.AppName == "" {
+		config.Alerts.Syslog.AppName = "postgres-stat-alert"
+	}
+	if config.Alerts.Syslog.Hostname == "" {
+		config.Alerts.Syslog.Hostname, _ = os.Hostname()
+	}
+	if config.Alerts.Syslog.Enabled && config.Alerts.Syslog.EnterpriseID <= 0 {
+		return nil, fmt.Errorf("syslog.enterprise_id is required, set the private enterprise number of your organization")
+	}
+	if config.Alerts.Syslog.MaxSize == 0 {
+		config.Alerts.Syslog.MaxSize = syslogMaxStream
+		if config.Alerts.Syslog.Network == "udp" {
+			config.Alerts.Syslog.MaxSize = syslogMaxDatagram
+		}
+	}
+	if err := config.Alerts.Syslog.TLS.validate("syslog"); err != nil {
+		return nil, err
+	}
+	if config.Alerts.Journald.SocketPath == "" {
+		config.Alerts.Journald.SocketPath = "/run/systemd/journal/socket"
+	}
+	if config.Alerts.Journald.Identifier == "" {
+		config.Alerts.Journald.Identifier = "postgres-stat-alert"
+	}
+	if err := validateJournaldFields(config.Alerts.Journald.Fields); err != nil {
+		return nil, err
+	}
+	if err := validatePriorities("syslog", config.Alerts.Syslog.Priorities, 0, 7); err != nil {
+		return nil, err
+	}
+	if err := validatePriorities("journald", config.Alerts.Journald.Priorities, 0, 7); err != nil {
+		return nil, err
+	}
+	if config.Alerts.JSONLog.Enabled && config.Alerts.JSONLog.FilePath == "" {
+		return nil, fmt.Errorf("jsonlog file_path is required")
+	}
+	if config.Alerts.MQTT.Topic == "" {
+		config.Alerts.MQTT.Topic = "postgres-stat-alert/{{.Type}}/{{.Instance}}/{{.Query}}"
+	}
+	if config.Alerts.MQTT.ClientID == "" {
+		hostname, _ := os.Hostname()
+		config.Alerts.MQTT.ClientID = "postgres-stat-alert-" + hostname
+	}
+	if config.Alerts.MQTT.KeepAlive == 0 {
+		config.Alerts.MQTT.KeepAlive = time.Minute
+	}
+	if qos := config.Alerts.MQTT.QoS; qos != nil && *qos != 0 && *qos != 1 {
+		return nil, fmt.Errorf("invalid mqtt qos %d, expected 0 or 1", *qos)
+	}
+	if config.Alerts.MQTT.Enabled && config.Alerts.MQTT.BrokerURL == "" {
+		return nil, fmt.Errorf("mqtt broker_url is required")
+	}
+	if config.Alerts.NATS.Topic == "" {
+		config.Alerts.NATS.Topic = "pgstat.{{.Type}}.{{.Instance}}.{{.Query}}"
+	}
+	if config.Alerts.NATS.URL == "" {
+		config.Alerts.NATS.URL = "nats://localhost:4222"
+	}
+	if config.Alerts.NATS.Name == "" {
+		config.Alerts.NATS.Name = "postgres-stat-alert"
+	}
+	if config.Alerts.Kafka.Topic == "" {
+		config.Alerts.Kafka.Topic = "postgres-stat-{{.Type}}s"
+	}
+	if config.Alerts.Kafka.ClientID == "" {
+		config.Alerts.Kafka.ClientID = "postgres-stat-alert"
+	}
+	if config.Alerts.Kafka.SecurityProtocol == "" {
+		config.Alerts.Kafka.SecurityProtocol = "PLAINTEXT"
+	}
+	switch config.Alerts.Kafka.SecurityProtocol {
+	case "PLAINTEXT", "SSL", "SASL_PLAINTEXT", "SASL_SSL":
+	default:
+		return nil, fmt.Errorf("invalid kafka security_protocol %q, expected PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL", config.Alerts.Kafka.SecurityProtocol)
+	}
+	if config.Alerts.Kafka.SASL.Mechanism == "" {
+		config.Alerts.Kafka.SASL.Mechanism = "PLAIN"
+	}
+	switch config.Alerts.Kafka.SASL.Mechanism {
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+	default:
+		return nil, fmt.Errorf("invalid kafka sasl mechanism %q, expected PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", config.Alerts.Kafka.SASL.Mechanism)
+	}
+	if config.Alerts.Kafka.Acks == 0 {
+		config.Alerts.Kafka.Acks = -1
+	}
+	if config.Alerts.Kafka.Acks != -1 && config.Alerts.Kafka.Acks != 1 {
+		return nil, fmt.Errorf("invalid kafka acks %d, expected -1 or 1", config.Alerts.Kafka.Acks)
+	}
+	if config.Alerts.Kafka.Enabled && len(config.Alerts.Kafka.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers are required")
+	}
+	for name, bus := range map[string]*BusConfig{"mqtt": &config.Alerts.MQTT.BusConfig, "nats": &config.Alerts.NATS.BusConfig, "kafka": &config.Alerts.Kafka.BusConfig} {
+		if bus.BufferSize == 0 {
+			bus.BufferSize = 1000
+		}
+		if err := validateBusTopic(name, bus.Topic); err != nil {
+			return nil, err
+		}
+		if err := bus.TLS.validate(name); err != nil {
+			return nil, err
+		}
+	}
+	if config.Alerts.Alertmanager.ResolveTimeout == 0 {
+		config.Alerts.Alertmanager.ResolveTimeout = 5 * time.Minute
+	}
+	if config.Alerts.Delivery.MaxAttempts == 0 {
+		config.Alerts.Delivery.MaxAttempts = 5
+	}
+	if config.Alerts.Delivery.InitialBackoff == 0 {
+		config.Alerts.Delivery.InitialBackoff = 10 * time.Second
+	}
+	if config.Alerts.Delivery.MaxBackoff == 0 {
+		config.Alerts.Delivery.MaxBackoff = 10 * time.Minute
+	}
+	if config.Alerts.Delivery.QueueSize == 0 {
+		config.Alerts.Delivery.QueueSize = 100
+	}
+	if config.Alerts.Delivery.OutboxDir == "" {
+		config.Alerts.Delivery.OutboxDir = "outbox"
+	}
+	for _, bus := range []*BusConfig{&config.Alerts.MQTT.BusConfig, &config.Alerts.NATS.BusConfig, &config.Alerts.Kafka.BusConfig} {
+		if bus.BufferDir == "" {
+			bus.BufferDir = filepath.Join(config.Alerts.Delivery.OutboxDir, "bus")
+		}
+	}
+	if config.Alerts.Delivery.Workers == 0 {
+		config.Alerts.Delivery.Workers = 1
+	}
+	if config.Alerts.Delivery.SendTimeout == 0 {
+		config.Alerts.Delivery.SendTimeout = 30 * time.Second
+	}
+	if config.Alerts.Delivery.StatsInterval == 0 {
+		config.Alerts.Delivery.StatsInterval = 15 * time.Minute
+	}
+	if config.Alerts.Grouping.Window == 0 {
+		config.Alerts.Grouping.Window = 30 * time.Second
+	}
+	if config.Alerts.Digest.Interval == 0 {
+		config.Alerts.Digest.Interval = 24 * time.Hour
+	}
+
+	if config.Silences.File == "" {
+		config.Silences.File = "silences.json"
+	}
+	if config.API.Listen == "" {
+		config.API.Listen = "127.0.0.1:9187"
+	}
+	if config.API.Enabled && config.API.Token == "" && !isLoopbackAddress(config.API.Listen) {
+		return nil, fmt.Errorf("api.token is required when the API listens on %s, a non-loopback address", config.API.Listen)
+	}
+
+	for _, query := range config.Queries {
+		if err := validateRuleIDs(query); err != nil {
+			return nil, err
+		}
+		for i, rule := range query.AlertRules {
+			if rule.AlertHours == nil {
+				continue
+			}
+			if err := validateAlertHours(rule.AlertHours); err != nil {
+				return nil, fmt.Errorf("invalid alert hours of rule %d of query %s: %w", i+1, query.Name, err)
+			}
+		}
+	}
+
+	for name, schedule := range config.OnCall {
+		if _, err := schedule.OnCallAt(time.Now()); err != nil {
+			return nil, fmt.Errorf("invalid on-call schedule %s: %w", name, err)
+		}
+	}
 
 	return &config, nil
 }
 
+// validateRuleIDs checks that the rules of a query have distinct identifiers, which key their firing state,
+// deduplication and retries. Rules sharing a condition and value need a name to tell them apart.
+func validateRuleIDs(query QueryConfig) error {
+	seen := map[string]int{queryErrorRuleName: 0}
+	for i, rule := range query.AlertRules {
+		id := ruleID(rule)
+		if previous, exists := seen[id]; exists {
+			if previous == 0 {
+				return fmt.Errorf("alert rule %d of query %s uses the reserved name %s", i+1, query.Name, id)
+			}
+			return fmt.Errorf("alert rules %d and %d of query %s are both identified as %q, give them distinct names", previous, i+1, query.Name, id)
+		}
+		seen[id] = i + 1
+	}
+	return nil
+}
+
 // connectToDatabase establishes a connection to PostgreSQL
 func connectToDatabase(dbConfig DatabaseConfig) (*sql.DB, error) {
 	var sslstr = "disable"
@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deferredCheckInterval is the time between checks for deferred alerts that can be delivered
+const deferredCheckInterval = 30 * time.Second
+
+// DeferredAlerts holds the alerts held back by alert hours with defer enabled.
+// They are delivered once the alert hours allow it, if they are still firing by then.
+// With a file, they are persisted so that they are delivered after a restart.
+type DeferredAlerts struct {
+	file     string
+	alerts   map[string]*deferredAlert
+	restored []deferredRecord // Loaded alerts waiting for their instance, see Restore
+	mu       sync.Mutex
+}
+
+// deferredAlert is an alert held back by alert hours
+type deferredAlert struct {
+	instance *MonitorInstance
+	event    AlertEvent
+	first    time.Time
+	count    int
+}
+
+// deferredRecord is a deferred alert as persisted
+type deferredRecord struct {
+	Key      string     `json:"key"`
+	Instance string     `json:"instance"`
+	Database string     `json:"database"`
+	Event    AlertEvent `json:"event"`
+	First    time.Time  `json:"first"`
+	Count    int        `json:"count"`
+}
+
+// NewDeferredAlerts creates the set of deferred alerts and loads the ones persisted in file.
+// Without a file they are kept in memory only.
+func NewDeferredAlerts(file string) (*DeferredAlerts, error) {
+	d := &DeferredAlerts{file: file, alerts: make(map[string]*deferredAlert)}
+	if file == "" {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deferred alerts: %w", err)
+	}
+	if err := json.Unmarshal(data, &d.restored); err != nil {
+		return nil, fmt.Errorf("failed to parse deferred alerts: %w", err)
+	}
+	return d, nil
+}
+
+// deferredAlertsFile returns the file persisting the deferred alerts, next to the outbox entries
+func deferredAlertsFile(config DeliveryConfig) string {
+	if config.OutboxDir == "" {
+		return ""
+	}
+	return filepath.Join(config.OutboxDir, "deferred", "alerts.json")
+}
+
+// Restore holds back the loaded alerts again, on the instances that resolve returns. They are marked firing
+// until the next check of their query tells otherwise. It returns the number of restored alerts.
+func (d *DeferredAlerts) Restore(resolve func(instance, database string) *MonitorInstance) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	restored := 0
+	for _, record := range d.restored {
+		instance := resolve(record.Instance, record.Database)
+		if instance == nil {
+			continue
+		}
+		instance.alertTracker.MarkFiring(record.Key)
+		d.alerts[record.Key] = &deferredAlert{instance: instance, event: record.Event, first: record.First, count: record.Count}
+		restored++
+	}
+	d.restored = nil
+	return restored
+}
+
+// Add holds back an alert, keeping the latest event when it fires repeatedly
+func (d *DeferredAlerts) Add(key string, instance *MonitorInstance, event AlertEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	alert, exists := d.alerts[key]
+	if !exists {
+		alert = &deferredAlert{instance: instance, first: time.Now()}
+		d.alerts[key] = alert
+	}
+	alert.event = event
+	alert.count++
+	return d.save()
+}
+
+// save persists the deferred alerts, written to a temporary file first so a crash never leaves a partial file
+func (d *DeferredAlerts) save() error {
+	if d.file == "" {
+		return nil
+	}
+
+	records := make([]deferredRecord, 0, len(d.alerts))
+	for key, alert := range d.alerts {
+		records = append(records, deferredRecord{
+			Key:      key,
+			Instance: alert.instance.dbConfig.Instance,
+			Database: alert.instance.dbConfig.Database,
+			Event:    alert.event,
+			First:    alert.first,
+			Count:    alert.count,
+		})
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deferred alerts: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(d.file), 0700); err != nil {
+		return fmt.Errorf("failed to create deferred alerts directory: %w", err)
+	}
+	if err := os.WriteFile(d.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write deferred alerts: %w", err)
+	}
+	if err := os.Rename(d.file+".tmp", d.file); err != nil {
+		return fmt.Errorf("failed to write deferred alerts: %w", err)
+	}
+	return nil
+}
+
+// Pending checks if an alert is held back
+func (d *DeferredAlerts) Pending(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, exists := d.alerts[key]
+	return exists
+}
+
+// Ready removes and returns the alerts that the alert hours allow at now.
+// Alerts that are no longer firing are removed and returned as cleared.
+func (d *DeferredAlerts) Ready(now time.Time) (ready, cleared []*deferredAlert, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, alert := range d.alerts {
+		if _, firing := alert.instance.alertTracker.FiringSince(key); !firing {
+			delete(d.alerts, key)
+			cleared = append(cleared, alert)
+			continue
+		}
+		if allowed, _, _ := alertHoursAllow(alert.event.Rule.AlertHours, now); allowed {
+			delete(d.alerts, key)
+			ready = append(ready, alert)
+		}
+	}
+	if len(ready) > 0 || len(cleared) > 0 {
+		err = d.save()
+	}
+	return ready, cleared, err
+}
+
+// deliverDeferredAlerts periodically delivers the deferred alerts once their alert hours begin.
+// The alerts becoming ready together are sent as a single summary on channels that support it.
+func (m *Monitor) deliverDeferredAlerts() {
+	ticker := time.NewTicker(deferredCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ready, cleared, err := m.deferred.Ready(time.Now())
+		if err != nil {
+			m.logger.Printf("Error saving deferred alerts: %v", err)
+		}
+		for _, alert := range cleared {
+			m.logger.Printf("Deferred alert for query %s on %s cleared before alert hours began: %s", alert.event.Query, alert.instance.dbConfig.Instance, alert.event.Rule.Message)
+		}
+		if len(ready) == 0 {
+			continue
+		}
+		m.logger.Printf("Delivering %d deferred alerts", len(ready))
+
+		var channels []string
+		byChannel := make(map[string][]*Notification)
+		for _, alert := range ready {
+			if alert.instance.isSilenced(alert.event.Query, alert.event.Rule) {
+				continue
+			}
+			if alert.event.Rule.ExecuteAction != "" {
+				alert.instance.executeAction(alert.event)
+			}
+
+			event := alert.event
+			event.Rule.Message = fmt.Sprintf("%s (held back by alert hours since %s, fired %d times)", event.Rule.Message, alert.first.Format("2006-01-02 15:04"), alert.count)
+			for _, channel := range alert.instance.alertChannels(event.Rule) {
+				channel = strings.ToLower(channel)
+				if !alert.instance.alertTracker.CanSendAlert(event.Query, channel, alert.instance.channelInterval(channel)) {
+					continue
+				}
+				if _, exists := byChannel[channel]; !exists {
+					channels = append(channels, channel)
+				}
+				byChannel[channel] = append(byChannel[channel], alert.instance.newNotification(channel, event))
+			}
+		}
+
+		for _, channel := range channels {
+			notifications := byChannel[channel]
+			if len(notifications) > 1 && channelBatches(channel) {
+				first := notifications[0]
+				if instance := m.instanceFor(first.Instance, first.Database); instance != nil {
+					instance.enqueue(newBatchNotification("deferred|"+channel, notifications))
+				}
+				continue
+			}
+			for _, n := range notifications {
+				if instance := m.instanceFor(n.Instance, n.Database); instance != nil {
+					instance.enqueue(n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeferredAlertsSurviveRestart(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, ""))
+	file := filepath.Join(t.TempDir(), "deferred", "alerts.json")
+	deferred, err := NewDeferredAlerts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := testEvent()
+	event.Rule.AlertHours = &AlertHours{Start: "08:00", End: "18:00", Timezone: "UTC", Defer: true}
+	key := instance.alertKey(event.Query, event.Rule)
+	for range 2 {
+		if err := deferred.Add(key, instance, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restart loads the alert with a new alert tracker
+	instance.alertTracker = NewAlertTracker()
+	reloaded, err := NewDeferredAlerts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := instance.monitor.instanceFor
+	if restored := reloaded.Restore(resolve); restored != 1 {
+		t.Fatalf("Restore() = %d, want 1", restored)
+	}
+	if !reloaded.Pending(key) {
+		t.Fatal("restored alert is not pending")
+	}
+	if _, firing := instance.alertTracker.FiringSince(key); !firing {
+		t.Error("restored alert is not marked firing")
+	}
+
+	ready, cleared, err := reloaded.Ready(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 || len(cleared) != 0 {
+		t.Fatalf("Ready() = %d ready, %d cleared, want 1 ready", len(ready), len(cleared))
+	}
+	if alert := ready[0]; alert.instance != instance || alert.count != 2 || alert.event.Rule.Message != event.Rule.Message {
+		t.Errorf("ready alert = %+v, want the restored alert fired twice", alert)
+	}
+
+	// Delivered alerts are not restored again
+	again, err := NewDeferredAlerts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored := again.Restore(resolve); restored != 0 {
+		t.Errorf("Restore() after delivery = %d, want 0", restored)
+	}
+}
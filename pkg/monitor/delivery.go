@@ -0,0 +1,226 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/textproto"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeliveryStatus is the outcome of a delivery attempt
+type DeliveryStatus string
+
+const (
+	DeliverySent             DeliveryStatus = "sent"               // The channel accepted the alert
+	DeliverySkippedRateLimit DeliveryStatus = "skipped_rate_limit" // A previous alert was sent within the channel interval
+	DeliverySkippedDisabled  DeliveryStatus = "skipped_disabled"   // The channel is not enabled
+	DeliveryFailed           DeliveryStatus = "failed"             // The attempt failed and may be retried
+)
+
+// deliveryStatuses lists the known delivery statuses
+var deliveryStatuses = []DeliveryStatus{DeliverySent, DeliverySkippedRateLimit, DeliverySkippedDisabled, DeliveryFailed}
+
+// maxDeliveryHistory is the number of delivery results kept in memory
+const maxDeliveryHistory = 1000
+
+// DeliveryResult is the outcome of a delivery attempt of a notification to its channel
+type DeliveryResult struct {
+	Time       time.Time      `json:"time"`
+	Channel    string         `json:"channel"`
+	Instance   string         `json:"instance"`
+	Query      string         `json:"query"`
+	Alerts     int            `json:"alerts"` // Number of alerts, more than one for grouped notifications
+	Resolved   bool           `json:"resolved,omitempty"`
+	Status     DeliveryStatus `json:"status"`
+	Attempt    int            `json:"attempt"`
+	Duration   time.Duration  `json:"-"`                     // Serialized as duration_ms
+	StatusCode int            `json:"status_code,omitempty"` // HTTP or SMTP status code of a failed attempt
+	Body       string         `json:"body,omitempty"`        // Response body of a failed attempt
+	Permanent  bool           `json:"permanent,omitempty"`   // The failure will not go away by retrying
+	Error      string         `json:"error,omitempty"`
+	Targets    []TargetResult `json:"failed_targets,omitempty"` // Failures per target of a channel with several targets
+	Err        error          `json:"-"`
+	RetryAfter time.Duration  `json:"-"` // Delay before a retry requested by the channel
+}
+
+// TargetResult is the failure of a delivery attempt to one target of a channel, such as a webhook or phone number
+type TargetResult struct {
+	Target     string `json:"target"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Permanent  bool   `json:"permanent,omitempty"`
+	Error      string `json:"error"`
+}
+
+// MarshalJSON encodes the result with its duration in milliseconds
+func (r DeliveryResult) MarshalJSON() ([]byte, error) {
+	type result DeliveryResult
+	return json.Marshal(struct {
+		result
+		DurationMS float64 `json:"duration_ms"`
+	}{result(r), float64(r.Duration.Microseconds()) / 1000})
+}
+
+// newDeliveryResult creates the result of a delivery attempt
+func newDeliveryResult(n *Notification, status DeliveryStatus, err error) DeliveryResult {
+	result := DeliveryResult{
+		Time:     time.Now(),
+		Channel:  n.Channel,
+		Instance: n.Instance,
+		Query:    n.Query,
+		Alerts:   len(n.alerts()),
+		Resolved: n.Resolved,
+		Status:   status,
+		Attempt:  n.Attempts + 1,
+		Err:      err,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	result.StatusCode, result.Body = errorResponse(err)
+
+	var failed targetErrors
+	if errors.As(err, &failed) {
+		for _, target := range failed {
+			_, permanent := classifyDeliveryError(target.err)
+			statusCode, _ := errorResponse(target.err)
+			result.Targets = append(result.Targets, TargetResult{
+				Target:     target.target,
+				StatusCode: statusCode,
+				Permanent:  permanent,
+				Error:      target.err.Error(),
+			})
+		}
+	}
+	return result
+}
+
+// errorResponse returns the HTTP or SMTP status code and response of a failed attempt
+func errorResponse(err error) (int, string) {
+	var statusErr *httpStatusError
+	var smtpErr *textproto.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode, statusErr.Body
+	case errors.As(err, &smtpErr):
+		return smtpErr.Code, smtpErr.Msg
+	}
+	return 0, ""
+}
+
+// deliveryResult creates the result of sending a notification to its channel, classifying a failure
+func deliveryResult(n *Notification, err error) DeliveryResult {
+	if err == nil {
+		return newDeliveryResult(n, DeliverySent, nil)
+	}
+	result := newDeliveryResult(n, DeliveryFailed, err)
+	result.RetryAfter, result.Permanent = classifyDeliveryError(err)
+	return result
+}
+
+// sendToTargets sends a notification to every target that did not receive it in an earlier attempt, even when
+// sending to one of them fails. Targets that received it or failed permanently are recorded on the notification,
+// so a retry only sends to the targets that failed transiently.
+func (n *Notification) sendToTargets(targets []string, send func(target string) error) error {
+	var failed targetErrors
+	for _, target := range targets {
+		if _, done := n.Targets[target]; done {
+			continue
+		}
+
+		status := DeliverySent
+		if err := send(target); err != nil {
+			failed = append(failed, targetError{target: target, err: err})
+			if _, permanent := classifyDeliveryError(err); !permanent {
+				continue
+			}
+			status = DeliveryFailed
+		}
+		if n.Targets == nil {
+			n.Targets = make(map[string]DeliveryStatus)
+		}
+		n.Targets[target] = status
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// DeliveryHistory keeps the recent delivery results and counts the outcomes per channel
+type DeliveryHistory struct {
+	results []DeliveryResult
+	counts  map[string]map[DeliveryStatus]int64
+	mu      sync.Mutex
+}
+
+// NewDeliveryHistory creates an empty delivery history
+func NewDeliveryHistory() *DeliveryHistory {
+	return &DeliveryHistory{counts: make(map[string]map[DeliveryStatus]int64)}
+}
+
+// Record adds a delivery result
+func (h *DeliveryHistory) Record(result DeliveryResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.results = append(h.results, result)
+	if len(h.results) > maxDeliveryHistory {
+		h.results = h.results[len(h.results)-maxDeliveryHistory:]
+	}
+
+	if h.counts[result.Channel] == nil {
+		h.counts[result.Channel] = make(map[DeliveryStatus]int64)
+	}
+	h.counts[result.Channel][result.Status]++
+}
+
+// Results returns the recent delivery results, newest first, optionally limited to a channel and status
+func (h *DeliveryHistory) Results(channel string, status DeliveryStatus) []DeliveryResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	results := []DeliveryResult{}
+	for i := len(h.results) - 1; i >= 0; i-- {
+		result := h.results[i]
+		if (channel == "" || result.Channel == channel) && (status == "" || result.Status == status) {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Counts returns the number of delivery results per channel and status since startup
+func (h *DeliveryHistory) Counts() map[string]map[DeliveryStatus]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make(map[string]map[DeliveryStatus]int64, len(h.counts))
+	for channel, statuses := range h.counts {
+		counts[channel] = make(map[DeliveryStatus]int64, len(statuses))
+		for status, count := range statuses {
+			counts[channel][status] = count
+		}
+	}
+	return counts
+}
+
+// LogStats logs the delivery outcomes of every channel
+func (h *DeliveryHistory) LogStats(logger *log.Logger) {
+	counts := h.Counts()
+	channels := make([]string, 0, len(counts))
+	for channel := range counts {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	for _, channel := range channels {
+		c := counts[channel]
+		logger.Printf("Deliveries %s: sent %d, skipped (rate limit) %d, skipped (disabled) %d, failed %d",
+			channel, c[DeliverySent], c[DeliverySkippedRateLimit], c[DeliverySkippedDisabled], c[DeliveryFailed])
+	}
+}
@@ -4,79 +4,453 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Discord limits, see https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	discordMaxContent     = 2000
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFieldName   = 256
+	discordMaxFieldValue  = 1024
+	discordMaxFields      = 25
+	discordMaxFooter      = 2048
+	discordMaxEmbeds      = 10
+	discordMaxEmbedsTotal = 6000 // Characters of all embeds of a message
+)
+
 // DiscordConfig holds Discord webhook configuration
 type DiscordConfig struct {
-	Enabled    bool          `yaml:"enabled"`
-	WebhookURL string        `yaml:"webhook_url"`
-	Interval   time.Duration `yaml:"interval"`
+	Enabled     bool                `yaml:"enabled"`
+	WebhookURL  string              `yaml:"webhook_url"`
+	Mentions    map[string][]string `yaml:"mentions,omitempty"`     // Mentions per severity: "role:<id>", "user:<id>", "everyone" or "here"
+	Forum       bool                `yaml:"forum,omitempty"`        // The webhook posts into a forum channel, with a thread per instance
+	Threads     map[string]string   `yaml:"threads,omitempty"`      // Existing thread IDs per instance
+	ThreadsFile string              `yaml:"threads_file,omitempty"` // Keeps the created forum threads across restarts (default discord-threads.json)
+	Interval    time.Duration       `yaml:"interval"`
 }
 
 // DiscordMessage represents a Discord webhook message
 type DiscordMessage struct {
-	Content string         `json:"content,omitempty"`
-	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
+	Content         string                 `json:"content,omitempty"`
+	Embeds          []DiscordEmbed         `json:"embeds,omitempty"`
+	ThreadName      string                 `json:"thread_name,omitempty"` // Creates a forum post with this name
+	AllowedMentions *DiscordAllowedMention `json:"allowed_mentions,omitempty"`
 }
 
 // DiscordEmbed represents a Discord embed
 type DiscordEmbed struct {
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
-	Color       int    `json:"color,omitempty"`
-	Timestamp   string `json:"timestamp,omitempty"`
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+}
+
+// DiscordEmbedField is a name and value pair of an embed
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// DiscordEmbedFooter is the footer of an embed
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordAllowedMention limits who a message may ping, so only the configured mentions notify anyone
+type DiscordAllowedMention struct {
+	Parse []string `json:"parse"` // "everyone" for @everyone and @here
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// discordThreads remembers the forum threads created per instance
+type discordThreads struct {
+	ids  map[string]string
+	file string // File the created threads are saved to
+	mu   sync.Mutex
+}
+
+// loadDiscordThreads loads the forum threads created by earlier runs
+func loadDiscordThreads(config DiscordConfig) (*discordThreads, error) {
+	threads := &discordThreads{ids: make(map[string]string)}
+	if !config.Enabled || !config.Forum {
+		return threads, nil
+	}
+
+	threads.file = config.ThreadsFile
+	data, err := os.ReadFile(threads.file)
+	if os.IsNotExist(err) {
+		return threads, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Discord threads file: %w", err)
+	}
+	if err := json.Unmarshal(data, &threads.ids); err != nil {
+		return nil, fmt.Errorf("failed to parse Discord threads file: %w", err)
+	}
+	return threads, nil
+}
+
+// save writes the created threads to the threads file, threads.mu must be held
+func (threads *discordThreads) save() error {
+	if threads.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(threads.ids, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Discord threads: %w", err)
+	}
+	if err := os.WriteFile(threads.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write Discord threads file: %w", err)
+	}
+	if err := os.Rename(threads.file+".tmp", threads.file); err != nil {
+		return fmt.Errorf("failed to write Discord threads file: %w", err)
+	}
+	return nil
 }
 
 // sendDiscordAlert sends an alert to Discord
-func (m *MonitorInstance) sendDiscordAlert(queryName string, rule AlertRule) error {
-	if m.monitor.config.Alerts.Discord.Interval > 0 && !m.alertTracker.CanSendAlert(queryName, "discord", m.monitor.config.Alerts.Discord.Interval) {
-		m.monitor.logger.Printf("%s alert for query %s skipped due to interval limit", "discord", queryName)
-		return fmt.Errorf("%s alert for query %s skipped due to interval limit", "discord", queryName)
+func (m *MonitorInstance) sendDiscordAlert(n *Notification) DeliveryResult {
+	f := m.formatAlert(n.Event())
+	content, allowed := m.monitor.discordMentions(f.Severity)
+	return deliveryResult(n, m.postDiscordMessages(n, n.Query, m.dbConfig.Instance, discordMessages(content, allowed, f.DiscordEmbeds())))
+}
+
+// sendDiscordBatch sends a group of alerts to Discord, in as few embeds as the Discord limits allow
+func (m *MonitorInstance) sendDiscordBatch(n *Notification) DeliveryResult {
+	batch := n.Batch
+	instance := batch[0].Instance
+	for _, alert := range batch {
+		if alert.Instance != instance {
+			instance = "Multiple instances"
+			break
+		}
+	}
+
+	f := formatBatch(batch)
+	content, allowed := m.monitor.discordMentions(f.Severity)
+	return deliveryResult(n, m.postDiscordMessages(n, batchQueries(batch), instance, discordMessages(content, allowed, f.DiscordEmbeds())))
+}
+
+// DiscordEmbeds renders the alert as an embed with inline fields for the alert and its result row. A group is
+// rendered as a list in the description, split over as many embeds as the Discord limits require.
+func (f alertFormat) DiscordEmbeds() []DiscordEmbed {
+	if !f.Group {
+		description := f.Summary
+		if f.Note != "" {
+			description += "\n\n" + f.Note
+		}
+		if f.Runbook != "" {
+			description += "\n\n[Open runbook](" + f.Runbook + ")"
+		}
+
+		var fields []DiscordEmbedField
+		for _, field := range f.Fields {
+			fields = append(fields, DiscordEmbedField{Name: field.Name, Value: field.Value, Inline: field.Short})
+		}
+		return []DiscordEmbed{{
+			Title:       f.Title,
+			Description: description,
+			Color:       f.ColorValue(),
+			Timestamp:   f.Time.Format(time.RFC3339),
+			Fields:      append(fields, discordRowFields(f.Row, discordMaxFields-len(fields))...),
+			Footer:      discordFooter(),
+		}}
+	}
+
+	var lines []string
+	for _, field := range f.Fields {
+		lines = append(lines, fmt.Sprintf("• **%s**\n%s", field.Name, field.Value))
+	}
+	var embeds []DiscordEmbed
+	for i, description := range splitText(strings.Join(lines, "\n"), discordMaxDescription) {
+		embed := DiscordEmbed{Description: description, Color: f.ColorValue()}
+		if i == 0 {
+			embed.Title = f.Title
+		}
+		embeds = append(embeds, embed)
+	}
+	embeds[len(embeds)-1].Timestamp = f.Time.Format(time.RFC3339)
+	embeds[len(embeds)-1].Footer = discordFooter()
+	return embeds
+}
+
+// discordRowFields returns up to max inline fields with the columns of a result row
+func discordRowFields(row []alertField, max int) []DiscordEmbedField {
+	var fields []DiscordEmbedField
+	for i, column := range row {
+		if i == max-1 && len(row) > max {
+			fields = append(fields, DiscordEmbedField{Name: "…", Value: fmt.Sprintf("%d more columns", len(row)-i)})
+			break
+		}
+		fields = append(fields, DiscordEmbedField{Name: column.Name, Value: column.Value, Inline: true})
+	}
+	return fields
+}
+
+// discordFooter returns the footer naming the host the monitor runs on
+func discordFooter() *DiscordEmbedFooter {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown host"
+	}
+	return &DiscordEmbedFooter{Text: "postgres-stat-alert on " + host}
+}
+
+// discordMentions returns the mentions configured for a severity and the allowed mentions pinging exactly them
+func (m *Monitor) discordMentions(severity string) (string, *DiscordAllowedMention) {
+	allowed := &DiscordAllowedMention{Parse: []string{}}
+	var mentions []string
+	for _, mention := range m.config.Alerts.Discord.Mentions[severity] {
+		kind, id, _ := strings.Cut(mention, ":")
+		switch kind {
+		case "role":
+			mentions = append(mentions, "<@&"+id+">")
+			allowed.Roles = append(allowed.Roles, id)
+		case "user":
+			mentions = append(mentions, "<@"+id+">")
+			allowed.Users = append(allowed.Users, id)
+		case "everyone", "here":
+			mentions = append(mentions, "@"+kind)
+			allowed.Parse = []string{"everyone"}
+		}
+	}
+	return strings.Join(mentions, " "), allowed
+}
+
+// validateDiscordMentions checks the configured mentions
+func validateDiscordMentions(mentions map[string][]string) error {
+	for severity, list := range mentions {
+		switch severity {
+		case "critical", "error", "warning", "info":
+		default:
+			return fmt.Errorf("invalid discord mention severity %q, expected critical, error, warning or info", severity)
+		}
+		for _, mention := range list {
+			kind, id, _ := strings.Cut(mention, ":")
+			switch {
+			case (kind == "role" || kind == "user") && id != "":
+			case (kind == "everyone" || kind == "here") && id == "":
+			default:
+				return fmt.Errorf("invalid discord mention %q, expected role:<id>, user:<id>, everyone or here", mention)
+			}
+		}
 	}
-	// Choose color based on category
-	color := 0xff0000 // Red default
-	switch strings.ToLower(rule.Category) {
-	case "performance":
-		color = 0xffa500 // Orange
-	case "storage":
-		color = 0xffff00 // Yellow
-	case "security":
-		color = 0xff0000 // Red
-	case "maintenance":
-		color = 0x0080ff // Blue
+	return nil
+}
+
+// discordMessages truncates the embeds to the Discord limits and packs them into as few messages as possible,
+// the mentions go with the first message
+func discordMessages(content string, allowed *DiscordAllowedMention, embeds []DiscordEmbed) []DiscordMessage {
+	var messages []DiscordMessage
+	current := DiscordMessage{Content: truncateText(content, discordMaxContent), AllowedMentions: allowed}
+	size := 0
+	for _, embed := range embeds {
+		embed = limitDiscordEmbed(embed)
+		embedSize := discordEmbedSize(embed)
+		if len(current.Embeds) == discordMaxEmbeds || (len(current.Embeds) > 0 && size+embedSize > discordMaxEmbedsTotal) {
+			messages = append(messages, current)
+			current = DiscordMessage{AllowedMentions: allowed}
+			size = 0
+		}
+		current.Embeds = append(current.Embeds, embed)
+		size += embedSize
 	}
+	return append(messages, current)
+}
 
-	embed := DiscordEmbed{
-		Title:       "🚨 Database Alert 🚨",
-		Description: fmt.Sprintf("**Instance:** %s\n**Query:** %s\n**Message:** %s \n**Value** %v\n\n %v", m.dbConfig.Instance, queryName, rule.Message, rule.Value, rule.ResolutionNote),
-		Color:       color,
-		Timestamp:   time.Now().Format(time.RFC3339),
+// limitDiscordEmbed truncates the parts of an embed to the Discord limits
+func limitDiscordEmbed(embed DiscordEmbed) DiscordEmbed {
+	embed.Title = truncateText(embed.Title, discordMaxTitle)
+	embed.Description = truncateText(embed.Description, discordMaxDescription)
+	if len(embed.Fields) > discordMaxFields {
+		embed.Fields = embed.Fields[:discordMaxFields]
+	}
+	fields := make([]DiscordEmbedField, len(embed.Fields))
+	for i, field := range embed.Fields {
+		field.Name = truncateText(field.Name, discordMaxFieldName)
+		field.Value = truncateText(field.Value, discordMaxFieldValue)
+		// Discord rejects empty field names and values
+		if field.Name == "" {
+			field.Name = "-"
+		}
+		if field.Value == "" {
+			field.Value = "-"
+		}
+		fields[i] = field
+	}
+	embed.Fields = fields
+	if embed.Footer != nil {
+		embed.Footer = &DiscordEmbedFooter{Text: truncateText(embed.Footer.Text, discordMaxFooter)}
 	}
 
-	discordMsg := DiscordMessage{
-		Embeds: []DiscordEmbed{embed},
+	// Trim the description when the embed is still over the total limit
+	if over := discordEmbedSize(embed) - discordMaxEmbedsTotal; over > 0 {
+		description := []rune(embed.Description)
+		embed.Description = truncateText(embed.Description, max(len(description)-over, 1))
 	}
+	return embed
+}
+
+// discordEmbedSize counts the characters of an embed that count towards the Discord limit per message
+func discordEmbedSize(embed DiscordEmbed) int {
+	size := len([]rune(embed.Title)) + len([]rune(embed.Description))
+	for _, field := range embed.Fields {
+		size += len([]rune(field.Name)) + len([]rune(field.Value))
+	}
+	if embed.Footer != nil {
+		size += len([]rune(embed.Footer.Text))
+	}
+	return size
+}
+
+// splitText splits text into parts of at most limit characters, at line breaks where possible
+func splitText(text string, limit int) []string {
+	var parts []string
+	var current []rune
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+		if len(current)+len(runes) > limit && len(current) > 0 {
+			parts = append(parts, strings.TrimRight(string(current), "\n"))
+			current = nil
+		}
+		for len(runes) > limit {
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 || len(parts) == 0 {
+		parts = append(parts, strings.TrimRight(string(current), "\n"))
+	}
+	return parts
+}
+
+// truncateText shortens text to at most limit characters, ending it with an ellipsis when cut
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
 
+// postDiscordMessages posts the messages of an alert in order, into the thread of the instance when configured.
+// The messages posted are recorded on the notification, so a retry continues with the first message that failed.
+func (m *MonitorInstance) postDiscordMessages(n *Notification, queryName, instance string, messages []DiscordMessage) error {
+	for i, discordMsg := range messages {
+		part := fmt.Sprintf("message %d/%d", i+1, len(messages))
+		err := n.sendToTargets([]string{part}, func(string) error {
+			return m.postDiscordMessage(queryName, instance, discordMsg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postDiscordMessage posts a message to the Discord webhook. Messages go to the configured thread of the instance,
+// and in forum mode a thread is created for an instance on its first alert.
+func (m *MonitorInstance) postDiscordMessage(queryName, instance string, discordMsg DiscordMessage) error {
+	config := m.monitor.config.Alerts.Discord
+
+	threadID := config.Threads[instance]
+	if threadID == "" && config.Forum {
+		threads := m.monitor.discordThreads
+		threads.mu.Lock()
+		defer threads.mu.Unlock()
+
+		threadID = threads.ids[instance]
+		if threadID == "" {
+			discordMsg.ThreadName = truncateText(instance, 100)
+			webhookURL, err := discordWebhookURL(config.WebhookURL, url.Values{"wait": {"true"}})
+			if err != nil {
+				return err
+			}
+			channelID, err := m.postDiscordWebhook(queryName, webhookURL, discordMsg)
+			if err != nil {
+				return err
+			}
+			if channelID == "" {
+				// The post was created, but without its ID the next alert opens another one
+				m.monitor.logger.Printf("Discord did not report the forum thread created for instance %s, add it to threads", instance)
+				return nil
+			}
+			threads.ids[instance] = channelID
+			m.monitor.logger.Printf("Created Discord forum thread %s for instance %s", channelID, instance)
+			if err := threads.save(); err != nil {
+				m.monitor.logger.Printf("Error saving Discord forum threads: %v", err)
+			}
+			return nil
+		}
+	}
+
+	params := url.Values{}
+	if threadID != "" {
+		params.Set("thread_id", threadID)
+	}
+	webhookURL, err := discordWebhookURL(config.WebhookURL, params)
+	if err != nil {
+		return err
+	}
+	_, err = m.postDiscordWebhook(queryName, webhookURL, discordMsg)
+	return err
+}
+
+// discordWebhookURL adds query parameters to a webhook URL, keeping those it already has
+func discordWebhookURL(webhookURL string, params url.Values) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Discord webhook URL: %w", err)
+	}
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// postDiscordWebhook posts a message to a Discord webhook URL and returns the channel of the created message,
+// which Discord only reports with wait=true
+func (m *MonitorInstance) postDiscordWebhook(queryName, webhookURL string, discordMsg DiscordMessage) (string, error) {
 	jsonData, err := json.Marshal(discordMsg)
 	if err != nil {
 		m.monitor.logger.Printf("Error marshaling Discord message: %v", err)
-		return fmt.Errorf("failed to marshal Discord message: %w", err)
+		return "", fmt.Errorf("failed to marshal Discord message: %w", err)
 	}
 
-	resp, err := http.Post(m.monitor.config.Alerts.Discord.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := m.monitor.httpClient.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		m.monitor.logger.Printf("Error sending Discord alert: %v", err)
-		return fmt.Errorf("failed to send Discord alert: %w", err)
+		return "", fmt.Errorf("failed to send Discord alert: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		m.monitor.logger.Printf("Discord alert sent successfully for query: %s", queryName)
-	} else {
-		m.monitor.logger.Printf("Discord alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		m.monitor.logger.Printf("Discord alert failed with status code: %d (%s) for query: %s", resp.StatusCode, string(respBody), queryName)
+		return "", newHTTPStatusError(resp, respBody, "Discord alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
 	}
-	return nil
+	m.monitor.logger.Printf("Discord alert sent successfully for query: %s", queryName)
+
+	var created struct {
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		m.monitor.logger.Printf("Error parsing Discord response for query %s: %v", queryName, err)
+	}
+	return created.ChannelID, nil
 }
@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"fits", "one\ntwo", 10, []string{"one\ntwo"}},
+		{"empty", "", 10, []string{""}},
+		{"at line breaks", "one\ntwo\nthree", 8, []string{"one\ntwo", "three"}},
+		{"long line", "abcdefghij\nk", 4, []string{"abcd", "efgh", "ij\nk"}},
+		{"runes", "ééééé", 2, []string{"éé", "éé", "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+			for _, part := range got {
+				if n := len([]rune(part)); n > tt.limit {
+					t.Errorf("part %q has %d characters, over the limit of %d", part, n, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscordWebhookURL(t *testing.T) {
+	got, err := discordWebhookURL("https://discord.com/api/webhooks/1/abc?thread_id=old&with_components=true", map[string][]string{"thread_id": {"42"}, "wait": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://discord.com/api/webhooks/1/abc?thread_id=42&wait=true&with_components=true"; got != want {
+		t.Errorf("discordWebhookURL() = %q, want %q", got, want)
+	}
+}
+
+func TestDiscordForumThreadsPersist(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		if r.URL.Query().Get("wait") == "true" {
+			w.Write([]byte(`{"id": "1", "channel_id": "777"}`))
+		}
+	}))
+	defer server.Close()
+
+	config := loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  discord:
+    enabled: true
+    webhook_url: %q
+    forum: true
+    threads_file: %q
+`, server.URL+"/webhook?token=abc", filepath.Join(t.TempDir(), "discord-threads.json")))
+
+	for run := 0; run < 2; run++ {
+		threads, err := loadDiscordThreads(config.Alerts.Discord)
+		if err != nil {
+			t.Fatalf("loadDiscordThreads() error = %v", err)
+		}
+		instance := newTestInstance(t, config)
+		instance.monitor.discordThreads = threads
+		if result := instance.sendDiscordAlert(instance.newNotification("discord", testEvent())); result.Status != DeliverySent {
+			t.Fatalf("run %d: alert %s: %s", run, result.Status, result.Error)
+		}
+	}
+
+	// The thread created by the first run is used after the restart
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"token=abc&wait=true", "thread_id=777&token=abc"}
+	if strings.Join(queries, " ") != strings.Join(want, " ") {
+		t.Errorf("webhook queries = %q, want %q", queries, want)
+	}
+}
+
+func TestPostDiscordMessagesResumes(t *testing.T) {
+	var mu sync.Mutex
+	var posted []string
+	failSecond := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var msg DiscordMessage
+		json.Unmarshal(body, &msg)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Content == "second" && failSecond {
+			failSecond = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		posted = append(posted, msg.Content)
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  discord:
+    enabled: true
+    webhook_url: %q
+`, server.URL)))
+
+	n := instance.newNotification("discord", testEvent())
+	messages := []DiscordMessage{{Content: "first"}, {Content: "second"}, {Content: "third"}}
+	if err := instance.postDiscordMessages(n, "connections", "test", messages); err == nil {
+		t.Fatal("postDiscordMessages() succeeded while the second message failed")
+	}
+	if err := instance.postDiscordMessages(n, "connections", "test", messages); err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "first second third"; strings.Join(posted, " ") != want {
+		t.Errorf("posted %q, want each message once in order", posted)
+	}
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dispatcher delivers notifications asynchronously, with a bounded queue and workers per channel.
+// A slow or hanging channel therefore never delays query checks or other channels.
+type Dispatcher struct {
+	queueSize int
+	workers   int
+	logger    *log.Logger
+	queues    map[string]*channelQueue
+	mu        sync.Mutex
+}
+
+// channelQueue holds the pending notifications and counters of a single channel
+type channelQueue struct {
+	jobs      chan dispatchJob
+	delivered atomic.Int64
+	rejected  atomic.Int64
+}
+
+// dispatchJob is a notification waiting for delivery by an instance
+type dispatchJob struct {
+	instance     *MonitorInstance
+	notification *Notification
+}
+
+// NewDispatcher creates a dispatcher with queueSize pending notifications and the given number of workers per channel
+func NewDispatcher(queueSize, workers int, logger *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		queueSize: queueSize,
+		workers:   workers,
+		logger:    logger,
+		queues:    make(map[string]*channelQueue),
+	}
+}
+
+// queue returns the queue of a channel, starting its workers on first use
+func (d *Dispatcher) queue(channel string) *channelQueue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if q, exists := d.queues[channel]; exists {
+		return q
+	}
+
+	q := &channelQueue{jobs: make(chan dispatchJob, d.queueSize)}
+	d.queues[channel] = q
+	for i := 0; i < d.workers; i++ {
+		go func() {
+			for job := range q.jobs {
+				job.instance.deliver(job.notification)
+				q.delivered.Add(1)
+			}
+		}()
+	}
+	return q
+}
+
+// Dispatch queues a notification for delivery. It never blocks: when the queue of the
+// channel is full, the notification is rejected and counted, and false is returned.
+func (d *Dispatcher) Dispatch(instance *MonitorInstance, n *Notification) bool {
+	q := d.queue(n.Channel)
+
+	select {
+	case q.jobs <- dispatchJob{instance: instance, notification: n}:
+		return true
+	default:
+		rejected := q.rejected.Add(1)
+		d.logger.Printf("%s queue full (%d pending), alert for query %s rejected (%d rejected in total)", n.Channel, len(q.jobs), n.Query, rejected)
+		return false
+	}
+}
+
+// LogStats logs the queue depth, delivery and drop counters of every channel
+func (d *Dispatcher) LogStats() {
+	d.mu.Lock()
+	channels := make([]string, 0, len(d.queues))
+	for channel := range d.queues {
+		channels = append(channels, channel)
+	}
+	d.mu.Unlock()
+	sort.Strings(channels)
+
+	for _, channel := range channels {
+		q := d.queue(channel)
+		d.logger.Printf("Dispatch queue %s: depth %d/%d, processed %d, rejected %d", channel, len(q.jobs), cap(q.jobs), q.delivered.Load(), q.rejected.Load())
+	}
+}
+
+// logDispatchStats logs the dispatcher statistics periodically
+func (m *Monitor) logDispatchStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.dispatcher.LogStats()
+		m.deliveries.LogStats(m.logger)
+	}
+}
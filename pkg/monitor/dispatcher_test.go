@@ -0,0 +1,188 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it holds or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blockingWebhook returns a webhook server that answers once release is closed, counting its requests
+func blockingWebhook(t *testing.T, release chan struct{}, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDispatchKeepsRejectedAlertsInOutbox(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := blockingWebhook(t, release, &requests)
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+  delivery:
+    queue_size: 1
+    initial_backoff: 1m
+`, server.URL)))
+	outbox := instance.monitor.outbox
+
+	// The worker blocks on the first alert, the second fills the queue and the third is rejected
+	var notifications []*Notification
+	for i := 0; i < 3; i++ {
+		event := testEvent()
+		event.Rule.Name = fmt.Sprintf("rule%d", i)
+		n := instance.newNotification("webhook", event)
+		notifications = append(notifications, n)
+		instance.enqueue(n)
+		if i == 0 {
+			waitFor(t, time.Second, func() bool { return requests.Load() == 1 })
+		}
+	}
+
+	rejected, exists := outbox.Pending(notifications[2].ID)
+	if !exists {
+		t.Fatal("rejected alert was dropped instead of kept in the outbox")
+	}
+	if wait := time.Until(rejected.NextAttempt); wait < 55*time.Second {
+		t.Errorf("rejected alert dispatched again in %s, want the initial backoff", wait)
+	}
+	if due := outbox.Due(time.Now()); len(due) != 0 {
+		t.Errorf("Due() returned %d alerts before their next attempt", len(due))
+	}
+
+	close(release)
+	waitFor(t, time.Second, func() bool { return outbox.Len() == 1 })
+	if _, exists := outbox.Pending(notifications[2].ID); !exists {
+		t.Error("rejected alert removed from the outbox without being delivered")
+	}
+}
+
+func TestDispatchIsolatesChannels(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var requests atomic.Int32
+	server := blockingWebhook(t, release, &requests)
+	logFile := filepath.Join(t.TempDir(), "alerts.jsonl")
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+  jsonlog:
+    enabled: true
+    file_path: %q
+`, server.URL, logFile)))
+	outbox := instance.monitor.outbox
+
+	// Retries of a hanging channel must not hold up the retries of other channels
+	for _, channel := range []string{"webhook", "jsonlog"} {
+		n := instance.newNotification(channel, testEvent())
+		n.Attempts = 1
+		outbox.Add(n)
+		outbox.Retry(n)
+	}
+	for _, n := range outbox.Due(time.Now()) {
+		instance.dispatch(n)
+	}
+
+	waitFor(t, time.Second, func() bool {
+		_, err := os.Stat(logFile)
+		return err == nil && outbox.Len() == 1
+	})
+	if _, exists := outbox.Pending(notificationID(instance.alertKey("connections", testEvent().Rule), "webhook")); !exists {
+		t.Error("hanging webhook alert is no longer pending")
+	}
+}
+
+func TestClaimAlertIsAtomic(t *testing.T) {
+	tracker := NewAlertTracker()
+
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := tracker.ClaimAlert("connections", "webhook", time.Hour); ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Fatalf("%d concurrent claims passed the interval, want 1", claimed.Load())
+	}
+
+	// A released claim lets the next attempt pass
+	tracker.ReleaseAlert("connections", "webhook", time.Time{})
+	if _, ok := tracker.ClaimAlert("connections", "webhook", time.Hour); !ok {
+		t.Error("claim after release did not pass")
+	}
+	if _, ok := tracker.ClaimAlert("connections", "email", time.Hour); !ok {
+		t.Error("claim on another channel did not pass")
+	}
+}
+
+func TestSendNotificationInterval(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+    interval: 1h
+`, server.URL)))
+
+	// A failed attempt gives the interval back, so its retry is not rate limited
+	if result := instance.sendNotification(instance.newNotification("webhook", testEvent())); result.Status != DeliveryFailed {
+		t.Fatalf("first attempt %s, want failed", result.Status)
+	}
+	status.Store(http.StatusOK)
+	if result := instance.sendNotification(instance.newNotification("webhook", testEvent())); result.Status != DeliverySent {
+		t.Fatalf("retry %s, want sent", result.Status)
+	}
+	if result := instance.sendNotification(instance.newNotification("webhook", testEvent())); result.Status != DeliverySkippedRateLimit {
+		t.Fatalf("alert within the interval %s, want skipped_rate_limit", result.Status)
+	}
+
+	resolved := instance.newNotification("webhook", testEvent())
+	resolved.Resolved = true
+	if claims := instance.claimAlerts(resolved); claims == nil {
+		t.Error("resolution rate limited")
+	}
+}
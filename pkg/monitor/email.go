@@ -3,205 +3,297 @@ package monitor
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // EmailConfig holds SMTP email configuration
 type EmailConfig struct {
-	Enabled   bool          `yaml:"enabled"`
-	SMTPHost  string        `yaml:"smtp_host"`
-	SMTPPort  int           `yaml:"smtp_port"`
-	Username  string        `yaml:"username"`
-	Password  string        `yaml:"password"`
-	FromEmail string        `yaml:"from_email"`
-	FromName  string        `yaml:"from_name"`
-	TLS       bool          `yaml:"tls"`
-	Interval  time.Duration `yaml:"interval"`
+	Enabled             bool          `yaml:"enabled"`
+	SMTPHost            string        `yaml:"smtp_host"`
+	SMTPPort            int           `yaml:"smtp_port"`
+	Username            string        `yaml:"username"`
+	Password            string        `yaml:"password"`
+	FromEmail           string        `yaml:"from_email"`
+	FromName            string        `yaml:"from_name"`
+	TLS                 bool          `yaml:"tls"`                   // Implicit TLS, usually on port 465
+	StartTLS            string        `yaml:"starttls"`              // "opportunistic" (default), "required" or "disabled", without tls
+	Auth                string        `yaml:"auth"`                  // "plain", "login", "cram-md5" or "none" (default plain, none without username)
+	SendResolved        bool          `yaml:"send_resolved"`         // Email when an alert clears, threaded with the alert
+	Template            string        `yaml:"template"`              // Optional html/template file for the alert email
+	TextTemplate        string        `yaml:"text_template"`         // Optional text/template file for the plain text part
+	SummaryTemplate     string        `yaml:"summary_template"`      // Optional html/template file for grouped alerts and digests
+	SummaryTextTemplate string        `yaml:"summary_text_template"` // Optional text/template file for their plain text part
+	Interval            time.Duration `yaml:"interval"`
 }
 
 // sendEmailAlert sends an alert via SMTP email
-func (m *MonitorInstance) sendEmailAlert(queryName string, rule AlertRule) error {
+func (m *MonitorInstance) sendEmailAlert(n *Notification) DeliveryResult {
+	event, thread := n.Event(), m.emailThread(n)
+	queryName, rule := event.Query, event.Rule
 
-	// Check if enough time has passed since last alert
-	if !m.alertTracker.CanSendAlert(queryName, "email", m.monitor.config.Alerts.Email.Interval) {
-		m.monitor.logger.Printf("Email alert for query %s skipped due to interval limit", queryName)
-		return fmt.Errorf("email alert for query %s skipped due to interval limit", queryName)
+	recipients, err := m.monitor.ruleEmailRecipients(rule)
+	if err != nil {
+		m.monitor.logger.Printf("Email alert failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve email recipients for query %s: %w", queryName, err))
 	}
 
 	// Prepare email content
 	subject := fmt.Sprintf("[%s] Database Alert: %s", m.dbConfig.Instance, queryName)
-
-	// Create HTML email body
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .header { background-color: #f4f4f4; padding: 10px; border-left: 4px solid #d32f2f; }
-        .content { padding: 20px; }
-        .alert-info { background-color: #fff3cd; padding: 15px; border-radius: 5px; margin: 10px 0; }
-        .critical { border-left: 4px solid #d32f2f; }
-        .performance { border-left: 4px solid #ff9800; }
-        .storage { border-left: 4px solid #ffeb3b; }
-        .maintenance { border-left: 4px solid #2196f3; }
-        .security { border-left: 4px solid #f44336; }
-        table { border-collapse: collapse; width: 100%%; margin: 10px 0; }
-        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
-        th { background-color: #f2f2f2; }
-    </style>
-</head>
-<body>
-    <div class="header">
-        <h2>🚨 Database Alert</h2>
-    </div>
-    <div class="content">
-        <div class="alert-info %s">
-            <h3>%s</h3>
-            <p><strong>Message:</strong> %s</p>
-        </div>
-        
-        <table>
-            <tr><th>Instance</th><td>%s</td></tr>
-            <tr><th>Query</th><td>%s</td></tr>
-            <tr><th>Category</th><td>%s</td></tr>
-            <tr><th>Timestamp</th><td>%s</td></tr>
-            <tr><th>Recipient</th><td>%s</td></tr>
-			<tr><th>Note</th><td>%s</td></tr>
-        </table>
-        
-        <p><em>This alert was automatically generated by PostgreSQL Database Monitor.</em></p>
-		<p>Please take appropriate action based on the alert details.</p>
-		<p>If you have any questions, please contact your database administrator.</p>
-    </div>
-</body>
-</html>`,
-		rule.Category,
-		rule.Message,
-		rule.Message,
-		m.dbConfig.Instance,
-		queryName,
-		rule.Category,
-		time.Now().Format("2006-01-02 15:04:05 MST"),
-		rule.To,
-		rule.ResolutionNote,
-	)
-
-	// Create plain text version
-	textBody := fmt.Sprintf(`Database Alert: %s
-
-Instance: %s
-Query: %s  
-Category: %s
-Message: %s
-Timestamp: %s
-Recipient: %s
-
-This alert was automatically generated by PostgreSQL Database Monitor.`,
-		queryName,
-		m.dbConfig.Instance,
-		queryName,
-		rule.Category,
-		rule.Message,
-		time.Now().Format("2006-01-02 15:04:05 MST"),
-		rule.To,
-	)
+	data := m.emailTemplateData(event, recipients)
 
 	// Send email
-	err := m.sendEmail(rule.To, subject, textBody, htmlBody)
+	err = m.sendTemplatedEmail(recipients, subject, data, thread)
 	if err != nil {
 		m.monitor.logger.Printf("Email alert failed for query %s: %v", queryName, err)
-		return fmt.Errorf("failed to send email alert for query %s: %w", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to send email alert for query %s: %w", queryName, err))
 	}
 
 	m.monitor.logger.Printf("Email alert sent successfully for query: %s", queryName)
-	m.alertTracker.RecordAlert(queryName, "email")
+	return deliveryResult(n, nil)
+}
 
-	return nil
+// sendEmailResolved emails that an alert has cleared, as a reply to the alert
+func (m *MonitorInstance) sendEmailResolved(n *Notification) DeliveryResult {
+	queryName, rule, since := n.Query, n.Rule, n.Since
+	thread := m.emailThread(n)
+	recipients, err := m.monitor.ruleEmailRecipients(rule)
+	if err != nil {
+		m.monitor.logger.Printf("Email resolution failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve email recipients for query %s: %w", queryName, err))
+	}
+
+	subject := fmt.Sprintf("Re: [%s] Database Alert: %s (resolved)", m.dbConfig.Instance, queryName)
+	data := m.emailTemplateData(AlertEvent{Query: queryName, Rule: rule}, recipients)
+	data.Title = "✅ Database Alert Resolved"
+	data.Resolved = true
+	data.Color = categoryColor("resolved")
+	if !since.IsZero() {
+		data.Since = since.Format("2006-01-02 15:04:05 MST")
+		data.Duration = time.Since(since).Round(time.Second).String()
+	}
+
+	err = m.sendTemplatedEmail(recipients, subject, data, thread)
+	if err != nil {
+		m.monitor.logger.Printf("Email resolution failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to send email resolution for query %s: %w", queryName, err))
+	}
+
+	m.monitor.logger.Printf("Email resolution sent successfully for query: %s", queryName)
+	return deliveryResult(n, nil)
 }
 
-// sendEmail sends an email using SMTP
-func (m *MonitorInstance) sendEmail(to, subject, textBody, htmlBody string) error {
-	config := m.monitor.config.Alerts.Email
+// sendTemplatedEmail renders the email templates and sends the email, embedding the recent values chart
+func (m *MonitorInstance) sendTemplatedEmail(recipients emailRecipients, subject string, data EmailTemplateData, thread emailThread) error {
+	var inline []emailInline
+	if data.Sparkline != "" {
+		image, err := sparklinePNG(data.RecentValues, data.Color)
+		if err != nil {
+			m.monitor.logger.Printf("Error drawing recent values of query %s: %v", data.Query, err)
+			data.Sparkline = ""
+		} else {
+			inline = append(inline, emailInline{ContentID: sparklineContentID, ContentType: "image/png", Filename: "sparkline.png", Data: image})
+		}
+	}
 
-	// Create authentication
-	auth := smtp.PlainAuth("", config.Username, config.Password, config.SMTPHost)
+	htmlBody, textBody, err := m.monitor.templates.render(data)
+	if err != nil {
+		return err
+	}
+
+	return m.monitor.sendEmail(recipients, subject, textBody, htmlBody, thread, inline...)
+}
 
-	// Prepare headers
-	from := config.FromEmail
-	if config.FromName != "" {
-		from = fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail)
+// sendEmailBatch sends a group of alerts for the same recipient as a single email
+func (m *MonitorInstance) sendEmailBatch(n *Notification) DeliveryResult {
+	batch := n.Batch
+	summaries := make([]alertSummary, 0, len(batch))
+	for _, alert := range batch {
+		summaries = append(summaries, notificationSummary(alert))
 	}
 
-	// Create multipart message
-	boundary := "boundary-postgres-stat-alert-" + fmt.Sprintf("%d", time.Now().Unix())
+	subject := fmt.Sprintf("Database Alerts: %d alerts (%s)", len(batch), batchQueries(batch))
+	title := fmt.Sprintf("🚨 %d Database Alerts", len(batch))
 
-	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%s\r\n\r\n",
-		from, to, subject, boundary)
+	recipients, err := m.monitor.ruleEmailRecipients(batch[0].Rule)
+	if err != nil {
+		m.monitor.logger.Printf("Email alert failed for queries %s: %v", batchQueries(batch), err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve email recipients for queries %s: %w", batchQueries(batch), err))
+	}
 
-	textPart := fmt.Sprintf("--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n\r\n", boundary, textBody)
-	htmlPart := fmt.Sprintf("--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n\r\n", boundary, htmlBody)
-	ending := fmt.Sprintf("--%s--\r\n", boundary)
+	err = m.monitor.sendEmailSummary(recipients, subject, title, summaries)
+	if err != nil {
+		m.monitor.logger.Printf("Email alert failed for queries %s: %v", batchQueries(batch), err)
+		return deliveryResult(n, fmt.Errorf("failed to send email alert for queries %s: %w", batchQueries(batch), err))
+	}
 
-	message := headers + textPart + htmlPart + ending
+	m.monitor.logger.Printf("Email alert sent successfully for queries: %s", batchQueries(batch))
+	return deliveryResult(n, nil)
+}
 
-	// Connect and send
-	addr := fmt.Sprintf("%s:%d", config.SMTPHost, config.SMTPPort)
+// sendEmailSummary sends an email with a table of alerts
+func (m *Monitor) sendEmailSummary(recipients emailRecipients, subject, title string, summaries []alertSummary) error {
+	htmlBody, textBody, err := m.templates.renderSummary(emailSummaryData(title, summaries))
+	if err != nil {
+		return err
+	}
+	return m.sendEmail(recipients, subject, textBody, htmlBody, emailThread{})
+}
+
+// emailRecipients holds the recipients of an email
+type emailRecipients struct {
+	To  []string
+	CC  []string
+	BCC []string
+}
+
+// all returns every recipient of an email, as used for the SMTP envelope
+func (r emailRecipients) all() []string {
+	all := make([]string, 0, len(r.To)+len(r.CC)+len(r.BCC))
+	all = append(all, r.To...)
+	all = append(all, r.CC...)
+	return append(all, r.BCC...)
+}
+
+// ruleEmailRecipients resolves the To, CC and BCC recipients of a rule
+func (m *Monitor) ruleEmailRecipients(rule AlertRule) (emailRecipients, error) {
+	var recipients emailRecipients
+	var err error
+	if recipients.To, err = m.ruleRecipients(rule, "email"); err != nil {
+		return emailRecipients{}, err
+	}
+	if recipients.CC, err = m.expandRecipients(rule.CC, "email"); err != nil {
+		return emailRecipients{}, err
+	}
+	if recipients.BCC, err = m.expandRecipients(rule.BCC, "email"); err != nil {
+		return emailRecipients{}, err
+	}
+
+	// A recipient gets a single copy, in the most visible field it appears in
+	seen := make(map[string]bool)
+	unique := func(addresses []string) []string {
+		var kept []string
+		for _, address := range addresses {
+			if key := strings.ToLower(address); !seen[key] {
+				seen[key] = true
+				kept = append(kept, address)
+			}
+		}
+		return kept
+	}
+	recipients.To = unique(recipients.To)
+	recipients.CC = unique(recipients.CC)
+	recipients.BCC = unique(recipients.BCC)
+	return recipients, nil
+}
 
+// sendEmail sends an email using SMTP
+func (m *Monitor) sendEmail(recipients emailRecipients, subject, textBody, htmlBody string, thread emailThread, inline ...emailInline) error {
+	config := m.config.Alerts.Email
+
+	if len(recipients.all()) == 0 {
+		return fmt.Errorf("no email recipients")
+	}
+
+	// Create authentication
+	auth, err := m.smtpAuth()
+	if err != nil {
+		return err
+	}
+
+	message, err := m.buildEmailMessage(recipients, subject, textBody, htmlBody, thread, inline)
+	if err != nil {
+		return err
+	}
+
+	// Connect and send, bounded by the delivery send timeout
+	addr := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	timeout := m.config.Alerts.Delivery.SendTimeout
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
 	if config.TLS {
 		// Use TLS connection
 		tlsConfig := &tls.Config{
 			ServerName: config.SMTPHost,
 		}
 
-		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
 		if err != nil {
 			return fmt.Errorf("failed to connect with TLS: %w", err)
 		}
-		defer conn.Close()
-
-		client, err := smtp.NewClient(conn, config.SMTPHost)
+	} else {
+		// Use plain SMTP
+		conn, err = dialer.Dial("tcp", addr)
 		if err != nil {
-			return fmt.Errorf("failed to create SMTP client: %w", err)
+			return fmt.Errorf("failed to connect: %w", err)
 		}
-		defer client.Quit()
+	}
+	defer conn.Close()
 
-		if err = client.Auth(auth); err != nil {
-			return fmt.Errorf("SMTP authentication failed: %w", err)
-		}
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("failed to set connection deadline: %w", err)
+	}
 
-		if err = client.Mail(config.FromEmail); err != nil {
-			return fmt.Errorf("failed to set sender: %w", err)
-		}
+	client, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer client.Quit()
 
-		if err = client.Rcpt(to); err != nil {
-			return fmt.Errorf("failed to set recipient: %w", err)
+	if !config.TLS {
+		// Upgrade the connection with STARTTLS, when the server supports it unless required
+		ok, _ := client.Extension("STARTTLS")
+		switch strings.ToLower(config.StartTLS) {
+		case "required":
+			if !ok {
+				return fmt.Errorf("SMTP server does not support STARTTLS")
+			}
+		case "disabled":
+			ok = false
 		}
-
-		w, err := client.Data()
-		if err != nil {
-			return fmt.Errorf("failed to get data writer: %w", err)
+		if ok {
+			if err = client.StartTLS(&tls.Config{ServerName: config.SMTPHost}); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
 		}
+	}
 
-		_, err = w.Write([]byte(message))
-		if err != nil {
-			return fmt.Errorf("failed to write message: %w", err)
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok || config.TLS {
+			if err = client.Auth(auth); err != nil {
+				return fmt.Errorf("SMTP authentication failed: %w", err)
+			}
 		}
+	}
 
-		err = w.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close data writer: %w", err)
-		}
+	if err = client.Mail(config.FromEmail); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
 
-	} else {
-		// Use plain SMTP
-		err := smtp.SendMail(addr, auth, config.FromEmail, []string{to}, []byte(message))
-		if err != nil {
-			return fmt.Errorf("failed to send email: %w", err)
+	for _, recipient := range recipients.all() {
+		if err = client.Rcpt(envelopeAddress(recipient)); err != nil {
+			return fmt.Errorf("failed to set recipient %s: %w", recipient, err)
 		}
 	}
 
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to get data writer: %w", err)
+	}
+
+	_, err = w.Write(message)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close data writer: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,409 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// sparklineContentID is the Content-ID of the recent values image embedded in alert emails
+const sparklineContentID = "sparkline@postgres-stat-alert"
+
+// EmailTemplateData is the data available to email templates
+type EmailTemplateData struct {
+	Title          string
+	Instance       string
+	Database       string
+	Query          string
+	Category       string
+	Severity       string
+	Message        string
+	ResolutionNote string
+	Value          interface{} // Threshold of the rule
+	Observed       interface{} // Value the query returned, nil when unknown
+	Operator       string      // Comparison of the rule as a symbol, e.g. ">"
+	Comparison     string      // e.g. "observed 143 > threshold 100"
+	Recipients     string
+	Timestamp      string
+	Since          string // Time the alert started firing, empty when unknown
+	Duration       string // Time the alert was firing, set for resolutions
+	Resolved       bool
+	Color          string           // Accent color of the category, e.g. "#d32f2f"
+	Row            []EmailRowValue  // Columns of the result row that fired the alert
+	Sparkline      htmltemplate.URL // Source of the recent values image, empty with fewer than two values
+	RecentValues   []float64        // Recent values of the first column of the query, oldest first
+}
+
+// EmailRowValue is a column of the result row that fired an alert
+type EmailRowValue struct {
+	Column string
+	Value  string
+}
+
+// EmailSummaryData is the data available to the templates of emails listing several alerts,
+// such as grouped alerts and digests
+type EmailSummaryData struct {
+	Title  string
+	Alerts []EmailSummaryAlert
+}
+
+// EmailSummaryAlert is an alert listed in a summary email
+type EmailSummaryAlert struct {
+	Time     string
+	Instance string
+	Query    string
+	Category string
+	Color    string // Accent color of the category
+	Message  string
+	Value    string // Observed value compared to the threshold, e.g. "observed 143 > threshold 100"
+}
+
+// emailTemplates holds the parsed HTML and plain text templates of alert and summary emails
+type emailTemplates struct {
+	html        *htmltemplate.Template
+	text        *texttemplate.Template
+	summaryHTML *htmltemplate.Template
+	summaryText *texttemplate.Template
+}
+
+// loadEmailTemplates parses the configured email templates, falling back to the built-in ones
+func loadEmailTemplates(config EmailConfig) (*emailTemplates, error) {
+	var templates emailTemplates
+	var err error
+	if templates.html, err = loadHTMLTemplate("email template", config.Template, defaultEmailHTMLTemplate); err != nil {
+		return nil, err
+	}
+	if templates.text, err = loadTextTemplate("email text template", config.TextTemplate, defaultEmailTextTemplate); err != nil {
+		return nil, err
+	}
+	if templates.summaryHTML, err = loadHTMLTemplate("email summary template", config.SummaryTemplate, defaultEmailSummaryHTMLTemplate); err != nil {
+		return nil, err
+	}
+	if templates.summaryText, err = loadTextTemplate("email summary text template", config.SummaryTextTemplate, defaultEmailSummaryTextTemplate); err != nil {
+		return nil, err
+	}
+	return &templates, nil
+}
+
+// readTemplate returns the content of a template file, or the built-in template without a file
+func readTemplate(name, file, builtIn string) (string, error) {
+	if file == "" {
+		return builtIn, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// loadHTMLTemplate parses an html/template file, or the built-in template without a file
+func loadHTMLTemplate(name, file, builtIn string) (*htmltemplate.Template, error) {
+	source, err := readTemplate(name, file, builtIn)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := htmltemplate.New("email").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// loadTextTemplate parses a text/template file, or the built-in template without a file
+func loadTextTemplate(name, file, builtIn string) (*texttemplate.Template, error) {
+	source, err := readTemplate(name, file, builtIn)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := texttemplate.New("email").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// render renders the HTML and plain text bodies of an email
+func (t *emailTemplates) render(data EmailTemplateData) (string, string, error) {
+	var html, text bytes.Buffer
+	if err := t.html.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email template: %w", err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email text template: %w", err)
+	}
+	return html.String(), text.String(), nil
+}
+
+// renderSummary renders the HTML and plain text bodies of a summary email
+func (t *emailTemplates) renderSummary(data EmailSummaryData) (string, string, error) {
+	var html, text bytes.Buffer
+	if err := t.summaryHTML.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email summary template: %w", err)
+	}
+	if err := t.summaryText.Execute(&text, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email summary text template: %w", err)
+	}
+	return html.String(), text.String(), nil
+}
+
+// emailSummaryData collects the template data of a summary email
+func emailSummaryData(title string, summaries []alertSummary) EmailSummaryData {
+	data := EmailSummaryData{Title: title}
+	for _, summary := range summaries {
+		data.Alerts = append(data.Alerts, EmailSummaryAlert{
+			Time:     summary.Time.Format("2006-01-02 15:04:05"),
+			Instance: summary.Instance,
+			Query:    summary.Query,
+			Category: summary.Category,
+			Color:    categoryColor(strings.ToLower(summary.Category)),
+			Message:  summary.Message,
+			Value:    summary.Value,
+		})
+	}
+	return data
+}
+
+// emailTemplateData collects the template data of an alert
+func (m *MonitorInstance) emailTemplateData(event AlertEvent, recipients emailRecipients) EmailTemplateData {
+	queryName, rule, row := event.Query, event.Rule, event.Row
+	data := EmailTemplateData{
+		Title:          "🚨 Database Alert",
+		Instance:       m.dbConfig.Instance,
+		Database:       m.dbConfig.Database,
+		Query:          queryName,
+		Category:       rule.Category,
+		Severity:       alertSeverity(rule),
+		Message:        rule.Message,
+		ResolutionNote: rule.ResolutionNote,
+		Value:          rule.Value,
+		Observed:       event.Observed,
+		Operator:       event.Operator(),
+		Comparison:     event.Comparison(),
+		Recipients:     strings.Join(recipients.To, ", "),
+		Timestamp:      time.Now().Format("2006-01-02 15:04:05 MST"),
+		Color:          categoryColor(rule.Category),
+		RecentValues:   m.alertTracker.RecentValues(queryName),
+	}
+
+	if since, firing := m.alertTracker.FiringSince(m.alertKey(queryName, rule)); firing {
+		data.Since = since.Format("2006-01-02 15:04:05 MST")
+	}
+
+	for _, field := range rowFields(row, event.Columns) {
+		data.Row = append(data.Row, EmailRowValue{Column: field.Name, Value: field.Value})
+	}
+
+	if len(data.RecentValues) >= 2 {
+		data.Sparkline = htmltemplate.URL("cid:" + sparklineContentID)
+	}
+	return data
+}
+
+// sparklinePNG draws values as a small line chart
+func sparklinePNG(values []float64, hexColor string) ([]byte, error) {
+	const width, height, padding = 240, 48, 4
+
+	lineColor := color.RGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}
+	fmt.Sscanf(hexColor, "#%02x%02x%02x", &lineColor.R, &lineColor.G, &lineColor.B)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low = min(low, v)
+		high = max(high, v)
+	}
+	point := func(i int) (float64, float64) {
+		x := padding + float64(i)*float64(width-2*padding)/float64(len(values)-1)
+		y := float64(height) / 2
+		if high > low {
+			y = float64(height-padding) - (values[i]-low)*float64(height-2*padding)/(high-low)
+		}
+		return x, y
+	}
+
+	// Draw each segment with a two pixel wide pen
+	for i := 1; i < len(values); i++ {
+		x0, y0 := point(i - 1)
+		x1, y1 := point(i)
+		steps := int(max(abs(x1-x0), abs(y1-y0))) + 1
+		for s := 0; s <= steps; s++ {
+			x := int(x0 + (x1-x0)*float64(s)/float64(steps))
+			y := int(y0 + (y1-y0)*float64(s)/float64(steps))
+			img.Set(x, y, lineColor)
+			img.Set(x+1, y, lineColor)
+			img.Set(x, y+1, lineColor)
+			img.Set(x+1, y+1, lineColor)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode sparkline: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// abs returns the absolute value of f
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// defaultEmailHTMLTemplate is the built-in HTML alert email
+const defaultEmailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .header { background-color: #f4f4f4; padding: 10px; border-left: 4px solid {{.Color}}; }
+        .content { padding: 20px; }
+        .alert-info { background-color: #fff3cd; padding: 15px; border-radius: 5px; margin: 10px 0; border-left: 4px solid {{.Color}}; }
+        .resolved { background-color: #e8f5e9; }
+        table { border-collapse: collapse; width: 100%; margin: 10px 0; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <h2>{{.Title}}</h2>
+    </div>
+    <div class="content">
+        <div class="alert-info{{if .Resolved}} resolved{{end}}">
+            <h3>{{.Message}}</h3>
+        </div>
+
+        <table>
+            <tr><th>Instance</th><td>{{.Instance}}</td></tr>
+            <tr><th>Query</th><td>{{.Query}}</td></tr>
+            <tr><th>Category</th><td>{{.Category}}</td></tr>
+            <tr><th>Severity</th><td>{{.Severity}}</td></tr>
+            {{- if not .Resolved}}
+            <tr><th>Value</th><td>{{.Comparison}}</td></tr>
+            {{- end}}
+            <tr><th>Timestamp</th><td>{{.Timestamp}}</td></tr>
+            {{- if .Since}}
+            <tr><th>Firing since</th><td>{{.Since}}</td></tr>
+            {{- end}}
+            {{- if .Duration}}
+            <tr><th>Duration</th><td>{{.Duration}}</td></tr>
+            {{- end}}
+            <tr><th>Recipient</th><td>{{.Recipients}}</td></tr>
+            {{- if .ResolutionNote}}
+            <tr><th>Note</th><td>{{.ResolutionNote}}</td></tr>
+            {{- end}}
+        </table>
+        {{- if .Row}}
+
+        <h4>Query Result</h4>
+        <table>
+            <tr>{{range .Row}}<th>{{.Column}}</th>{{end}}</tr>
+            <tr>{{range .Row}}<td>{{.Value}}</td>{{end}}</tr>
+        </table>
+        {{- end}}
+        {{- if .Sparkline}}
+
+        <h4>Recent Values</h4>
+        <p><img src="{{.Sparkline}}" alt="Recent values of {{.Query}}" width="240" height="48"></p>
+        {{- end}}
+
+        <p><em>This alert was automatically generated by PostgreSQL Database Monitor.</em></p>
+        {{- if not .Resolved}}
+        <p>Please take appropriate action based on the alert details.</p>
+        <p>If you have any questions, please contact your database administrator.</p>
+        {{- end}}
+    </div>
+</body>
+</html>
+`
+
+// defaultEmailTextTemplate is the built-in plain text alert email
+const defaultEmailTextTemplate = `{{if .Resolved}}Database Alert Resolved{{else}}Database Alert{{end}}: {{.Query}}
+
+Instance: {{.Instance}}
+Query: {{.Query}}
+Category: {{.Category}}
+Severity: {{.Severity}}
+Message: {{.Message}}
+{{- if not .Resolved}}
+Value: {{.Comparison}}
+{{- end}}
+Timestamp: {{.Timestamp}}
+{{- if .Since}}
+Firing since: {{.Since}}
+{{- end}}
+{{- if .Duration}}
+Duration: {{.Duration}}
+{{- end}}
+Recipient: {{.Recipients}}
+{{- if .ResolutionNote}}
+Note: {{.ResolutionNote}}
+{{- end}}
+{{- if .Row}}
+
+Query result:
+{{- range .Row}}
+  {{.Column}}: {{.Value}}
+{{- end}}
+{{- end}}
+
+This alert was automatically generated by PostgreSQL Database Monitor.
+`
+
+// defaultEmailSummaryHTMLTemplate is the built-in HTML email listing several alerts
+const defaultEmailSummaryHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .header { background-color: #f4f4f4; padding: 10px; border-left: 4px solid #d32f2f; }
+        .content { padding: 20px; }
+        table { border-collapse: collapse; width: 100%; margin: 10px 0; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <h2>{{.Title}}</h2>
+    </div>
+    <div class="content">
+        <table>
+            <tr><th>Time</th><th>Instance</th><th>Query</th><th>Category</th><th>Message</th><th>Value</th></tr>
+            {{- range .Alerts}}
+            <tr><td style="border-left: 4px solid {{.Color}}">{{.Time}}</td><td>{{.Instance}}</td><td>{{.Query}}</td><td>{{.Category}}</td><td>{{.Message}}</td><td>{{.Value}}</td></tr>
+            {{- end}}
+        </table>
+
+        <p><em>This alert was automatically generated by PostgreSQL Database Monitor.</em></p>
+    </div>
+</body>
+</html>
+`
+
+// defaultEmailSummaryTextTemplate is the built-in plain text email listing several alerts
+const defaultEmailSummaryTextTemplate = `{{.Title}}
+
+{{range .Alerts -}}
+{{.Time}}  {{.Instance}} / {{.Query}} [{{.Category}}] {{.Message}} ({{.Value}})
+{{end}}
+This alert was automatically generated by PostgreSQL Database Monitor.
+`
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailTemplateRendersMessageOnce(t *testing.T) {
+	templates, err := loadEmailTemplates(EmailConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, text, err := templates.render(EmailTemplateData{Title: "Alert", Message: "Too many <connections>", Query: "connections"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(html, "Too many &lt;connections&gt;"); count != 1 {
+		t.Errorf("HTML body shows the message %d times, want once", count)
+	}
+	if !strings.Contains(text, "Message: Too many <connections>") {
+		t.Errorf("text body lacks the message:\n%s", text)
+	}
+}
+
+func TestEmailSummaryTemplate(t *testing.T) {
+	templates, err := loadEmailTemplates(EmailConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := []alertSummary{
+		{Time: time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC), Instance: "prod", Query: "connections", Category: "performance", Message: "Too many <connections>", Value: "observed 143 > threshold 100"},
+		{Time: time.Date(2025, 1, 15, 10, 5, 0, 0, time.UTC), Instance: "prod", Query: "disk", Category: "storage", Message: "Disk & WAL", Value: "observed 95 > threshold 90"},
+	}
+	html, text, err := templates.renderSummary(emailSummaryData("🚨 2 Database Alerts", summaries))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"<h2>🚨 2 Database Alerts</h2>", "Too many &lt;connections&gt;", "Disk &amp; WAL", "border-left: 4px solid #ff9800", "2025-01-15 10:05:00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML body lacks %q", want)
+		}
+	}
+	if !strings.Contains(text, "2025-01-15 10:00:00  prod / connections [performance] Too many <connections> (observed 143 > threshold 100)\n") {
+		t.Errorf("text body lacks the alert line:\n%s", text)
+	}
+}
+
+func TestEmailSummaryTemplateFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "summary.html")
+	if err := os.WriteFile(file, []byte(`{{range .Alerts}}<li>{{.Query}}</li>{{end}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := loadEmailTemplates(EmailConfig{SummaryTemplate: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, _, err := templates.renderSummary(emailSummaryData("Digest", []alertSummary{{Query: "a<b"}}))
+	if err != nil || html != "<li>a&lt;b</li>" {
+		t.Errorf("renderSummary() = %q, %v", html, err)
+	}
+
+	if _, err := loadEmailTemplates(EmailConfig{SummaryTextTemplate: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("loadEmailTemplates() accepted a missing summary text template")
+	}
+}
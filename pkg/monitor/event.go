@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AlertEvent is a fired alert: the rule with its threshold, the value the query returned and the result row
+type AlertEvent struct {
+	Query    string                 `json:"query"`
+	Rule     AlertRule              `json:"rule"`
+	Observed interface{}            `json:"observed,omitempty"` // Value the query returned, nil when unknown
+	Row      map[string]interface{} `json:"row,omitempty"`
+	Columns  []string               `json:"columns,omitempty"` // Columns of Row in the order of the query
+}
+
+// Event returns the alert event of a notification
+func (n *Notification) Event() AlertEvent {
+	return AlertEvent{Query: n.Query, Rule: n.Rule, Observed: n.Observed, Row: n.Row, Columns: n.Columns}
+}
+
+// Threshold returns the value the rule compares against
+func (e AlertEvent) Threshold() interface{} {
+	return e.Rule.Value
+}
+
+// Operator returns the comparison of the rule as a symbol, e.g. ">" for "gt"
+func (e AlertEvent) Operator() string {
+	switch strings.ToLower(e.Rule.Condition) {
+	case "gt":
+		return ">"
+	case "lt":
+		return "<"
+	case "gte":
+		return ">="
+	case "lte":
+		return "<="
+	case "eq":
+		return "="
+	case "ne":
+		return "!="
+	}
+	return ""
+}
+
+// Comparison describes why the alert fired, e.g. "observed 143 > threshold 100".
+// Without an observed value only the threshold is given, and the value itself for rules without a condition
+// such as query errors.
+func (e AlertEvent) Comparison() string {
+	operator := e.Operator()
+	switch {
+	case operator == "" && e.Observed != nil:
+		return fmt.Sprintf("%v", e.Observed)
+	case operator == "":
+		return fmt.Sprintf("%v", e.Rule.Value)
+	case e.Observed == nil:
+		return fmt.Sprintf("threshold %s %v", operator, e.Rule.Value)
+	}
+	return fmt.Sprintf("observed %v %s threshold %v", e.Observed, operator, e.Rule.Value)
+}
+
+// observedValue returns a scanned value for display, PostgreSQL numeric and text types may come as byte slices
+func observedValue(value interface{}) interface{} {
+	if b, ok := value.([]uint8); ok {
+		return string(b)
+	}
+	return value
+}
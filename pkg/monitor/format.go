@@ -0,0 +1,228 @@
+package monitor
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertFormat is the content of an alert or group of alerts shared by the chat channels, which only differ in
+// how they render it
+type alertFormat struct {
+	Title    string
+	Summary  string       // Rule message, or the number of alerts of a group
+	Fields   []alertField // Instance, query, category, severity and value, or one field per alert of a group
+	Row      []alertField // Columns of the result row, sorted by name
+	Note     string       // Resolution note
+	Category string
+	Severity string // Severity of the alert, the highest of a group
+	Color    string // Accent color of the category, e.g. "#d32f2f"
+	Runbook  string // Runbook URL of the rule
+	Group    bool   // The format holds a group of alerts
+	Time     time.Time
+}
+
+// alertField is a labelled value of an alert
+type alertField struct {
+	Name     string
+	Value    string
+	Short    bool   // Short enough to be shown next to other fields
+	Category string // Category of the alert a field of a group describes
+	Severity string // Severity of the alert a field of a group describes
+}
+
+// formatAlert collects the content of an alert
+func (m *MonitorInstance) formatAlert(event AlertEvent) alertFormat {
+	rule := event.Rule
+	return alertFormat{
+		Title:   "🚨 Database Alert",
+		Summary: rule.Message,
+		Fields: []alertField{
+			{Name: "Instance", Value: m.dbConfig.Instance, Short: true},
+			{Name: "Query", Value: event.Query, Short: true},
+			{Name: "Category", Value: rule.Category, Short: true},
+			{Name: "Severity", Value: alertSeverity(rule), Short: true},
+			{Name: "Value", Value: event.Comparison()},
+		},
+		Row:      rowFields(event.Row, event.Columns),
+		Note:     rule.ResolutionNote,
+		Category: rule.Category,
+		Severity: alertSeverity(rule),
+		Color:    categoryColor(rule.Category),
+		Runbook:  rule.Runbook,
+		Time:     time.Now(),
+	}
+}
+
+// rowFields returns the columns of a result row in the order of columns, the query order.
+// Columns missing from columns, as in alerts queued before the order was kept, follow sorted by name.
+func rowFields(row map[string]interface{}, columns []string) []alertField {
+	var rest []string
+	for column := range row {
+		if !slices.Contains(columns, column) {
+			rest = append(rest, column)
+		}
+	}
+	sort.Strings(rest)
+
+	fields := make([]alertField, 0, len(row))
+	for _, column := range slices.Concat(columns, rest) {
+		if value, exists := row[column]; exists {
+			fields = append(fields, alertField{Name: column, Value: fmt.Sprintf("%v", value), Short: true})
+		}
+	}
+	return fields
+}
+
+// formatBatch collects the content of a group of alerts, with a field per alert
+func formatBatch(batch []*Notification) alertFormat {
+	f := alertFormat{
+		Title:    fmt.Sprintf("🚨 %d Database Alerts", len(batch)),
+		Summary:  fmt.Sprintf("%d alerts fired on %s", len(batch), batchQueries(batch)),
+		Category: batch[0].Rule.Category,
+		Severity: "info",
+		Color:    categoryColor(batch[0].Rule.Category),
+		Group:    true,
+		Time:     time.Now(),
+	}
+	for _, n := range batch {
+		severity := alertSeverity(n.Rule)
+		if severityRank(severity) > severityRank(f.Severity) {
+			f.Severity = severity
+		}
+		f.Fields = append(f.Fields, alertField{
+			Name:     fmt.Sprintf("%s / %s", n.Instance, n.Query),
+			Value:    fmt.Sprintf("[%s] %s (%s)", n.Rule.Category, n.Rule.Message, n.Event().Comparison()),
+			Category: n.Rule.Category,
+			Severity: severity,
+		})
+	}
+	return f
+}
+
+// Text renders the alert as plain text
+func (f alertFormat) Text() string {
+	plain := func(s string) string { return s }
+	return f.markup(plain, plain, plain)
+}
+
+// markup renders the alert as text in a chat markup, with bold titles and labels and an italic note and time.
+// escape is applied to every value before the markup is added.
+func (f alertFormat) markup(bold, italic, escape func(string) string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n", bold(escape(f.Title)), escape(f.Summary))
+	for _, field := range f.Fields {
+		fmt.Fprintf(&b, "\n%s %s", bold(escape(field.Name)+":"), escape(field.Value))
+	}
+	if len(f.Row) > 0 {
+		fmt.Fprintf(&b, "\n\n%s", bold("Query result:"))
+		for _, field := range f.Row {
+			fmt.Fprintf(&b, "\n  %s: %s", escape(field.Name), escape(field.Value))
+		}
+	}
+	if f.Note != "" {
+		fmt.Fprintf(&b, "\n\n%s", italic(escape(f.Note)))
+	}
+	if f.Runbook != "" {
+		fmt.Fprintf(&b, "\n\nRunbook: %s", escape(f.Runbook))
+	}
+	fmt.Fprintf(&b, "\n\n%s", italic(f.Time.Format("2006-01-02 15:04:05 MST")))
+	return b.String()
+}
+
+// HTML renders the alert as HTML, limited to the tags chat clients such as Matrix allow
+func (f alertFormat) HTML() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h4><font color="%s">%s</font></h4><p>%s</p>`, f.Color, html.EscapeString(f.Title), html.EscapeString(f.Summary))
+	b.WriteString("<ul>")
+	for _, field := range f.Fields {
+		fmt.Fprintf(&b, "<li><b>%s:</b> %s</li>", html.EscapeString(field.Name), html.EscapeString(field.Value))
+	}
+	b.WriteString("</ul>")
+	if len(f.Row) > 0 {
+		b.WriteString("<p><b>Query result</b></p><table><tr>")
+		for _, field := range f.Row {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(field.Name))
+		}
+		b.WriteString("</tr><tr>")
+		for _, field := range f.Row {
+			fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(field.Value))
+		}
+		b.WriteString("</tr></table>")
+	}
+	if f.Note != "" {
+		fmt.Fprintf(&b, "<p><i>%s</i></p>", html.EscapeString(f.Note))
+	}
+	if f.Runbook != "" {
+		fmt.Fprintf(&b, `<p><a href="%s">Open runbook</a></p>`, html.EscapeString(f.Runbook))
+	}
+	fmt.Fprintf(&b, "<p><sub>%s</sub></p>", f.Time.Format("2006-01-02 15:04:05 MST"))
+	return b.String()
+}
+
+// categoryColor returns the accent color of a category
+func categoryColor(category string) string {
+	switch strings.ToLower(category) {
+	case "critical":
+		return "#d32f2f"
+	case "security":
+		return "#f44336"
+	case "performance":
+		return "#ff9800"
+	case "storage":
+		return "#ffeb3b"
+	case "maintenance":
+		return "#2196f3"
+	case "resolved":
+		return "#4caf50"
+	}
+	return "#d32f2f"
+}
+
+// ColorValue returns the accent color as a number, as used by Discord embeds
+func (f alertFormat) ColorValue() int {
+	color, _ := strconv.ParseInt(strings.TrimPrefix(f.Color, "#"), 16, 32)
+	return int(color)
+}
+
+// ChatAttachment is a Slack style message attachment, as accepted by Mattermost and Rocket.Chat webhooks
+type ChatAttachment struct {
+	Fallback  string                `json:"fallback,omitempty"`
+	Color     string                `json:"color,omitempty"`
+	Title     string                `json:"title,omitempty"`
+	TitleLink string                `json:"title_link,omitempty"`
+	Text      string                `json:"text,omitempty"`
+	Fields    []ChatAttachmentField `json:"fields,omitempty"`
+	Footer    string                `json:"footer,omitempty"`
+}
+
+// ChatAttachmentField is a field of a message attachment
+type ChatAttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Attachment renders the alert as a message attachment colored by category, linking the title to the runbook
+func (f alertFormat) Attachment() ChatAttachment {
+	text := f.Summary
+	if f.Note != "" {
+		text += "\n\n_" + f.Note + "_"
+	}
+	attachment := ChatAttachment{
+		Fallback:  fmt.Sprintf("%s: %s", f.Title, f.Summary),
+		Color:     f.Color,
+		Title:     f.Title,
+		TitleLink: f.Runbook,
+		Text:      text,
+		Footer:    f.Time.Format("2006-01-02 15:04:05 MST"),
+	}
+	for _, field := range slices.Concat(f.Fields, f.Row) {
+		attachment.Fields = append(attachment.Fields, ChatAttachmentField{Title: field.Name, Value: field.Value, Short: field.Short})
+	}
+	return attachment
+}
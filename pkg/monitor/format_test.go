@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRowFields(t *testing.T) {
+	row := rowValues([]string{"state", "count"}, []interface{}{[]uint8("idle"), 143, 1.5})
+	tests := []struct {
+		columns []string
+		want    string
+	}{
+		{rowColumns([]string{"state", "count"}, 3), "state=idle count=143 column3=1.5"},
+		{nil, "column3=1.5 count=143 state=idle"}, // Queued before the column order was kept
+		{[]string{"count"}, "count=143 column3=1.5 state=idle"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, field := range rowFields(row, tt.columns) {
+			got = append(got, field.Name+"="+field.Value)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("rowFields(%v) = %v, want %s", tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestAlertFormatRenderers(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, ""))
+	event := testEvent()
+	event.Rule.Message = "Too many <connections> & waits"
+	event.Rule.ResolutionNote = "Check the pool"
+	f := instance.formatAlert(event)
+
+	telegram := f.TelegramHTML()
+	for _, want := range []string{"<b>🚨 Database Alert</b>", "Too many &lt;connections&gt; &amp; waits", "<b>Instance:</b> test", "<b>Query result:</b>\n  count: 143", "<i>Check the pool</i>"} {
+		if !strings.Contains(telegram, want) {
+			t.Errorf("TelegramHTML() = %q, missing %q", telegram, want)
+		}
+	}
+
+	if whatsApp := f.WhatsAppText(); !strings.Contains(whatsApp, "*Query:* connections") || !strings.Contains(whatsApp, "_Check the pool_") {
+		t.Errorf("WhatsAppText() = %q, want bold labels and an italic note", whatsApp)
+	}
+
+	embeds := f.DiscordEmbeds()
+	if len(embeds) != 1 || embeds[0].Color != 0xff9800 || embeds[0].Fields[len(embeds[0].Fields)-1].Name != "count" {
+		t.Errorf("DiscordEmbeds() = %+v, want one orange embed ending with the row", embeds)
+	}
+
+	card := f.TeamsAdaptiveCard("https://grafana.example.com")
+	if card.Body[0].Style != "warning" || len(card.Actions) != 1 || card.Body[len(card.Body)-1].Text != "Check the pool" {
+		t.Errorf("TeamsAdaptiveCard() = %+v, want a warning header, the dashboard button and the note", card)
+	}
+	if msg := f.TeamsMessageCard(""); msg.ThemeColor != "ff9800" || msg.Sections[0].Text != "Check the pool" {
+		t.Errorf("TeamsMessageCard() = %+v, want the category color and the note", msg)
+	}
+}
+
+func TestAlertFormatBatch(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, ""))
+	warning := instance.newNotification("discord", testEvent())
+	critical := testEvent()
+	critical.Query = "locks"
+	critical.Rule.Severity = "critical"
+	f := formatBatch([]*Notification{warning, instance.newNotification("discord", critical)})
+
+	if !f.Group || f.Severity != "critical" {
+		t.Errorf("formatBatch() group %v severity %q, want a critical group", f.Group, f.Severity)
+	}
+	embeds := f.DiscordEmbeds()
+	if len(embeds) != 1 || !strings.Contains(embeds[0].Description, "• **test / locks**") {
+		t.Errorf("DiscordEmbeds() = %+v, want a list of the alerts", embeds)
+	}
+	card := f.TeamsAdaptiveCard("")
+	if len(card.Body) != 4 || card.Body[3].Style != "attention" {
+		t.Errorf("TeamsAdaptiveCard() = %+v, want a container per alert colored by its severity", card)
+	}
+}
+
+func TestMatrixTxnID(t *testing.T) {
+	n := &Notification{ID: "abc", CreatedAt: time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)}
+	retry := *n
+	retry.Attempts = 2
+	newer := *n
+	newer.CreatedAt = n.CreatedAt.Add(time.Minute)
+
+	if matrixTxnID(n, "!a:example.com") != matrixTxnID(&retry, "!a:example.com") {
+		t.Error("retry of a notification got a new transaction ID")
+	}
+	if matrixTxnID(n, "!a:example.com") == matrixTxnID(n, "!b:example.com") || matrixTxnID(n, "!a:example.com") == matrixTxnID(&newer, "!a:example.com") {
+		t.Error("transaction ID does not differ per room and alert")
+	}
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// GoogleChatConfig holds Google Chat webhook configuration
+type GoogleChatConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	WebhookURL string        `yaml:"webhook_url"` // Space webhook URL including its key and token
+	Interval   time.Duration `yaml:"interval"`
+}
+
+// GoogleChatMessage represents a Google Chat message with cards
+type GoogleChatMessage struct {
+	Text    string           `json:"text,omitempty"`
+	CardsV2 []GoogleChatCard `json:"cardsV2"`
+}
+
+// GoogleChatCard is a card of a Google Chat message
+type GoogleChatCard struct {
+	CardID string             `json:"cardId"`
+	Card   GoogleChatCardBody `json:"card"`
+}
+
+// GoogleChatCardBody holds the header and sections of a card
+type GoogleChatCardBody struct {
+	Header   GoogleChatCardHeader `json:"header"`
+	Sections []GoogleChatSection  `json:"sections"`
+}
+
+// GoogleChatCardHeader is the header of a card
+type GoogleChatCardHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+// GoogleChatSection is a section of a card
+type GoogleChatSection struct {
+	Header      string             `json:"header,omitempty"`
+	Collapsible bool               `json:"collapsible,omitempty"`
+	Widgets     []GoogleChatWidget `json:"widgets"`
+}
+
+// GoogleChatWidget is a widget of a card section, only one of its fields is set
+type GoogleChatWidget struct {
+	DecoratedText *GoogleChatDecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *GoogleChatTextParagraph `json:"textParagraph,omitempty"`
+	ButtonList    *GoogleChatButtonList    `json:"buttonList,omitempty"`
+}
+
+// GoogleChatDecoratedText is a text with a label above it
+type GoogleChatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"`
+	WrapText bool   `json:"wrapText,omitempty"`
+}
+
+// GoogleChatTextParagraph is a paragraph of formatted text
+type GoogleChatTextParagraph struct {
+	Text string `json:"text"`
+}
+
+// GoogleChatButtonList holds buttons opening links
+type GoogleChatButtonList struct {
+	Buttons []GoogleChatButton `json:"buttons"`
+}
+
+// GoogleChatButton is a button opening a link
+type GoogleChatButton struct {
+	Text    string `json:"text"`
+	OnClick struct {
+		OpenLink struct {
+			URL string `json:"url"`
+		} `json:"openLink"`
+	} `json:"onClick"`
+}
+
+// sendGoogleChatAlert sends an alert to Google Chat
+func (m *MonitorInstance) sendGoogleChatAlert(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postGoogleChatMessage(n.Query, m.formatAlert(n.Event())))
+}
+
+// sendGoogleChatBatch sends a group of alerts to Google Chat as a single card
+func (m *MonitorInstance) sendGoogleChatBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postGoogleChatMessage(batchQueries(n.Batch), formatBatch(n.Batch)))
+}
+
+// googleChatCard renders an alert as a card: the summary in the color of the category, a labelled text per field,
+// a collapsible section with the result row and a runbook button
+func googleChatCard(f alertFormat) GoogleChatCard {
+	main := GoogleChatSection{Widgets: []GoogleChatWidget{{
+		TextParagraph: &GoogleChatTextParagraph{Text: fmt.Sprintf(`<font color="%s"><b>%s</b></font>`, f.Color, html.EscapeString(f.Summary))},
+	}}}
+	for _, field := range f.Fields {
+		main.Widgets = append(main.Widgets, GoogleChatWidget{
+			DecoratedText: &GoogleChatDecoratedText{TopLabel: field.Name, Text: html.EscapeString(field.Value), WrapText: true},
+		})
+	}
+	if f.Note != "" {
+		main.Widgets = append(main.Widgets, GoogleChatWidget{TextParagraph: &GoogleChatTextParagraph{Text: "<i>" + html.EscapeString(f.Note) + "</i>"}})
+	}
+	if f.Runbook != "" {
+		button := GoogleChatButton{Text: "Open runbook"}
+		button.OnClick.OpenLink.URL = f.Runbook
+		main.Widgets = append(main.Widgets, GoogleChatWidget{ButtonList: &GoogleChatButtonList{Buttons: []GoogleChatButton{button}}})
+	}
+
+	sections := []GoogleChatSection{main}
+	if len(f.Row) > 0 {
+		row := GoogleChatSection{Header: "Query result", Collapsible: len(f.Row) > 5}
+		for _, field := range f.Row {
+			row.Widgets = append(row.Widgets, GoogleChatWidget{
+				DecoratedText: &GoogleChatDecoratedText{TopLabel: field.Name, Text: html.EscapeString(field.Value), WrapText: true},
+			})
+		}
+		sections = append(sections, row)
+	}
+
+	return GoogleChatCard{
+		CardID: "database-alert",
+		Card: GoogleChatCardBody{
+			Header:   GoogleChatCardHeader{Title: f.Title, Subtitle: f.Time.Format("2006-01-02 15:04:05 MST")},
+			Sections: sections,
+		},
+	}
+}
+
+// postGoogleChatMessage posts an alert card to the Google Chat webhook
+func (m *MonitorInstance) postGoogleChatMessage(queryName string, f alertFormat) error {
+	msg := GoogleChatMessage{
+		Text:    f.Title,
+		CardsV2: []GoogleChatCard{googleChatCard(f)},
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Google Chat message: %v", err)
+		return fmt.Errorf("failed to marshal Google Chat message: %w", err)
+	}
+
+	resp, err := m.monitor.httpClient.Post(m.monitor.config.Alerts.GoogleChat.WebhookURL, "application/json; charset=UTF-8", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Google Chat alert: %v", err)
+		return fmt.Errorf("failed to send Google Chat alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Google Chat alert sent successfully for query: %s", queryName)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Google Chat alert failed with status code: %d (%s) for query: %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName)
+		return newHTTPStatusError(resp, respBody, "Google Chat alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GotifyConfig holds Gotify configuration
+type GotifyConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	ServerURL  string         `yaml:"server_url"`
+	AppToken   string         `yaml:"app_token"`            // Token of the application the messages are sent as
+	Priorities map[string]int `yaml:"priorities,omitempty"` // Priority (0-10) per severity
+	Interval   time.Duration  `yaml:"interval"`
+}
+
+// GotifyMessage represents a Gotify message
+type GotifyMessage struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// sendGotifyAlert sends an alert to Gotify
+func (m *MonitorInstance) sendGotifyAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	config := m.monitor.config.Alerts.Gotify
+	msg := GotifyMessage{
+		Title:    pushTitle(m.dbConfig.Instance, queryName),
+		Message:  pushBody(event),
+		Priority: pushPriority(rule, config.Priorities, gotifyPriorities),
+		Extras: map[string]interface{}{
+			"client::display": map[string]string{"contentType": "text/plain"},
+		},
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Gotify message: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to marshal Gotify message: %w", err))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(config.ServerURL, "/")+"/message", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error creating Gotify request: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to create Gotify request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", config.AppToken)
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Gotify alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to send Gotify alert: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Gotify alert sent successfully for query: %s", queryName)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Gotify alert failed with status code: %d (%s) for query: %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName)
+		return deliveryResult(n, newHTTPStatusError(resp, respBody, "Gotify alert failed with status code: %d for query: %s", resp.StatusCode, queryName))
+	}
+	return deliveryResult(n, nil)
+}
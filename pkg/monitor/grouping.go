@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupingConfig holds the settings for batching alerts that fire together
+type GroupingConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Window  time.Duration `yaml:"window"`       // Time to collect further alerts before sending a group (default 30s)
+	By      []string      `yaml:"by,omitempty"` // "instance" and/or "category", empty groups all alerts of a channel
+}
+
+// DigestConfig holds the settings of the periodic digest email
+type DigestConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // Time between digests, e.g. 1h or 24h (default 24h)
+	To       string        `yaml:"to"`       // Recipients of the digest, comma separated or "list:<name>"
+}
+
+// alertSummary is a condensed alert as listed in grouped notifications and digests
+type alertSummary struct {
+	Time     time.Time
+	Instance string
+	Query    string
+	Category string
+	Message  string
+	Value    string // Observed value compared to the threshold, e.g. "observed 143 > threshold 100"
+}
+
+// notificationSummary condenses a notification into an alert summary
+func notificationSummary(n *Notification) alertSummary {
+	return alertSummary{
+		Time:     n.CreatedAt,
+		Instance: n.Instance,
+		Query:    n.Query,
+		Category: n.Rule.Category,
+		Message:  n.Rule.Message,
+		Value:    n.Event().Comparison(),
+	}
+}
+
+// batchQueries returns the distinct query names of a batch, comma separated
+func batchQueries(batch []*Notification) string {
+	var queries []string
+	seen := make(map[string]bool)
+	for _, n := range batch {
+		if !seen[n.Query] {
+			seen[n.Query] = true
+			queries = append(queries, n.Query)
+		}
+	}
+	return strings.Join(queries, ", ")
+}
+
+// channelBatches checks if a channel can render a group of alerts as a single notification
+func channelBatches(channel string) bool {
+	switch channel {
+	case "telegram", "discord", "teams", "email", "whatsapp", "sms", "voice", "matrix", "mattermost", "rocketchat", "googlechat":
+		return true
+	}
+	return false
+}
+
+// alerts returns the individual alerts of a notification
+func (n *Notification) alerts() []*Notification {
+	if len(n.Batch) > 0 {
+		return n.Batch
+	}
+	return []*Notification{n}
+}
+
+// Grouper collects the alerts firing within the grouping window into a single notification per channel
+type Grouper struct {
+	config GroupingConfig
+	groups map[string]*alertGroup
+	mu     sync.Mutex
+}
+
+// alertGroup holds the alerts collected for one channel and group
+type alertGroup struct {
+	instance      *MonitorInstance
+	notifications []*Notification
+}
+
+// NewGrouper creates a grouper
+func NewGrouper(config GroupingConfig) *Grouper {
+	return &Grouper{
+		config: config,
+		groups: make(map[string]*alertGroup),
+	}
+}
+
+// groupKey returns the key of the group a notification belongs to
+func (g *Grouper) groupKey(n *Notification) string {
+	parts := []string{n.Channel}
+	for _, by := range g.config.By {
+		switch strings.ToLower(by) {
+		case "instance":
+			parts = append(parts, n.Instance)
+		case "category":
+			parts = append(parts, n.Rule.Category)
+		}
+	}
+	// Alerts going to the recipients of their rule can only be grouped with alerts for the same recipients
+	if n.Channel == "email" || hasRuleRecipients(n.Rule, n.Channel) {
+		parts = append(parts, n.Rule.To, strings.Join(n.Rule.Recipients[n.Channel], ","))
+	}
+	if n.Channel == "email" {
+		parts = append(parts, strings.Join(n.Rule.CC, ","), strings.Join(n.Rule.BCC, ","))
+	}
+	return strings.Join(parts, "|")
+}
+
+// Add adds a notification to its group. The group is sent once the grouping window has passed.
+func (g *Grouper) Add(instance *MonitorInstance, n *Notification) {
+	key := g.groupKey(n)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	group, exists := g.groups[key]
+	if !exists {
+		group = &alertGroup{instance: instance}
+		g.groups[key] = group
+		time.AfterFunc(g.config.Window, func() { g.flush(key) })
+	}
+
+	// A rule firing again within the window replaces its previous alert
+	for i, pending := range group.notifications {
+		if pending.ID == n.ID {
+			group.notifications[i] = n
+			return
+		}
+	}
+	group.notifications = append(group.notifications, n)
+}
+
+// flush sends a group as a single notification
+func (g *Grouper) flush(key string) {
+	g.mu.Lock()
+	group := g.groups[key]
+	delete(g.groups, key)
+	g.mu.Unlock()
+
+	if group == nil {
+		return
+	}
+
+	// Leave out alerts that are still held back by the channel interval
+	var batch []*Notification
+	for _, n := range group.notifications {
+		instance := group.instance.monitor.instanceFor(n.Instance, n.Database)
+		if instance == nil || !instance.alertTracker.CanSendAlert(n.Query, n.Channel, instance.channelInterval(n.Channel)) {
+			continue
+		}
+		batch = append(batch, n)
+	}
+
+	switch len(batch) {
+	case 0:
+		return
+	case 1:
+		group.instance.enqueue(batch[0])
+		return
+	}
+
+	group.instance.enqueue(newBatchNotification(key, batch))
+}
+
+// newBatchNotification creates a single notification for a batch of alerts on the same channel
+func newBatchNotification(key string, batch []*Notification) *Notification {
+	first := batch[0]
+	now := time.Now()
+	return &Notification{
+		ID:          notificationID(key, fmt.Sprintf("batch-%d", now.UnixNano())),
+		Channel:     first.Channel,
+		Instance:    first.Instance,
+		Database:    first.Database,
+		Query:       batchQueries(batch),
+		Rule:        first.Rule,
+		Batch:       batch,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+}
+
+// Digest collects the alerts that fired since the last digest
+type Digest struct {
+	entries map[string]*digestEntry
+	mu      sync.Mutex
+}
+
+// digestEntry holds how often an alert fired during a digest period
+type digestEntry struct {
+	summary alertSummary
+	first   time.Time
+	count   int
+}
+
+// NewDigest creates an empty digest
+func NewDigest() *Digest {
+	return &Digest{entries: make(map[string]*digestEntry)}
+}
+
+// Record adds a fired alert to the digest
+func (d *Digest) Record(key string, summary alertSummary) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, exists := d.entries[key]
+	if !exists {
+		entry = &digestEntry{first: summary.Time}
+		d.entries[key] = entry
+	}
+	entry.summary = summary
+	entry.count++
+}
+
+// Flush returns the alerts of the digest period, ordered by first occurrence, and starts a new period
+func (d *Digest) Flush() []alertSummary {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[string]*digestEntry)
+	d.mu.Unlock()
+
+	sorted := make([]*digestEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].first.Before(sorted[j].first) })
+
+	summaries := make([]alertSummary, 0, len(sorted))
+	for _, entry := range sorted {
+		summary := entry.summary
+		if entry.count > 1 {
+			summary.Message = fmt.Sprintf("%s (fired %d times since %s)", summary.Message, entry.count, entry.first.Format("2006-01-02 15:04"))
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// sendDigests periodically emails the digest of fired alerts
+func (m *Monitor) sendDigests() {
+	config := m.config.Alerts.Digest
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		summaries := m.digest.Flush()
+		if len(summaries) == 0 {
+			m.logger.Printf("No alerts fired in the last %v, digest skipped", config.Interval)
+			continue
+		}
+
+		subject := fmt.Sprintf("Database Alert Digest: %d alerts in the last %v", len(summaries), config.Interval)
+		title := fmt.Sprintf("📋 Alert Digest (%d alerts in the last %v)", len(summaries), config.Interval)
+		to, err := m.expandRecipients([]string{config.To}, "email")
+		if err != nil {
+			m.logger.Printf("Error resolving alert digest recipients: %v", err)
+			continue
+		}
+		if err := m.sendEmailSummary(emailRecipients{To: to}, subject, title, summaries); err != nil {
+			m.logger.Printf("Error sending alert digest: %v", err)
+			continue
+		}
+		m.logger.Printf("Alert digest with %d alerts sent to %s", len(summaries), config.To)
+	}
+}
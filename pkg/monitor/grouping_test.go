@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGrouperGroupKey(t *testing.T) {
+	n := &Notification{
+		Channel:  "telegram",
+		Instance: "prod",
+		Rule:     AlertRule{Category: "storage", To: "ops"},
+	}
+
+	tests := []struct {
+		name string
+		by   []string
+		n    *Notification
+		want string
+	}{
+		{"channel only", nil, n, "telegram"},
+		{"by instance", []string{"instance"}, n, "telegram|prod"},
+		{"by instance and category", []string{"Instance", "category"}, n, "telegram|prod|storage"},
+		{"rule recipients", nil, &Notification{Channel: "sms", Rule: AlertRule{To: "list:dba"}}, "sms|list:dba|"},
+		{"email recipients", nil, &Notification{Channel: "email", Rule: AlertRule{To: "a@example.com", CC: []string{"b@example.com"}}}, "email|a@example.com||b@example.com|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGrouper(GroupingConfig{By: tt.by})
+			if got := g.groupKey(tt.n); got != tt.want {
+				t.Errorf("groupKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrouperSendsOneNotificationPerWindow(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  mattermost:
+    enabled: true
+    webhook_url: %q
+  grouping:
+    enabled: true
+    window: 50ms
+`, server.URL)))
+
+	for _, query := range []string{"connections", "replication_lag", "connections"} {
+		event := testEvent()
+		event.Query = query
+		instance.sendAlerts(event)
+	}
+
+	waitFor(t, time.Second, func() bool {
+		return instance.monitor.outbox.Len() == 0 && len(instance.monitor.deliveries.Results("mattermost", DeliverySent)) > 0
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("Mattermost received %d messages, want 1", len(bodies))
+	}
+	if !strings.Contains(bodies[0], "connections") || !strings.Contains(bodies[0], "replication_lag") {
+		t.Errorf("grouped message does not list both queries: %s", bodies[0])
+	}
+	if results := instance.monitor.deliveries.Results("mattermost", DeliverySent); results[0].Alerts != 2 {
+		t.Errorf("grouped notification holds %d alerts, want 2 (a repeated alert replaces its previous one)", results[0].Alerts)
+	}
+}
+
+func TestDigestFlush(t *testing.T) {
+	d := NewDigest()
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	d.Record("b", alertSummary{Time: start.Add(time.Minute), Query: "replication_lag", Message: "Lagging"})
+	d.Record("a", alertSummary{Time: start, Query: "connections", Message: "Too many connections"})
+	d.Record("a", alertSummary{Time: start.Add(2 * time.Minute), Query: "connections", Message: "Too many connections"})
+
+	summaries := d.Flush()
+	if len(summaries) != 2 {
+		t.Fatalf("Flush() returned %d summaries, want 2", len(summaries))
+	}
+	if summaries[0].Query != "connections" || summaries[0].Message != "Too many connections (fired 2 times since 2025-01-15 10:00)" {
+		t.Errorf("first summary = %+v", summaries[0])
+	}
+	if summaries[1].Message != "Lagging" {
+		t.Errorf("second summary = %+v", summaries[1])
+	}
+	if again := d.Flush(); len(again) != 0 {
+		t.Errorf("Flush() after flushing returned %d summaries, want 0", len(again))
+	}
+}
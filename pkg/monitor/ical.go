@@ -0,0 +1,562 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCalendarOccurrences bounds the expansion of a recurring calendar event
+const maxCalendarOccurrences = 100000
+
+// calendar holds the events of an iCalendar (.ics) file, such as a holiday or maintenance calendar.
+// Only VEVENT components with DTSTART, DTEND or DURATION and the RRULEs of recurrenceRule are supported.
+type calendar struct {
+	events []calendarEvent
+}
+
+// calendarEvent is a single, possibly recurring, event of a calendar
+type calendarEvent struct {
+	uid          string
+	summary      string
+	start        time.Time
+	duration     time.Duration
+	floating     bool // Start has no time zone, or is a date, and is interpreted in the time zone of the alert hours
+	allDay       bool
+	rule         *recurrenceRule
+	exdates      []calendarTime // Occurrences excluded by EXDATE or replaced by an event with a RECURRENCE-ID
+	recurrenceID *calendarTime  // Occurrence of the recurring event with the same UID this event replaces
+	cancelled    bool
+}
+
+// calendarTime is a time of a calendar, possibly floating
+type calendarTime struct {
+	time     time.Time
+	floating bool
+}
+
+// in returns the time, moving a floating time to the same wall clock time in loc
+func (t calendarTime) in(loc *time.Location) time.Time {
+	if !t.floating {
+		return t.time
+	}
+	return time.Date(t.time.Year(), t.time.Month(), t.time.Day(), t.time.Hour(), t.time.Minute(), t.time.Second(), 0, loc)
+}
+
+// recurrenceRule is the subset of an RRULE supported for calendar events: FREQ, INTERVAL, COUNT and UNTIL,
+// BYDAY and BYMONTHDAY with DAILY, WEEKLY and MONTHLY, and WKST
+type recurrenceRule struct {
+	freq       string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []recurrenceDay
+	byMonthDay []int // Negative days count from the end of the month
+	weekStart  time.Weekday
+}
+
+// recurrenceDay is a BYDAY entry such as MO, or 2MO and -1FR for the second Monday and last Friday of the month
+type recurrenceDay struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+// calendarWeekdays maps the weekdays of an RRULE to their time.Weekday
+var calendarWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// cachedCalendar is a parsed calendar file with its modification time
+type cachedCalendar struct {
+	modTime  time.Time
+	calendar *calendar
+}
+
+var (
+	calendarCache   = make(map[string]cachedCalendar)
+	calendarCacheMu sync.Mutex
+)
+
+// loadCalendar returns the parsed calendar file, parsing it again when it was modified. When the file can no
+// longer be read, the calendar as it was last loaded is returned with the error.
+func loadCalendar(path string) (*calendar, error) {
+	calendarCacheMu.Lock()
+	defer calendarCacheMu.Unlock()
+
+	cached, exists := calendarCache[path]
+	info, err := os.Stat(path)
+	if err != nil {
+		return cached.calendar, fmt.Errorf("failed to read calendar %s: %w", path, err)
+	}
+	if exists && cached.modTime.Equal(info.ModTime()) {
+		return cached.calendar, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cached.calendar, fmt.Errorf("failed to read calendar %s: %w", path, err)
+	}
+	cal, err := parseCalendar(data)
+	if err != nil {
+		return cached.calendar, fmt.Errorf("failed to parse calendar %s: %w", path, err)
+	}
+
+	calendarCache[path] = cachedCalendar{modTime: info.ModTime(), calendar: cal}
+	return cal, nil
+}
+
+// parseCalendar parses the events of an iCalendar file
+func parseCalendar(data []byte) (*calendar, error) {
+	cal := &calendar{}
+
+	var event *calendarEvent
+	var overrides []calendarEvent
+	var hasEnd bool
+	var end time.Time
+	for _, line := range unfoldCalendarLines(data) {
+		name, params, value := splitCalendarProperty(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &calendarEvent{}
+			hasEnd = false
+		case name == "END" && value == "VEVENT":
+			if event == nil {
+				continue
+			}
+			if event.start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", event.summary)
+			}
+			if hasEnd {
+				event.duration = end.Sub(event.start)
+			} else if event.duration == 0 && event.allDay {
+				event.duration = 24 * time.Hour
+			}
+			if event.recurrenceID != nil {
+				overrides = append(overrides, *event)
+			} else if !event.cancelled {
+				cal.events = append(cal.events, *event)
+			}
+			event = nil
+		case event == nil:
+			continue
+		case name == "UID":
+			event.uid = value
+		case name == "SUMMARY":
+			event.summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+		case name == "DTSTART":
+			start, floating, allDay, err := parseCalendarTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTSTART %q: %w", value, err)
+			}
+			event.start, event.floating, event.allDay = start, floating, allDay
+		case name == "DTEND":
+			var err error
+			end, _, _, err = parseCalendarTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTEND %q: %w", value, err)
+			}
+			hasEnd = true
+		case name == "DURATION":
+			duration, err := parseCalendarDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DURATION %q: %w", value, err)
+			}
+			event.duration = duration
+		case name == "RRULE":
+			rule, err := parseRecurrenceRule(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE %q: %w", value, err)
+			}
+			event.rule = rule
+		case name == "EXDATE":
+			for _, date := range strings.Split(value, ",") {
+				t, floating, _, err := parseCalendarTime(params, date)
+				if err != nil {
+					return nil, fmt.Errorf("invalid EXDATE %q: %w", date, err)
+				}
+				event.exdates = append(event.exdates, calendarTime{time: t, floating: floating})
+			}
+		case name == "RECURRENCE-ID":
+			if params["RANGE"] != "" {
+				return nil, fmt.Errorf("unsupported RECURRENCE-ID RANGE %q", params["RANGE"])
+			}
+			t, floating, _, err := parseCalendarTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RECURRENCE-ID %q: %w", value, err)
+			}
+			event.recurrenceID = &calendarTime{time: t, floating: floating}
+		case name == "RDATE":
+			return nil, fmt.Errorf("RDATE of event %q is not supported", event.summary)
+		case name == "STATUS" && value == "CANCELLED":
+			// Cancelled events never block alerts
+			event.cancelled = true
+		}
+	}
+
+	// An event with a RECURRENCE-ID moves or cancels an occurrence of the recurring event with its UID
+	for _, override := range overrides {
+		for i := range cal.events {
+			if cal.events[i].uid == override.uid && cal.events[i].rule != nil {
+				cal.events[i].exdates = append(cal.events[i].exdates, *override.recurrenceID)
+			}
+		}
+		if !override.cancelled {
+			cal.events = append(cal.events, override)
+		}
+	}
+	return cal, nil
+}
+
+// unfoldCalendarLines splits an iCalendar file into lines, joining folded continuation lines
+func unfoldCalendarLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitCalendarProperty splits a content line into its upper case name, parameters and value
+func splitCalendarProperty(line string) (string, map[string]string, string) {
+	head, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", nil, ""
+	}
+
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		if key, val, ok := strings.Cut(param, "="); ok {
+			params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, strings.TrimSpace(value)
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value. Dates and times without a time zone
+// are floating and returned in UTC, to be moved to the time zone of the alert hours later.
+func parseCalendarTime(params map[string]string, value string) (t time.Time, floating, allDay bool, err error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err = time.Parse("20060102", value)
+		return t, true, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, false, err
+	}
+
+	if tzid := params["TZID"]; tzid != "" {
+		loc, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, false, fmt.Errorf("unknown TZID %q: %w", tzid, err)
+		}
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+		return t, false, false, err
+	}
+
+	t, err = time.Parse("20060102T150405", value)
+	return t, true, false, err
+}
+
+// parseCalendarDuration parses a duration such as P1D, PT2H30M or P1W
+func parseCalendarDuration(value string) (time.Duration, error) {
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimLeft(value, "+-")
+	if !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("duration must start with P")
+	}
+
+	var duration time.Duration
+	var number string
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("missing number before %c", r)
+		}
+		number = ""
+
+		switch r {
+		case 'W':
+			duration += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			duration += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			duration += time.Duration(n) * time.Hour
+		case 'M':
+			duration += time.Duration(n) * time.Minute
+		case 'S':
+			duration += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("unknown designator %c", r)
+		}
+	}
+
+	if negative {
+		duration = -duration
+	}
+	return duration, nil
+}
+
+// parseRecurrenceRule parses an RRULE, returning an error for the parts that are not supported
+func parseRecurrenceRule(value string) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(part, "=")
+		switch key = strings.ToUpper(key); key {
+		case "FREQ":
+			rule.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", val)
+			}
+			rule.count = count
+		case "UNTIL":
+			until, _, allDay, err := parseCalendarTime(nil, val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", val)
+			}
+			if allDay {
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			rule.until = until
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(val), ",") {
+				if len(day) < 2 {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				weekday, exists := calendarWeekdays[day[len(day)-2:]]
+				if !exists {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				var ordinal int
+				if prefix := day[:len(day)-2]; prefix != "" {
+					var err error
+					ordinal, err = strconv.Atoi(prefix)
+					if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+						return nil, fmt.Errorf("invalid BYDAY %q", day)
+					}
+				}
+				rule.byDay = append(rule.byDay, recurrenceDay{ordinal: ordinal, weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				rule.byMonthDay = append(rule.byMonthDay, monthDay)
+			}
+		case "WKST":
+			weekday, exists := calendarWeekdays[strings.ToUpper(val)]
+			if !exists {
+				return nil, fmt.Errorf("invalid WKST %q", val)
+			}
+			rule.weekStart = weekday
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule.freq)
+	}
+	if rule.freq == "YEARLY" && (len(rule.byDay) > 0 || len(rule.byMonthDay) > 0) {
+		return nil, fmt.Errorf("BYDAY and BYMONTHDAY are not supported with FREQ=YEARLY")
+	}
+	if rule.freq == "WEEKLY" && len(rule.byMonthDay) > 0 {
+		return nil, fmt.Errorf("BYMONTHDAY is not allowed with FREQ=WEEKLY")
+	}
+	if rule.freq != "MONTHLY" && slices.ContainsFunc(rule.byDay, func(day recurrenceDay) bool { return day.ordinal != 0 }) {
+		return nil, fmt.Errorf("BYDAY with an ordinal requires FREQ=MONTHLY")
+	}
+	return rule, nil
+}
+
+// busy checks if an event of the calendar is in progress at now, returning its summary
+func (c *calendar) busy(now time.Time) (string, bool) {
+	for _, event := range c.events {
+		if event.occursAt(now) {
+			return event.summary, true
+		}
+	}
+	return "", false
+}
+
+// occursAt checks if an occurrence of the event is in progress at now.
+// Floating events are interpreted in the location of now.
+func (e calendarEvent) occursAt(now time.Time) bool {
+	start := calendarTime{time: e.start, floating: e.floating}.in(now.Location())
+	if e.rule == nil {
+		return e.inProgress(start, now)
+	}
+
+	var until time.Time
+	if !e.rule.until.IsZero() {
+		until = calendarTime{time: e.rule.until, floating: e.floating}.in(now.Location())
+	}
+
+	// COUNT includes the excluded occurrences
+	var count int
+	for period := 0; period < maxCalendarOccurrences; period++ {
+		for _, occurrence := range e.rule.occurrences(start, period) {
+			if occurrence.Before(start) {
+				continue
+			}
+			count++
+			if e.rule.count > 0 && count > e.rule.count {
+				return false
+			}
+			if occurrence.After(now) {
+				return false
+			}
+			if !until.IsZero() && occurrence.After(until) {
+				return false
+			}
+			if !e.excluded(occurrence) && e.inProgress(occurrence, now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excluded checks if an occurrence is excluded by an EXDATE or replaced by another event
+func (e calendarEvent) excluded(occurrence time.Time) bool {
+	for _, exdate := range e.exdates {
+		if exdate.in(occurrence.Location()).Equal(occurrence) {
+			return true
+		}
+	}
+	return false
+}
+
+// inProgress checks if an occurrence starting at start is in progress at now.
+// All day events last until midnight of their last day, even across DST changes.
+func (e calendarEvent) inProgress(start, now time.Time) bool {
+	end := start.Add(e.duration)
+	if e.allDay {
+		end = start.AddDate(0, 0, int(e.duration/(24*time.Hour)))
+	}
+	return !now.Before(start) && now.Before(end)
+}
+
+// occurrences returns the starts of the occurrences in the nth period of a recurring event in order,
+// keeping its wall clock time. Dates that do not exist, such as the 31st of a 30 day month, are skipped.
+func (r *recurrenceRule) occurrences(start time.Time, n int) []time.Time {
+	step := n * r.interval
+	switch r.freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, step)
+		if !r.matches(day) {
+			return nil
+		}
+		return []time.Time{day}
+
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			return []time.Time{start.AddDate(0, 0, 7*step)}
+		}
+		weekStart := start.AddDate(0, 0, 7*step-weekdayOffset(start.Weekday(), r.weekStart))
+		var days []time.Time
+		for i := 0; i < 7; i++ {
+			if day := weekStart.AddDate(0, 0, i); r.matches(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	case "MONTHLY":
+		hour, minute, second := start.Clock()
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, hour, minute, second, 0, start.Location())
+		if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+			if start.Day() > daysInMonth(first) {
+				return nil
+			}
+			return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+		}
+		var days []time.Time
+		for i := 0; i < daysInMonth(first); i++ {
+			if day := first.AddDate(0, 0, i); r.matches(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	default:
+		day := start.AddDate(step, 0, 0)
+		if day.Day() != start.Day() {
+			return nil // February 29 in a year that is not a leap year
+		}
+		return []time.Time{day}
+	}
+}
+
+// matches checks if a day satisfies the BYDAY and BYMONTHDAY parts of the rule
+func (r *recurrenceRule) matches(day time.Time) bool {
+	days := daysInMonth(day)
+	if len(r.byMonthDay) > 0 && !slices.ContainsFunc(r.byMonthDay, func(monthDay int) bool {
+		return monthDay == day.Day() || days+monthDay+1 == day.Day()
+	}) {
+		return false
+	}
+	if len(r.byDay) > 0 && !slices.ContainsFunc(r.byDay, func(weekday recurrenceDay) bool {
+		switch {
+		case weekday.weekday != day.Weekday():
+			return false
+		case weekday.ordinal > 0:
+			return (day.Day()-1)/7+1 == weekday.ordinal
+		case weekday.ordinal < 0:
+			return (days-day.Day())/7+1 == -weekday.ordinal
+		}
+		return true
+	}) {
+		return false
+	}
+	return true
+}
+
+// weekdayOffset returns the number of days from the start of the week to weekday
+func weekdayOffset(weekday, weekStart time.Weekday) int {
+	return (int(weekday) - int(weekStart) + 7) % 7
+}
+
+// daysInMonth returns the number of days in the month of t
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
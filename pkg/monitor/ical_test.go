@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCalendar parses a calendar of the given VEVENT lines
+func testCalendar(t *testing.T, lines ...string) *calendar {
+	t.Helper()
+
+	data := "BEGIN:VCALENDAR\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+	cal, err := parseCalendar([]byte(data))
+	if err != nil {
+		t.Fatalf("parseCalendar: %v", err)
+	}
+	return cal
+}
+
+func TestCalendarRecurrence(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(value string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", value, berlin)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name  string
+		event []string
+		busy  []string
+		free  []string
+	}{
+		{
+			name:  "weekly by day",
+			event: []string{"DTSTART:20250106T090000", "DURATION:PT1H", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE"},
+			busy:  []string{"2025-01-06 09:30", "2025-01-08 09:30", "2025-02-12 09:59"},
+			free:  []string{"2025-01-07 09:30", "2025-01-08 10:00", "2025-01-01 09:30"},
+		},
+		{
+			name:  "every other week from sunday",
+			event: []string{"DTSTART:20250105T090000", "DURATION:PT1H", "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,MO;WKST=SU"},
+			busy:  []string{"2025-01-05 09:30", "2025-01-06 09:30", "2025-01-19 09:30", "2025-01-20 09:30"},
+			free:  []string{"2025-01-12 09:30", "2025-01-13 09:30"},
+		},
+		{
+			name:  "monthly on the 31st",
+			event: []string{"DTSTART;VALUE=DATE:20250131", "RRULE:FREQ=MONTHLY"},
+			busy:  []string{"2025-01-31 12:00", "2025-03-31 12:00", "2025-05-31 12:00"},
+			free:  []string{"2025-02-28 12:00", "2025-03-01 12:00", "2025-03-03 12:00", "2025-04-30 12:00", "2025-05-01 12:00"},
+		},
+		{
+			name:  "last friday of the month",
+			event: []string{"DTSTART;TZID=Europe/Berlin:20250131T220000", "DURATION:PT4H", "RRULE:FREQ=MONTHLY;BYDAY=-1FR"},
+			busy:  []string{"2025-02-28 23:00", "2025-03-29 01:00", "2025-05-30 22:00"},
+			free:  []string{"2025-03-21 23:00", "2025-03-29 02:00"},
+		},
+		{
+			name:  "first and last day of the month",
+			event: []string{"DTSTART;VALUE=DATE:20250101", "RRULE:FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+			busy:  []string{"2025-02-28 12:00", "2025-03-01 12:00", "2025-12-31 12:00"},
+			free:  []string{"2025-02-27 12:00", "2025-03-02 12:00"},
+		},
+		{
+			name:  "count includes excluded dates",
+			event: []string{"DTSTART;VALUE=DATE:20250101", "RRULE:FREQ=DAILY;COUNT=3", "EXDATE;VALUE=DATE:20250102"},
+			busy:  []string{"2025-01-01 12:00", "2025-01-03 12:00"},
+			free:  []string{"2025-01-02 12:00", "2025-01-04 12:00"},
+		},
+		{
+			name:  "excluded time with time zone",
+			event: []string{"DTSTART;TZID=Europe/Berlin:20250106T090000", "DURATION:PT1H", "RRULE:FREQ=DAILY", "EXDATE:20250107T080000Z,20250109T080000Z"},
+			busy:  []string{"2025-01-06 09:30", "2025-01-08 09:30"},
+			free:  []string{"2025-01-07 09:30", "2025-01-09 09:30"},
+		},
+		{
+			name:  "weekly across daylight saving",
+			event: []string{"DTSTART;TZID=Europe/Berlin:20250324T090000", "DURATION:PT1H", "RRULE:FREQ=WEEKLY"},
+			busy:  []string{"2025-03-31 09:30", "2025-10-27 09:30"},
+			free:  []string{"2025-03-31 10:30", "2025-10-27 08:30"},
+		},
+		{
+			name:  "yearly on february 29",
+			event: []string{"DTSTART;VALUE=DATE:20240229", "RRULE:FREQ=YEARLY"},
+			busy:  []string{"2024-02-29 12:00", "2028-02-29 12:00"},
+			free:  []string{"2025-02-28 12:00", "2025-03-01 12:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := append([]string{"BEGIN:VEVENT", "SUMMARY:Event"}, tt.event...)
+			cal := testCalendar(t, append(lines, "END:VEVENT")...)
+			for _, value := range tt.busy {
+				if _, busy := cal.busy(at(value)); !busy {
+					t.Errorf("not busy at %s", value)
+				}
+			}
+			for _, value := range tt.free {
+				if _, busy := cal.busy(at(value)); busy {
+					t.Errorf("busy at %s", value)
+				}
+			}
+		})
+	}
+}
+
+func TestCalendarRecurrenceID(t *testing.T) {
+	cal := testCalendar(t,
+		"BEGIN:VEVENT", "UID:standup", "SUMMARY:Standup", "DTSTART:20250106T090000", "DURATION:PT1H", "RRULE:FREQ=WEEKLY", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:standup", "SUMMARY:Moved standup", "RECURRENCE-ID:20250113T090000", "DTSTART:20250114T090000", "DURATION:PT1H", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:standup", "RECURRENCE-ID:20250120T090000", "DTSTART:20250120T090000", "STATUS:CANCELLED", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:other", "SUMMARY:Cancelled", "DTSTART:20250106T120000", "DURATION:PT1H", "STATUS:CANCELLED", "END:VEVENT",
+	)
+
+	at := func(day int, hour int) time.Time { return time.Date(2025, 1, day, hour, 30, 0, 0, time.UTC) }
+	if summary, busy := cal.busy(at(14, 9)); !busy || summary != "Moved standup" {
+		t.Errorf("busy() = %q, %v at the moved occurrence", summary, busy)
+	}
+	for _, now := range []time.Time{at(13, 9), at(20, 9), at(6, 12)} {
+		if summary, busy := cal.busy(now); busy {
+			t.Errorf("busy with %q at %s", summary, now)
+		}
+	}
+	if _, busy := cal.busy(at(27, 9)); !busy {
+		t.Error("not busy at the occurrence after the cancelled one")
+	}
+}
+
+func TestCalendarUnsupported(t *testing.T) {
+	for _, property := range []string{
+		"RRULE:FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU,WE,TH,FR",
+		"RRULE:FREQ=YEARLY;BYMONTH=1",
+		"RRULE:FREQ=HOURLY",
+		"RRULE:FREQ=WEEKLY;BYDAY=1MO",
+		"RRULE:FREQ=WEEKLY;BYMONTHDAY=1",
+		"RRULE:FREQ=YEARLY;BYDAY=MO",
+		"RRULE:FREQ=MONTHLY;BYDAY=XX",
+		"RRULE:FREQ=MONTHLY;BYMONTHDAY=32",
+		"RDATE:20250110T090000",
+		"RECURRENCE-ID;RANGE=THISANDFUTURE:20250113T090000",
+	} {
+		data := "BEGIN:VEVENT\r\nDTSTART:20250106T090000\r\n" + property + "\r\nEND:VEVENT\r\n"
+		if _, err := parseCalendar([]byte(data)); err == nil {
+			t.Errorf("parseCalendar accepted %s", property)
+		}
+	}
+}
+
+func TestParseCalendarDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"PT1H", time.Hour},
+		{"PT2H30M", 150 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT12H", 36 * time.Hour},
+		{"-PT15M", -15 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := parseCalendarDuration(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseCalendarDuration(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"1H", "PTH", "P1X"} {
+		if _, err := parseCalendarDuration(value); err == nil {
+			t.Errorf("parseCalendarDuration(%q) accepted", value)
+		}
+	}
+}
+
+func TestLoadCalendarKeepsLastLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.ics")
+	data := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Upgrade\r\nDTSTART:20250701T020000Z\r\nDTEND:20250701T040000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCalendar(path); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+
+	// A calendar removed while running still suppresses its events
+	allowed, reason, err := alertHoursAllow(&AlertHours{Timezone: "UTC", Calendar: path}, time.Date(2025, 7, 1, 3, 0, 0, 0, time.UTC))
+	if err == nil || allowed || reason != `calendar event "Upgrade"` {
+		t.Errorf("alertHoursAllow() = %v, %q, %v, want blocked by the last loaded calendar with an error", allowed, reason, err)
+	}
+}
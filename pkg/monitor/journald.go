@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// JournaldConfig holds systemd journal configuration
+type JournaldConfig struct {
+	Enabled    bool              `yaml:"enabled"`
+	SocketPath string            `yaml:"socket_path,omitempty"` // Native protocol socket (default /run/systemd/journal/socket)
+	Identifier string            `yaml:"identifier,omitempty"`  // SYSLOG_IDENTIFIER of the entries (default postgres-stat-alert)
+	Fields     map[string]string `yaml:"fields,omitempty"`      // Custom fields, the values are Go templates rendered with the alert record
+	Priorities map[string]int    `yaml:"priorities,omitempty"`  // PRIORITY per alert severity, 0 (emergency) to 7 (debug)
+	Interval   time.Duration     `yaml:"interval"`
+}
+
+// journalFieldName matches the field names journald accepts from clients
+var journalFieldName = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_]{0,63}$`)
+
+// validateJournaldFields checks the names and templates of the custom journal fields
+func validateJournaldFields(fields map[string]string) error {
+	for name, value := range fields {
+		if !journalFieldName.MatchString(name) {
+			return fmt.Errorf("invalid journald field name %q, expected uppercase letters, digits and underscores", name)
+		}
+		if _, err := template.New(name).Parse(value); err != nil {
+			return fmt.Errorf("invalid journald field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sendJournaldAlert writes an alert or resolution to the systemd journal
+func (m *MonitorInstance) sendJournaldAlert(n *Notification) DeliveryResult {
+	config := m.monitor.config.Alerts.Journald
+	record := m.alertRecord(n, config.Priorities)
+	entry, err := journalEntry(config, record)
+	if err != nil {
+		m.monitor.logger.Printf("Error building journald entry: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to build journald entry: %w", err))
+	}
+
+	conn, err := net.DialTimeout("unixgram", config.SocketPath, m.monitor.config.Alerts.Delivery.SendTimeout)
+	if err != nil {
+		m.monitor.logger.Printf("Error connecting to journald: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to connect to journald: %w", err))
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(entry); err != nil {
+		m.monitor.logger.Printf("Error sending journald alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to send journald alert: %w", err))
+	}
+	m.monitor.logger.Printf("Journald alert sent successfully for query: %s", record.Query)
+	return deliveryResult(n, nil)
+}
+
+// journalEntry encodes a record in the journal native protocol, with a PGSTAT_ field per record attribute and
+// result column followed by the custom fields
+func journalEntry(config JournaldConfig, record AlertRecord) ([]byte, error) {
+	var b bytes.Buffer
+	fields := [][2]string{
+		{"MESSAGE", record.Text()},
+		{"PRIORITY", strconv.Itoa(record.priority)},
+		{"SYSLOG_IDENTIFIER", config.Identifier},
+		{"PGSTAT_STATUS", record.Status},
+		{"PGSTAT_ALERT_ID", record.AlertID},
+		{"PGSTAT_INSTANCE", record.Instance},
+		{"PGSTAT_DATABASE", record.Database},
+		{"PGSTAT_QUERY", record.Query},
+		{"PGSTAT_RULE", record.Rule},
+		{"PGSTAT_CATEGORY", record.Category},
+		{"PGSTAT_SEVERITY", record.Severity},
+		{"PGSTAT_VALUE", record.Value()},
+		{"PGSTAT_THRESHOLD", fmt.Sprintf("%v", record.Threshold)},
+		{"PGSTAT_OPERATOR", record.Operator},
+		{"PGSTAT_COMPARISON", record.Comparison},
+		{"PGSTAT_NOTE", record.Note},
+		{"PGSTAT_RUNBOOK", record.Runbook},
+	}
+	for _, field := range fields {
+		writeJournalField(&b, field[0], field[1])
+	}
+
+	for _, field := range rowFields(record.Row, record.Columns) {
+		if name := "PGSTAT_ROW_" + strings.ToUpper(field.Name); journalFieldName.MatchString(name) {
+			writeJournalField(&b, name, field.Value)
+		}
+	}
+
+	names := make([]string, 0, len(config.Fields))
+	for name := range config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl, err := template.New(name).Parse(config.Fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid journald field %s: %w", name, err)
+		}
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, record); err != nil {
+			return nil, fmt.Errorf("failed to render journald field %s: %w", name, err)
+		}
+		writeJournalField(&b, name, value.String())
+	}
+	return b.Bytes(), nil
+}
+
+// writeJournalField appends a field to a native protocol entry. Values containing newlines are written as
+// the name, a newline, the little endian 64 bit length and the raw value.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
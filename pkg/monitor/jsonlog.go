@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSONLogConfig holds JSON lines file configuration
+type JSONLogConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	FilePath string        `yaml:"file_path"` // File the records are appended to, "-" for standard output
+	Interval time.Duration `yaml:"interval"`
+}
+
+// jsonLogWriter serializes the writes of all instances to the JSON lines file
+type jsonLogWriter struct {
+	mu sync.Mutex
+}
+
+// sendJSONLogAlert appends an alert or resolution to the JSON lines file
+func (m *MonitorInstance) sendJSONLogAlert(n *Notification) DeliveryResult {
+	config := m.monitor.config.Alerts.JSONLog
+	record := m.alertRecord(n, nil)
+	// Operators such as ">" are kept readable instead of being escaped for HTML
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		m.monitor.logger.Printf("Error marshaling JSON log record: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to marshal JSON log record: %w", err))
+	}
+
+	if err := m.monitor.jsonLog.append(config.FilePath, line.Bytes()); err != nil {
+		m.monitor.logger.Printf("Error writing JSON log alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to write JSON log alert: %w", err))
+	}
+	m.monitor.logger.Printf("JSON log alert written successfully for query: %s", record.Query)
+	return deliveryResult(n, nil)
+}
+
+// append writes a line to the file, which is reopened for every line so that it can be rotated
+func (w *jsonLogWriter) append(path string, line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if path == "-" {
+		_, err := os.Stdout.Write(line)
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,536 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KafkaConfig holds Kafka producer configuration
+type KafkaConfig struct {
+	Enabled          bool            `yaml:"enabled"`
+	Brokers          []string        `yaml:"brokers"`                     // Bootstrap brokers, host:port
+	ClientID         string          `yaml:"client_id,omitempty"`         // Default postgres-stat-alert
+	SecurityProtocol string          `yaml:"security_protocol,omitempty"` // PLAINTEXT (default), SSL, SASL_PLAINTEXT or SASL_SSL
+	SASL             KafkaSASLConfig `yaml:"sasl,omitempty"`
+	Acks             int             `yaml:"acks,omitempty"` // -1 waits for all in-sync replicas (default), 1 for the leader only
+	BusConfig        `yaml:",inline"`
+}
+
+// KafkaSASLConfig holds the SASL credentials of the SASL security protocols
+type KafkaSASLConfig struct {
+	Mechanism string `yaml:"mechanism,omitempty"` // PLAIN (default), SCRAM-SHA-256 or SCRAM-SHA-512
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// Kafka API keys and the versions used, supported by Kafka 1.0 and newer
+const (
+	kafkaProduce          = 0
+	kafkaMetadata         = 3
+	kafkaSaslHandshake    = 17
+	kafkaSaslAuthenticate = 36
+
+	kafkaProduceVersion  = 3
+	kafkaMetadataVersion = 4
+)
+
+// kafkaErrors names the error codes a producer may get
+var kafkaErrors = map[int16]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	31: "CLUSTER_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+	87: "INVALID_RECORD",
+}
+
+// kafkaRejected are the error codes of messages the broker will not accept on a retry either
+var kafkaRejected = map[int16]bool{
+	2:  true, // CORRUPT_MESSAGE
+	10: true, // MESSAGE_TOO_LARGE
+	17: true, // INVALID_TOPIC_EXCEPTION
+	29: true, // TOPIC_AUTHORIZATION_FAILED
+	87: true, // INVALID_RECORD
+}
+
+// kafkaError returns the error of a non-zero error code
+func kafkaError(code int16, context string) error {
+	name, exists := kafkaErrors[code]
+	if !exists {
+		name = "UNKNOWN"
+	}
+	err := fmt.Errorf("kafka %s failed: %s (error code %d)", context, name, code)
+	if kafkaRejected[code] {
+		return &busRejectedError{err: err}
+	}
+	return err
+}
+
+// kafkaConn is a connection to a broker
+type kafkaConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// kafkaClient is a minimal Kafka producer. It sends every message as a single record batch to the leader
+// of its partition and waits for the acknowledgement.
+type kafkaClient struct {
+	config        KafkaConfig
+	timeout       time.Duration
+	brokers       map[int32]string   // Broker addresses by node ID
+	leaders       map[string][]int32 // Leader node ID per partition of the topics
+	conns         map[string]*kafkaConn
+	correlationID int32
+	mu            sync.Mutex
+}
+
+// newKafkaClient creates a Kafka producer, brokers are connected on the first publish
+func newKafkaClient(config KafkaConfig, timeout time.Duration) *kafkaClient {
+	return &kafkaClient{
+		config:  config,
+		timeout: timeout,
+		brokers: make(map[int32]string),
+		leaders: make(map[string][]int32),
+		conns:   make(map[string]*kafkaConn),
+	}
+}
+
+// kafkaTopicValue replaces the characters Kafka does not allow in topic names
+func kafkaTopicValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// Publish produces a message to the partition of its key. A failed attempt is retried once with fresh
+// metadata and connections, as the partition leader may have moved, unless the broker rejected the message.
+func (c *kafkaClient) Publish(topic string, key, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.produce(topic, key, payload)
+	var rejected *busRejectedError
+	if err == nil || errors.As(err, &rejected) {
+		return err
+	}
+	c.reset()
+	return c.produce(topic, key, payload)
+}
+
+// produce sends a Produce request to the partition leader and checks its response
+func (c *kafkaClient) produce(topic string, key, payload []byte) error {
+	leaders, err := c.partitionLeaders(topic)
+	if err != nil {
+		return err
+	}
+	partition := kafkaPartition(key, len(leaders))
+	address, exists := c.brokers[leaders[partition]]
+	if !exists {
+		return fmt.Errorf("no leader for kafka topic %s partition %d", topic, partition)
+	}
+
+	now := time.Now().UnixMilli()
+	var body kafkaEncoder
+	body.int16(-1) // No transactional ID
+	body.int16(int16(c.config.Acks))
+	body.int32(int32(c.timeout / time.Millisecond))
+	body.int32(1)
+	body.string(topic)
+	body.int32(1)
+	body.int32(partition)
+	body.bytes(kafkaRecordBatch(key, payload, now))
+
+	resp, err := c.request(address, kafkaProduce, kafkaProduceVersion, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	d := kafkaDecoder{b: resp}
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		d.string()
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int32()
+			code := d.int16()
+			d.int64() // Base offset
+			d.int64() // Log append time
+			if code != 0 {
+				return kafkaError(code, "produce to "+topic)
+			}
+		}
+	}
+	return d.err
+}
+
+// partitionLeaders returns the leader per partition of a topic, requesting the metadata when not known
+func (c *kafkaClient) partitionLeaders(topic string) ([]int32, error) {
+	if leaders, exists := c.leaders[topic]; exists {
+		return leaders, nil
+	}
+
+	var body kafkaEncoder
+	body.int32(1)
+	body.string(topic)
+	body.bool(true) // Allow auto topic creation
+
+	var resp []byte
+	var errs []string
+	for _, broker := range c.config.Brokers {
+		var err error
+		if resp, err = c.request(broker, kafkaMetadata, kafkaMetadataVersion, body.Bytes()); err == nil {
+			break
+		}
+		errs = append(errs, err.Error())
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("failed to get kafka metadata: %s", strings.Join(errs, "; "))
+	}
+
+	d := kafkaDecoder{b: resp}
+	d.int32() // Throttle time
+	for brokers := d.int32(); brokers > 0 && d.err == nil; brokers-- {
+		node := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // Rack
+		c.brokers[node] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	d.nullableString() // Cluster ID
+	d.int32()          // Controller ID
+
+	var leaders []int32
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		code := d.int16()
+		name := d.string()
+		d.bool() // Internal
+		var partitionLeaders []int32
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int16() // Partition error, the leader tells whether it can be produced to
+			index := d.int32()
+			leader := d.int32()
+			d.int32Array() // Replicas
+			d.int32Array() // In-sync replicas
+			if index < 0 {
+				continue
+			}
+			for int(index) >= len(partitionLeaders) {
+				partitionLeaders = append(partitionLeaders, -1)
+			}
+			partitionLeaders[index] = leader
+		}
+		if name != topic {
+			continue
+		}
+		if code != 0 {
+			return nil, kafkaError(code, "metadata of "+topic)
+		}
+		leaders = partitionLeaders
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(leaders) == 0 {
+		return nil, fmt.Errorf("kafka topic %s has no partitions", topic)
+	}
+	c.leaders[topic] = leaders
+	return leaders, nil
+}
+
+// request sends a request to a broker and returns the response body after the correlation ID
+func (c *kafkaClient) request(address string, apiKey, version int16, body []byte) ([]byte, error) {
+	conn, err := c.connection(address)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(conn, apiKey, version, body)
+	if err != nil {
+		conn.conn.Close()
+		delete(c.conns, address)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// roundTrip writes a request with its header and reads the matching response
+func (c *kafkaClient) roundTrip(conn *kafkaConn, apiKey, version int16, body []byte) ([]byte, error) {
+	c.correlationID++
+	var header kafkaEncoder
+	header.int16(apiKey)
+	header.int16(version)
+	header.int32(c.correlationID)
+	header.string(c.config.ClientID)
+
+	request := make([]byte, 4, 4+header.Len()+len(body))
+	binary.BigEndian.PutUint32(request, uint32(header.Len()+len(body)))
+	request = append(append(request, header.Bytes()...), body...)
+
+	conn.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.conn.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to send kafka request: %w", err)
+	}
+
+	var size int32
+	if err := binary.Read(conn.reader, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read kafka response: %w", err)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(conn.reader, resp); err != nil {
+		return nil, fmt.Errorf("failed to read kafka response: %w", err)
+	}
+	if len(resp) < 4 || int32(binary.BigEndian.Uint32(resp)) != c.correlationID {
+		return nil, fmt.Errorf("kafka response does not match the request")
+	}
+	return resp[4:], nil
+}
+
+// connection returns the connection to a broker, connecting and authenticating when needed
+func (c *kafkaClient) connection(address string) (*kafkaConn, error) {
+	if conn, exists := c.conns[address]; exists {
+		return conn, nil
+	}
+
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var netConn net.Conn
+	var err error
+	switch c.config.SecurityProtocol {
+	case "SSL", "SASL_SSL":
+		tlsConfig, tlsErr := c.config.TLS.clientConfig(address)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		netConn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	default:
+		netConn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka broker %s: %w", address, err)
+	}
+
+	conn := &kafkaConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if strings.HasPrefix(c.config.SecurityProtocol, "SASL_") {
+		if err := c.authenticate(conn); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	c.conns[address] = conn
+	return conn, nil
+}
+
+// authenticate performs the SASL handshake and authentication of a new connection
+func (c *kafkaClient) authenticate(conn *kafkaConn) error {
+	var handshake kafkaEncoder
+	handshake.string(c.config.SASL.Mechanism)
+	resp, err := c.roundTrip(conn, kafkaSaslHandshake, 1, handshake.Bytes())
+	if err != nil {
+		return err
+	}
+	d := kafkaDecoder{b: resp}
+	if code := d.int16(); code != 0 {
+		return kafkaError(code, "SASL handshake")
+	}
+
+	// Every SASL message is exchanged in a SaslAuthenticate request
+	exchange := func(message []byte) ([]byte, error) {
+		var auth kafkaEncoder
+		auth.bytes(message)
+		resp, err := c.roundTrip(conn, kafkaSaslAuthenticate, 0, auth.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		d := kafkaDecoder{b: resp}
+		code := d.int16()
+		reason := d.nullableString()
+		data := d.bytesField()
+		if code != 0 {
+			return nil, fmt.Errorf("%w: %s", kafkaError(code, "SASL authentication"), reason)
+		}
+		return data, d.err
+	}
+
+	sasl := c.config.SASL
+	if sasl.Mechanism == "PLAIN" {
+		_, err := exchange([]byte("\x00" + sasl.Username + "\x00" + sasl.Password))
+		return err
+	}
+	return scramAuthenticate(exchange, sasl.Mechanism, sasl.Username, sasl.Password)
+}
+
+// reset closes the connections and forgets the metadata
+func (c *kafkaClient) reset() {
+	for address, conn := range c.conns {
+		conn.conn.Close()
+		delete(c.conns, address)
+	}
+	clear(c.leaders)
+}
+
+// kafkaRecordBatch encodes a message as a record batch (magic 2) holding a single record
+func kafkaRecordBatch(key, value []byte, timestamp int64) []byte {
+	var record []byte
+	record = append(record, 0)              // Attributes
+	record = binary.AppendVarint(record, 0) // Timestamp delta
+	record = binary.AppendVarint(record, 0) // Offset delta
+	record = binary.AppendVarint(record, int64(len(key)))
+	record = append(record, key...)
+	record = binary.AppendVarint(record, int64(len(value)))
+	record = append(record, value...)
+	record = binary.AppendVarint(record, 0) // Headers
+
+	// The CRC covers everything from the attributes to the end of the batch
+	var crcData kafkaEncoder
+	crcData.int16(0) // Attributes: no compression
+	crcData.int32(0) // Last offset delta
+	crcData.int64(timestamp)
+	crcData.int64(timestamp)
+	crcData.int64(-1) // Producer ID
+	crcData.int16(-1) // Producer epoch
+	crcData.int32(-1) // Base sequence
+	crcData.int32(1)  // Records
+	crcData.Write(binary.AppendVarint(nil, int64(len(record))))
+	crcData.Write(record)
+
+	var batch kafkaEncoder
+	batch.int64(0) // Base offset
+	batch.int32(int32(4 + 1 + 4 + crcData.Len()))
+	batch.int32(-1) // Partition leader epoch
+	batch.WriteByte(2)
+	batch.int32(int32(crc32.Checksum(crcData.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(crcData.Bytes())
+	return batch.Bytes()
+}
+
+// kafkaPartition returns the partition of a key, using the murmur2 hash of the Java client so that
+// other producers send the same key to the same partition
+func kafkaPartition(key []byte, partitions int) int32 {
+	return int32(uint32(kafkaMurmur2(key)&0x7fffffff) % uint32(partitions))
+}
+
+// kafkaMurmur2 is the murmur2 hash as implemented by the Java client
+func kafkaMurmur2(data []byte) int32 {
+	const m = 0x5bd1e995
+	length := len(data)
+	h := uint32(0x9747b28c) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaEncoder writes the big endian primitives of the Kafka protocol
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int16(v int16) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int32(v int32) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int64(v int64) { binary.Write(e, binary.BigEndian, v) }
+
+func (e *kafkaEncoder) bool(v bool) {
+	if v {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+// kafkaDecoder reads the big endian primitives of the Kafka protocol, keeping the first error
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		if d.err == nil {
+			d.err = fmt.Errorf("truncated kafka response")
+		}
+		return make([]byte, max(n, 0))
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) int16() int16 { return int16(binary.BigEndian.Uint16(d.next(2))) }
+func (d *kafkaDecoder) int32() int32 { return int32(binary.BigEndian.Uint32(d.next(4))) }
+func (d *kafkaDecoder) int64() int64 { return int64(binary.BigEndian.Uint64(d.next(8))) }
+func (d *kafkaDecoder) bool() bool   { return d.next(1)[0] != 0 }
+
+func (d *kafkaDecoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *kafkaDecoder) nullableString() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) bytesField() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+func (d *kafkaDecoder) int32Array() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kafkaBroker is a stub broker answering metadata requests with itself as the leader of a single partition
+// and produce requests with produceError, recording the record batches produced
+type kafkaBroker struct {
+	listener     net.Listener
+	produceError int16
+	batches      [][]byte
+	mu           sync.Mutex
+}
+
+func newKafkaBroker(t *testing.T, produceError int16) *kafkaBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	broker := &kafkaBroker{listener: listener, produceError: produceError}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+func (b *kafkaBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var size int32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+		request := make([]byte, size)
+		if _, err := io.ReadFull(reader, request); err != nil {
+			return
+		}
+		d := kafkaDecoder{b: request}
+		apiKey := d.int16()
+		d.int16() // Version
+		correlationID := d.int32()
+		d.string() // Client ID
+
+		var resp kafkaEncoder
+		resp.int32(correlationID)
+		switch apiKey {
+		case kafkaMetadata:
+			d.int32()
+			topic := d.string()
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			portNumber, _ := strconv.Atoi(port)
+			resp.int32(0) // Throttle time
+			resp.int32(1)
+			resp.int32(7) // Node ID
+			resp.string(host)
+			resp.int32(int32(portNumber))
+			resp.int16(-1) // Rack
+			resp.int16(-1) // Cluster ID
+			resp.int32(7)  // Controller ID
+			resp.int32(2)
+			// Topics other than the requested one are ignored
+			for _, name := range []string{"other", topic} {
+				resp.int16(0)
+				resp.string(name)
+				resp.bool(false)
+				resp.int32(1)
+				resp.int16(0)
+				resp.int32(0) // Partition
+				resp.int32(7) // Leader
+				resp.int32(1)
+				resp.int32(7) // Replicas
+				resp.int32(1)
+				resp.int32(7) // In-sync replicas
+			}
+		case kafkaProduce:
+			d.int16() // Transactional ID
+			d.int16() // Acks
+			d.int32() // Timeout
+			d.int32()
+			topic := d.string()
+			d.int32()
+			d.int32() // Partition
+			b.mu.Lock()
+			b.batches = append(b.batches, d.bytesField())
+			b.mu.Unlock()
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(b.produceError)
+			resp.int64(0)
+			resp.int64(-1)
+		default:
+			return
+		}
+		binary.Write(conn, binary.BigEndian, int32(resp.Len()))
+		conn.Write(resp.Bytes())
+	}
+}
+
+func (b *kafkaBroker) produced() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.batches
+}
+
+func newTestKafkaClient(broker *kafkaBroker) *kafkaClient {
+	return newKafkaClient(KafkaConfig{
+		Brokers:          []string{broker.listener.Addr().String()},
+		ClientID:         "test",
+		SecurityProtocol: "PLAINTEXT",
+		Acks:             -1,
+	}, 5*time.Second)
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	timestamp := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC).UnixMilli()
+	batch := kafkaRecordBatch([]byte("key"), []byte(`{"status":"firing"}`), timestamp)
+
+	d := kafkaDecoder{b: batch}
+	if offset := d.int64(); offset != 0 {
+		t.Errorf("base offset = %d, want 0", offset)
+	}
+	if length := d.int32(); int(length) != len(d.b) {
+		t.Errorf("batch length = %d, want the %d bytes that follow", length, len(d.b))
+	}
+	d.int32() // Partition leader epoch
+	if magic := d.next(1)[0]; magic != 2 {
+		t.Errorf("magic = %d, want 2", magic)
+	}
+	crc := uint32(d.int32())
+	if want := crc32.Checksum(d.b, crc32.MakeTable(crc32.Castagnoli)); crc != want {
+		t.Errorf("crc = %08x, want the CRC32C %08x of the rest of the batch", crc, want)
+	}
+	if attributes := d.int16(); attributes != 0 {
+		t.Errorf("attributes = %d, want no compression", attributes)
+	}
+	d.int32() // Last offset delta
+	if first, last := d.int64(), d.int64(); first != timestamp || last != timestamp {
+		t.Errorf("timestamps = %d, %d, want %d", first, last, timestamp)
+	}
+	d.int64() // Producer ID
+	d.int16() // Producer epoch
+	d.int32() // Base sequence
+	if records := d.int32(); records != 1 {
+		t.Fatalf("records = %d, want 1", records)
+	}
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+
+	r := bytes.NewReader(d.b)
+	varint := func() int64 {
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	field := func() string {
+		b := make([]byte, varint())
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if length := varint(); int(length) != r.Len() {
+		t.Errorf("record length = %d, want the %d bytes that follow", length, r.Len())
+	}
+	r.ReadByte() // Attributes
+	varint()     // Timestamp delta
+	varint()     // Offset delta
+	if key, value := field(), field(); key != "key" || value != `{"status":"firing"}` {
+		t.Errorf("record = %q: %q, want the key and payload", key, value)
+	}
+	if headers := varint(); headers != 0 || r.Len() != 0 {
+		t.Errorf("%d headers and %d trailing bytes, want none", headers, r.Len())
+	}
+}
+
+func TestKafkaPublish(t *testing.T) {
+	broker := newKafkaBroker(t, 0)
+	client := newTestKafkaClient(broker)
+
+	if err := client.Publish("alerts", []byte("key"), []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if leaders := client.leaders["alerts"]; len(leaders) != 1 || leaders[0] != 7 {
+		t.Errorf("leaders = %v, want node 7 for partition 0", leaders)
+	}
+	if client.brokers[7] != broker.listener.Addr().String() {
+		t.Errorf("brokers = %v, want node 7 at the stub broker", client.brokers)
+	}
+	if batches := broker.produced(); len(batches) != 1 {
+		t.Errorf("produced %d batches, want 1", len(batches))
+	}
+}
+
+func TestKafkaPublishRejected(t *testing.T) {
+	broker := newKafkaBroker(t, 10) // MESSAGE_TOO_LARGE
+	client := newTestKafkaClient(broker)
+
+	err := client.Publish("alerts", []byte("key"), []byte(`{}`))
+	var rejected *busRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("Publish() = %v, want a rejected message", err)
+	}
+	if batches := broker.produced(); len(batches) != 1 {
+		t.Errorf("produced %d batches, want no retry of a rejected message", len(batches))
+	}
+}
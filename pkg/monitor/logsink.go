@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default syslog severities of the log sinks, overridable with their priorities setting.
+// Journald uses the same levels for its PRIORITY field.
+var logPriorities = map[string]int{"critical": 2, "error": 3, "warning": 4, "info": 6}
+
+// logPriorityResolved is the syslog severity of resolutions (notice)
+const logPriorityResolved = 5
+
+// AlertRecord is an alert or resolution as written by the log sinks
+type AlertRecord struct {
+	Time       time.Time              `json:"time"`
+	Status     string                 `json:"status"` // "firing" or "resolved"
+	AlertID    string                 `json:"alert_id"`
+	Instance   string                 `json:"instance"`
+	Database   string                 `json:"database"`
+	Query      string                 `json:"query"`
+	Rule       string                 `json:"rule"`
+	Category   string                 `json:"category"`
+	Severity   string                 `json:"severity"`
+	Message    string                 `json:"message"`
+	Observed   interface{}            `json:"observed,omitempty"`
+	Threshold  interface{}            `json:"threshold"`
+	Operator   string                 `json:"operator,omitempty"`
+	Comparison string                 `json:"comparison"`
+	Row        map[string]interface{} `json:"row,omitempty"`
+	Columns    []string               `json:"-"` // Columns of Row in the order of the query
+	Note       string                 `json:"note,omitempty"`
+	Runbook    string                 `json:"runbook,omitempty"`
+	Since      time.Time              `json:"since,omitzero"` // Time the alert started firing
+	Resolved   bool                   `json:"-"`
+	priority   int
+}
+
+// alertRecord flattens a notification into a log record
+func (m *MonitorInstance) alertRecord(n *Notification, priorities map[string]int) AlertRecord {
+	event := n.Event()
+	record := AlertRecord{
+		Time:       time.Now(),
+		Status:     "firing",
+		AlertID:    alertID(m.alertKey(n.Query, n.Rule)),
+		Instance:   m.dbConfig.Instance,
+		Database:   n.Database,
+		Query:      n.Query,
+		Rule:       ruleID(n.Rule),
+		Category:   n.Rule.Category,
+		Severity:   alertSeverity(n.Rule),
+		Message:    n.Rule.Message,
+		Observed:   event.Observed,
+		Threshold:  event.Threshold(),
+		Operator:   event.Operator(),
+		Comparison: event.Comparison(),
+		Row:        event.Row,
+		Columns:    event.Columns,
+		Note:       n.Rule.ResolutionNote,
+		Runbook:    n.Rule.Runbook,
+		Since:      n.Since,
+		Resolved:   n.Resolved,
+		priority:   pushPriority(n.Rule, priorities, logPriorities),
+	}
+	if n.Resolved {
+		record.Status = "resolved"
+		record.priority = logPriorityResolved
+	}
+	return record
+}
+
+// Text returns the one line message of a record
+func (r AlertRecord) Text() string {
+	if r.Resolved {
+		return fmt.Sprintf("[%s/%s] resolved: %s", r.Instance, r.Query, r.Message)
+	}
+	return fmt.Sprintf("[%s/%s] %s (%s)", r.Instance, r.Query, r.Message, r.Comparison)
+}
+
+// Value returns the observed value of a record, or "" when nothing was observed
+func (r AlertRecord) Value() string {
+	if r.Observed == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", r.Observed)
+}
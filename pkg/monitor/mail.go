@@ -0,0 +1,283 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// emailThread links an email to the thread of an alert in mail clients
+type emailThread struct {
+	Root  string // Message-ID of the first email about the alert, empty for a standalone email
+	Reply bool   // The email continues the thread: a repeat or resolution of the alert
+}
+
+// emailThread returns the thread of a notification. The root Message-ID is derived from the alert and the time it
+// started firing, so every email about the same firing period refers to the same root.
+func (m *MonitorInstance) emailThread(n *Notification) emailThread {
+	if n.Since.IsZero() {
+		return emailThread{}
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", m.alertKey(n.Query, n.Rule), n.Since.Unix())))
+	return emailThread{
+		Root:  fmt.Sprintf("<alert-%s@%s>", hex.EncodeToString(sum[:12]), m.monitor.messageIDDomain()),
+		Reply: n.Repeat || n.Resolved,
+	}
+}
+
+// messageIDDomain returns the domain used in Message-IDs, taken from the sender address
+func (m *Monitor) messageIDDomain() string {
+	if _, domain, found := strings.Cut(m.config.Alerts.Email.FromEmail, "@"); found && domain != "" {
+		return domain
+	}
+	return "postgres-stat-alert.localhost"
+}
+
+// newMessageID returns a unique Message-ID
+func (m *Monitor) newMessageID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate message id: %w", err)
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), m.messageIDDomain()), nil
+}
+
+// headerLineLength is the line length that folded headers keep to, as recommended by RFC 5322
+const headerLineLength = 78
+
+// formatAddressList formats addresses for the header name, encoding display names as needed.
+// The list is folded after a comma before a line gets longer than headerLineLength.
+func formatAddressList(name string, addresses []string) string {
+	var list strings.Builder
+	line := len(name) + len(": ")
+	for i, address := range addresses {
+		if parsed, err := mail.ParseAddress(address); err == nil {
+			address = parsed.String()
+		}
+		if i > 0 {
+			list.WriteString(",")
+			line++
+			if line+1+len(address) > headerLineLength {
+				list.WriteString("\r\n")
+				line = 0
+			}
+			list.WriteString(" ")
+			line++
+		}
+		list.WriteString(address)
+		line += len(address)
+	}
+	return list.String()
+}
+
+// envelopeAddress returns the bare address of a recipient, e.g. "jane@company.com" for "Jane <jane@company.com>"
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+// emailInline is an inline attachment of an HTML email, referenced as "cid:<ContentID>"
+type emailInline struct {
+	ContentID   string
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// buildEmailMessage builds an RFC 5322 message with a quoted-printable text and HTML alternative.
+// Inline attachments are added to the HTML alternative as a multipart/related part.
+func (m *Monitor) buildEmailMessage(recipients emailRecipients, subject, textBody, htmlBody string, thread emailThread, inline []emailInline) ([]byte, error) {
+	config := m.config.Alerts.Email
+	from := mail.Address{Name: config.FromName, Address: config.FromEmail}
+
+	messageID := thread.Root
+	if messageID == "" || thread.Reply {
+		var err error
+		if messageID, err = m.newMessageID(); err != nil {
+			return nil, err
+		}
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	if err := writeQuotedPrintablePart(parts, "text/plain; charset=UTF-8", textBody); err != nil {
+		return nil, err
+	}
+
+	if len(inline) == 0 {
+		if err := writeQuotedPrintablePart(parts, "text/html; charset=UTF-8", htmlBody); err != nil {
+			return nil, err
+		}
+	} else {
+		var related bytes.Buffer
+		relatedParts := multipart.NewWriter(&related)
+		if err := writeQuotedPrintablePart(relatedParts, "text/html; charset=UTF-8", htmlBody); err != nil {
+			return nil, err
+		}
+		for _, attachment := range inline {
+			if err := writeInlinePart(relatedParts, attachment); err != nil {
+				return nil, err
+			}
+		}
+		if err := relatedParts.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close message part: %w", err)
+		}
+
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {fmt.Sprintf("multipart/related; type=\"text/html\"; boundary=%q", relatedParts.Boundary())},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message part: %w", err)
+		}
+		if _, err := w.Write(related.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write message part: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close message: %w", err)
+	}
+
+	// BCC recipients are only part of the envelope, never of the headers
+	var message bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&message, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	if len(recipients.To) > 0 {
+		header("To", formatAddressList("To", recipients.To))
+	} else {
+		header("To", "undisclosed-recipients:;")
+	}
+	if len(recipients.CC) > 0 {
+		header("Cc", formatAddressList("Cc", recipients.CC))
+	}
+	// Encoded words are folded one per line, whitespace between them is not part of the subject
+	header("Subject", strings.ReplaceAll(mime.QEncoding.Encode("UTF-8", subject), "?= =?", "?=\r\n =?"))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	if thread.Reply && thread.Root != "" {
+		header("In-Reply-To", thread.Root)
+		header("References", thread.Root)
+	}
+	header("Auto-Submitted", "auto-generated")
+	header("MIME-Version", "1.0")
+	header("Content-Type", fmt.Sprintf("multipart/alternative;\r\n boundary=%q", parts.Boundary()))
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// writeQuotedPrintablePart adds a quoted-printable encoded text part
+func writeQuotedPrintablePart(parts *multipart.Writer, contentType, content string) error {
+	w, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create message part: %w", err)
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return fmt.Errorf("failed to encode message part: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("failed to encode message part: %w", err)
+	}
+	return nil
+}
+
+// writeInlinePart adds a base64 encoded inline attachment, wrapped at 76 characters per line
+func writeInlinePart(parts *multipart.Writer, attachment emailInline) error {
+	w, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("%s; name=%q", attachment.ContentType, attachment.Filename)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Id":                {"<" + attachment.ContentID + ">"},
+		"Content-Disposition":       {fmt.Sprintf("inline; filename=%q", attachment.Filename)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create message part: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 0 {
+		n := min(76, len(encoded))
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:n]); err != nil {
+			return fmt.Errorf("failed to write message part: %w", err)
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// smtpAuth returns the authentication mechanism configured for the SMTP server, nil for none
+func (m *Monitor) smtpAuth() (smtp.Auth, error) {
+	config := m.config.Alerts.Email
+
+	switch strings.ToLower(config.Auth) {
+	case "none":
+		return nil, nil
+	case "plain":
+		return smtp.PlainAuth("", config.Username, config.Password, config.SMTPHost), nil
+	case "login":
+		return &loginAuth{username: config.Username, password: config.Password, host: config.SMTPHost}, nil
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(config.Username, config.Password), nil
+	}
+	return nil, fmt.Errorf("unknown SMTP auth %q, expected plain, login, cram-md5 or none", config.Auth)
+}
+
+// loginAuth implements the LOGIN authentication mechanism, still required by some mail servers
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start begins LOGIN authentication, refusing to send credentials over an unencrypted connection to a remote server
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username and password challenges of the server
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+// isLocalhost checks if a server name refers to the local machine
+func isLocalhost(name string) bool {
+	if name == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && ip.IsLoopback()
+}
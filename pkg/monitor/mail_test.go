@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEmailPart returns the media type, parameters and decoded body of a message part
+func readEmailPart(t *testing.T, part *multipart.Part) (string, map[string]string, []byte) {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mediaType, params, body
+}
+
+func TestBuildEmailMessage(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, `
+alerts:
+  email:
+    from_email: "alerts@example.com"
+    from_name: "Postgres Alerts"
+`))
+	var to []string
+	for i := range 8 {
+		to = append(to, fmt.Sprintf("Database Administrator %d <dba%d@example.com>", i, i))
+	}
+	recipients := emailRecipients{To: to, CC: []string{"ops@example.com"}, BCC: []string{"audit@example.com"}}
+	subject := "⚠️ " + strings.Repeat("Too many connections on app ", 4)
+	message, err := instance.monitor.buildEmailMessage(recipients, subject, "Observed 143 > 100", "<p>Observed 143 &gt; 100</p>", emailThread{}, []emailInline{
+		{ContentID: "chart", ContentType: "image/png", Filename: "chart.png", Data: []byte("png")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Headers are folded: the address lists keep to the recommended line length, the rest to the limit
+	addressList := false
+	for _, line := range strings.Split(string(message), "\r\n") {
+		if line == "" {
+			break
+		}
+		if !strings.HasPrefix(line, " ") {
+			addressList = strings.HasPrefix(line, "To:") || strings.HasPrefix(line, "Cc:")
+		}
+		if len(line) > 998 || addressList && len(line) > headerLineLength {
+			t.Errorf("header line of %d characters: %q", len(line), line)
+		}
+	}
+	if !bytes.Contains(message, []byte(",\r\n \"Database Administrator")) {
+		t.Error("To header is not folded")
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := msg.Header.AddressList("To"); err != nil || len(got) != len(to) || got[7].Address != "dba7@example.com" {
+		t.Errorf("To = %v, %v, want the %d recipients", got, err, len(to))
+	}
+	if got := msg.Header.Get("Cc"); got != "<ops@example.com>" {
+		t.Errorf("Cc = %q, want the CC recipient", got)
+	}
+	if got := msg.Header.Get("Bcc"); got != "" || bytes.Contains(message, []byte("audit@example.com")) {
+		t.Errorf("BCC recipient in the headers: %q", got)
+	}
+	if got, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || got != subject {
+		t.Errorf("Subject = %q, %v, want %q", got, err, subject)
+	}
+	if got := msg.Header.Get("Message-ID"); !strings.HasSuffix(got, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one in the sender domain", got)
+	}
+	if got := msg.Header.Get("In-Reply-To"); got != "" {
+		t.Errorf("In-Reply-To = %q on a standalone email", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v, want multipart/alternative", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	part, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType, _, body := readEmailPart(t, part); mediaType != "text/plain" || string(body) != "Observed 143 > 100" {
+		t.Errorf("first part = %s %q, want the text body", mediaType, body)
+	}
+	if part, err = parts.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if mediaType != "multipart/related" {
+		t.Fatalf("second part = %s, want the HTML body with its inline attachments", mediaType)
+	}
+	related := multipart.NewReader(part, params["boundary"])
+	if part, err = related.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	if mediaType, _, body := readEmailPart(t, part); mediaType != "text/html" || string(body) != "<p>Observed 143 &gt; 100</p>" {
+		t.Errorf("related part = %s %q, want the HTML body", mediaType, body)
+	}
+	if part, err = related.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	if part.Header.Get("Content-Id") != "<chart>" || part.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Errorf("inline part headers = %v, want the base64 encoded chart", part.Header)
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("NextPart() = %v after the HTML body, want the end of the message", err)
+	}
+}
+
+func TestBuildEmailMessageThreading(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, `
+alerts:
+  email:
+    from_email: "alerts@example.com"
+`))
+	n := instance.newNotification("email", testEvent())
+	n.Since = time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	headers := func(n *Notification) mail.Header {
+		t.Helper()
+		thread := instance.emailThread(n)
+		message, err := instance.monitor.buildEmailMessage(emailRecipients{To: []string{"dba@example.com"}}, "Alert", "text", "html", thread, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Header
+	}
+
+	first := headers(n)
+	root := first.Get("Message-ID")
+	if !strings.HasPrefix(root, "<alert-") || first.Get("In-Reply-To") != "" {
+		t.Fatalf("first email Message-ID = %q, In-Reply-To = %q, want the thread root", root, first.Get("In-Reply-To"))
+	}
+
+	n.Repeat = true
+	repeat := headers(n)
+	if id := repeat.Get("Message-ID"); id == root || repeat.Get("In-Reply-To") != root || repeat.Get("References") != root {
+		t.Errorf("repeat Message-ID = %q, In-Reply-To = %q, References = %q, want a reply to %q", id, repeat.Get("In-Reply-To"), repeat.Get("References"), root)
+	}
+
+	// A new firing period starts a new thread
+	n.Repeat = false
+	n.Since = n.Since.Add(time.Hour)
+	if id := headers(n).Get("Message-ID"); id == root {
+		t.Errorf("Message-ID = %q of a new firing period, want a new thread root", id)
+	}
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MatrixConfig holds Matrix configuration
+type MatrixConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	HomeserverURL string        `yaml:"homeserver_url"` // e.g. https://matrix.example.com
+	AccessToken   string        `yaml:"access_token"`   // Access token of the bot user, which must have joined the rooms
+	RoomID        string        `yaml:"room_id"`        // Room IDs, comma separated, e.g. "!abc123:example.com"
+	Interval      time.Duration `yaml:"interval"`
+}
+
+// MatrixMessage represents an m.room.message event with an HTML formatted body
+type MatrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+// matrixErrorResponse is the error body of the Matrix client-server API
+type matrixErrorResponse struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMS int64  `json:"retry_after_ms"`
+}
+
+// sendMatrixAlert sends an alert to the Matrix rooms of a rule
+func (m *MonitorInstance) sendMatrixAlert(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postMatrixMessage(n, n.Query, n.Rule, m.formatAlert(n.Event())))
+}
+
+// sendMatrixBatch sends a group of alerts to Matrix as a single message
+func (m *MonitorInstance) sendMatrixBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postMatrixMessage(n, batchQueries(n.Batch), n.Batch[0].Rule, formatBatch(n.Batch)))
+}
+
+// postMatrixMessage sends an alert to every room of a rule that did not receive it yet
+func (m *MonitorInstance) postMatrixMessage(n *Notification, queryName string, rule AlertRule, f alertFormat) error {
+	rooms, err := m.monitor.channelRecipients(rule, "matrix", splitRecipients(m.monitor.config.Alerts.Matrix.RoomID))
+	if err != nil {
+		m.monitor.logger.Printf("Matrix alert failed for query %s: %v", queryName, err)
+		return fmt.Errorf("failed to resolve Matrix room for query %s: %w", queryName, err)
+	}
+	if len(rooms) == 0 {
+		return fmt.Errorf("no Matrix room for query %s", queryName)
+	}
+
+	msg := MatrixMessage{
+		MsgType:       "m.text",
+		Body:          f.Text(),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: f.HTML(),
+	}
+
+	return n.sendToTargets(rooms, func(room string) error {
+		return m.postMatrixEvent(queryName, room, matrixTxnID(n, room), msg)
+	})
+}
+
+// matrixTxnID returns the transaction ID of a notification sent to a room. It stays the same across retries, so
+// the homeserver ignores a retry of an event it already received; a newer alert gets a new one.
+func matrixTxnID(n *Notification, room string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", n.ID, n.CreatedAt.UnixNano(), room)))
+	return "pgstat-" + hex.EncodeToString(sum[:16])
+}
+
+// postMatrixEvent sends a message event to a room
+func (m *MonitorInstance) postMatrixEvent(queryName, room, txnID string, msg MatrixMessage) error {
+	config := m.monitor.config.Alerts.Matrix
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Matrix message: %v", err)
+		return fmt.Errorf("failed to marshal Matrix message: %w", err)
+	}
+
+	sendURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(config.HomeserverURL, "/"), url.PathEscape(room), txnID)
+
+	req, err := http.NewRequest(http.MethodPut, sendURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error creating Matrix request: %v", err)
+		return fmt.Errorf("failed to create Matrix request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.AccessToken)
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Matrix alert: %v", err)
+		return fmt.Errorf("failed to send Matrix alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Matrix alert sent successfully for query: %s to room %s", queryName, room)
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var errResp matrixErrorResponse
+	json.Unmarshal(respBody, &errResp)
+	m.monitor.logger.Printf("Matrix alert failed with status code: %d (%s %s) for query: %s to room %s", resp.StatusCode, errResp.ErrCode, errResp.Error, queryName, room)
+	statusErr := newHTTPStatusError(resp, respBody, "Matrix alert failed with status code: %d (%s %s) for query: %s to room %s", resp.StatusCode, errResp.ErrCode, errResp.Error, queryName, room)
+	if errResp.RetryAfterMS > 0 {
+		// Rate limited homeservers report the wait in the body instead of a Retry-After header
+		statusErr.RetryAfter = time.Duration(errResp.RetryAfterMS) * time.Millisecond
+	}
+	return statusErr
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// MattermostConfig holds Mattermost incoming webhook configuration
+type MattermostConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	WebhookURL string        `yaml:"webhook_url"`
+	Channel    string        `yaml:"channel,omitempty"`  // Overrides the channel of the webhook, if the webhook allows it
+	Username   string        `yaml:"username,omitempty"` // Overrides the name shown, if the webhook allows it
+	IconURL    string        `yaml:"icon_url,omitempty"`
+	Interval   time.Duration `yaml:"interval"`
+}
+
+// MattermostMessage represents a Mattermost incoming webhook message
+type MattermostMessage struct {
+	Channel     string           `json:"channel,omitempty"`
+	Username    string           `json:"username,omitempty"`
+	IconURL     string           `json:"icon_url,omitempty"`
+	Attachments []ChatAttachment `json:"attachments"`
+}
+
+// sendMattermostAlert sends an alert to Mattermost
+func (m *MonitorInstance) sendMattermostAlert(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postMattermostMessage(n.Query, m.formatAlert(n.Event())))
+}
+
+// sendMattermostBatch sends a group of alerts to Mattermost as a single attachment
+func (m *MonitorInstance) sendMattermostBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postMattermostMessage(batchQueries(n.Batch), formatBatch(n.Batch)))
+}
+
+// postMattermostMessage posts an alert to the Mattermost webhook
+func (m *MonitorInstance) postMattermostMessage(queryName string, f alertFormat) error {
+	config := m.monitor.config.Alerts.Mattermost
+	msg := MattermostMessage{
+		Channel:     config.Channel,
+		Username:    config.Username,
+		IconURL:     config.IconURL,
+		Attachments: []ChatAttachment{f.Attachment()},
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Mattermost message: %v", err)
+		return fmt.Errorf("failed to marshal Mattermost message: %w", err)
+	}
+
+	resp, err := m.monitor.httpClient.Post(config.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Mattermost alert: %v", err)
+		return fmt.Errorf("failed to send Mattermost alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Mattermost alert sent successfully for query: %s", queryName)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Mattermost alert failed with status code: %d (%s) for query: %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName)
+		return newHTTPStatusError(resp, respBody, "Mattermost alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+	}
+	return nil
+}
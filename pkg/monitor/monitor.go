@@ -1,8 +1,10 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -27,11 +29,76 @@ func NewMonitor(configPath string) (*Monitor, error) {
 	logger := log.New(logFile, fmt.Sprintf("[Postgres Stat Alert] "), log.LstdFlags|log.Lshortfile)
 	fmt.Printf("\nLogging to file: %s\n", config.Logging.FilePath)
 
+	// Load undelivered alerts of a previous run
+	outbox, err := NewOutbox(config.Alerts.Delivery.OutboxDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %w", err)
+	}
+	if outbox.Len() > 0 {
+		logger.Printf("Loaded %d undelivered alerts from outbox %s", outbox.Len(), config.Alerts.Delivery.OutboxDir)
+	}
+
+	silences, err := NewSilenceStore(config.Silences.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open silences: %w", err)
+	}
+
+	templates, err := loadEmailTemplates(config.Alerts.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	buses, err := newMessageBuses(config)
+	if err != nil {
+		return nil, err
+	}
+
+	teamsGraph, err := loadTeamsGraphToken(config.Alerts.Teams.Graph)
+	if err != nil {
+		return nil, err
+	}
+
+	discordThreads, err := loadDiscordThreads(config.Alerts.Discord)
+	if err != nil {
+		return nil, err
+	}
+
+	deferred, err := NewDeferredAlerts(deferredAlertsFile(config.Alerts.Delivery))
+	if err != nil {
+		return nil, err
+	}
+
+	voiceCalls, err := newVoiceCalls(voiceCallsFile(config.Alerts.Delivery))
+	if err != nil {
+		return nil, err
+	}
+
+	pushoverReceipts, err := loadPushoverReceipts(pushoverReceiptsFile(config.Alerts.Delivery))
+	if err != nil {
+		return nil, err
+	}
+
 	monitor := &Monitor{
-		config:    config,
-		instances: nil,
-		logger:    logger,
-		osSignal:  make(chan os.Signal, 1),
+		config:         config,
+		instances:      nil,
+		logger:         logger,
+		osSignal:       make(chan os.Signal, 1),
+		outbox:         outbox,
+		dispatcher:     NewDispatcher(config.Alerts.Delivery.QueueSize, config.Alerts.Delivery.Workers, logger),
+		httpClient:     &http.Client{Timeout: config.Alerts.Delivery.SendTimeout},
+		grouper:        NewGrouper(config.Alerts.Grouping),
+		digest:         NewDigest(),
+		silences:       silences,
+		deferred:       deferred,
+		templates:      templates,
+		deliveries:     NewDeliveryHistory(),
+		teamsGraph:     teamsGraph,
+		discordThreads: discordThreads,
+		voiceCalls:     voiceCalls,
+		receipts:       pushoverReceipts,
+		syslog:         &syslogConn{},
+		jsonLog:        &jsonLogWriter{},
+		buses:          buses,
 	}
 
 	signal.Notify(monitor.osSignal, syscall.SIGINT, syscall.SIGTERM)
@@ -67,6 +134,44 @@ func NewMonitor(configPath string) (*Monitor, error) {
 func (m *Monitor) Start() {
 	m.logger.Println("Starting database monitor...")
 
+	// Background loops that can stop end when Start returns
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Retry undelivered alerts in the background
+	go m.processOutbox()
+	go m.logDispatchStats(m.config.Alerts.Delivery.StatsInterval)
+	if restored := m.deferred.Restore(m.instanceFor); restored > 0 {
+		m.logger.Printf("Restored %d deferred alerts", restored)
+	}
+	go m.deliverDeferredAlerts()
+
+	if m.config.Alerts.Digest.Enabled {
+		go m.sendDigests()
+	}
+
+	for _, bus := range m.buses {
+		go m.publishBuffered(bus, bus.alerts, "alert")
+		if bus.results != nil {
+			go m.publishBuffered(bus, bus.results, "query result")
+		}
+	}
+
+	if m.config.API.Enabled {
+		go m.startAPI()
+	}
+
+	if m.config.Alerts.Voice.Enabled {
+		if restored := m.voiceCalls.restore(m.instanceFor); restored > 0 {
+			m.logger.Printf("Restored %d voice calls waiting for an answer", restored)
+		}
+		go m.trackVoiceCalls(ctx)
+	}
+
+	if m.config.Alerts.Telegram.Enabled && m.config.Alerts.Telegram.Commands {
+		go m.pollTelegramCommands(ctx)
+	}
+
 	for _, instance := range m.instances {
 		// Start monitoring each query in separate goroutines
 		for _, query := range instance.monitor.config.Queries {
@@ -98,11 +203,19 @@ func (m *MonitorInstance) monitorQuery(queryConfig QueryConfig) {
 				//If an error occurs, send alerts for all alert rules
 				for r := range queryConfig.AlertRules {
 					rule := queryConfig.AlertRules[r]
+					rule.Name = queryErrorRuleName
 					rule.Message = fmt.Sprintf("Error executing query %s: %v", queryConfig.Name, err)
 					rule.Category = "error"
+					rule.Condition = ""
 					rule.Value = err.Error()
-
-					m.sendAlerts(queryConfig.Name, rule)
+					event := AlertEvent{Query: queryConfig.Name, Rule: rule}
+					m.recordDigest(event)
+					if m.isSilenced(queryConfig.Name, rule) {
+						continue
+					}
+
+					m.alertTracker.MarkFiring(m.alertKey(queryConfig.Name, rule))
+					m.sendAlerts(event)
 				}
 			}
 		}
@@ -117,7 +230,7 @@ func (m *MonitorInstance) executeAndCheck(queryConfig QueryConfig) error {
 		now := time.Now()
 		if m.startedAt.IsZero() {
 			m.startedAt = now
-			m.checkAlertRules(queryConfig, nil, []interface{}{1})
+			m.checkAlertRules(queryConfig, nil, []interface{}{1}, nil)
 		}
 
 		return nil
@@ -137,7 +250,11 @@ func (m *MonitorInstance) executeAndCheck(queryConfig QueryConfig) error {
 		return fmt.Errorf("failed to get columns for query %s: %w", queryConfig.Name, err)
 	}
 
-	// Process results
+	// Process results, keeping track of which rules fired on any row
+	fired := make(map[string]bool)
+	first := true
+	publish := m.monitor.publishesResults()
+	var results []map[string]interface{}
 	for rows.Next() {
 		// Create a slice to hold the values
 		values := make([]interface{}, len(columns))
@@ -153,14 +270,29 @@ func (m *MonitorInstance) executeAndCheck(queryConfig QueryConfig) error {
 			continue
 		}
 
+		// Keep the history of the first column of the first row for charts
+		if first && len(values) > 0 {
+			m.alertTracker.RecordValue(queryConfig.Name, values[0])
+			first = false
+		}
+
+		if publish {
+			results = append(results, rowValues(columns, values))
+		}
+
 		// Check alert rules
-		m.checkAlertRules(queryConfig, columns, values)
+		m.checkAlertRules(queryConfig, columns, values, fired)
 	}
 
 	if err = rows.Err(); err != nil {
 		m.monitor.logger.Printf("Error iterating rows for query %s: %v", queryConfig.Name, err)
 		return fmt.Errorf("error iterating rows for query %s: %w", queryConfig.Name, err)
 	}
+
+	m.resolveClearedAlerts(queryConfig, fired)
+	if publish {
+		m.publishResults(queryConfig.Name, columns, results)
+	}
 	return nil
 }
 
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeTestConfig writes a configuration file, returning its path
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadTestConfig loads a configuration from YAML, applying the defaults of loadConfig
+func loadTestConfig(t *testing.T, data string) *Config {
+	t.Helper()
+
+	config, err := loadConfig(writeTestConfig(t, data))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	return config
+}
+
+// newTestInstance creates a monitor with a single instance "test" on database "app", without a database connection
+func newTestInstance(t *testing.T, config *Config) *MonitorInstance {
+	t.Helper()
+
+	// Keep the default outbox directory out of the package directory
+	if config.Alerts.Delivery.OutboxDir == "outbox" {
+		config.Alerts.Delivery.OutboxDir = t.TempDir()
+	}
+	outbox, err := NewOutbox(config.Alerts.Delivery.OutboxDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := loadEmailTemplates(config.Alerts.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silences, err := NewSilenceStore(filepath.Join(t.TempDir(), "silences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	m := &Monitor{
+		config:         config,
+		logger:         logger,
+		outbox:         outbox,
+		dispatcher:     NewDispatcher(config.Alerts.Delivery.QueueSize, config.Alerts.Delivery.Workers, logger),
+		httpClient:     &http.Client{Timeout: 5 * time.Second},
+		grouper:        NewGrouper(config.Alerts.Grouping),
+		digest:         NewDigest(),
+		deferred:       &DeferredAlerts{alerts: make(map[string]*deferredAlert)},
+		deliveries:     NewDeliveryHistory(),
+		discordThreads: &discordThreads{ids: make(map[string]string)},
+		voiceCalls:     &voiceCalls{calls: make(map[string]*voiceCall)},
+		receipts:       &pushoverReceipts{receipts: make(map[string][]string)},
+		syslog:         &syslogConn{},
+		jsonLog:        &jsonLogWriter{},
+		templates:      templates,
+		silences:       silences,
+	}
+	instance := &MonitorInstance{
+		monitor:      m,
+		dbConfig:     &DatabaseConfig{Instance: "test", Database: "app"},
+		alertTracker: NewAlertTracker(),
+	}
+	m.instances = map[string]*MonitorInstance{"test": instance}
+	return instance
+}
+
+// testEvent returns a fired alert of query "connections" observing 143 against the threshold 100
+func testEvent() AlertEvent {
+	return AlertEvent{
+		Query: "connections",
+		Rule: AlertRule{
+			Name:      "too_many",
+			Condition: "gt",
+			Value:     100,
+			Message:   "Too many connections",
+			Category:  "performance",
+		},
+		Observed: 143,
+		Row:      map[string]interface{}{"count": 143},
+	}
+}
+
+// recordedRequest is a request received by a stub server
+type recordedRequest struct {
+	Method string
+	Path   string // Escaped path
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+// recordingServer returns a stub server answering every request with status and body, recording the requests
+// it received
+func recordingServer(t *testing.T, status int, body string) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery, Header: r.Header, Body: data})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
@@ -0,0 +1,304 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MQTTConfig holds MQTT broker configuration
+type MQTTConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	BrokerURL string        `yaml:"broker_url"`           // tcp://host:1883, or ssl://host:8883 for TLS (also mqtts:// and tls://)
+	ClientID  string        `yaml:"client_id,omitempty"`  // Default postgres-stat-alert-<hostname>
+	Username  string        `yaml:"username,omitempty"`   // Optional
+	Password  string        `yaml:"password,omitempty"`   // Optional
+	QoS       *int          `yaml:"qos,omitempty"`        // 0 (at most once) or 1 (at least once, default)
+	Retain    bool          `yaml:"retain,omitempty"`     // Keep the last message of each topic for new subscribers
+	KeepAlive time.Duration `yaml:"keep_alive,omitempty"` // Default 60s
+	BusConfig `yaml:",inline"`
+}
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect = 1
+	mqttConnAck = 2
+	mqttPublish = 3
+	mqttPubAck  = 4
+)
+
+// mqttMaxRemainingLength is the largest body the four byte remaining length of a packet can describe
+const mqttMaxRemainingLength = 268435455
+
+// mqttConnAckErrors are the reasons of refused connections
+var mqttConnAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttClient is a minimal MQTT 3.1.1 publisher keeping a single connection to the broker
+type mqttClient struct {
+	config   MQTTConfig
+	qos      int
+	timeout  time.Duration
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	lastUsed time.Time
+	mu       sync.Mutex
+}
+
+// newMQTTClient creates an MQTT publisher, the broker is connected on the first publish
+func newMQTTClient(config MQTTConfig, timeout time.Duration) *mqttClient {
+	qos := 1
+	if config.QoS != nil {
+		qos = *config.QoS
+	}
+	return &mqttClient{config: config, qos: qos, timeout: timeout}
+}
+
+// mqttTopicValue replaces the level separator and wildcard characters in topic values
+func mqttTopicValue(value string) string {
+	return replaceReserved(value, "+#/")
+}
+
+// Publish sends a message and, with QoS 1, waits for its acknowledgement. The connection is reopened once
+// when the broker closed it. MQTT 3.1.1 has no error reply, brokers close the connection on a publish the
+// client is not authorized for, so closing a fresh connection too rejects the message.
+func (c *mqttClient) Publish(topic string, key, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := validateMQTTPublish(topic, payload); err != nil {
+		return &busRejectedError{err: err}
+	}
+
+	// The broker drops connections idle for longer than the keep alive, reconnect instead of writing into them
+	if c.conn != nil && time.Since(c.lastUsed) > c.config.KeepAlive {
+		c.close()
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if err = c.connect(); err != nil {
+				return err
+			}
+		}
+		if err = c.publish(topic, payload); err == nil {
+			c.lastUsed = time.Now()
+			return nil
+		}
+		c.close()
+		if attempt == 1 && errors.Is(err, io.EOF) {
+			return &busRejectedError{err: fmt.Errorf("MQTT broker closed the connection on the publish to %s, the client may not be authorized: %w", topic, err)}
+		}
+	}
+	return err
+}
+
+// validateMQTTPublish checks that a topic is a valid topic name without wildcards and that the message fits
+// in a packet
+func validateMQTTPublish(topic string, payload []byte) error {
+	switch {
+	case topic == "":
+		return fmt.Errorf("MQTT topic is empty")
+	case len(topic) > 65535:
+		return fmt.Errorf("MQTT topic is longer than 65535 bytes")
+	case !utf8.ValidString(topic), strings.ContainsAny(topic, "+#\x00"):
+		return fmt.Errorf("invalid MQTT topic %q", topic)
+	case 2+len(topic)+2+len(payload) > mqttMaxRemainingLength:
+		return fmt.Errorf("MQTT message of %d bytes exceeds the maximum packet size", len(payload))
+	}
+	return nil
+}
+
+// connect opens the connection and sends the CONNECT packet
+func (c *mqttClient) connect() error {
+	broker, err := url.Parse(c.config.BrokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT broker URL: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	switch broker.Scheme {
+	case "ssl", "tls", "mqtts":
+		tlsConfig, err := c.config.TLS.clientConfig(broker.Host)
+		if err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", broker.Host, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+	default:
+		conn, err = dialer.Dial("tcp", broker.Host)
+		if err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	// Variable header: protocol name and level, connect flags (clean session) and keep alive
+	var packet bytes.Buffer
+	writeMQTTString(&packet, "MQTT")
+	flags := byte(0x02)
+	if c.config.Username != "" {
+		flags |= 0x80
+	}
+	if c.config.Password != "" {
+		flags |= 0x40
+	}
+	packet.Write([]byte{4, flags})
+	binary.Write(&packet, binary.BigEndian, uint16(c.config.KeepAlive/time.Second))
+
+	writeMQTTString(&packet, c.config.ClientID)
+	if c.config.Username != "" {
+		writeMQTTString(&packet, c.config.Username)
+	}
+	if c.config.Password != "" {
+		writeMQTTString(&packet, c.config.Password)
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := writeMQTTPacket(conn, mqttConnect<<4, packet.Bytes()); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send MQTT connect: %w", err)
+	}
+	packetType, body, err := readMQTTPacket(reader)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read MQTT connack: %w", err)
+	}
+	if packetType != mqttConnAck || len(body) != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected MQTT packet type %d instead of connack", packetType)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return fmt.Errorf("MQTT connection refused: %s (code %d)", mqttConnAckErrors[code], code)
+	}
+
+	c.conn, c.reader = conn, reader
+	return nil
+}
+
+// publish sends a PUBLISH packet and waits for the PUBACK of QoS 1 messages
+func (c *mqttClient) publish(topic string, payload []byte) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	var packet bytes.Buffer
+	writeMQTTString(&packet, topic)
+	header := byte(mqttPublish << 4)
+	if c.config.Retain {
+		header |= 0x01
+	}
+	if c.qos == 1 {
+		header |= 0x02
+		// Packet identifiers must not be 0
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		binary.Write(&packet, binary.BigEndian, c.packetID)
+	}
+	packet.Write(payload)
+
+	if err := writeMQTTPacket(c.conn, header, packet.Bytes()); err != nil {
+		return fmt.Errorf("failed to send MQTT publish: %w", err)
+	}
+	if c.qos == 0 {
+		return nil
+	}
+
+	for {
+		packetType, body, err := readMQTTPacket(c.reader)
+		if err != nil {
+			return fmt.Errorf("failed to read MQTT puback: %w", err)
+		}
+		if packetType == mqttPubAck && len(body) == 2 && binary.BigEndian.Uint16(body) == c.packetID {
+			return nil
+		}
+	}
+}
+
+// close closes the connection to the broker
+func (c *mqttClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.reader = nil, nil
+	}
+}
+
+// writeMQTTString appends a length prefixed UTF-8 string
+func writeMQTTString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+// writeMQTTPacket writes a control packet: the header byte, the variable length remaining length and the body
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	if len(body) > mqttMaxRemainingLength {
+		return fmt.Errorf("MQTT packet of %d bytes exceeds the maximum remaining length", len(body))
+	}
+	packet := appendMQTTLength([]byte{header}, len(body))
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// appendMQTTLength appends a remaining length, seven bits per byte with the high bit marking continuation
+func appendMQTTLength(b []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			return b
+		}
+	}
+}
+
+// readMQTTPacket reads a control packet, returning its type and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed MQTT remaining length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMQTTRemainingLength(t *testing.T) {
+	tests := []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{mqttMaxRemainingLength, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+
+	for _, tt := range tests {
+		if got := appendMQTTLength(nil, tt.length); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendMQTTLength(%d) = % x, want % x", tt.length, got, tt.want)
+		}
+		if tt.length > 2097152 {
+			continue
+		}
+
+		var packet bytes.Buffer
+		body := bytes.Repeat([]byte{'a'}, tt.length)
+		if err := writeMQTTPacket(&packet, mqttPublish<<4|0x02, body); err != nil {
+			t.Fatal(err)
+		}
+		packetType, got, err := readMQTTPacket(bufio.NewReader(&packet))
+		if err != nil || packetType != mqttPublish || !bytes.Equal(got, body) {
+			t.Errorf("round trip of %d bytes = type %d, %d bytes, %v", tt.length, packetType, len(got), err)
+		}
+	}
+}
+
+func TestReadMQTTPacketMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"five length bytes": {mqttPubAck << 4, 0x80, 0x80, 0x80, 0x80, 0x01},
+		"truncated length":  {mqttPubAck << 4, 0x80},
+		"truncated body":    {mqttPubAck << 4, 0x02, 0x00},
+	}
+
+	for name, packet := range tests {
+		if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet))); err == nil {
+			t.Errorf("%s: readMQTTPacket() succeeded, want an error", name)
+		}
+	}
+}
+
+func TestMQTTPublishRejectsInvalidTopics(t *testing.T) {
+	client := newMQTTClient(MQTTConfig{BrokerURL: "tcp://127.0.0.1:1"}, 0)
+
+	for _, topic := range []string{"", "alerts/+/prod", "alerts/#", "alerts/\x00", strings.Repeat("a", 65536)} {
+		err := client.Publish(topic, nil, []byte(`{}`))
+		var rejected *busRejectedError
+		if !errors.As(err, &rejected) {
+			t.Errorf("Publish(%.20q) = %v, want a rejected message", topic, err)
+		}
+	}
+}
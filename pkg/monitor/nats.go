@@ -0,0 +1,333 @@
+package monitor
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSConfig holds NATS server configuration
+type NATSConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	URL       string `yaml:"url"`                 // Servers, comma separated, e.g. nats://nats1:4222; tls:// requires TLS
+	Username  string `yaml:"username,omitempty"`  // Optional, may also be given in the URL
+	Password  string `yaml:"password,omitempty"`  // Optional
+	Token     string `yaml:"token,omitempty"`     // Optional authentication token
+	Name      string `yaml:"name,omitempty"`      // Connection name shown by the server (default postgres-stat-alert)
+	JetStream bool   `yaml:"jetstream,omitempty"` // Wait for the acknowledgement of the stream storing the subject
+	BusConfig `yaml:",inline"`
+}
+
+// natsInfo is the part of the server INFO message the client uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT message of the client
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name,omitempty"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// natsPubAck is the acknowledgement of a JetStream publish
+type natsPubAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// natsClient is a minimal NATS publisher keeping a single connection to one of the servers
+type natsClient struct {
+	config  NATSConfig
+	timeout time.Duration
+	conn    net.Conn
+	reader  *bufio.Reader
+	inbox   string // Subject prefix of JetStream acknowledgements
+	replies int
+	mu      sync.Mutex
+}
+
+// newNATSClient creates a NATS publisher, the server is connected on the first publish
+func newNATSClient(config NATSConfig, timeout time.Duration) *natsClient {
+	return &natsClient{config: config, timeout: timeout}
+}
+
+// natsSubjectValue replaces the token separator, wildcard and whitespace characters in subject values
+func natsSubjectValue(value string) string {
+	return replaceReserved(value, ".*> \t")
+}
+
+// Publish sends a message and waits until the server, or with JetStream the stream, has accepted it.
+// The connection is reopened once when the server closed it, unless the server rejected the message.
+func (c *natsClient) Publish(topic string, key, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if err = c.connect(); err != nil {
+				return err
+			}
+		}
+		if err = c.publish(topic, payload); err == nil {
+			return nil
+		}
+		// Replies to the failed publish may still follow, start over on a new connection
+		c.close()
+		var rejected *busRejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+	}
+	return err
+}
+
+// connect connects to the first reachable server
+func (c *natsClient) connect() error {
+	var errs []string
+	for _, server := range splitRecipients(c.config.URL) {
+		err := c.connectServer(server)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return fmt.Errorf("failed to connect to NATS: %s", strings.Join(errs, "; "))
+}
+
+// connectServer opens the connection to a server, upgrading it to TLS when required, and authenticates
+func (c *natsClient) connectServer(server string) error {
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL %s: %w", server, err)
+	}
+	address := serverURL.Host
+	if serverURL.Port() == "" {
+		address = net.JoinHostPort(serverURL.Hostname(), "4222")
+	}
+
+	conn, err := net.DialTimeout("tcp", address, c.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	reader := bufio.NewReader(conn)
+
+	// The server greets with its INFO before the client may upgrade the connection to TLS
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read NATS info: %w", err)
+	}
+	var info natsInfo
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(line[5:]), &info) != nil {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+
+	useTLS := serverURL.Scheme == "tls" || info.TLSRequired
+	if useTLS {
+		tlsConfig, err := c.config.TLS.clientConfig(address)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS TLS handshake failed: %w", err)
+		}
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect := natsConnect{
+		TLSRequired: useTLS,
+		Name:        c.config.Name,
+		Lang:        "go",
+		Version:     "1.0.0",
+		Protocol:    1,
+		User:        c.config.Username,
+		Pass:        c.config.Password,
+		AuthToken:   c.config.Token,
+	}
+	if serverURL.User != nil && connect.User == "" {
+		connect.User = serverURL.User.Username()
+		connect.Pass, _ = serverURL.User.Password()
+	}
+	connectJSON, _ := json.Marshal(connect)
+
+	c.conn, c.reader = conn, reader
+	commands := "CONNECT " + string(connectJSON) + "\r\n"
+	if c.config.JetStream {
+		c.inbox = "_INBOX." + natsNUID()
+		commands += "SUB " + c.inbox + ".* 1\r\n"
+	}
+	if _, err := io.WriteString(conn, commands+"PING\r\n"); err != nil {
+		c.close()
+		return fmt.Errorf("failed to send NATS connect: %w", err)
+	}
+	if err := c.waitPong(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// publish sends a PUB message and waits for the server or stream acknowledgement
+func (c *natsClient) publish(subject string, payload []byte) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if !c.config.JetStream {
+		// Without JetStream the server does not acknowledge messages, the PONG confirms it processed the PUB
+		msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+		if _, err := io.WriteString(c.conn, msg); err != nil {
+			return fmt.Errorf("failed to send NATS publish: %w", err)
+		}
+		return c.waitPong()
+	}
+
+	c.replies++
+	reply := fmt.Sprintf("%s.%d", c.inbox, c.replies)
+	msg := fmt.Sprintf("PUB %s %s %d\r\n%s\r\n", subject, reply, len(payload), payload)
+	if _, err := io.WriteString(c.conn, msg); err != nil {
+		return fmt.Errorf("failed to send NATS publish: %w", err)
+	}
+
+	for {
+		subject, data, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if subject != reply {
+			continue
+		}
+		var ack natsPubAck
+		if err := json.Unmarshal(data, &ack); err != nil {
+			return fmt.Errorf("invalid JetStream acknowledgement %q: %w", data, err)
+		}
+		if ack.Error != nil {
+			err := fmt.Errorf("JetStream publish failed: %s (code %d)", ack.Error.Description, ack.Error.Code)
+			// 4xx codes reject the message itself, like one exceeding the maximum size of the stream
+			if ack.Error.Code >= 400 && ack.Error.Code < 500 {
+				return &busRejectedError{err: err}
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// waitPong reads until the PONG answering a PING
+func (c *natsClient) waitPong() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "PONG" {
+			return nil
+		}
+		if strings.HasPrefix(line, "MSG ") {
+			// A late JetStream acknowledgement, skip its payload
+			if _, err := c.readPayload(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readMessage reads until the next MSG, returning its subject and payload
+func (c *natsClient) readMessage() (string, []byte, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", nil, err
+		}
+		if !strings.HasPrefix(line, "MSG ") {
+			continue
+		}
+		data, err := c.readPayload(line)
+		if err != nil {
+			return "", nil, err
+		}
+		return strings.Fields(line)[1], data, nil
+	}
+}
+
+// readPayload reads the payload of a "MSG <subject> <sid> [reply] <size>" line
+func (c *natsClient) readPayload(line string) ([]byte, error) {
+	fields := strings.Fields(line)
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed NATS message %q", line)
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return nil, fmt.Errorf("failed to read NATS message: %w", err)
+	}
+	return data[:size], nil
+}
+
+// readLine reads a protocol line, answering server PINGs and returning server errors
+func (c *natsClient) readLine() (string, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read from NATS: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(c.conn, "PONG\r\n"); err != nil {
+				return "", fmt.Errorf("failed to answer NATS ping: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			err := fmt.Errorf("NATS error: %s", strings.Trim(strings.TrimSpace(line[4:]), "'"))
+			if strings.Contains(line, "Permissions Violation for Publish") || strings.Contains(line, "Maximum Payload Violation") {
+				return "", &busRejectedError{err: err}
+			}
+			return "", err
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+		default:
+			return line, nil
+		}
+	}
+}
+
+// close closes the connection to the server
+func (c *natsClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.reader = nil, nil
+	}
+}
+
+// natsNUID returns a random token for inbox subjects
+func natsNUID() string {
+	b := make([]byte, 11)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// natsServer is a stub server denying publishes to subjects starting with "denied", counting the publishes
+func natsServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var published atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, "INFO {\"max_payload\":1048576}\r\n")
+				reader := bufio.NewReader(conn)
+				denied := false
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 0:
+					case fields[0] == "PUB":
+						published.Add(1)
+						var size int
+						fmt.Sscan(fields[len(fields)-1], &size)
+						io.ReadFull(reader, make([]byte, size+2))
+						denied = strings.HasPrefix(fields[1], "denied")
+					case fields[0] == "PING":
+						if denied {
+							io.WriteString(conn, "-ERR 'Permissions Violation for Publish to \"denied\"'\r\n")
+						}
+						io.WriteString(conn, "PONG\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return "nats://" + listener.Addr().String(), &published
+}
+
+func TestNATSPublishRejected(t *testing.T) {
+	url, published := natsServer(t)
+	client := newNATSClient(NATSConfig{URL: url}, 5*time.Second)
+
+	if err := client.Publish("alerts", nil, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	err := client.Publish("denied", nil, []byte(`{}`))
+	var rejected *busRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("Publish() = %v, want a rejected message", err)
+	}
+	if got := published.Load(); got != 2 {
+		t.Errorf("published %d times, want no retry of the rejected message", got)
+	}
+
+	// The next message is published on a new connection
+	if err := client.Publish("alerts", nil, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+}
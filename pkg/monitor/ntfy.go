@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NtfyConfig holds ntfy configuration
+type NtfyConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	ServerURL  string         `yaml:"server_url,omitempty"` // ntfy server (default https://ntfy.sh)
+	Topic      string         `yaml:"topic"`                // Topics, comma separated
+	Token      string         `yaml:"token,omitempty"`      // Access token
+	Username   string         `yaml:"username,omitempty"`   // Basic auth, when no token is set
+	Password   string         `yaml:"password,omitempty"`
+	Tags       []string       `yaml:"tags,omitempty"`       // Added to every message, emoji shortcodes are shown as icons
+	Priorities map[string]int `yaml:"priorities,omitempty"` // Priority (1-5) per severity
+	ClickURL   string         `yaml:"click_url,omitempty"`  // Opened when the notification is tapped
+	Interval   time.Duration  `yaml:"interval"`
+}
+
+// NtfyMessage represents an ntfy message published as JSON
+type NtfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+}
+
+// ntfySeverityTags are the emoji tags shown with a message per severity
+var ntfySeverityTags = map[string]string{
+	"critical": "rotating_light",
+	"error":    "x",
+	"warning":  "warning",
+	"info":     "information_source",
+}
+
+// sendNtfyAlert publishes an alert to the ntfy topics of a rule
+func (m *MonitorInstance) sendNtfyAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	config := m.monitor.config.Alerts.Ntfy
+	topics, err := m.monitor.channelRecipients(rule, "ntfy", []string{config.Topic})
+	if err != nil {
+		m.monitor.logger.Printf("ntfy alert failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve ntfy topic for query %s: %w", queryName, err))
+	}
+	if len(topics) == 0 {
+		return deliveryResult(n, fmt.Errorf("no ntfy topic for query %s", queryName))
+	}
+
+	var tags []string
+	for _, tag := range append([]string{ntfySeverityTags[alertSeverity(rule)], rule.Category, m.dbConfig.Instance}, config.Tags...) {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return deliveryResult(n, n.sendToTargets(topics, func(topic string) error {
+		msg := NtfyMessage{
+			Topic:    topic,
+			Title:    pushTitle(m.dbConfig.Instance, queryName),
+			Message:  pushBody(event),
+			Priority: pushPriority(rule, config.Priorities, ntfyPriorities),
+			Tags:     tags,
+			Click:    config.ClickURL,
+		}
+		return m.postNtfyMessage(queryName, msg)
+	}))
+}
+
+// postNtfyMessage publishes a message to the ntfy server
+func (m *MonitorInstance) postNtfyMessage(queryName string, msg NtfyMessage) error {
+	config := m.monitor.config.Alerts.Ntfy
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling ntfy message: %v", err)
+		return fmt.Errorf("failed to marshal ntfy message: %w", err)
+	}
+
+	// Messages published as JSON go to the server root, the topic is part of the body
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(config.ServerURL, "/")+"/", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error creating ntfy request: %v", err)
+		return fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	} else if config.Username != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending ntfy alert: %v", err)
+		return fmt.Errorf("failed to send ntfy alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("ntfy alert sent successfully for query: %s to topic %s", queryName, msg.Topic)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("ntfy alert failed with status code: %d (%s) for query: %s to topic %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName, msg.Topic)
+		return newHTTPStatusError(resp, respBody, "ntfy alert failed with status code: %d for query: %s to topic %s", resp.StatusCode, queryName, msg.Topic)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// onCallPrefix marks a recipient resolved through an on-call schedule, e.g. "oncall:dba"
+const onCallPrefix = "oncall:"
+
+// OnCallSchedule defines a weekly rotation of members with optional overrides
+type OnCallSchedule struct {
+	Timezone  string           `yaml:"timezone,omitempty"`  // Timezone of start and overrides (default: system time zone)
+	Start     string           `yaml:"start"`               // First handoff in "YYYY-MM-DD HH:MM" format
+	Weeks     int              `yaml:"weeks,omitempty"`     // Length of a shift in weeks (default 1)
+	Members   []OnCallMember   `yaml:"members"`             // Members in rotation order
+	Overrides []OnCallOverride `yaml:"overrides,omitempty"` // Temporary replacements of the member on call
+}
+
+// OnCallMember is a person in an on-call rotation
+type OnCallMember struct {
+	Name     string `yaml:"name"`
+	Email    string `yaml:"email,omitempty"`
+	Phone    string `yaml:"phone,omitempty"`    // International format, used for WhatsApp
+	Telegram string `yaml:"telegram,omitempty"` // Telegram handle, mentioned in Telegram alerts
+	Ntfy     string `yaml:"ntfy,omitempty"`     // Personal ntfy topic
+	Pushover string `yaml:"pushover,omitempty"` // Pushover user key
+	Matrix   string `yaml:"matrix,omitempty"`   // Matrix room, e.g. a direct message room with the member
+}
+
+// OnCallOverride puts a member on call for a period instead of the rotation
+type OnCallOverride struct {
+	Start  string `yaml:"start"`  // Start in "YYYY-MM-DD HH:MM" format
+	End    string `yaml:"end"`    // End in "YYYY-MM-DD HH:MM" format
+	Member string `yaml:"member"` // Name of the member on call
+}
+
+// isOnCall checks if a recipient refers to an on-call schedule
+func isOnCall(to string) bool {
+	return strings.HasPrefix(to, onCallPrefix)
+}
+
+// location returns the time zone of a schedule
+func (s OnCallSchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s': %w", s.Timezone, err)
+	}
+	return loc, nil
+}
+
+// member returns the member with the given name
+func (s OnCallSchedule) member(name string) (OnCallMember, bool) {
+	for _, member := range s.Members {
+		if strings.EqualFold(member.Name, name) {
+			return member, true
+		}
+	}
+	return OnCallMember{}, false
+}
+
+// OnCallAt returns the member on call at the given time.
+// Overrides take precedence; before the first handoff the first member is on call.
+func (s OnCallSchedule) OnCallAt(now time.Time) (OnCallMember, error) {
+	if len(s.Members) == 0 {
+		return OnCallMember{}, fmt.Errorf("schedule has no members")
+	}
+
+	loc, err := s.location()
+	if err != nil {
+		return OnCallMember{}, err
+	}
+	now = now.In(loc)
+
+	for _, override := range s.Overrides {
+		start, err := time.ParseInLocation("2006-01-02 15:04", override.Start, loc)
+		if err != nil {
+			return OnCallMember{}, fmt.Errorf("invalid override start '%s', expected YYYY-MM-DD HH:MM: %w", override.Start, err)
+		}
+		end, err := time.ParseInLocation("2006-01-02 15:04", override.End, loc)
+		if err != nil {
+			return OnCallMember{}, fmt.Errorf("invalid override end '%s', expected YYYY-MM-DD HH:MM: %w", override.End, err)
+		}
+		if !now.Before(start) && now.Before(end) {
+			member, exists := s.member(override.Member)
+			if !exists {
+				return OnCallMember{}, fmt.Errorf("override member %s is not a member of the schedule", override.Member)
+			}
+			return member, nil
+		}
+	}
+
+	handoff, err := time.ParseInLocation("2006-01-02 15:04", s.Start, loc)
+	if err != nil {
+		return OnCallMember{}, fmt.Errorf("invalid start '%s', expected YYYY-MM-DD HH:MM: %w", s.Start, err)
+	}
+	weeks := s.Weeks
+	if weeks <= 0 {
+		weeks = 1
+	}
+
+	// Step through the handoffs by calendar days, so handoffs keep their wall clock time across DST changes
+	shift := 0
+	for next := handoff.AddDate(0, 0, 7*weeks); !now.Before(next); next = next.AddDate(0, 0, 7*weeks) {
+		shift++
+	}
+	return s.Members[shift%len(s.Members)], nil
+}
+
+// resolveRecipient resolves an "oncall:<schedule>" recipient to the contact of the member on call
+// for a channel: the email address for email, the phone number for WhatsApp, the handle for Telegram,
+// the user for Opsgenie and the name with email address elsewhere. Other recipients are returned unchanged.
+func (m *Monitor) resolveRecipient(to, channel string) (string, error) {
+	if !isOnCall(to) {
+		return to, nil
+	}
+
+	name := strings.TrimPrefix(to, onCallPrefix)
+	schedule, exists := m.config.OnCall[name]
+	if !exists {
+		return "", fmt.Errorf("unknown on-call schedule %s", name)
+	}
+	member, err := schedule.OnCallAt(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("on-call schedule %s: %w", name, err)
+	}
+
+	var contact string
+	switch channel {
+	case "email":
+		contact = member.Email
+	case "whatsapp", "sms", "voice":
+		contact = member.Phone
+	case "telegram":
+		contact = member.Telegram
+		if contact != "" && !strings.HasPrefix(contact, "@") {
+			contact = "@" + contact
+		}
+	case "ntfy":
+		contact = member.Ntfy
+	case "pushover":
+		contact = member.Pushover
+	case "matrix":
+		contact = member.Matrix
+	case "opsgenie":
+		if member.Email != "" {
+			contact = "user:" + member.Email
+		}
+	default:
+		contact = member.Name
+		if member.Email != "" {
+			contact = fmt.Sprintf("%s <%s>", member.Name, member.Email)
+		}
+	}
+	if contact == "" {
+		return "", fmt.Errorf("on-call member %s of schedule %s has no %s contact", member.Name, name, channel)
+	}
+	return contact, nil
+}
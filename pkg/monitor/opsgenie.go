@@ -0,0 +1,208 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const opsgenieAPIURL = "https://api.opsgenie.com"
+
+var opsgeniePriorityPattern = regexp.MustCompile(`^P[1-5]$`)
+
+// OpsgenieConfig holds Opsgenie Alert API configuration
+type OpsgenieConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	APIKey   string        `yaml:"api_key"`           // API key of an API integration
+	APIURL   string        `yaml:"api_url,omitempty"` // Defaults to https://api.opsgenie.com (use https://api.eu.opsgenie.com for EU accounts)
+	Tags     []string      `yaml:"tags,omitempty"`    // Tags added to every alert
+	Interval time.Duration `yaml:"interval"`
+}
+
+// OpsgenieAlert represents an Opsgenie create alert request
+type OpsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description,omitempty"`
+	Responders  []OpsgenieResponder `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Entity      string              `json:"entity,omitempty"`
+	Source      string              `json:"source,omitempty"`
+	Priority    string              `json:"priority,omitempty"`
+	Note        string              `json:"note,omitempty"`
+}
+
+// OpsgenieResponder represents a team, user, escalation or schedule that is notified
+type OpsgenieResponder struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// OpsgenieNote represents the body of the add note and close alert requests
+type OpsgenieNote struct {
+	Source string `json:"source,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// sendOpsgenieAlert creates an Opsgenie alert, or adds a note to it when the alert is already open
+func (m *MonitorInstance) sendOpsgenieAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	alias := m.alertKey(queryName, rule)
+
+	if n.Repeat {
+		note := OpsgenieNote{
+			Source: "postgres-stat-alert",
+			Note:   fmt.Sprintf("Still firing at %s: %s (%s)", time.Now().Format("2006-01-02 15:04:05"), rule.Message, event.Comparison()),
+		}
+		return deliveryResult(n, m.postOpsgenie(queryName, "add note", fmt.Sprintf("/v2/alerts/%s/notes?identifierType=alias", url.PathEscape(alias)), note))
+	}
+
+	details := map[string]string{
+		"instance":  m.dbConfig.Instance,
+		"query":     queryName,
+		"category":  rule.Category,
+		"condition": rule.Condition,
+		"threshold": fmt.Sprintf("%v", rule.Value),
+		"value":     event.Comparison(),
+	}
+	if event.Observed != nil {
+		details["observed"] = fmt.Sprintf("%v", event.Observed)
+	}
+	for column, value := range event.Row {
+		details[column] = fmt.Sprintf("%v", value)
+	}
+
+	tags := m.monitor.config.Alerts.Opsgenie.Tags
+	if rule.Category != "" {
+		tags = append([]string{rule.Category}, tags...)
+	}
+
+	// Opsgenie limits the message to 130 characters
+	message := truncateText(fmt.Sprintf("[%s] %s: %s", m.dbConfig.Instance, queryName, rule.Message), 130)
+
+	alert := OpsgenieAlert{
+		Message:     message,
+		Alias:       alias,
+		Description: fmt.Sprintf("%s\n\n%s", rule.Message, rule.ResolutionNote),
+		Responders:  opsgenieResponders(m.monitor.displayRecipients(rule, "opsgenie")),
+		Tags:        tags,
+		Details:     details,
+		Entity:      m.dbConfig.Instance,
+		Source:      "postgres-stat-alert",
+		Priority:    opsgeniePriority(rule),
+	}
+
+	return deliveryResult(n, m.postOpsgenie(queryName, "create", "/v2/alerts", alert))
+}
+
+// sendOpsgenieClose closes the Opsgenie alert of a cleared alert
+func (m *MonitorInstance) sendOpsgenieClose(n *Notification) DeliveryResult {
+	queryName, rule := n.Query, n.Rule
+	note := OpsgenieNote{
+		Source: "postgres-stat-alert",
+		Note:   fmt.Sprintf("Condition cleared at %s", time.Now().Format("2006-01-02 15:04:05")),
+	}
+	alias := m.alertKey(queryName, rule)
+
+	return deliveryResult(n, m.postOpsgenie(queryName, "close", fmt.Sprintf("/v2/alerts/%s/close?identifierType=alias", url.PathEscape(alias)), note))
+}
+
+// postOpsgenie posts a request to the Opsgenie Alert API
+func (m *MonitorInstance) postOpsgenie(queryName, action, path string, body interface{}) error {
+	config := m.monitor.config.Alerts.Opsgenie
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Opsgenie %s request: %v", action, err)
+		return fmt.Errorf("failed to marshal Opsgenie %s request: %w", action, err)
+	}
+
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = opsgenieAPIURL
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(apiURL, "/")+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error creating Opsgenie %s request: %v", action, err)
+		return fmt.Errorf("failed to create Opsgenie %s request: %w", action, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+config.APIKey)
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Opsgenie %s request: %v", action, err)
+		return fmt.Errorf("failed to send Opsgenie %s request: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("Opsgenie %s request sent successfully for query: %s", action, queryName)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Opsgenie %s request failed with status code: %d (%s) for query: %s", action, resp.StatusCode, string(respBody), queryName)
+		return newHTTPStatusError(resp, respBody, "Opsgenie %s request failed with status code: %d (%s) for query: %s", action, resp.StatusCode, string(respBody), queryName)
+	}
+
+	return nil
+}
+
+// opsgeniePriority maps a rule to an Opsgenie priority.
+// A category of "P1" to "P5" is used as is, otherwise the priority follows the severity.
+func opsgeniePriority(rule AlertRule) string {
+	if category := strings.ToUpper(rule.Category); opsgeniePriorityPattern.MatchString(category) {
+		return category
+	}
+
+	switch alertSeverity(rule) {
+	case "critical":
+		return "P1"
+	case "error":
+		return "P2"
+	case "warning":
+		return "P3"
+	}
+	return "P4"
+}
+
+// opsgenieResponders parses the responders from a rule recipient.
+// Entries are comma separated and may be prefixed with their type, e.g. "team:dba, user:jane@company.com".
+// Entries without a type are users when they contain an @, otherwise teams.
+func opsgenieResponders(to string) []OpsgenieResponder {
+	var responders []OpsgenieResponder
+	for _, entry := range strings.Split(to, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, name, found := strings.Cut(entry, ":")
+		if !found {
+			kind, name = "team", entry
+			if strings.Contains(entry, "@") {
+				kind = "user"
+			}
+		}
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		name = strings.TrimSpace(name)
+
+		switch kind {
+		case "user":
+			responders = append(responders, OpsgenieResponder{Type: "user", Username: name})
+		case "team", "escalation", "schedule":
+			responders = append(responders, OpsgenieResponder{Type: kind, Name: name})
+		}
+	}
+	return responders
+}
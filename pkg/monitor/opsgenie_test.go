@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// opsgenieTestInstance returns an instance sending to an Opsgenie stub server
+func opsgenieTestInstance(t *testing.T) (*MonitorInstance, func() []recordedRequest) {
+	server, requests := recordingServer(t, http.StatusAccepted, `{"result": "Request will be processed"}`)
+	return newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  opsgenie:
+    enabled: true
+    api_key: "key"
+    api_url: %q
+    tags: ["postgres"]
+`, server.URL))), requests
+}
+
+func TestOpsgenieCreateNoteAndClose(t *testing.T) {
+	instance, requests := opsgenieTestInstance(t)
+	event := testEvent()
+	event.Rule.To = "team:dba, jane@example.com"
+	event.Rule.Severity = "critical"
+	key := instance.alertKey(event.Query, event.Rule)
+
+	if result := instance.sendOpsgenieAlert(instance.newNotification("opsgenie", event)); result.Status != DeliverySent {
+		t.Fatalf("sendOpsgenieAlert() = %+v", result)
+	}
+	instance.alertTracker.OpenIncident(key, "opsgenie")
+	repeat := instance.newNotification("opsgenie", event)
+	if !repeat.Repeat {
+		t.Fatal("notification of an open incident is not a repeat")
+	}
+	if result := instance.sendOpsgenieAlert(repeat); result.Status != DeliverySent {
+		t.Fatalf("sendOpsgenieAlert() repeat = %+v", result)
+	}
+	if result := instance.sendOpsgenieClose(instance.newNotification("opsgenie", event)); result.Status != DeliverySent {
+		t.Fatalf("sendOpsgenieClose() = %+v", result)
+	}
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("got %d requests, want create, note and close", len(got))
+	}
+	for _, r := range got {
+		if r.Header.Get("Authorization") != "GenieKey key" {
+			t.Errorf("%s Authorization = %q", r.Path, r.Header.Get("Authorization"))
+		}
+	}
+
+	var alert OpsgenieAlert
+	if err := json.Unmarshal(got[0].Body, &alert); err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Path != "/v2/alerts" || alert.Alias != key || alert.Priority != "P1" || alert.Message != "[test] connections: Too many connections" {
+		t.Errorf("create %s = %+v, want a P1 alert aliased %s", got[0].Path, alert, key)
+	}
+	if len(alert.Responders) != 2 || alert.Responders[0] != (OpsgenieResponder{Type: "team", Name: "dba"}) || alert.Responders[1] != (OpsgenieResponder{Type: "user", Username: "jane@example.com"}) {
+		t.Errorf("responders = %+v, want the team and the user of the rule", alert.Responders)
+	}
+	if strings.Join(alert.Tags, ",") != "performance,postgres" || alert.Details["count"] != "143" {
+		t.Errorf("tags %v details %v, want the category tag and the row values", alert.Tags, alert.Details)
+	}
+
+	aliasPath := "/v2/alerts/test%2Fconnections%2Ftoo_many"
+	for _, r := range got[1:] {
+		if r.Query != "identifierType=alias" {
+			t.Errorf("%s query = %q, want the alias identifier type", r.Path, r.Query)
+		}
+	}
+	var note OpsgenieNote
+	json.Unmarshal(got[1].Body, &note)
+	if got[1].Path != aliasPath+"/notes" || !strings.HasPrefix(note.Note, "Still firing") {
+		t.Errorf("repeat %s = %+v, want a note on the alias", got[1].Path, note)
+	}
+	json.Unmarshal(got[2].Body, &note)
+	if got[2].Path != aliasPath+"/close" || !strings.HasPrefix(note.Note, "Condition cleared") {
+		t.Errorf("close %s = %+v, want a close of the alias", got[2].Path, note)
+	}
+}
+
+func TestOpsgeniePriority(t *testing.T) {
+	tests := []struct {
+		rule AlertRule
+		want string
+	}{
+		{AlertRule{Category: "p2"}, "P2"},
+		{AlertRule{Category: "critical"}, "P1"},
+		{AlertRule{Category: "performance"}, "P3"},
+		{AlertRule{Category: "performance", Severity: "error"}, "P2"},
+		{AlertRule{Category: "maintenance"}, "P4"},
+	}
+
+	for _, tt := range tests {
+		if got := opsgeniePriority(tt.rule); got != tt.want {
+			t.Errorf("opsgeniePriority(%+v) = %s, want %s", tt.rule, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeliveryConfig holds the retry and outbox settings for alert delivery
+type DeliveryConfig struct {
+	OutboxDir       string        `yaml:"outbox_dir,omitempty"`       // Directory persisting undelivered alerts (default outbox)
+	MaxAttempts     int           `yaml:"max_attempts,omitempty"`     // Attempts before a delivery fails permanently (default 5)
+	InitialBackoff  time.Duration `yaml:"initial_backoff,omitempty"`  // Delay before the first retry (default 10s)
+	MaxBackoff      time.Duration `yaml:"max_backoff,omitempty"`      // Upper bound of the delay between retries (default 10m)
+	FallbackChannel string        `yaml:"fallback_channel,omitempty"` // Channel receiving a meta-alert when a delivery fails permanently
+	QueueSize       int           `yaml:"queue_size,omitempty"`       // Pending alerts per channel before new ones are dropped (default 100)
+	Workers         int           `yaml:"workers,omitempty"`          // Concurrent deliveries per channel (default 1)
+	SendTimeout     time.Duration `yaml:"send_timeout,omitempty"`     // Timeout of a single delivery attempt (default 30s)
+	StatsInterval   time.Duration `yaml:"stats_interval,omitempty"`   // Interval for logging queue statistics (default 15m)
+}
+
+// httpStatusError is returned by channels when the endpoint answers with a non-2xx status code
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+	msg        string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.msg
+}
+
+// newHTTPStatusError creates an error for a non-2xx response, honouring its Retry-After header
+func newHTTPStatusError(resp *http.Response, body []byte, format string, args ...interface{}) *httpStatusError {
+	return &httpStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       string(body),
+		msg:        fmt.Sprintf(format, args...),
+	}
+}
+
+// permanentError is a failure that a retry cannot fix, like a body template that does not render
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// targetError is the failure of a notification to one of the targets of its channel
+type targetError struct {
+	target string
+	err    error
+}
+
+// targetErrors is returned by channels with several targets when sending to some of them fails
+type targetErrors []targetError
+
+func (e targetErrors) Error() string {
+	return errors.Join(e.Unwrap()...).Error()
+}
+
+func (e targetErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, failed := range e {
+		errs = append(errs, failed.err)
+	}
+	return errs
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// classifyDeliveryError reports how long to wait before retrying a failed delivery and whether it failed permanently
+func classifyDeliveryError(err error) (time.Duration, bool) {
+	// Failed targets are retried unless every one of them failed permanently
+	var failed targetErrors
+	if errors.As(err, &failed) {
+		var retryAfter time.Duration
+		permanent := true
+		for _, target := range failed {
+			targetRetryAfter, targetPermanent := classifyDeliveryError(target.err)
+			retryAfter = max(retryAfter, targetRetryAfter)
+			permanent = permanent && targetPermanent
+		}
+		return retryAfter, permanent
+	}
+
+	var permanentErr *permanentError
+	if errors.As(err, &permanentErr) {
+		return 0, true
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusRequestTimeout, statusErr.StatusCode == http.StatusTooManyRequests:
+			return statusErr.RetryAfter, false
+		case statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+			return 0, true
+		}
+		return statusErr.RetryAfter, false
+	}
+
+	// SMTP replies: 4xx are transient, 5xx are permanent
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return 0, smtpErr.Code >= 500
+	}
+
+	return 0, false
+}
+
+// Notification is a single alert delivery to one channel.
+// Undelivered notifications are kept in the outbox and retried.
+type Notification struct {
+	ID          string                    `json:"id"`
+	Channel     string                    `json:"channel"`
+	Instance    string                    `json:"instance"`
+	Database    string                    `json:"database"`
+	Query       string                    `json:"query"`
+	Rule        AlertRule                 `json:"rule"`
+	Row         map[string]interface{}    `json:"row,omitempty"`
+	Columns     []string                  `json:"columns,omitempty"`  // Columns of Row in the order of the query
+	Observed    interface{}               `json:"observed,omitempty"` // Value the query returned when the alert fired
+	Since       time.Time                 `json:"since"`              // Time the alert started firing
+	Repeat      bool                      `json:"repeat,omitempty"`   // The alert was already delivered to the channel while firing
+	Resolved    bool                      `json:"resolved,omitempty"` // The notification resolves the alert
+	Batch       []*Notification           `json:"batch,omitempty"`    // Alerts grouped into this notification
+	CreatedAt   time.Time                 `json:"created_at"`
+	Attempts    int                       `json:"attempts"`
+	NextAttempt time.Time                 `json:"next_attempt"`
+	LastError   string                    `json:"last_error,omitempty"`
+	Targets     map[string]DeliveryStatus `json:"targets,omitempty"` // Targets that received the notification or failed permanently
+	version     int                       // Outbox version the notification was copied from
+}
+
+// notificationID returns the outbox identifier of the notifications of an alert on a channel
+func notificationID(alertKey, channel string) string {
+	sum := sha256.Sum256([]byte(alertKey + "|" + channel))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Outbox holds the notifications from the moment they are queued until they are delivered or fail permanently,
+// optionally persisted to disk so queued and in-flight alerts survive a restart.
+// Deliveries work on copies handed out by Claim and Due, the stored notifications are only changed under the lock.
+type Outbox struct {
+	dir     string
+	pending map[string]*outboxEntry
+	mu      sync.Mutex
+}
+
+// outboxEntry is a pending notification with its delivery state
+type outboxEntry struct {
+	n        *Notification
+	version  int  // Incremented whenever a newer alert replaces the notification
+	inFlight bool // A copy is queued for or being delivered
+}
+
+// NewOutbox creates an outbox and loads the notifications persisted in dir
+func NewOutbox(dir string) (*Outbox, error) {
+	outbox := &Outbox{
+		dir:     dir,
+		pending: make(map[string]*outboxEntry),
+	}
+	if dir == "" {
+		return outbox, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox directory: %w", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read outbox entry %s: %w", file, err)
+		}
+		var n Notification
+		if err := json.Unmarshal(data, &n); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox entry %s: %w", file, err)
+		}
+		outbox.pending[n.ID] = &outboxEntry{n: &n}
+	}
+
+	return outbox, nil
+}
+
+// Len returns the number of pending notifications
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending)
+}
+
+// Pending returns a copy of the pending notification with the given id, if any
+func (o *Outbox) Pending(id string) (*Notification, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.pending[id]
+	if !exists {
+		return nil, false
+	}
+	return entry.copy(), true
+}
+
+// Add stores a new notification. When a notification for the same alert and channel is pending, the new one
+// replaces it and keeps its retry schedule. It returns a copy to deliver, or nil when the pending notification
+// waits for a retry or is being delivered; the replacement then goes out with its next attempt.
+func (o *Outbox) Add(n *Notification) (*Notification, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.pending[n.ID]
+	if !exists {
+		entry = &outboxEntry{n: n, inFlight: true}
+		o.pending[n.ID] = entry
+		return entry.copy(), o.write(n)
+	}
+
+	n.Attempts = entry.n.Attempts
+	n.NextAttempt = entry.n.NextAttempt
+	n.LastError = entry.n.LastError
+	entry.n = n
+	entry.version++
+	return nil, o.write(n)
+}
+
+// Due claims the notifications whose next attempt is due and that are not being delivered. It returns copies
+// ordered by channel and creation time.
+func (o *Outbox) Due(now time.Time) []*Notification {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var due []*Notification
+	for _, entry := range o.pending {
+		if !entry.inFlight && !entry.n.NextAttempt.After(now) {
+			entry.inFlight = true
+			due = append(due, entry.copy())
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Channel != due[j].Channel {
+			return due[i].Channel < due[j].Channel
+		}
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	return due
+}
+
+// Complete removes a notification that was delivered or failed permanently. When a newer alert replaced it in
+// the meantime, the replacement stays pending.
+func (o *Outbox) Complete(n *Notification) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.pending[n.ID]
+	if !exists {
+		return nil
+	}
+	if entry.version != n.version {
+		entry.inFlight = false
+		return nil
+	}
+	delete(o.pending, n.ID)
+	if o.dir == "" {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(o.dir, n.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove outbox entry: %w", err)
+	}
+	return nil
+}
+
+// Retry stores the retry schedule of a failed attempt. When a newer alert replaced the notification in the
+// meantime, the replacement takes over the schedule.
+func (o *Outbox) Retry(n *Notification) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.pending[n.ID]
+	if !exists {
+		return nil
+	}
+	if entry.version == n.version {
+		entry.n = n
+	} else {
+		entry.n.Attempts = n.Attempts
+		entry.n.NextAttempt = n.NextAttempt
+		entry.n.LastError = n.LastError
+	}
+	entry.inFlight = false
+	return o.write(entry.n)
+}
+
+// copy returns a copy of the entry's notification for delivery
+func (e *outboxEntry) copy() *Notification {
+	n := *e.n
+	n.Targets = maps.Clone(e.n.Targets)
+	n.version = e.version
+	return &n
+}
+
+// write persists a notification, o.mu must be held
+func (o *Outbox) write(n *Notification) error {
+	if o.dir == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial entry
+	path := filepath.Join(o.dir, n.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	return nil
+}
+
+// retryBackoff returns the delay before the next attempt, doubling with every attempt
+func (c DeliveryConfig) retryBackoff(attempts int, retryAfter time.Duration) time.Duration {
+	backoff := c.InitialBackoff
+	for i := 1; i < attempts && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.MaxBackoff {
+		backoff = c.MaxBackoff
+	}
+	if retryAfter > backoff {
+		backoff = retryAfter
+	}
+	return backoff
+}
+
+// processOutbox dispatches the pending notifications as they become due, through the channel queues so a
+// slow channel does not hold up the retries of the others
+func (m *Monitor) processOutbox() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, n := range m.outbox.Due(time.Now()) {
+			instance := m.instanceFor(n.Instance, n.Database)
+			if instance == nil {
+				m.logger.Printf("Dropping outbox entry %s for unknown instance %s (%s)", n.ID, n.Instance, n.Database)
+				m.outbox.Complete(n)
+				continue
+			}
+			instance.dispatch(n)
+		}
+	}
+}
+
+// instanceFor returns the monitored instance with the given instance and database name
+func (m *Monitor) instanceFor(instanceName, database string) *MonitorInstance {
+	for _, instance := range m.instances {
+		if instance.dbConfig.Instance == instanceName && instance.dbConfig.Database == database {
+			return instance
+		}
+	}
+	return nil
+}
+
+// newNotification creates a notification of an alert for a channel
+func (m *MonitorInstance) newNotification(channel string, event AlertEvent) *Notification {
+	key := m.alertKey(event.Query, event.Rule)
+	since, _ := m.alertTracker.FiringSince(key)
+	now := time.Now()
+
+	return &Notification{
+		ID:          notificationID(key, channel),
+		Channel:     channel,
+		Instance:    m.dbConfig.Instance,
+		Database:    m.dbConfig.Database,
+		Query:       event.Query,
+		Rule:        event.Rule,
+		Row:         event.Row,
+		Columns:     event.Columns,
+		Observed:    event.Observed,
+		Since:       since,
+		Repeat:      m.alertTracker.IncidentOpen(key, channel),
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+}
+
+// enqueue stores a new notification in the outbox and dispatches it for delivery, unless a notification for the
+// same alert and channel is waiting for a retry. In that case the pending one is replaced and keeps its retry schedule.
+func (m *MonitorInstance) enqueue(n *Notification) {
+	dispatch, err := m.monitor.outbox.Add(n)
+	if err != nil {
+		m.monitor.logger.Printf("Error saving outbox entry for %s alert of query %s: %v", n.Channel, n.Query, err)
+	}
+	if dispatch == nil {
+		m.monitor.logger.Printf("%s alert for query %s queued behind pending retry (attempt %d)", n.Channel, n.Query, n.Attempts+1)
+		return
+	}
+
+	m.dispatch(dispatch)
+}
+
+// dispatch hands a notification claimed from the outbox to the queue of its channel. When the queue is full,
+// the notification stays in the outbox and is dispatched again after the initial backoff.
+func (m *MonitorInstance) dispatch(n *Notification) {
+	if m.monitor.dispatcher.Dispatch(m, n) {
+		return
+	}
+
+	n.NextAttempt = time.Now().Add(m.monitor.config.Alerts.Delivery.InitialBackoff)
+	if err := m.monitor.outbox.Retry(n); err != nil {
+		m.monitor.logger.Printf("Error saving outbox entry for %s alert of query %s: %v", n.Channel, n.Query, err)
+	}
+	m.monitor.logger.Printf("%s alert for query %s kept in the outbox, dispatching again at %s", n.Channel, n.Query, n.NextAttempt.Format(time.RFC3339))
+}
+
+// deliver attempts to send a notification copied from the outbox and schedules a retry when the attempt fails
+func (m *MonitorInstance) deliver(n *Notification) {
+	result := m.sendNotification(n)
+	m.monitor.deliveries.Record(result)
+
+	switch result.Status {
+	case DeliverySent:
+		if !n.Resolved {
+			for _, alert := range n.alerts() {
+				if instance := m.monitor.instanceFor(alert.Instance, alert.Database); instance != nil {
+					instance.alertTracker.RecordAlert(alert.Query, alert.Channel)
+					instance.alertTracker.OpenIncident(instance.alertKey(alert.Query, alert.Rule), alert.Channel)
+				}
+			}
+		}
+		m.completeDelivery(n)
+		if n.Attempts > 0 {
+			m.monitor.logger.Printf("%s alert for query %s delivered after %d retries", n.Channel, n.Query, n.Attempts)
+		}
+		return
+
+	case DeliverySkippedRateLimit:
+		// Not a failure, a newer alert was delivered in the meantime
+		m.completeDelivery(n)
+		return
+
+	case DeliverySkippedDisabled:
+		m.monitor.logger.Printf("%s alert for query %s skipped, the channel is not enabled", n.Channel, n.Query)
+		m.completeDelivery(n)
+		return
+	}
+
+	m.failDelivery(n, result)
+}
+
+// failDelivery schedules the retry of a failed attempt, or gives up when it failed permanently or too often
+func (m *MonitorInstance) failDelivery(n *Notification, result DeliveryResult) {
+	config := m.monitor.config.Alerts.Delivery
+	n.Attempts++
+	n.LastError = result.Error
+
+	if result.Permanent || n.Attempts >= config.MaxAttempts {
+		m.monitor.logger.Printf("%s alert for query %s failed permanently after %d attempts: %v", n.Channel, n.Query, n.Attempts, result.Err)
+		m.completeDelivery(n)
+		m.sendDeliveryFailure(n)
+		return
+	}
+
+	n.NextAttempt = time.Now().Add(config.retryBackoff(n.Attempts, result.RetryAfter))
+	if err := m.monitor.outbox.Retry(n); err != nil {
+		m.monitor.logger.Printf("Error saving outbox entry for %s alert of query %s: %v", n.Channel, n.Query, err)
+	}
+	m.monitor.logger.Printf("%s alert for query %s failed (attempt %d/%d), retrying at %s", n.Channel, n.Query, n.Attempts, config.MaxAttempts, n.NextAttempt.Format(time.RFC3339))
+}
+
+// completeDelivery removes a notification that needs no further attempts from the outbox
+func (m *MonitorInstance) completeDelivery(n *Notification) {
+	if err := m.monitor.outbox.Complete(n); err != nil {
+		m.monitor.logger.Printf("Error removing outbox entry for %s alert of query %s: %v", n.Channel, n.Query, err)
+	}
+}
+
+// sendDeliveryFailure raises a meta-alert through the fallback channel for a notification that could not be delivered
+func (m *MonitorInstance) sendDeliveryFailure(failed *Notification) {
+	fallback := strings.ToLower(m.monitor.config.Alerts.Delivery.FallbackChannel)
+	if fallback == "" || fallback == failed.Channel {
+		return
+	}
+
+	rule := AlertRule{
+		Name:     "delivery_failed",
+		Message:  fmt.Sprintf("Delivery of %s alert to %s failed after %d attempts: %s", failed.Query, failed.Channel, failed.Attempts, failed.LastError),
+		Category: "error",
+		Value:    failed.Rule.Message,
+		To:       failed.Rule.To,
+	}
+
+	// The meta-alert is attempted once, so a failing fallback cannot cause a loop
+	n := m.newNotification(fallback, AlertEvent{Query: failed.Query, Rule: rule})
+	result := m.sendNotification(n)
+	m.monitor.deliveries.Record(result)
+	if result.Status != DeliverySent {
+		m.monitor.logger.Printf("Delivery failure alert to fallback channel %s %s: %s", fallback, result.Status, result.Error)
+	}
+}
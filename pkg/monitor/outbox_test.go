@@ -0,0 +1,367 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	config := DeliveryConfig{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+
+	tests := []struct {
+		attempts   int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{1, 0, 10 * time.Second},
+		{2, 0, 20 * time.Second},
+		{3, 0, 40 * time.Second},
+		{4, 0, time.Minute},
+		{10, 0, time.Minute},
+		{1, 30 * time.Second, 30 * time.Second},
+		{3, 5 * time.Second, 40 * time.Second},
+		{10, 5 * time.Minute, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := config.retryBackoff(tt.attempts, tt.retryAfter); got != tt.want {
+			t.Errorf("retryBackoff(%d, %s) = %s, want %s", tt.attempts, tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyDeliveryError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter time.Duration
+		permanent  bool
+	}{
+		{"network error", errors.New("connection refused"), 0, false},
+		{"bad request", &httpStatusError{StatusCode: 400}, 0, true},
+		{"not found", &httpStatusError{StatusCode: 404}, 0, true},
+		{"request timeout", &httpStatusError{StatusCode: 408}, 0, false},
+		{"too many requests", &httpStatusError{StatusCode: 429, RetryAfter: time.Minute}, time.Minute, false},
+		{"server error", &httpStatusError{StatusCode: 503, RetryAfter: 5 * time.Second}, 5 * time.Second, false},
+		{"wrapped client error", fmt.Errorf("webhook: %w", &httpStatusError{StatusCode: 401}), 0, true},
+		{"smtp transient", &textproto.Error{Code: 421, Msg: "try later"}, 0, false},
+		{"smtp permanent", &textproto.Error{Code: 550, Msg: "no such user"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryAfter, permanent := classifyDeliveryError(tt.err)
+			if retryAfter != tt.retryAfter || permanent != tt.permanent {
+				t.Errorf("classifyDeliveryError() = (%s, %v), want (%s, %v)", retryAfter, permanent, tt.retryAfter, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Errorf("parseRetryAfter(120) = %s", got)
+	}
+	if got := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(date) = %s", got)
+	}
+	for _, value := range []string{"", "soon", "-5"} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want 0", value, got)
+		}
+	}
+}
+
+func TestOutboxReplacesPendingNotification(t *testing.T) {
+	outbox, _ := NewOutbox("")
+
+	first := &Notification{ID: "a", Channel: "webhook", Rule: AlertRule{Message: "first"}, NextAttempt: time.Now()}
+	sending, err := outbox.Add(first)
+	if err != nil || sending == nil {
+		t.Fatalf("Add() = %v, %v, want a notification to deliver", sending, err)
+	}
+	if due := outbox.Due(time.Now()); len(due) != 0 {
+		t.Fatalf("Due() returned %d notifications being delivered", len(due))
+	}
+
+	// A newer alert while the first one is in flight replaces it without being delivered itself
+	second := &Notification{ID: "a", Channel: "webhook", Rule: AlertRule{Message: "second"}, NextAttempt: time.Now()}
+	if again, _ := outbox.Add(second); again != nil {
+		t.Fatal("Add() of a pending notification returned a notification to deliver")
+	}
+
+	// The delivered first alert must not remove its replacement
+	outbox.Complete(sending)
+	due := outbox.Due(time.Now())
+	if len(due) != 1 || due[0].Rule.Message != "second" {
+		t.Fatalf("Due() = %+v, want the replacement", due)
+	}
+	outbox.Complete(due[0])
+	if outbox.Len() != 0 {
+		t.Errorf("Len() = %d after completing, want 0", outbox.Len())
+	}
+}
+
+func TestOutboxRetryKeepsReplacement(t *testing.T) {
+	outbox, _ := NewOutbox("")
+
+	sending, _ := outbox.Add(&Notification{ID: "a", Rule: AlertRule{Message: "first"}})
+	outbox.Add(&Notification{ID: "a", Rule: AlertRule{Message: "second"}})
+
+	next := time.Now().Add(time.Minute)
+	sending.Attempts, sending.NextAttempt, sending.LastError = 1, next, "503"
+	outbox.Retry(sending)
+
+	pending, _ := outbox.Pending("a")
+	if pending.Rule.Message != "second" || pending.Attempts != 1 || !pending.NextAttempt.Equal(next) || pending.LastError != "503" {
+		t.Errorf("Pending() = %+v, want the replacement with the retry schedule", pending)
+	}
+	if due := outbox.Due(time.Now()); len(due) != 0 {
+		t.Errorf("Due() returned a notification before its next attempt")
+	}
+	if due := outbox.Due(next); len(due) != 1 {
+		t.Errorf("Due() at the next attempt returned %d notifications, want 1", len(due))
+	}
+}
+
+func TestOutboxCopiesAreIndependent(t *testing.T) {
+	outbox, _ := NewOutbox("")
+
+	sending, _ := outbox.Add(&Notification{ID: "a"})
+	sending.Attempts = 3
+	if pending, _ := outbox.Pending("a"); pending.Attempts != 0 {
+		t.Errorf("changing a delivery copy changed the stored notification")
+	}
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Notifications are persisted as soon as they are queued, before any attempt
+	sending, err := outbox.Add(&Notification{ID: "a", Channel: "webhook", Query: "connections"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); err != nil {
+		t.Fatalf("queued notification not persisted: %v", err)
+	}
+
+	// After a restart the in-flight notification is due again
+	reloaded, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := reloaded.Due(time.Now()); len(due) != 1 || due[0].Query != "connections" {
+		t.Fatalf("Due() after reload = %+v, want the queued notification", due)
+	}
+
+	if err := outbox.Complete(sending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); !os.IsNotExist(err) {
+		t.Errorf("delivered notification still persisted: %v", err)
+	}
+}
+
+func TestDeliverRetriesTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+`, server.URL)))
+	outbox := instance.monitor.outbox
+
+	n := instance.newNotification("webhook", testEvent())
+	sending, _ := outbox.Add(n)
+	instance.deliver(sending)
+
+	pending, exists := outbox.Pending(n.ID)
+	if !exists || pending.Attempts != 1 {
+		t.Fatalf("Pending() = %+v, %v, want a retry after the first attempt", pending, exists)
+	}
+	if wait := time.Until(pending.NextAttempt); wait < 25*time.Second || wait > 30*time.Second {
+		t.Errorf("next attempt in %s, want the Retry-After of 30s", wait)
+	}
+
+	due := outbox.Due(pending.NextAttempt)
+	if len(due) != 1 {
+		t.Fatalf("Due() returned %d notifications, want 1", len(due))
+	}
+	instance.deliver(due[0])
+	if outbox.Len() != 0 {
+		t.Errorf("outbox holds %d notifications after delivery, want 0", outbox.Len())
+	}
+	if !instance.alertTracker.IncidentOpen(instance.alertKey(n.Query, n.Rule), "webhook") {
+		t.Error("delivered alert did not open an incident")
+	}
+}
+
+func TestDeliverDropsPermanentFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+`, server.URL)))
+
+	sending, _ := instance.monitor.outbox.Add(instance.newNotification("webhook", testEvent()))
+	instance.deliver(sending)
+
+	if instance.monitor.outbox.Len() != 0 {
+		t.Error("permanently failed notification kept for retry")
+	}
+	results := instance.monitor.deliveries.Results("webhook", DeliveryFailed)
+	if len(results) != 1 || results[0].StatusCode != http.StatusBadRequest || !results[0].Permanent {
+		t.Errorf("delivery results = %+v, want one permanent failure with status 400", results)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("webhook received %d requests, want 1", requests.Load())
+	}
+}
+
+func TestDeliverRetriesFailedTargets(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	status := map[string]int{"/ok": http.StatusOK, "/rejected": http.StatusBadRequest, "/down": http.StatusServiceUnavailable}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		w.WriteHeader(status[r.URL.Path])
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    targets:
+      - name: ok
+        url: %[1]q
+      - name: rejected
+        url: %[2]q
+      - name: down
+        url: %[3]q
+`, server.URL+"/ok", server.URL+"/rejected", server.URL+"/down")))
+	outbox := instance.monitor.outbox
+
+	n := instance.newNotification("webhook", testEvent())
+	sending, _ := outbox.Add(n)
+	instance.deliver(sending)
+
+	// A permanently rejecting target does not drop the alert for a target that is down
+	pending, exists := outbox.Pending(n.ID)
+	if !exists {
+		t.Fatal("alert dropped while a target failed transiently")
+	}
+	results := instance.monitor.deliveries.Results("webhook", DeliveryFailed)
+	if len(results) != 1 || results[0].Permanent || len(results[0].Targets) != 2 {
+		t.Fatalf("delivery results = %+v, want one transient failure of two targets", results)
+	}
+	if target := results[0].Targets[0]; target.Target != "rejected" || !target.Permanent || target.StatusCode != http.StatusBadRequest {
+		t.Errorf("first failed target = %+v, want rejected with status 400", target)
+	}
+
+	mu.Lock()
+	status["/down"] = http.StatusOK
+	mu.Unlock()
+	instance.deliver(outbox.Due(pending.NextAttempt)[0])
+
+	if outbox.Len() != 0 {
+		t.Errorf("outbox holds %d notifications after delivery, want 0", outbox.Len())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for path, want := range map[string]int{"/ok": 1, "/rejected": 1, "/down": 2} {
+		if requests[path] != want {
+			t.Errorf("%s received %d requests, want %d", path, requests[path], want)
+		}
+	}
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    url: %q
+  delivery:
+    max_attempts: 2
+`, server.URL)))
+	outbox := instance.monitor.outbox
+
+	sending, _ := outbox.Add(instance.newNotification("webhook", testEvent()))
+	instance.deliver(sending)
+	due := outbox.Due(time.Now().Add(time.Hour))
+	if len(due) != 1 {
+		t.Fatalf("Due() returned %d notifications, want 1", len(due))
+	}
+	instance.deliver(due[0])
+	if outbox.Len() != 0 {
+		t.Errorf("notification kept after %d attempts", due[0].Attempts)
+	}
+}
+
+func TestDeliveryResultJSON(t *testing.T) {
+	n := &Notification{Channel: "webhook", Instance: "prod", Query: "connections"}
+	result := deliveryResult(n, &httpStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute, msg: "rate limited"})
+	result.Duration = 1500 * time.Microsecond
+
+	if result.Status != DeliveryFailed || result.Permanent || result.RetryAfter != time.Minute {
+		t.Fatalf("deliveryResult() = %+v, want a transient failure retried after 1m", result)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded["duration_ms"] != 1.5 {
+		t.Errorf("duration_ms = %v, want 1.5", decoded["duration_ms"])
+	}
+	if _, exists := decoded["duration"]; exists {
+		t.Error("duration still serialized in nanoseconds")
+	}
+	if decoded["status_code"] != float64(http.StatusTooManyRequests) || decoded["status"] != "failed" {
+		t.Errorf("encoded result = %s", data)
+	}
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig holds PagerDuty Events API v2 configuration
+type PagerDutyConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	RoutingKey string        `yaml:"routing_key"`          // Integration key of the PagerDuty service
+	EventsURL  string        `yaml:"events_url,omitempty"` // Defaults to the public Events API v2 endpoint
+	Interval   time.Duration `yaml:"interval"`
+}
+
+// PagerDutyEvent represents a PagerDuty Events API v2 event
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // "trigger", "acknowledge" or "resolve"
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload represents the payload of a PagerDuty trigger event
+type PagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"` // "critical", "error", "warning" or "info"
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// sendPagerDutyAlert sends a trigger event to PagerDuty
+func (m *MonitorInstance) sendPagerDutyAlert(n *Notification) DeliveryResult {
+	alert := n.Event()
+	queryName, rule := alert.Query, alert.Rule
+	details := map[string]interface{}{
+		"condition": rule.Condition,
+		"threshold": rule.Value,
+		"value":     alert.Comparison(),
+		"to":        m.monitor.displayRecipients(rule, "pagerduty"),
+	}
+	if rule.ResolutionNote != "" {
+		details["note"] = rule.ResolutionNote
+	}
+	if alert.Observed != nil {
+		details["observed"] = alert.Observed
+	}
+	if alert.Row != nil {
+		details["row"] = alert.Row
+	}
+
+	event := PagerDutyEvent{
+		RoutingKey:  m.monitor.config.Alerts.PagerDuty.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    m.alertKey(queryName, rule),
+		Client:      "postgres-stat-alert",
+		Payload: &PagerDutyPayload{
+			Summary:       fmt.Sprintf("[%s] %s: %s", m.dbConfig.Instance, queryName, rule.Message),
+			Source:        m.dbConfig.Instance,
+			Severity:      alertSeverity(rule),
+			Timestamp:     time.Now().Format(time.RFC3339),
+			Component:     queryName,
+			Group:         m.dbConfig.Database,
+			Class:         rule.Category,
+			CustomDetails: details,
+		},
+	}
+
+	return deliveryResult(n, m.postPagerDutyEvent(queryName, event))
+}
+
+// sendPagerDutyResolve sends a resolve event to PagerDuty for a cleared alert
+func (m *MonitorInstance) sendPagerDutyResolve(n *Notification) DeliveryResult {
+	queryName, rule := n.Query, n.Rule
+	event := PagerDutyEvent{
+		RoutingKey:  m.monitor.config.Alerts.PagerDuty.RoutingKey,
+		EventAction: "resolve",
+		DedupKey:    m.alertKey(queryName, rule),
+	}
+
+	return deliveryResult(n, m.postPagerDutyEvent(queryName, event))
+}
+
+// postPagerDutyEvent posts an event to the PagerDuty Events API
+func (m *MonitorInstance) postPagerDutyEvent(queryName string, event PagerDutyEvent) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling PagerDuty event: %v", err)
+		return fmt.Errorf("failed to marshal PagerDuty event: %w", err)
+	}
+
+	url := m.monitor.config.Alerts.PagerDuty.EventsURL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+
+	resp, err := m.monitor.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error sending PagerDuty %s event: %v", event.EventAction, err)
+		return fmt.Errorf("failed to send PagerDuty %s event: %w", event.EventAction, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		m.monitor.logger.Printf("PagerDuty %s event sent successfully for query: %s (dedup key: %s)", event.EventAction, queryName, event.DedupKey)
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("PagerDuty %s event failed with status code: %d (%s) for query: %s", event.EventAction, resp.StatusCode, string(respBody), queryName)
+		return newHTTPStatusError(resp, respBody, "PagerDuty %s event failed with status code: %d (%s) for query: %s", event.EventAction, resp.StatusCode, string(respBody), queryName)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestPagerDutyTriggerAndResolve(t *testing.T) {
+	server, requests := recordingServer(t, http.StatusAccepted, `{"status": "success"}`)
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  pagerduty:
+    enabled: true
+    routing_key: "key"
+    events_url: %q
+`, server.URL)))
+
+	event := testEvent()
+	event.Rule.ResolutionNote = "Check the pool"
+	if result := instance.sendPagerDutyAlert(instance.newNotification("pagerduty", event)); result.Status != DeliverySent {
+		t.Fatalf("sendPagerDutyAlert() = %+v", result)
+	}
+	resolved := instance.newNotification("pagerduty", event)
+	resolved.Resolved = true
+	if result := instance.sendPagerDutyResolve(resolved); result.Status != DeliverySent {
+		t.Fatalf("sendPagerDutyResolve() = %+v", result)
+	}
+
+	var events []PagerDutyEvent
+	for _, r := range requests() {
+		var event PagerDutyEvent
+		if err := json.Unmarshal(r.Body, &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want a trigger and a resolve", len(events))
+	}
+
+	trigger, resolve := events[0], events[1]
+	if trigger.EventAction != "trigger" || trigger.RoutingKey != "key" || trigger.DedupKey != "test/connections/too_many" {
+		t.Errorf("trigger = %+v, want the routing key and the instance/query/rule dedup key", trigger)
+	}
+	payload := trigger.Payload
+	if payload == nil || payload.Summary != "[test] connections: Too many connections" || payload.Severity != "warning" || payload.Source != "test" || payload.Group != "app" {
+		t.Fatalf("payload = %+v", payload)
+	}
+	if payload.CustomDetails["note"] != "Check the pool" || payload.CustomDetails["observed"] != float64(143) {
+		t.Errorf("custom details = %v, want the note and the observed value", payload.CustomDetails)
+	}
+	if row, _ := payload.CustomDetails["row"].(map[string]interface{}); row["count"] != float64(143) {
+		t.Errorf("custom details row = %v, want the row values", payload.CustomDetails["row"])
+	}
+
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Errorf("resolve = %+v, want a resolve of the trigger's dedup key", resolve)
+	}
+}
+
+func TestPagerDutyRejectedEventIsPermanent(t *testing.T) {
+	server, _ := recordingServer(t, http.StatusBadRequest, `{"status": "invalid event"}`)
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  pagerduty:
+    enabled: true
+    routing_key: "key"
+    events_url: %q
+`, server.URL)))
+
+	result := instance.sendPagerDutyAlert(instance.newNotification("pagerduty", testEvent()))
+	if result.Status != DeliveryFailed || !result.Permanent {
+		t.Errorf("sendPagerDutyAlert() = %+v, want a permanent failure", result)
+	}
+}
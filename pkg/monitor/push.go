@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default priorities per severity of the push channels, overridable with their priorities setting
+var (
+	ntfyPriorities     = map[string]int{"critical": 5, "error": 4, "warning": 3, "info": 2}
+	gotifyPriorities   = map[string]int{"critical": 10, "error": 8, "warning": 5, "info": 2}
+	pushoverPriorities = map[string]int{"critical": 2, "error": 1, "warning": 0, "info": -1}
+)
+
+// pushPriority returns the priority of a rule on a push channel: the configured priority of its severity, which
+// is derived from the category when not set, or the channel default
+func pushPriority(rule AlertRule, configured, defaults map[string]int) int {
+	severity := alertSeverity(rule)
+	if priority, exists := configured[severity]; exists {
+		return priority
+	}
+	return defaults[severity]
+}
+
+// pushTitle returns the title of a push notification
+func pushTitle(instance, queryName string) string {
+	return fmt.Sprintf("Database Alert: %s / %s", instance, queryName)
+}
+
+// pushBody returns the text of a push notification
+func pushBody(event AlertEvent) string {
+	lines := []string{
+		event.Rule.Message,
+		"Value: " + event.Comparison(),
+		"Category: " + event.Rule.Category,
+	}
+	if event.Rule.ResolutionNote != "" {
+		lines = append(lines, "", event.Rule.ResolutionNote)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validatePriorities checks the configured priorities of a push channel
+func validatePriorities(channel string, priorities map[string]int, low, high int) error {
+	for severity, priority := range priorities {
+		switch severity {
+		case "critical", "error", "warning", "info":
+		default:
+			return fmt.Errorf("invalid %s priority severity %q, expected critical, error, warning or info", channel, severity)
+		}
+		if priority < low || priority > high {
+			return fmt.Errorf("invalid %s priority %d for %s, expected %d to %d", channel, priority, severity, low, high)
+		}
+	}
+	return nil
+}
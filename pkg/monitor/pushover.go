@@ -0,0 +1,249 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PushoverConfig holds Pushover configuration
+type PushoverConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	APIURL     string         `yaml:"api_url,omitempty"` // Messages endpoint (default https://api.pushover.net/1/messages.json)
+	Token      string         `yaml:"token"`             // Application API token
+	UserKeys   []string       `yaml:"user_keys"`         // User or group keys
+	Device     string         `yaml:"device,omitempty"`  // Limit to devices of the users, comma separated
+	Sound      string         `yaml:"sound,omitempty"`
+	Priorities map[string]int `yaml:"priorities,omitempty"` // Priority (-2 to 2) per severity, 2 is an emergency
+	Retry      time.Duration  `yaml:"retry,omitempty"`      // How often an emergency is repeated until acknowledged (default 60s, at least 30s)
+	Expire     time.Duration  `yaml:"expire,omitempty"`     // How long an emergency is repeated (default 1h, at most 3h)
+	Interval   time.Duration  `yaml:"interval"`
+}
+
+// pushoverResponse is the response of the Pushover messages API
+type pushoverResponse struct {
+	Status  int      `json:"status"`
+	Receipt string   `json:"receipt"`
+	Errors  []string `json:"errors"`
+}
+
+// pushoverEmergency is the priority of emergency messages, which repeat until acknowledged
+const pushoverEmergency = 2
+
+// Limits of Pushover messages, in characters
+const (
+	pushoverMaxTitle   = 250
+	pushoverMaxMessage = 1024
+)
+
+// pushoverReceipts keeps the receipts of the emergency messages of firing alerts, so that they are cancelled when
+// the alert resolves. With a file, they are persisted so that they are still cancelled after a restart.
+type pushoverReceipts struct {
+	file     string
+	receipts map[string][]string // Receipts per alert key
+	mu       sync.Mutex
+}
+
+// loadPushoverReceipts creates the receipt store and loads the receipts persisted in file.
+// Without a file they are kept in memory only.
+func loadPushoverReceipts(file string) (*pushoverReceipts, error) {
+	r := &pushoverReceipts{file: file, receipts: make(map[string][]string)}
+	if file == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Pushover receipts: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.receipts); err != nil {
+		return nil, fmt.Errorf("failed to parse Pushover receipts: %w", err)
+	}
+	return r, nil
+}
+
+// pushoverReceiptsFile returns the file persisting the Pushover receipts, next to the outbox entries
+func pushoverReceiptsFile(config DeliveryConfig) string {
+	if config.OutboxDir == "" {
+		return ""
+	}
+	return filepath.Join(config.OutboxDir, "pushover", "receipts.json")
+}
+
+// add keeps the receipt of an emergency message of an alert
+func (r *pushoverReceipts) add(key, receipt string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.receipts[key] = append(r.receipts[key], receipt)
+	return r.save()
+}
+
+// get returns the receipts of the emergency messages of an alert
+func (r *pushoverReceipts) get(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.receipts[key]...)
+}
+
+// remove forgets the receipts of an alert
+func (r *pushoverReceipts) remove(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.receipts[key]; !exists {
+		return nil
+	}
+	delete(r.receipts, key)
+	return r.save()
+}
+
+// save persists the receipts, written to a temporary file first so a crash never leaves a partial file
+func (r *pushoverReceipts) save() error {
+	if r.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.receipts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Pushover receipts: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.file), 0700); err != nil {
+		return fmt.Errorf("failed to create Pushover receipts directory: %w", err)
+	}
+	if err := os.WriteFile(r.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write Pushover receipts: %w", err)
+	}
+	if err := os.Rename(r.file+".tmp", r.file); err != nil {
+		return fmt.Errorf("failed to write Pushover receipts: %w", err)
+	}
+	return nil
+}
+
+// sendPushoverAlert sends an alert to the Pushover users and groups of a rule
+func (m *MonitorInstance) sendPushoverAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	config := m.monitor.config.Alerts.Pushover
+	keys, err := m.monitor.channelRecipients(rule, "pushover", config.UserKeys)
+	if err != nil {
+		m.monitor.logger.Printf("Pushover alert failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve Pushover user key for query %s: %w", queryName, err))
+	}
+	if len(keys) == 0 {
+		return deliveryResult(n, fmt.Errorf("no Pushover user key for query %s", queryName))
+	}
+
+	priority := pushPriority(rule, config.Priorities, pushoverPriorities)
+	form := url.Values{
+		"token":     {config.Token},
+		"title":     {truncateText(pushTitle(m.dbConfig.Instance, queryName), pushoverMaxTitle)},
+		"message":   {truncateText(pushBody(event), pushoverMaxMessage)},
+		"priority":  {fmt.Sprintf("%d", priority)},
+		"timestamp": {fmt.Sprintf("%d", time.Now().Unix())},
+	}
+	if priority == pushoverEmergency {
+		form.Set("retry", fmt.Sprintf("%d", int(config.Retry.Seconds())))
+		form.Set("expire", fmt.Sprintf("%d", int(config.Expire.Seconds())))
+	}
+	if config.Device != "" {
+		form.Set("device", config.Device)
+	}
+	if config.Sound != "" {
+		form.Set("sound", config.Sound)
+	}
+
+	return deliveryResult(n, n.sendToTargets(keys, func(key string) error {
+		form.Set("user", key)
+		receipt, err := m.postPushoverMessage(queryName, form)
+		if receipt != "" {
+			if err := m.monitor.receipts.add(m.alertKey(queryName, rule), receipt); err != nil {
+				m.monitor.logger.Printf("Error saving Pushover receipt %s for query %s: %v", receipt, queryName, err)
+			}
+		}
+		return err
+	}))
+}
+
+// sendPushoverCancel cancels the emergency messages of a resolved alert, so that they stop repeating
+func (m *MonitorInstance) sendPushoverCancel(n *Notification) DeliveryResult {
+	key := m.alertKey(n.Query, n.Rule)
+	err := n.sendToTargets(m.monitor.receipts.get(key), func(receipt string) error {
+		return m.cancelPushoverReceipt(n.Query, receipt)
+	})
+	if err == nil {
+		if err := m.monitor.receipts.remove(key); err != nil {
+			m.monitor.logger.Printf("Error saving Pushover receipts: %v", err)
+		}
+	}
+	return deliveryResult(n, err)
+}
+
+// pushoverReceiptURL returns the cancel endpoint of a receipt, next to the configured messages endpoint
+func pushoverReceiptURL(apiURL, receipt string) string {
+	return strings.TrimSuffix(apiURL, "/messages.json") + "/receipts/" + url.PathEscape(receipt) + "/cancel.json"
+}
+
+// cancelPushoverReceipt stops an emergency message from repeating
+func (m *MonitorInstance) cancelPushoverReceipt(queryName, receipt string) error {
+	config := m.monitor.config.Alerts.Pushover
+	resp, err := m.monitor.httpClient.PostForm(pushoverReceiptURL(config.APIURL, receipt), url.Values{"token": {config.Token}})
+	if err != nil {
+		return fmt.Errorf("failed to cancel Pushover emergency: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result pushoverResponse
+	json.Unmarshal(respBody, &result)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && result.Status == 1 {
+		m.monitor.logger.Printf("Pushover emergency cancelled for query: %s (receipt %s)", queryName, receipt)
+		return nil
+	}
+
+	reason := strings.Join(result.Errors, "; ")
+	if reason == "" {
+		reason = strings.TrimSpace(string(respBody))
+	}
+	return newHTTPStatusError(resp, respBody, "Pushover cancel of receipt %s failed with status code: %d for query: %s: %s", receipt, resp.StatusCode, queryName, reason)
+}
+
+// postPushoverMessage posts a message to the Pushover API and returns the receipt of an emergency message
+func (m *MonitorInstance) postPushoverMessage(queryName string, form url.Values) (string, error) {
+	resp, err := m.monitor.httpClient.PostForm(m.monitor.config.Alerts.Pushover.APIURL, form)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Pushover alert: %v", err)
+		return "", fmt.Errorf("failed to send Pushover alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result pushoverResponse
+	json.Unmarshal(respBody, &result)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && result.Status == 1 {
+		if result.Receipt != "" {
+			m.monitor.logger.Printf("Pushover emergency alert sent successfully for query: %s (receipt %s)", queryName, result.Receipt)
+		} else {
+			m.monitor.logger.Printf("Pushover alert sent successfully for query: %s", queryName)
+		}
+		return result.Receipt, nil
+	}
+
+	reason := strings.Join(result.Errors, "; ")
+	if reason == "" {
+		reason = strings.TrimSpace(string(respBody))
+	}
+	m.monitor.logger.Printf("Pushover alert failed with status code: %d (%s) for query: %s", resp.StatusCode, reason, queryName)
+	return "", newHTTPStatusError(resp, respBody, "Pushover alert failed with status code: %d for query: %s: %s", resp.StatusCode, queryName, reason)
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPushoverConfigValidation(t *testing.T) {
+	// Retry and expire are only checked when Pushover is used
+	loadTestConfig(t, "alerts:\n  pushover:\n    enabled: false\n    retry: \"10s\"\n    expire: \"5h\"\n")
+
+	if _, err := loadConfig(writeTestConfig(t, "alerts:\n  pushover:\n    enabled: true\n    retry: \"10s\"\n")); err == nil {
+		t.Error("loadConfig() accepted a Pushover retry below 30s")
+	}
+}
+
+func TestPushoverEmergencyCancelledOnResolve(t *testing.T) {
+	server, requests := recordingServer(t, http.StatusOK, `{"status":1,"receipt":"R1"}`)
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  pushover:
+    enabled: true
+    api_url: %q
+    token: "app"
+    user_keys: ["u1"]
+    priorities:
+      warning: 2
+`, server.URL+"/1/messages.json")))
+	event := testEvent()
+	event.Rule.Message = strings.Repeat("Too many connections ", 100)
+	key := instance.alertKey(event.Query, event.Rule)
+
+	if result := instance.sendPushoverAlert(instance.newNotification("pushover", event)); result.Status != DeliverySent {
+		t.Fatalf("sendPushoverAlert() = %+v", result)
+	}
+	form, _ := url.ParseQuery(string(requests()[0].Body))
+	if form.Get("priority") != "2" || form.Get("retry") == "" {
+		t.Errorf("priority = %q, retry = %q, want an emergency", form.Get("priority"), form.Get("retry"))
+	}
+	if n := len([]rune(form.Get("message"))); n != pushoverMaxMessage {
+		t.Errorf("message of %d characters, want it cut to %d", n, pushoverMaxMessage)
+	}
+	if got := instance.monitor.receipts.get(key); len(got) != 1 || got[0] != "R1" {
+		t.Fatalf("receipts = %v, want the emergency receipt", got)
+	}
+
+	n := instance.newNotification("pushover", AlertEvent{Query: event.Query, Rule: event.Rule})
+	n.Resolved = true
+	if result := instance.sendPushoverCancel(n); result.Status != DeliverySent {
+		t.Fatalf("sendPushoverCancel() = %+v", result)
+	}
+	cancel := requests()[1]
+	form, _ = url.ParseQuery(string(cancel.Body))
+	if cancel.Path != "/1/receipts/R1/cancel.json" || form.Get("token") != "app" {
+		t.Errorf("cancelled at %s with token %q, want the receipt cancelled with the app token", cancel.Path, form.Get("token"))
+	}
+	if got := instance.monitor.receipts.get(key); len(got) != 0 {
+		t.Errorf("receipts = %v after the resolution, want none", got)
+	}
+}
@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// listPrefix marks a recipient referring to a distribution list, e.g. "list:dba-team"
+const listPrefix = "list:"
+
+// maxListDepth bounds the nesting of distribution lists, so lists referring to each other cannot loop
+const maxListDepth = 5
+
+// splitRecipients splits a comma or semicolon separated recipient value
+func splitRecipients(value string) []string {
+	var recipients []string
+	for _, recipient := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// expandRecipients expands recipient entries for a channel. Entries may be comma separated and refer to
+// distribution lists ("list:<name>") or on-call schedules ("oncall:<name>"). Duplicates are removed.
+func (m *Monitor) expandRecipients(entries []string, channel string) ([]string, error) {
+	var recipients []string
+	seen := make(map[string]bool)
+	if err := m.appendRecipients(&recipients, seen, entries, channel, 0); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// appendRecipients adds the expanded entries to recipients
+func (m *Monitor) appendRecipients(recipients *[]string, seen map[string]bool, entries []string, channel string, depth int) error {
+	for _, entry := range entries {
+		for _, recipient := range splitRecipients(entry) {
+			if strings.HasPrefix(recipient, listPrefix) {
+				name := strings.TrimPrefix(recipient, listPrefix)
+				list, exists := m.config.Lists[name]
+				if !exists {
+					return fmt.Errorf("unknown distribution list %s", name)
+				}
+				if depth >= maxListDepth {
+					return fmt.Errorf("distribution list %s is nested too deeply", name)
+				}
+				if err := m.appendRecipients(recipients, seen, list, channel, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+
+			resolved, err := m.resolveRecipient(recipient, channel)
+			if err != nil {
+				return err
+			}
+			if key := strings.ToLower(resolved); !seen[key] {
+				seen[key] = true
+				*recipients = append(*recipients, resolved)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleRecipients returns the recipients of a rule on a channel: the per channel override when set, otherwise to
+func (m *Monitor) ruleRecipients(rule AlertRule, channel string) ([]string, error) {
+	if override, exists := rule.Recipients[channel]; exists {
+		return m.expandRecipients(override, channel)
+	}
+	return m.expandRecipients([]string{rule.To}, channel)
+}
+
+// channelRecipients returns the recipients of a rule on a channel that sends to configured destinations unless
+// the rule targets its own, expanding lists and on-call schedules in both
+func (m *Monitor) channelRecipients(rule AlertRule, channel string, configured []string) ([]string, error) {
+	if hasRuleRecipients(rule, channel) {
+		return m.ruleRecipients(rule, channel)
+	}
+	return m.expandRecipients(configured, channel)
+}
+
+// hasRuleRecipients checks if a rule targets specific recipients on a channel that otherwise uses its configured
+// destination, through a per channel override, an on-call schedule or a distribution list
+func hasRuleRecipients(rule AlertRule, channel string) bool {
+	if _, exists := rule.Recipients[channel]; exists {
+		return true
+	}
+	return isOnCall(rule.To) || strings.HasPrefix(strings.TrimSpace(rule.To), listPrefix)
+}
+
+// displayRecipients returns the recipients of a rule on a channel as shown in alerts, falling back to the
+// configured value when they cannot be resolved
+func (m *Monitor) displayRecipients(rule AlertRule, channel string) string {
+	recipients, err := m.ruleRecipients(rule, channel)
+	if err != nil {
+		m.logger.Printf("Error resolving recipients %s: %v", rule.To, err)
+		return rule.To
+	}
+	return strings.Join(recipients, ", ")
+}
@@ -0,0 +1,162 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const recipientsTestConfig = `
+lists:
+  dba: ["alice@example.com", "bob@example.com; list:oncall"]
+  oncall: ["oncall:primary"]
+  everyone: ["list:dba", "carol@example.com", "ALICE@example.com"]
+  loop: ["list:loop"]
+oncall:
+  primary:
+    start: "2025-01-06 09:00"
+    members:
+      - name: Dave
+        email: dave@example.com
+        phone: "+31600000000"
+        telegram: dave_dba
+        ntfy: dave-alerts
+        pushover: udave0000000000000000000000000
+        matrix: "!dave:example.com"
+`
+
+func TestExpandRecipients(t *testing.T) {
+	m := newTestInstance(t, loadTestConfig(t, recipientsTestConfig)).monitor
+
+	tests := []struct {
+		name    string
+		entries []string
+		channel string
+		want    string
+	}{
+		{"plain", []string{"a@example.com, b@example.com"}, "email", "a@example.com|b@example.com"},
+		{"nested lists", []string{"list:everyone"}, "email", "alice@example.com|bob@example.com|dave@example.com|carol@example.com"},
+		{"duplicates removed", []string{"alice@example.com", "list:dba"}, "email", "alice@example.com|bob@example.com|dave@example.com"},
+		{"on-call phone", []string{"oncall:primary"}, "sms", "+31600000000"},
+		{"on-call telegram handle", []string{"oncall:primary"}, "telegram", "@dave_dba"},
+		{"on-call opsgenie user", []string{"oncall:primary"}, "opsgenie", "user:dave@example.com"},
+		{"on-call ntfy topic", []string{"oncall:primary"}, "ntfy", "dave-alerts"},
+		{"on-call pushover key", []string{"oncall:primary"}, "pushover", "udave0000000000000000000000000"},
+		{"on-call matrix room", []string{"oncall:primary"}, "matrix", "!dave:example.com"},
+		{"on-call elsewhere", []string{"oncall:primary"}, "webhook", "Dave <dave@example.com>"},
+		{"empty", []string{""}, "email", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipients, err := m.expandRecipients(tt.entries, tt.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(recipients, "|"); got != tt.want {
+				t.Errorf("expandRecipients(%q) = %q, want %q", tt.entries, got, tt.want)
+			}
+		})
+	}
+
+	for _, entry := range []string{"list:missing", "list:loop", "oncall:missing"} {
+		if _, err := m.expandRecipients([]string{entry}, "email"); err == nil {
+			t.Errorf("expandRecipients(%q) succeeded", entry)
+		}
+	}
+	if _, err := m.expandRecipients([]string{"oncall:primary"}, "gotify"); err != nil {
+		t.Errorf("on-call member without a gotify contact: %v", err)
+	}
+}
+
+func TestRuleRecipients(t *testing.T) {
+	m := newTestInstance(t, loadTestConfig(t, recipientsTestConfig)).monitor
+	rule := AlertRule{To: "list:dba", Recipients: map[string][]string{"sms": {"oncall:primary", "+31611111111"}}}
+
+	if recipients, _ := m.ruleRecipients(rule, "sms"); strings.Join(recipients, "|") != "+31600000000|+31611111111" {
+		t.Errorf("ruleRecipients(sms) = %q, want the override", recipients)
+	}
+	if recipients, _ := m.ruleRecipients(rule, "email"); len(recipients) != 3 {
+		t.Errorf("ruleRecipients(email) = %q, want the list", recipients)
+	}
+	if recipients, _ := m.channelRecipients(AlertRule{Recipients: map[string][]string{"ntfy": {"oncall:primary", "db"}}}, "ntfy", []string{"alerts"}); strings.Join(recipients, "|") != "dave-alerts|db" {
+		t.Errorf("channelRecipients(ntfy) = %q, want the expanded override", recipients)
+	}
+	if recipients, _ := m.channelRecipients(AlertRule{To: "ops@example.com"}, "pushover", []string{"ukey1, ukey2"}); strings.Join(recipients, "|") != "ukey1|ukey2" {
+		t.Errorf("channelRecipients(pushover) = %q, want the configured keys", recipients)
+	}
+	if !hasRuleRecipients(rule, "webhook") || !hasRuleRecipients(AlertRule{To: "oncall:primary"}, "email") || hasRuleRecipients(AlertRule{To: "ops@example.com"}, "telegram") {
+		t.Error("hasRuleRecipients() did not detect the rule recipients")
+	}
+	if got := m.displayRecipients(AlertRule{To: "list:missing"}, "email"); got != "list:missing" {
+		t.Errorf("displayRecipients() = %q, want the configured value", got)
+	}
+}
+
+func TestMatrixRoomsOfRule(t *testing.T) {
+	server, requests := recordingServer(t, http.StatusOK, `{"event_id":"$1"}`)
+	instance := newTestInstance(t, loadTestConfig(t, recipientsTestConfig+fmt.Sprintf(`
+alerts:
+  matrix:
+    enabled: true
+    homeserver_url: %q
+    access_token: "token"
+    room_id: "!ops:example.com"
+`, server.URL)))
+
+	for _, to := range []string{"ops@example.com", "oncall:primary"} {
+		event := testEvent()
+		event.Rule.To = to
+		if result := instance.sendMatrixAlert(instance.newNotification("matrix", event)); result.Status != DeliverySent {
+			t.Fatalf("sendMatrixAlert() to %s = %+v", to, result)
+		}
+	}
+	sent := requests()
+	if !strings.HasPrefix(sent[0].Path, "/_matrix/client/v3/rooms/%21ops:example.com/") || !strings.HasPrefix(sent[1].Path, "/_matrix/client/v3/rooms/%21dave:example.com/") {
+		t.Errorf("posted to %s and %s, want the configured room and the room of the member on call", sent[0].Path, sent[1].Path)
+	}
+}
+
+func TestOnCallAt(t *testing.T) {
+	schedule := OnCallSchedule{
+		Timezone: "Europe/Amsterdam",
+		Start:    "2025-03-24 09:00",
+		Members:  []OnCallMember{{Name: "Alice"}, {Name: "Bob"}, {Name: "Carol"}},
+		Overrides: []OnCallOverride{
+			{Start: "2025-04-10 18:00", End: "2025-04-11 09:00", Member: "carol"},
+		},
+	}
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{"2025-03-20 12:00", "Alice"}, // Before the first handoff
+		{"2025-03-31 08:59", "Alice"},
+		{"2025-03-31 09:00", "Bob"}, // First handoff after the change to summer time
+		{"2025-04-07 09:00", "Carol"},
+		{"2025-04-10 20:00", "Carol"},
+		{"2025-04-14 09:00", "Alice"},
+		{"2025-10-27 09:00", "Bob"}, // 31 weeks after the start, after the change to winter time
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation("2006-01-02 15:04", tt.now, amsterdam)
+		member, err := schedule.OnCallAt(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member.Name != tt.want {
+			t.Errorf("OnCallAt(%s) = %s, want %s", tt.now, member.Name, tt.want)
+		}
+	}
+
+	schedule.Overrides = []OnCallOverride{{Start: "2025-03-20 00:00", End: "2025-03-21 00:00", Member: "Eve"}}
+	if _, err := schedule.OnCallAt(time.Date(2025, 3, 20, 12, 0, 0, 0, amsterdam)); err == nil {
+		t.Error("OnCallAt() accepted an override by someone outside the schedule")
+	}
+}
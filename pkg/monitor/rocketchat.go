@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RocketChatConfig holds Rocket.Chat incoming webhook configuration
+type RocketChatConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	WebhookURL string        `yaml:"webhook_url"`
+	Channel    string        `yaml:"channel,omitempty"` // Overrides the channel of the integration, e.g. "#dba" or "@user"
+	Alias      string        `yaml:"alias,omitempty"`   // Name shown instead of the integration user
+	Avatar     string        `yaml:"avatar,omitempty"`  // Avatar image URL
+	Interval   time.Duration `yaml:"interval"`
+}
+
+// RocketChatMessage represents a Rocket.Chat incoming webhook message
+type RocketChatMessage struct {
+	Text        string           `json:"text"`
+	Channel     string           `json:"channel,omitempty"`
+	Alias       string           `json:"alias,omitempty"`
+	Avatar      string           `json:"avatar,omitempty"`
+	Attachments []ChatAttachment `json:"attachments"`
+}
+
+// sendRocketChatAlert sends an alert to Rocket.Chat
+func (m *MonitorInstance) sendRocketChatAlert(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postRocketChatMessage(n.Query, m.formatAlert(n.Event())))
+}
+
+// sendRocketChatBatch sends a group of alerts to Rocket.Chat as a single attachment
+func (m *MonitorInstance) sendRocketChatBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postRocketChatMessage(batchQueries(n.Batch), formatBatch(n.Batch)))
+}
+
+// postRocketChatMessage posts an alert to the Rocket.Chat webhook
+func (m *MonitorInstance) postRocketChatMessage(queryName string, f alertFormat) error {
+	config := m.monitor.config.Alerts.RocketChat
+	msg := RocketChatMessage{
+		Text:        f.Title,
+		Channel:     config.Channel,
+		Alias:       config.Alias,
+		Avatar:      config.Avatar,
+		Attachments: []ChatAttachment{f.Attachment()},
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		m.monitor.logger.Printf("Error marshaling Rocket.Chat message: %v", err)
+		return fmt.Errorf("failed to marshal Rocket.Chat message: %w", err)
+	}
+
+	resp, err := m.monitor.httpClient.Post(config.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.monitor.logger.Printf("Error sending Rocket.Chat alert: %v", err)
+		return fmt.Errorf("failed to send Rocket.Chat alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Rocket.Chat answers failed script integrations with 200 and {"success": false}
+	respBody, _ := io.ReadAll(resp.Body)
+	var result struct {
+		Success *bool  `json:"success"`
+		Error   string `json:"error"`
+	}
+	json.Unmarshal(respBody, &result)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && (result.Success == nil || *result.Success) {
+		m.monitor.logger.Printf("Rocket.Chat alert sent successfully for query: %s", queryName)
+		return nil
+	}
+	m.monitor.logger.Printf("Rocket.Chat alert failed with status code: %d (%s) for query: %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName)
+	if resp.StatusCode < 300 {
+		return fmt.Errorf("Rocket.Chat alert failed for query: %s: %s", queryName, result.Error)
+	}
+	return newHTTPStatusError(resp, respBody, "Rocket.Chat alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// scramAuthenticate performs a SASL SCRAM-SHA-256 or SCRAM-SHA-512 authentication (RFC 5802), exchanging the
+// client and server messages with exchange
+func scramAuthenticate(exchange func([]byte) ([]byte, error), mechanism, username, password string) error {
+	nonce := make([]byte, 24)
+	rand.Read(nonce)
+	return scramExchange(exchange, mechanism, username, password, base64.RawStdEncoding.EncodeToString(nonce))
+}
+
+// scramExchange performs a SCRAM authentication with the given client nonce
+func scramExchange(exchange func([]byte) ([]byte, error), mechanism, username, password, nonce string) error {
+	newHash := sha256.New
+	if mechanism == "SCRAM-SHA-512" {
+		newHash = sha512.New
+	}
+
+	name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+	clientFirstBare := "n=" + name + ",r=" + nonce
+
+	serverFirst, err := exchange([]byte("n,," + clientFirstBare))
+	if err != nil {
+		return err
+	}
+	attrs := scramAttributes(string(serverFirst))
+	if !strings.HasPrefix(attrs["r"], nonce) {
+		return fmt.Errorf("SCRAM server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return fmt.Errorf("invalid SCRAM iteration count %q", attrs["i"])
+	}
+
+	saltedPassword, err := pbkdf2.Key(newHash, password, salt, iterations, newHash().Size())
+	if err != nil {
+		return fmt.Errorf("failed to derive SCRAM key: %w", err)
+	}
+	clientKey := scramHMAC(newHash, saltedPassword, "Client Key")
+	storedKey := newHash()
+	storedKey.Write(clientKey)
+
+	clientFinalBare := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirstBare + "," + string(serverFirst) + "," + clientFinalBare
+	proof := scramHMAC(newHash, storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	serverFinal, err := exchange([]byte(clientFinalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)))
+	if err != nil {
+		return err
+	}
+	final := scramAttributes(string(serverFinal))
+	if final["e"] != "" {
+		return fmt.Errorf("SCRAM authentication failed: %s", final["e"])
+	}
+	serverKey := scramHMAC(newHash, saltedPassword, "Server Key")
+	signature := base64.StdEncoding.EncodeToString(scramHMAC(newHash, serverKey, authMessage))
+	if !hmac.Equal([]byte(final["v"]), []byte(signature)) {
+		return fmt.Errorf("SCRAM server signature does not match")
+	}
+	return nil
+}
+
+// scramHMAC returns the HMAC of a message
+func scramHMAC(newHash func() hash.Hash, key []byte, message string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scramAttributes parses the comma separated attributes of a SCRAM message
+func scramAttributes(message string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(message, ",") {
+		if name, value, found := strings.Cut(attr, "="); found {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
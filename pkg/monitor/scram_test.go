@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestSCRAMExchange checks the SCRAM-SHA-256 example of RFC 7677
+func TestSCRAMExchange(t *testing.T) {
+	const (
+		clientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+		serverFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		clientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+		serverFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+	)
+
+	exchange := func(serverFinal string) func([]byte) ([]byte, error) {
+		step := 0
+		return func(message []byte) ([]byte, error) {
+			step++
+			switch {
+			case step == 1 && string(message) == clientFirst:
+				return []byte(serverFirst), nil
+			case step == 2 && string(message) == clientFinal:
+				return []byte(serverFinal), nil
+			}
+			return nil, fmt.Errorf("unexpected client message %d %q", step, message)
+		}
+	}
+
+	if err := scramExchange(exchange(serverFinal), "SCRAM-SHA-256", "user", "pencil", "rOprNGfwEbeRWgbNEkqO"); err != nil {
+		t.Errorf("scramExchange() = %v", err)
+	}
+	if err := scramExchange(exchange("v=AAAA"), "SCRAM-SHA-256", "user", "pencil", "rOprNGfwEbeRWgbNEkqO"); err == nil {
+		t.Error("scramExchange() accepted a wrong server signature")
+	}
+}
@@ -0,0 +1,379 @@
+package monitor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// SilencesConfig holds the settings of runtime silences
+type SilencesConfig struct {
+	File string `yaml:"file"` // JSON file persisting the silences (default "silences.json")
+}
+
+// Silence mutes the alerts matching its instance, query and category until EndsAt.
+// Empty matchers match everything, and matchers may contain shell patterns such as "prod-*".
+type Silence struct {
+	ID        string    `json:"id"`
+	Instance  string    `json:"instance,omitempty"`
+	Query     string    `json:"query,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// SuppressedAlert records an alert that was muted by a silence
+type SuppressedAlert struct {
+	Time      time.Time `json:"time"`
+	SilenceID string    `json:"silence_id"`
+	Instance  string    `json:"instance"`
+	Query     string    `json:"query"`
+	Category  string    `json:"category"`
+	Message   string    `json:"message"`
+}
+
+// maxSuppressedAlerts is the number of suppressed alerts kept in memory
+const maxSuppressedAlerts = 1000
+
+// Active checks if a silence is in effect at the given time
+func (s Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Matches checks if a silence applies to an alert
+func (s Silence) Matches(instance, query, category string) bool {
+	return matchesPattern(s.Instance, instance) && matchesPattern(s.Query, query) && matchesPattern(s.Category, category)
+}
+
+// matchesPattern matches a value against an optional shell pattern, case insensitive
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && matched
+}
+
+// SilenceStore holds the silences persisted in a JSON file.
+// The file is reloaded when it is changed by another process, such as the silence command.
+type SilenceStore struct {
+	file       string
+	modTime    time.Time
+	silences   []Silence
+	suppressed []SuppressedAlert
+	mu         sync.Mutex
+}
+
+// NewSilenceStore opens the silences persisted in file
+func NewSilenceStore(file string) (*SilenceStore, error) {
+	store := &SilenceStore{file: file}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads the silences file, a missing file holds no silences
+func (s *SilenceStore) load() error {
+	info, err := os.Stat(s.file)
+	if os.IsNotExist(err) {
+		s.silences = nil
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read silences file: %w", err)
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to read silences file: %w", err)
+	}
+
+	var silences []Silence
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &silences); err != nil {
+			return fmt.Errorf("failed to parse silences file: %w", err)
+		}
+	}
+	s.silences = silences
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// reloadIfChanged reloads the silences file when it was modified since it was last read
+func (s *SilenceStore) reloadIfChanged() error {
+	info, err := os.Stat(s.file)
+	if os.IsNotExist(err) {
+		if !s.modTime.IsZero() {
+			return s.load()
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read silences file: %w", err)
+	}
+	if !info.ModTime().Equal(s.modTime) {
+		return s.load()
+	}
+	return nil
+}
+
+// save writes the silences file, dropping silences that expired more than a week ago
+func (s *SilenceStore) save() error {
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	kept := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		if silence.EndsAt.After(cutoff) {
+			kept = append(kept, silence)
+		}
+	}
+	s.silences = kept
+
+	data, err := json.MarshalIndent(s.silences, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal silences: %w", err)
+	}
+	if err := os.WriteFile(s.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write silences file: %w", err)
+	}
+	if err := os.Rename(s.file+".tmp", s.file); err != nil {
+		return fmt.Errorf("failed to write silences file: %w", err)
+	}
+
+	if info, err := os.Stat(s.file); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Add creates a silence and persists it
+func (s *SilenceStore) Add(silence Silence) (Silence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadIfChanged(); err != nil {
+		return Silence{}, err
+	}
+
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = time.Now()
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return Silence{}, fmt.Errorf("silence must end after it starts")
+	}
+	if silence.ID == "" {
+		id := make([]byte, 4)
+		if _, err := rand.Read(id); err != nil {
+			return Silence{}, fmt.Errorf("failed to generate silence id: %w", err)
+		}
+		silence.ID = hex.EncodeToString(id)
+	}
+
+	s.silences = append(s.silences, silence)
+	return silence, s.save()
+}
+
+// Expire ends a silence now
+func (s *SilenceStore) Expire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadIfChanged(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range s.silences {
+		if s.silences[i].ID == id {
+			if s.silences[i].EndsAt.After(now) {
+				s.silences[i].EndsAt = now
+			}
+			return s.save()
+		}
+	}
+	return fmt.Errorf("silence %s not found", id)
+}
+
+// List returns the silences, including expired ones when all is set
+func (s *SilenceStore) List(all bool) ([]Silence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var silences []Silence
+	for _, silence := range s.silences {
+		if all || now.Before(silence.EndsAt) {
+			silences = append(silences, silence)
+		}
+	}
+	return silences, nil
+}
+
+// Match returns the active silence applying to an alert, if any
+func (s *SilenceStore) Match(instance, query, category string) (Silence, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep using the silences in memory if the file cannot be read
+	_ = s.reloadIfChanged()
+
+	now := time.Now()
+	for _, silence := range s.silences {
+		if silence.Active(now) && silence.Matches(instance, query, category) {
+			return silence, true
+		}
+	}
+	return Silence{}, false
+}
+
+// RecordSuppressed records an alert muted by a silence
+func (s *SilenceStore) RecordSuppressed(alert SuppressedAlert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suppressed = append(s.suppressed, alert)
+	if len(s.suppressed) > maxSuppressedAlerts {
+		s.suppressed = s.suppressed[len(s.suppressed)-maxSuppressedAlerts:]
+	}
+}
+
+// Suppressed returns the alerts recently muted by silences
+func (s *SilenceStore) Suppressed() []SuppressedAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SuppressedAlert(nil), s.suppressed...)
+}
+
+// isSilenced checks if an alert is muted by a silence, recording it when it is
+func (m *MonitorInstance) isSilenced(queryName string, rule AlertRule) bool {
+	silence, silenced := m.monitor.silences.Match(m.dbConfig.Instance, queryName, rule.Category)
+	if !silenced {
+		return false
+	}
+
+	m.monitor.logger.Printf("Alert for query %s suppressed by silence %s until %s (%s)", queryName, silence.ID, silence.EndsAt.Format(time.RFC3339), silence.Comment)
+	m.monitor.silences.RecordSuppressed(SuppressedAlert{
+		Time:      time.Now(),
+		SilenceID: silence.ID,
+		Instance:  m.dbConfig.Instance,
+		Query:     queryName,
+		Category:  rule.Category,
+		Message:   rule.Message,
+	})
+	return true
+}
+
+// RunSilenceCommand manages the silences of a configuration from the command line.
+// Supported commands are "add", "list" and "expire".
+func RunSilenceCommand(configPath string, args []string) error {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	store, err := NewSilenceStore(config.Silences.File)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: silence <add|list|expire> [options]")
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("silence add", flag.ContinueOnError)
+		instance := flags.String("instance", "", "instance to silence (pattern, empty for all)")
+		query := flags.String("query", "", "query to silence (pattern, empty for all)")
+		category := flags.String("category", "", "category to silence (pattern, empty for all)")
+		duration := flags.Duration("for", 0, "duration of the silence, e.g. 2h")
+		until := flags.String("until", "", "end of the silence, RFC 3339 timestamp")
+		comment := flags.String("comment", "", "reason for the silence")
+		createdBy := flags.String("by", os.Getenv("USER"), "creator of the silence")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		silence := Silence{
+			Instance:  *instance,
+			Query:     *query,
+			Category:  *category,
+			StartsAt:  time.Now(),
+			Comment:   *comment,
+			CreatedBy: *createdBy,
+		}
+		switch {
+		case *until != "":
+			silence.EndsAt, err = time.Parse(time.RFC3339, *until)
+			if err != nil {
+				return fmt.Errorf("invalid -until: %w", err)
+			}
+		case *duration > 0:
+			silence.EndsAt = silence.StartsAt.Add(*duration)
+		default:
+			return fmt.Errorf("either -for or -until is required")
+		}
+
+		silence, err = store.Add(silence)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Silence %s created until %s\n", silence.ID, silence.EndsAt.Format(time.RFC3339))
+
+	case "list":
+		flags := flag.NewFlagSet("silence list", flag.ContinueOnError)
+		all := flags.Bool("all", false, "include expired silences")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		silences, err := store.List(*all)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tINSTANCE\tQUERY\tCATEGORY\tENDS AT\tCREATED BY\tCOMMENT")
+		for _, s := range silences {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, orAny(s.Instance), orAny(s.Query), orAny(s.Category), s.EndsAt.Format(time.RFC3339), s.CreatedBy, s.Comment)
+		}
+		return w.Flush()
+
+	case "expire":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: silence expire <id>")
+		}
+		if err := store.Expire(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Silence %s expired\n", args[1])
+
+	default:
+		return fmt.Errorf("unknown silence command %q, expected add, list or expire", args[0])
+	}
+
+	return nil
+}
+
+// orAny returns "*" for an empty matcher
+func orAny(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	silence := Silence{Instance: "prod-*", Category: "Performance"}
+
+	tests := []struct {
+		instance, query, category string
+		want                      bool
+	}{
+		{"prod-db-01", "connections", "performance", true},
+		{"PROD-db-02", "replication_lag", "PERFORMANCE", true},
+		{"staging-db", "connections", "performance", false},
+		{"prod-db-01", "connections", "storage", false},
+	}
+	for _, tt := range tests {
+		if got := silence.Matches(tt.instance, tt.query, tt.category); got != tt.want {
+			t.Errorf("Matches(%q, %q, %q) = %v, want %v", tt.instance, tt.query, tt.category, got, tt.want)
+		}
+	}
+	if !(Silence{}).Matches("any", "query", "") {
+		t.Error("empty matchers do not match everything")
+	}
+}
+
+func TestSilenceStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "silences.json")
+	store, err := NewSilenceStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Add(Silence{Query: "connections", EndsAt: time.Now().Add(-time.Minute)}); err == nil {
+		t.Error("Add() accepted a silence ending before it starts")
+	}
+	silence, err := store.Add(Silence{Query: "connections", EndsAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if silence.ID == "" {
+		t.Fatal("Add() did not assign an id")
+	}
+	if match, ok := store.Match("prod", "connections", ""); !ok || match.ID != silence.ID {
+		t.Errorf("Match() = %+v, %v, want the silence", match, ok)
+	}
+	if _, ok := store.Match("prod", "replication_lag", ""); ok {
+		t.Error("Match() matched another query")
+	}
+
+	// A store of another process, such as the silence command, sees and expires the silence
+	other, err := NewSilenceStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if silences, _ := other.List(false); len(silences) != 1 {
+		t.Fatalf("List() in another store returned %d silences, want 1", len(silences))
+	}
+	if err := other.Expire(silence.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Expire("missing"); err == nil {
+		t.Error("Expire() of an unknown silence succeeded")
+	}
+
+	// Reloading depends on the modification time, which may not change within the same tick
+	store.modTime = time.Time{}
+	if _, ok := store.Match("prod", "connections", ""); ok {
+		t.Error("expired silence still matches")
+	}
+	if silences, _ := store.List(false); len(silences) != 0 {
+		t.Errorf("List() returned %d active silences, want 0", len(silences))
+	}
+	if silences, _ := store.List(true); len(silences) != 1 {
+		t.Errorf("List(all) returned %d silences, want 1", len(silences))
+	}
+}
+
+func TestSilenceStoreSuppressed(t *testing.T) {
+	store, err := NewSilenceStore(filepath.Join(t.TempDir(), "silences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxSuppressedAlerts+5; i++ {
+		store.RecordSuppressed(SuppressedAlert{Query: "connections"})
+	}
+	if suppressed := store.Suppressed(); len(suppressed) != maxSuppressedAlerts {
+		t.Errorf("Suppressed() returned %d alerts, want %d", len(suppressed), maxSuppressedAlerts)
+	}
+}
@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SyslogConfig holds syslog configuration
+type SyslogConfig struct {
+	Enabled      bool            `yaml:"enabled"`
+	Network      string          `yaml:"network"`              // "udp" (default), "tcp", "tls", "unix" or "unixgram"
+	Address      string          `yaml:"address"`              // host:port, or the socket path for unix (default localhost:514, localhost:6514 for tls, /dev/log for unix)
+	Facility     string          `yaml:"facility"`             // e.g. "local0" (default), "daemon" or "user"
+	AppName      string          `yaml:"app_name,omitempty"`   // APP-NAME of the messages (default postgres-stat-alert)
+	Hostname     string          `yaml:"hostname,omitempty"`   // HOSTNAME of the messages (default the host name)
+	EnterpriseID int             `yaml:"enterprise_id"`        // IANA private enterprise number of the structured data IDs
+	MaxSize      int             `yaml:"max_size,omitempty"`   // Longest message in bytes (default 2048 for udp, 8192 otherwise)
+	Priorities   map[string]int  `yaml:"priorities,omitempty"` // Syslog severity per alert severity, 0 (emergency) to 7 (debug)
+	TLS          TLSClientConfig `yaml:"tls,omitempty"`
+	Interval     time.Duration   `yaml:"interval"`
+}
+
+// Default message size limits: RFC 5426 receivers should accept 2048 byte datagrams, common stream receivers
+// such as rsyslog accept 8192 bytes
+const (
+	syslogMaxDatagram = 2048
+	syslogMaxStream   = 8192
+)
+
+// syslogFacilities maps the facility names to their codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogConn is the connection to the syslog server, shared by all instances and reopened after a write fails
+type syslogConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// sendSyslogAlert writes an alert or resolution to syslog
+func (m *MonitorInstance) sendSyslogAlert(n *Notification) DeliveryResult {
+	config := m.monitor.config.Alerts.Syslog
+	record := m.alertRecord(n, config.Priorities)
+	msg := syslogMessage(config, record)
+	if err := m.monitor.syslog.write(config, msg, m.monitor.config.Alerts.Delivery.SendTimeout); err != nil {
+		m.monitor.logger.Printf("Error sending syslog alert: %v", err)
+		return deliveryResult(n, fmt.Errorf("failed to send syslog alert: %w", err))
+	}
+	m.monitor.logger.Printf("Syslog alert sent successfully for query: %s", record.Query)
+	return deliveryResult(n, nil)
+}
+
+// syslogMessage formats a record as an RFC 5424 message with an alert and a row structured data element.
+// Messages longer than max_size leave out the last columns of the row, then the end of the text.
+func syslogMessage(config SyslogConfig, record AlertRecord) string {
+	msgID := "ALERT"
+	if record.Resolved {
+		msgID = "RESOLVED"
+	}
+
+	var sd strings.Builder
+	fmt.Fprintf(&sd, "[alert@%d", config.EnterpriseID)
+	params := [][2]string{
+		{"instance", record.Instance},
+		{"database", record.Database},
+		{"query", record.Query},
+		{"rule", record.Rule},
+		{"category", record.Category},
+		{"severity", record.Severity},
+		{"status", record.Status},
+		{"value", record.Value()},
+		{"threshold", fmt.Sprintf("%v", record.Threshold)},
+		{"operator", record.Operator},
+		{"alert_id", record.AlertID},
+	}
+	for _, param := range params {
+		if param[1] != "" {
+			fmt.Fprintf(&sd, ` %s="%s"`, param[0], syslogParamValue(param[1]))
+		}
+	}
+	sd.WriteString("]")
+
+	var row []string
+	for _, field := range rowFields(record.Row, record.Columns) {
+		if name := syslogName(field.Name, 32); name != "-" {
+			row = append(row, fmt.Sprintf(` %s="%s"`, name, syslogParamValue(field.Value)))
+		}
+	}
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s ",
+		syslogFacilities[config.Facility]*8+record.priority,
+		record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogName(config.Hostname, 255),
+		syslogName(config.AppName, 48),
+		os.Getpid(),
+		msgID)
+	// The UTF-8 BOM marks the message as UTF-8, as required by RFC 5424
+	text := " \xef\xbb\xbf" + record.Text()
+
+	for {
+		var msg strings.Builder
+		msg.WriteString(header)
+		msg.WriteString(sd.String())
+		if len(row) > 0 {
+			fmt.Fprintf(&msg, "[row@%d%s]", config.EnterpriseID, strings.Join(row, ""))
+		}
+		msg.WriteString(text)
+		if msg.Len() <= config.MaxSize || len(row) == 0 {
+			return truncateBytes(msg.String(), config.MaxSize)
+		}
+		row = row[:len(row)-1]
+	}
+}
+
+// truncateBytes shortens s to at most limit bytes without splitting a UTF-8 character
+func truncateBytes(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+// syslogName returns a header field or parameter name, which is limited to printable ASCII without spaces,
+// "=", "]" and quotes, or "-" when empty
+func syslogName(s string, limit int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() == limit {
+			break
+		}
+		if r > 32 && r < 127 && r != '=' && r != ']' && r != '"' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// syslogParamValue escapes a structured data parameter value
+func syslogParamValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// write sends a message, reconnecting once when the connection was closed by the server
+func (s *syslogConn) write(config SyslogConfig, msg string, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = dialSyslog(config, timeout); err != nil {
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(timeout))
+		if _, err = s.conn.Write(syslogFrame(s.conn, msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// syslogFrame frames a message for its transport: datagrams carry a single message, TCP and TLS streams use
+// octet counting (RFC 6587) and unix streams a trailing newline
+func syslogFrame(conn net.Conn, msg string) []byte {
+	switch conn.RemoteAddr().Network() {
+	case "udp", "unixgram":
+		return []byte(msg)
+	case "unix":
+		return []byte(msg + "\n")
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+// dialSyslog connects to the syslog server
+func dialSyslog(config SyslogConfig, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	switch config.Network {
+	case "tls":
+		tlsConfig, err := config.TLS.clientConfig(config.Address)
+		if err != nil {
+			return nil, err
+		}
+		return tls.DialWithDialer(dialer, "tcp", config.Address, tlsConfig)
+	case "unix":
+		// Local syslog daemons usually listen on a datagram socket, fall back to a stream socket
+		if conn, err := dialer.Dial("unixgram", config.Address); err == nil {
+			return conn, nil
+		}
+		return dialer.Dial("unix", config.Address)
+	}
+	return dialer.Dial(config.Network, config.Address)
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// syslogTestRecord returns a firing record with a result row
+func syslogTestRecord() AlertRecord {
+	return AlertRecord{
+		Time:       time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Status:     "firing",
+		Instance:   "prod",
+		Query:      "connections",
+		Message:    "Too many connections",
+		Observed:   143,
+		Threshold:  100,
+		Comparison: "observed 143 > threshold 100",
+		Row:        map[string]interface{}{"a": strings.Repeat("x", 100), "b": strings.Repeat("y", 100)},
+	}
+}
+
+func TestSyslogMessage(t *testing.T) {
+	config := SyslogConfig{Facility: "local0", Hostname: "db1", AppName: "pgstat", EnterpriseID: 99999, MaxSize: 8192}
+
+	msg := syslogMessage(config, syslogTestRecord())
+	if !strings.Contains(msg, `[alert@99999 instance="prod" query="connections" status="firing" value="143" threshold="100"]`) || !strings.Contains(msg, "[row@99999 a=") {
+		t.Errorf("syslogMessage() = %q, want the alert and row elements", msg)
+	}
+
+	record := syslogTestRecord()
+	record.Observed = nil
+	if msg := syslogMessage(config, record); strings.Contains(msg, "value=") {
+		t.Errorf("syslogMessage() = %q, want no value when nothing was observed", msg)
+	}
+}
+
+func TestSyslogMessageLimit(t *testing.T) {
+	config := SyslogConfig{Facility: "local0", Hostname: "db1", AppName: "pgstat", EnterpriseID: 99999}
+	full := syslogMessage(SyslogConfig{Facility: "local0", Hostname: "db1", AppName: "pgstat", EnterpriseID: 99999, MaxSize: 8192}, syslogTestRecord())
+
+	// The last column is left out first
+	config.MaxSize = len(full) - 50
+	msg := syslogMessage(config, syslogTestRecord())
+	if len(msg) > config.MaxSize || !strings.Contains(msg, " a=") || strings.Contains(msg, " b=") || !strings.HasSuffix(msg, "(observed 143 > threshold 100)") {
+		t.Errorf("syslogMessage() = %q, want the last column left out", msg)
+	}
+
+	// Without the row the text is cut, on a character boundary
+	record := syslogTestRecord()
+	record.Message = strings.Repeat("é", 2000)
+	config.MaxSize = 500
+	msg = syslogMessage(config, record)
+	if len(msg) > config.MaxSize || strings.Contains(msg, "[row@") || !utf8.ValidString(msg) {
+		t.Errorf("syslogMessage() = %q (%d bytes), want at most %d valid bytes without the row", msg, len(msg), config.MaxSize)
+	}
+}
+
+func TestSyslogConfigRequiresEnterpriseID(t *testing.T) {
+	if _, err := loadConfig(writeTestConfig(t, "alerts:\n  syslog:\n    enabled: true\n")); err == nil || !strings.Contains(err.Error(), "enterprise_id") {
+		t.Errorf("loadConfig() = %v, want an error requiring syslog.enterprise_id", err)
+	}
+
+	config := loadTestConfig(t, "alerts:\n  syslog:\n    enabled: true\n    enterprise_id: 99999\n")
+	if config.Alerts.Syslog.MaxSize != syslogMaxDatagram {
+		t.Errorf("max_size = %d, want %d for udp", config.Alerts.Syslog.MaxSize, syslogMaxDatagram)
+	}
+}
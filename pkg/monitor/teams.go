@@ -4,25 +4,30 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"slices"
 	"strings"
 	"time"
 )
 
 // TeamsConfig holds Microsoft Teams webhook configuration
 type TeamsConfig struct {
-	Enabled    bool          `yaml:"enabled"`
-	WebhookURL string        `yaml:"webhook_url"`
-	Interval   time.Duration `yaml:"interval"`
+	Enabled      bool             `yaml:"enabled"`
+	WebhookURL   string           `yaml:"webhook_url"`             // Teams Workflows (Power Automate) or legacy connector webhook URL
+	Format       string           `yaml:"format,omitempty"`        // "adaptive" for Adaptive Cards or "messagecard" for legacy connectors (default)
+	DashboardURL string           `yaml:"dashboard_url,omitempty"` // Linked from every card with an "Open dashboard" button
+	Graph        TeamsGraphConfig `yaml:"graph,omitempty"`         // Optional posting to a channel through Microsoft Graph
+	Interval     time.Duration    `yaml:"interval"`
 }
 
 // TeamsMessage represents a Microsoft Teams message
 type TeamsMessage struct {
-	Type       string                `json:"@type"`
-	Context    string                `json:"@context"`
-	ThemeColor string                `json:"themeColor,omitempty"`
-	Summary    string                `json:"summary"`
-	Sections   []TeamsMessageSection `json:"sections"`
+	Type            string                `json:"@type"`
+	Context         string                `json:"@context"`
+	ThemeColor      string                `json:"themeColor,omitempty"`
+	Summary         string                `json:"summary"`
+	Sections        []TeamsMessageSection `json:"sections"`
+	PotentialAction []TeamsMessageAction  `json:"potentialAction,omitempty"`
 }
 
 // TeamsMessageSection represents a section in Teams message
@@ -39,54 +44,242 @@ type TeamsMessageFact struct {
 	Value string `json:"value"`
 }
 
+// TeamsMessageAction represents a button of a message card opening a link
+type TeamsMessageAction struct {
+	Type    string                     `json:"@type"` // "OpenUri"
+	Name    string                     `json:"name"`
+	Targets []TeamsMessageActionTarget `json:"targets"`
+}
+
+// TeamsMessageActionTarget is the link opened by a message card button
+type TeamsMessageActionTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// TeamsCardMessage is a message carrying an Adaptive Card, as accepted by Teams Workflows webhooks
+type TeamsCardMessage struct {
+	Type        string            `json:"type"` // "message"
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+// TeamsAttachment is a card attached to a Teams message
+type TeamsAttachment struct {
+	ID          string      `json:"id,omitempty"`
+	ContentType string      `json:"contentType"`
+	ContentURL  *string     `json:"contentUrl"`
+	Content     interface{} `json:"content"`
+}
+
+// AdaptiveCard represents an Adaptive Card
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []AdaptiveElement `json:"body"`
+	Actions []AdaptiveAction  `json:"actions,omitempty"`
+	MSTeams *AdaptiveMSTeams  `json:"msteams,omitempty"`
+}
+
+// AdaptiveElement is a TextBlock, Container or FactSet of an Adaptive Card
+type AdaptiveElement struct {
+	Type      string            `json:"type"`
+	Text      string            `json:"text,omitempty"`
+	Size      string            `json:"size,omitempty"`
+	Weight    string            `json:"weight,omitempty"`
+	Color     string            `json:"color,omitempty"`
+	Wrap      bool              `json:"wrap,omitempty"`
+	IsSubtle  bool              `json:"isSubtle,omitempty"`
+	Separator bool              `json:"separator,omitempty"`
+	Style     string            `json:"style,omitempty"` // Container style: "attention", "warning", "good", "accent" or "emphasis"
+	Bleed     bool              `json:"bleed,omitempty"`
+	Items     []AdaptiveElement `json:"items,omitempty"`
+	Facts     []AdaptiveFact    `json:"facts,omitempty"`
+}
+
+// AdaptiveFact is a title and value pair of a FactSet
+type AdaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// AdaptiveAction is a button of an Adaptive Card opening a link
+type AdaptiveAction struct {
+	Type  string `json:"type"` // "Action.OpenUrl"
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// AdaptiveMSTeams holds the Teams specific settings of an Adaptive Card
+type AdaptiveMSTeams struct {
+	Width string `json:"width,omitempty"`
+}
+
 // sendTeamsAlert sends an alert to Microsoft Teams
-func (m *MonitorInstance) sendTeamsAlert(queryName string, rule AlertRule) error {
-	if m.monitor.config.Alerts.Teams.Interval > 0 && !m.alertTracker.CanSendAlert(queryName, "teams", m.monitor.config.Alerts.Teams.Interval) {
-		m.monitor.logger.Printf("%s alert for query %s skipped due to interval limit", "teams", queryName)
-		return fmt.Errorf("%s alert for query %s skipped due to interval limit", "teams", queryName)
-	}
-	// Choose theme color based on category
-	themeColor := "FF0000" // Red default
-	switch strings.ToLower(rule.Category) {
-	case "performance":
-		themeColor = "FFA500" // Orange
-	case "storage":
-		themeColor = "FFFF00" // Yellow
-	case "security":
-		themeColor = "FF0000" // Red
-	case "maintenance":
-		themeColor = "0080FF" // Blue
-	}
-
-	facts := []TeamsMessageFact{
-		{Name: "Instance", Value: m.dbConfig.Instance},
-		{Name: "Query", Value: queryName},
-		{Name: "Category", Value: rule.Category},
-		{Name: "Time", Value: time.Now().Format(time.RFC3339)},
-	}
-
-	section := TeamsMessageSection{
-		ActivityTitle:    "🚨 Database Alert",
-		ActivitySubtitle: rule.Message,
-		Text:             fmt.Sprintf("**Instance:** %s\n**Query:** %s\n**Message:** %s\n**Value:** %v \n %s", m.dbConfig.Instance, queryName, rule.Message, rule.Value, rule.ResolutionNote),
-		Facts:            facts,
-	}
-
-	teamsMsg := TeamsMessage{
+func (m *MonitorInstance) sendTeamsAlert(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postTeams(n, n.Query, m.formatAlert(n.Event())))
+}
+
+// sendTeamsBatch sends a group of alerts to Microsoft Teams as a single card with a fact per alert
+func (m *MonitorInstance) sendTeamsBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postTeams(n, batchQueries(n.Batch), formatBatch(n.Batch)))
+}
+
+// TeamsMessageCard renders the alert as a legacy connector message card with a fact per field
+func (f alertFormat) TeamsMessageCard(dashboard string) TeamsMessage {
+	var facts []TeamsMessageFact
+	for _, field := range slices.Concat(f.Fields, f.Row) {
+		facts = append(facts, TeamsMessageFact{Name: field.Name, Value: field.Value})
+	}
+	facts = append(facts, TeamsMessageFact{Name: "Time", Value: f.Time.Format("2006-01-02 15:04:05 MST")})
+
+	return TeamsMessage{
 		Type:       "MessageCard",
 		Context:    "http://schema.org/extensions",
-		ThemeColor: themeColor,
-		Summary:    fmt.Sprintf("Database Alert: %s", queryName),
-		Sections:   []TeamsMessageSection{section},
+		ThemeColor: strings.TrimPrefix(f.Color, "#"),
+		Summary:    fmt.Sprintf("%s: %s", f.Title, f.Summary),
+		Sections: []TeamsMessageSection{{
+			ActivityTitle:    f.Title,
+			ActivitySubtitle: f.Summary,
+			Facts:            facts,
+			Text:             f.Note,
+		}},
+		PotentialAction: teamsMessageActions(f.Runbook, dashboard),
+	}
+}
+
+// TeamsAdaptiveCard renders the alert as an Adaptive Card: a container colored by severity with the alert,
+// a FactSet of the result row and buttons linking to the runbook and dashboard. A group gets a colored
+// container per alert.
+func (f alertFormat) TeamsAdaptiveCard(dashboard string) AdaptiveCard {
+	actions := teamsCardActions(f.Runbook, dashboard)
+	if f.Group {
+		body := []AdaptiveElement{
+			{Type: "TextBlock", Text: f.Title, Size: "Large", Weight: "Bolder", Wrap: true},
+			{Type: "TextBlock", Text: f.Time.Format("2006-01-02 15:04:05 MST"), IsSubtle: true},
+		}
+		for _, field := range f.Fields {
+			body = append(body, AdaptiveElement{
+				Type:  "Container",
+				Style: teamsContainerStyle(field.Category, field.Severity),
+				Items: []AdaptiveElement{
+					{Type: "TextBlock", Text: "**" + field.Name + "**", Wrap: true},
+					{Type: "TextBlock", Text: field.Value, Wrap: true},
+				},
+			})
+		}
+		return newAdaptiveCard(body, actions)
 	}
 
+	facts := make([]AdaptiveFact, 0, len(f.Fields)+1)
+	for _, field := range f.Fields {
+		facts = append(facts, AdaptiveFact{Title: field.Name, Value: field.Value})
+	}
+	facts = append(facts, AdaptiveFact{Title: "Time", Value: f.Time.Format("2006-01-02 15:04:05 MST")})
+
+	body := []AdaptiveElement{
+		{
+			Type:  "Container",
+			Style: teamsContainerStyle(f.Category, f.Severity),
+			Bleed: true,
+			Items: []AdaptiveElement{
+				{Type: "TextBlock", Text: f.Title, Size: "Large", Weight: "Bolder", Wrap: true},
+				{Type: "TextBlock", Text: f.Summary, Wrap: true},
+			},
+		},
+		{Type: "FactSet", Facts: facts},
+	}
+	if len(f.Row) > 0 {
+		row := make([]AdaptiveFact, 0, len(f.Row))
+		for _, field := range f.Row {
+			row = append(row, AdaptiveFact{Title: field.Name, Value: field.Value})
+		}
+		body = append(body,
+			AdaptiveElement{Type: "TextBlock", Text: "Query Result", Weight: "Bolder", Separator: true},
+			AdaptiveElement{Type: "FactSet", Facts: row},
+		)
+	}
+	if f.Note != "" {
+		body = append(body, AdaptiveElement{Type: "TextBlock", Text: f.Note, Wrap: true, IsSubtle: true, Separator: true})
+	}
+	return newAdaptiveCard(body, actions)
+}
+
+// newAdaptiveCard creates a full width Adaptive Card
+func newAdaptiveCard(body []AdaptiveElement, actions []AdaptiveAction) AdaptiveCard {
+	return AdaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body:    body,
+		Actions: actions,
+		MSTeams: &AdaptiveMSTeams{Width: "Full"},
+	}
+}
+
+// teamsCardActions returns the buttons linking to the runbook of a rule and the dashboard
+func teamsCardActions(runbook, dashboard string) []AdaptiveAction {
+	var actions []AdaptiveAction
+	if runbook != "" {
+		actions = append(actions, AdaptiveAction{Type: "Action.OpenUrl", Title: "Open runbook", URL: runbook})
+	}
+	if dashboard != "" {
+		actions = append(actions, AdaptiveAction{Type: "Action.OpenUrl", Title: "Open dashboard", URL: dashboard})
+	}
+	return actions
+}
+
+// teamsMessageActions returns the runbook and dashboard buttons of a legacy message card
+func teamsMessageActions(runbook, dashboard string) []TeamsMessageAction {
+	var actions []TeamsMessageAction
+	for _, action := range teamsCardActions(runbook, dashboard) {
+		actions = append(actions, TeamsMessageAction{
+			Type:    "OpenUri",
+			Name:    action.Title,
+			Targets: []TeamsMessageActionTarget{{OS: "default", URI: action.URL}},
+		})
+	}
+	return actions
+}
+
+// postTeams delivers an alert to the webhook, as an Adaptive Card or legacy message card depending on the
+// configured format, and to the Graph channel when configured
+func (m *MonitorInstance) postTeams(n *Notification, queryName string, f alertFormat) error {
+	config := m.monitor.config.Alerts.Teams
+	card := f.TeamsAdaptiveCard(config.DashboardURL)
+
+	var targets []string
+	if config.WebhookURL != "" {
+		targets = append(targets, "webhook")
+	}
+	if config.Graph.Enabled {
+		targets = append(targets, "graph")
+	}
+	return n.sendToTargets(targets, func(target string) error {
+		if target == "graph" {
+			return m.postTeamsGraphMessage(queryName, card)
+		}
+
+		var payload interface{} = f.TeamsMessageCard(config.DashboardURL)
+		if config.Format == "adaptive" {
+			payload = TeamsCardMessage{
+				Type:        "message",
+				Attachments: []TeamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}},
+			}
+		}
+		return m.postTeamsMessage(queryName, payload)
+	})
+}
+
+// postTeamsMessage posts a message card or Adaptive Card message to the Teams webhook
+func (m *MonitorInstance) postTeamsMessage(queryName string, teamsMsg interface{}) error {
 	jsonData, err := json.Marshal(teamsMsg)
 	if err != nil {
 		m.monitor.logger.Printf("Error marshaling Teams message: %v", err)
 		return fmt.Errorf("failed to marshal Teams message: %w", err)
 	}
 
-	resp, err := http.Post(m.monitor.config.Alerts.Teams.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := m.monitor.httpClient.Post(m.monitor.config.Alerts.Teams.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		m.monitor.logger.Printf("Error sending Teams alert: %v", err)
 		return fmt.Errorf("failed to send Teams alert: %w", err)
@@ -96,8 +289,24 @@ func (m *MonitorInstance) sendTeamsAlert(queryName string, rule AlertRule) error
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		m.monitor.logger.Printf("Teams alert sent successfully for query: %s", queryName)
 	} else {
-		m.monitor.logger.Printf("Teams alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Teams alert failed with status code: %d (%s) for query: %s", resp.StatusCode, string(respBody), queryName)
+		return newHTTPStatusError(resp, respBody, "Teams alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
 	}
 
 	return nil
 }
+
+// teamsContainerStyle chooses the Adaptive Card container style based on category and severity
+func teamsContainerStyle(category, severity string) string {
+	if strings.ToLower(category) == "resolved" {
+		return "good"
+	}
+	switch severity {
+	case "warning":
+		return "warning"
+	case "info":
+		return "accent"
+	}
+	return "attention"
+}
@@ -0,0 +1,241 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TeamsGraphConfig holds the Microsoft Graph settings used to post alerts to a Teams channel.
+// Graph only allows posting channel messages with delegated permissions, so a refresh token of the
+// posting account is required, obtained once with the ChannelMessage.Send and offline_access scopes.
+type TeamsGraphConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	TenantID     string `yaml:"tenant_id"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret,omitempty"` // Required for confidential app registrations
+	RefreshToken string `yaml:"refresh_token"`
+	TokenFile    string `yaml:"token_file,omitempty"` // Keeps the rotated refresh token across restarts (default teams-graph-token.json)
+	TeamID       string `yaml:"team_id"`
+	ChannelID    string `yaml:"channel_id"`
+}
+
+// TeamsChatMessage is a Graph chat message carrying an Adaptive Card
+type TeamsChatMessage struct {
+	Body        TeamsChatMessageBody `json:"body"`
+	Attachments []TeamsAttachment    `json:"attachments"`
+}
+
+// TeamsChatMessageBody is the body of a Graph chat message
+type TeamsChatMessageBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// teamsGraphToken caches the Graph access token and keeps the latest refresh token, which rotates on use
+type teamsGraphToken struct {
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+	file         string // Token file the rotated refresh token is saved to
+	configured   string // Hash of the refresh token of the configuration
+	mu           sync.Mutex
+}
+
+// teamsGraphTokenFile is the content of the Graph token file
+type teamsGraphTokenFile struct {
+	RefreshToken string    `json:"refresh_token"`
+	Configured   string    `json:"configured"` // Hash of the configured refresh token the saved token descends from
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// loadTeamsGraphToken returns the latest refresh token: the one saved in the token file, unless the configured
+// refresh token was replaced since it was saved
+func loadTeamsGraphToken(config TeamsGraphConfig) (*teamsGraphToken, error) {
+	sum := sha256.Sum256([]byte(config.RefreshToken))
+	token := &teamsGraphToken{
+		refreshToken: config.RefreshToken,
+		file:         config.TokenFile,
+		configured:   hex.EncodeToString(sum[:]),
+	}
+	if !config.Enabled || token.file == "" {
+		return token, nil
+	}
+
+	data, err := os.ReadFile(token.file)
+	if os.IsNotExist(err) {
+		return token, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Teams Graph token file: %w", err)
+	}
+
+	var saved teamsGraphTokenFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse Teams Graph token file: %w", err)
+	}
+	if saved.Configured == token.configured && saved.RefreshToken != "" {
+		token.refreshToken = saved.RefreshToken
+	}
+	return token, nil
+}
+
+// save writes the refresh token to the token file, token.mu must be held
+func (token *teamsGraphToken) save() error {
+	if token.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(teamsGraphTokenFile{
+		RefreshToken: token.refreshToken,
+		Configured:   token.configured,
+		UpdatedAt:    time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Teams Graph token: %w", err)
+	}
+	// Write to a temporary file first so a crash never loses the only valid refresh token
+	if err := os.WriteFile(token.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write Teams Graph token file: %w", err)
+	}
+	if err := os.Rename(token.file+".tmp", token.file); err != nil {
+		return fmt.Errorf("failed to write Teams Graph token file: %w", err)
+	}
+	return nil
+}
+
+// graphTokenResponse is the response of the Microsoft identity platform token endpoint
+type graphTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// teamsGraphAccessToken returns a valid Graph access token, redeeming the refresh token when needed
+func (m *Monitor) teamsGraphAccessToken() (string, error) {
+	token := m.teamsGraph
+	token.mu.Lock()
+	defer token.mu.Unlock()
+
+	if token.accessToken != "" && time.Now().Before(token.expiresAt) {
+		return token.accessToken, nil
+	}
+
+	config := m.config.Alerts.Teams.Graph
+	form := url.Values{
+		"client_id":     {config.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.refreshToken},
+		"scope":         {"https://graph.microsoft.com/ChannelMessage.Send offline_access"},
+	}
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(config.TenantID))
+	resp, err := m.httpClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to request Graph token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var tokenResp graphTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil || resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "" {
+		if tokenResp.Error != "" {
+			return "", newHTTPStatusError(resp, body, "Graph token request failed: %s: %s", tokenResp.Error, firstLine(tokenResp.ErrorDescription))
+		}
+		return "", newHTTPStatusError(resp, body, "Graph token request failed with status code: %d", resp.StatusCode)
+	}
+
+	token.accessToken = tokenResp.AccessToken
+	// Renew a minute early so a token does not expire in flight
+	token.expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+	if tokenResp.RefreshToken != "" && tokenResp.RefreshToken != token.refreshToken {
+		token.refreshToken = tokenResp.RefreshToken
+		if err := token.save(); err != nil {
+			m.logger.Printf("Error saving rotated Teams Graph refresh token: %v", err)
+		}
+	}
+	return token.accessToken, nil
+}
+
+// postTeamsGraphMessage posts an Adaptive Card to the configured Teams channel through Microsoft Graph.
+// When Graph rejects the access token before it expires, e.g. after it was revoked, the refresh token is
+// redeemed again and the message posted once more.
+func (m *MonitorInstance) postTeamsGraphMessage(queryName string, card AdaptiveCard) error {
+	config := m.monitor.config.Alerts.Teams.Graph
+
+	content, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Teams card: %w", err)
+	}
+	msg := TeamsChatMessage{
+		Body: TeamsChatMessageBody{ContentType: "html", Content: `<attachment id="1"></attachment>`},
+		Attachments: []TeamsAttachment{{
+			ID:          "1",
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     string(content),
+		}},
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Teams Graph message: %w", err)
+	}
+
+	messagesURL := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/channels/%s/messages",
+		url.PathEscape(config.TeamID), url.PathEscape(config.ChannelID))
+	for redeemed := false; ; redeemed = true {
+		accessToken, err := m.monitor.teamsGraphAccessToken()
+		if err != nil {
+			m.monitor.logger.Printf("Error getting Graph token for Teams alert: %v", err)
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, messagesURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return fmt.Errorf("failed to create Teams Graph request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		resp, err := m.monitor.httpClient.Do(req)
+		if err != nil {
+			m.monitor.logger.Printf("Error sending Teams Graph alert: %v", err)
+			return fmt.Errorf("failed to send Teams Graph alert: %w", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Drop the cached token so that it is redeemed again
+			m.monitor.teamsGraph.mu.Lock()
+			if m.monitor.teamsGraph.accessToken == accessToken {
+				m.monitor.teamsGraph.accessToken = ""
+			}
+			m.monitor.teamsGraph.mu.Unlock()
+			if !redeemed {
+				m.monitor.logger.Printf("Teams Graph rejected the access token for query: %s, redeeming the refresh token again", queryName)
+				continue
+			}
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			m.monitor.logger.Printf("Teams Graph alert failed with status code: %d (%s) for query: %s", resp.StatusCode, strings.TrimSpace(string(respBody)), queryName)
+			return newHTTPStatusError(resp, respBody, "Teams Graph alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+		}
+
+		m.monitor.logger.Printf("Teams Graph alert sent successfully for query: %s", queryName)
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTeamsGraphTokenFile(t *testing.T) {
+	config := TeamsGraphConfig{
+		Enabled:      true,
+		RefreshToken: "configured",
+		TokenFile:    filepath.Join(t.TempDir(), "teams-graph-token.json"),
+	}
+
+	token, err := loadTeamsGraphToken(config)
+	if err != nil {
+		t.Fatalf("loadTeamsGraphToken() error = %v", err)
+	}
+	if token.refreshToken != "configured" {
+		t.Fatalf("refresh token without a token file = %q, want the configured one", token.refreshToken)
+	}
+
+	// A rotated refresh token survives a restart
+	token.refreshToken = "rotated"
+	if err := token.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	info, err := os.Stat(config.TokenFile)
+	if err != nil {
+		t.Fatalf("token file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if token, err = loadTeamsGraphToken(config); err != nil || token.refreshToken != "rotated" {
+		t.Errorf("refresh token after restart = %q (%v), want the rotated one", token.refreshToken, err)
+	}
+
+	// Replacing the configured refresh token takes precedence over the saved one
+	config.RefreshToken = "reissued"
+	if token, err = loadTeamsGraphToken(config); err != nil || token.refreshToken != "reissued" {
+		t.Errorf("refresh token after changing the configuration = %q (%v), want the configured one", token.refreshToken, err)
+	}
+}
+
+// rewriteTransport sends every request to a test server, whatever its host
+type rewriteTransport struct {
+	server *httptest.Server
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return t.server.Client().Transport.RoundTrip(req)
+}
+
+func TestTeamsGraphRedeemsRevokedToken(t *testing.T) {
+	var mu sync.Mutex
+	var redeemed, posted int
+	denied := false // The account lost the permission, every access token is rejected
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+			redeemed++
+			fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"rotated-%d","expires_in":3600}`, redeemed, redeemed)
+			return
+		}
+		posted++
+		if denied || r.Header.Get("Authorization") != "Bearer access-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, ""))
+	instance.monitor.httpClient = &http.Client{Transport: rewriteTransport{server}}
+	instance.monitor.teamsGraph = &teamsGraphToken{refreshToken: "configured", file: filepath.Join(t.TempDir(), "token.json")}
+
+	// The first access token is revoked before it expires
+	if err := instance.postTeamsGraphMessage("connections", AdaptiveCard{}); err != nil {
+		t.Fatalf("postTeamsGraphMessage() = %v, want it posted with a new access token", err)
+	}
+	if redeemed != 2 || posted != 2 {
+		t.Errorf("redeemed %d times and posted %d times, want 2 and 2", redeemed, posted)
+	}
+	if token := instance.monitor.teamsGraph; token.accessToken != "access-2" || token.refreshToken != "rotated-2" {
+		t.Errorf("token = %q, refresh token %q, want the new ones", token.accessToken, token.refreshToken)
+	}
+
+	// A token rejected again right after redeeming it is not retried further
+	mu.Lock()
+	denied, posted = true, 0
+	mu.Unlock()
+	err := instance.postTeamsGraphMessage("connections", AdaptiveCard{})
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized || posted != 2 {
+		t.Errorf("postTeamsGraphMessage() = %v after %d posts, want the 401 after one retry", err, posted)
+	}
+}
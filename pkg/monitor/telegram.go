@@ -5,52 +5,160 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
+	"strings"
 	"time"
 )
 
 // TelegramConfig holds Telegram bot configuration
 type TelegramConfig struct {
-	Enabled  bool          `yaml:"enabled"`
-	BotToken string        `yaml:"bot_token"`
-	ChatID   string        `yaml:"chat_id"`
-	Interval time.Duration `yaml:"interval"`
+	Enabled      bool          `yaml:"enabled"`
+	BotToken     string        `yaml:"bot_token"`
+	ChatID       string        `yaml:"chat_id"`
+	Interval     time.Duration `yaml:"interval"`
+	Commands     bool          `yaml:"commands,omitempty"`      // Accept bot commands and add ack/silence buttons to alerts
+	AllowedChats []string      `yaml:"allowed_chats,omitempty"` // Chat IDs allowed to send commands (default: chat_id)
+	PollTimeout  time.Duration `yaml:"poll_timeout,omitempty"`  // Long polling timeout of getUpdates (default 30s)
+	APIURL       string        `yaml:"api_url,omitempty"`       // Bot API server (default https://api.telegram.org)
 }
 
 // TelegramMessage represents a Telegram message
 type TelegramMessage struct {
-	ChatID    string `json:"chat_id"`
-	Text      string `json:"text"`
-	ParseMode string `json:"parse_mode,omitempty"`
+	ChatID      string               `json:"chat_id"`
+	Text        string               `json:"text"`
+	ParseMode   string               `json:"parse_mode,omitempty"`
+	ReplyMarkup *TelegramReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+// TelegramReplyMarkup holds the inline keyboard attached to a message
+type TelegramReplyMarkup struct {
+	InlineKeyboard [][]TelegramButton `json:"inline_keyboard"`
+}
+
+// TelegramButton is an inline keyboard button sending callback data to the bot
+type TelegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// telegramURL returns the URL of a Telegram Bot API method
+func (m *Monitor) telegramURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimRight(m.config.Alerts.Telegram.APIURL, "/"), m.config.Alerts.Telegram.BotToken, method)
+}
+
+// maxTelegramCallbackData is the size limit of the callback data of a Telegram button in bytes
+const maxTelegramCallbackData = 64
+
+// Limits of Telegram messages, in characters. Names and values are cut so that every line of a message stays
+// below the message limit, even with every character escaped.
+const (
+	telegramMaxMessage = 4096
+	telegramMaxName    = 64
+	telegramMaxValue   = 512
+)
+
+// telegramAlertKeyboard returns the ack and silence buttons of an alert, nil when commands are disabled.
+// The silence buttons refer to the instance and query, so they keep working after the alert resolves;
+// when those do not fit in the callback data they fall back to the alert id.
+func (m *MonitorInstance) telegramAlertKeyboard(queryName string, rule AlertRule) *TelegramReplyMarkup {
+	if !m.monitor.config.Alerts.Telegram.Commands {
+		return nil
+	}
+	id := alertID(m.alertKey(queryName, rule))
+	target := m.dbConfig.Instance + "/" + queryName
+	if len("silence "+target+" 24h") > maxTelegramCallbackData || strings.ContainsAny(target, " *?[") {
+		target = id
+	}
+	return &TelegramReplyMarkup{InlineKeyboard: [][]TelegramButton{{
+		{Text: "✅ Ack", CallbackData: "ack " + id},
+		{Text: "🔕 Silence 1h", CallbackData: "silence " + target + " 1h"},
+		{Text: "🔕 Silence 24h", CallbackData: "silence " + target + " 24h"},
+	}}}
 }
 
 // sendTelegramAlert sends an alert to Telegram
-func (m *MonitorInstance) sendTelegramAlert(queryName string, rule AlertRule) error {
-	if m.monitor.config.Alerts.Telegram.Interval > 0 && !m.alertTracker.CanSendAlert(queryName, "telegram", m.monitor.config.Alerts.Telegram.Interval) {
-		m.monitor.logger.Printf("%s alert for query %s skipped due to interval limit", "telegram", queryName)
-		return fmt.Errorf("%s alert for query %s skipped due to interval limit", "telegram", queryName)
+func (m *MonitorInstance) sendTelegramAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	message := m.formatAlert(event).TelegramHTML()
+	if hasRuleRecipients(rule, "telegram") {
+		message += "\n<b>Attention:</b> " + escapeHTML(m.monitor.displayRecipients(rule, "telegram"))
 	}
-	// Use HTML parse mode which is more reliable than Markdown
-	message := fmt.Sprintf("🚨 <b>Database Alert</b> 🚨\n\n"+
-		"<b>Instance:</b> %s\n"+
-		"<b>Query:</b> %s\n"+
-		"<b>Category:</b> %s\n"+
-		"<b>Message:</b> %s\n"+
-		"<b>Time:</b> %s\n"+
-		"<b>Value:</b> %s \n%s",
-		escapeHTML(m.dbConfig.Instance),
-		escapeHTML(queryName),
-		escapeHTML(rule.Category),
-		escapeHTML(rule.Message),
-		time.Now().Format("2006-01-02 15:04:05"),
-		escapeHTML(fmt.Sprintf("%v", rule.Value)),
-		escapeHTML(rule.ResolutionNote),
+
+	return deliveryResult(n, m.postTelegramMessages(n, queryName, message, m.telegramAlertKeyboard(queryName, rule)))
+}
+
+// sendTelegramBatch sends a group of alerts to Telegram as a single list
+func (m *MonitorInstance) sendTelegramBatch(n *Notification) DeliveryResult {
+	return deliveryResult(n, m.postTelegramMessages(n, batchQueries(n.Batch), formatBatch(n.Batch).TelegramHTML(), nil))
+}
+
+// TelegramHTML renders the alert in the HTML subset of the Telegram Bot API, which is more reliable than Markdown.
+// Long values are cut and tags never span lines, so the message can be split at any line break.
+func (f alertFormat) TelegramHTML() string {
+	f.Summary = truncateText(f.Summary, telegramMaxValue)
+	f.Note = truncateText(f.Note, telegramMaxValue)
+	f.Fields = telegramFields(f.Fields)
+	f.Row = telegramFields(f.Row)
+	return f.markup(
+		telegramTag("b"),
+		telegramTag("i"),
+		escapeHTML,
 	)
+}
+
+// telegramTag returns a function enclosing each line of a text in an HTML tag
+func telegramTag(tag string) func(string) string {
+	return func(s string) string {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			lines[i] = "<" + tag + ">" + line + "</" + tag + ">"
+		}
+		return strings.Join(lines, "\n")
+	}
+}
+
+// telegramFields returns a copy of fields with their names and values cut to the Telegram limits
+func telegramFields(fields []alertField) []alertField {
+	cut := make([]alertField, len(fields))
+	for i, field := range fields {
+		field.Name = truncateText(field.Name, telegramMaxName)
+		field.Value = truncateText(field.Value, telegramMaxValue)
+		cut[i] = field
+	}
+	return cut
+}
 
+// postTelegramMessages posts a message to the Telegram chat, split into several messages at line breaks when it is
+// longer than Telegram allows. The keyboard is attached to the last one. The messages posted are recorded on the
+// notification, so a retry continues with the first message that failed.
+func (m *MonitorInstance) postTelegramMessages(n *Notification, queryName, message string, markup *TelegramReplyMarkup) error {
+	parts := splitText(message, telegramMaxMessage)
+	if len(parts) == 1 {
+		return m.postTelegramMessage(queryName, message, markup)
+	}
+
+	for i, text := range parts {
+		var partMarkup *TelegramReplyMarkup
+		if i == len(parts)-1 {
+			partMarkup = markup
+		}
+		err := n.sendToTargets([]string{fmt.Sprintf("message %d/%d", i+1, len(parts))}, func(string) error {
+			return m.postTelegramMessage(queryName, text, partMarkup)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postTelegramMessage posts an HTML formatted message to the Telegram chat, with an optional inline keyboard
+func (m *MonitorInstance) postTelegramMessage(queryName, message string, markup *TelegramReplyMarkup) error {
 	telegramMsg := TelegramMessage{
-		ChatID:    m.monitor.config.Alerts.Telegram.ChatID,
-		Text:      message,
-		ParseMode: "HTML",
+		ChatID:      m.monitor.config.Alerts.Telegram.ChatID,
+		Text:        message,
+		ParseMode:   "HTML",
+		ReplyMarkup: markup,
 	}
 
 	jsonData, err := json.Marshal(telegramMsg)
@@ -59,9 +167,7 @@ func (m *MonitorInstance) sendTelegramAlert(queryName string, rule AlertRule) er
 		return fmt.Errorf("failed to marshal Telegram message: %w", err)
 	}
 
-	telegramURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", m.monitor.config.Alerts.Telegram.BotToken)
-
-	resp, err := http.Post(telegramURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := m.monitor.httpClient.Post(m.monitor.telegramURL("sendMessage"), "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		m.monitor.logger.Printf("Error sending Telegram alert: %v", err)
 		return fmt.Errorf("failed to send Telegram alert: %w", err)
@@ -79,7 +185,18 @@ func (m *MonitorInstance) sendTelegramAlert(queryName string, rule AlertRule) er
 		respBody, _ := io.ReadAll(resp.Body)
 
 		m.monitor.logger.Printf("Telegram alert failed with status code: %d %s (%s) for query: %s", resp.StatusCode, resp.Status, string(respBody), queryName)
-		return fmt.Errorf("Telegram alert failed with status code: %d %s (%s) for query: %s", resp.StatusCode, resp.Status, string(respBody), queryName)
+		statusErr := newHTTPStatusError(resp, respBody, "Telegram alert failed with status code: %d %s (%s) for query: %s", resp.StatusCode, resp.Status, string(respBody), queryName)
+
+		// Telegram reports flood control waits in the body rather than in a Retry-After header
+		var telegramErr struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		if json.Unmarshal(respBody, &telegramErr) == nil && telegramErr.Parameters.RetryAfter > 0 {
+			statusErr.RetryAfter = time.Duration(telegramErr.Parameters.RetryAfter) * time.Second
+		}
+		return statusErr
 	}
 
 	return nil
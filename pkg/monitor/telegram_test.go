@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTelegramLongAlertIsSplit(t *testing.T) {
+	server, requests := recordingServer(t, http.StatusOK, `{"ok":true}`)
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(telegramTestConfig, server.URL)))
+	event := testEvent()
+	event.Row = make(map[string]interface{})
+	for i := range 20 {
+		event.Row[fmt.Sprintf("column%d", i)] = strings.Repeat("a<b", 300)
+	}
+	n := instance.newNotification("telegram", event)
+
+	if result := instance.sendTelegramAlert(n); result.Status != DeliverySent {
+		t.Fatalf("sendTelegramAlert() = %+v", result)
+	}
+	sent := requests()
+	if len(sent) < 2 {
+		t.Fatalf("sent %d messages, want the alert split", len(sent))
+	}
+	var texts []string
+	for i, r := range sent {
+		var msg TelegramMessage
+		if err := json.Unmarshal(r.Body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, msg.Text)
+		if n := len([]rune(msg.Text)); n > telegramMaxMessage {
+			t.Errorf("message %d has %d characters, over the Telegram limit", i+1, n)
+		}
+		for _, tag := range []string{"b", "i"} {
+			if strings.Count(msg.Text, "<"+tag+">") != strings.Count(msg.Text, "</"+tag+">") {
+				t.Errorf("message %d has unbalanced <%s> tags", i+1, tag)
+			}
+		}
+		if last := i == len(sent)-1; (msg.ReplyMarkup != nil) != last {
+			t.Errorf("message %d has keyboard %v, want it on the last message only", i+1, msg.ReplyMarkup)
+		}
+	}
+	if text := strings.Join(texts, "\n"); !strings.Contains(text, strings.Repeat("a&lt;b", 170)+"a…") || strings.Contains(text, strings.Repeat("a&lt;b", 171)) {
+		t.Error("row values are not cut to the Telegram value limit")
+	}
+}
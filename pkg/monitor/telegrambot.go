@@ -0,0 +1,576 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStatusAlerts is the number of firing alerts listed by the status command
+const maxStatusAlerts = 25
+
+// maxRunRows is the number of result rows shown by the run command
+const maxRunRows = 10
+
+// telegramUpdate is an incoming update of the Telegram Bot API
+type telegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramIncoming      `json:"message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+// telegramIncoming is a message received by the bot
+type telegramIncoming struct {
+	MessageID int64        `json:"message_id"`
+	From      telegramUser `json:"from"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// telegramCallbackQuery is a press of an inline keyboard button
+type telegramCallbackQuery struct {
+	ID      string            `json:"id"`
+	From    telegramUser      `json:"from"`
+	Message *telegramIncoming `json:"message"`
+	Data    string            `json:"data"`
+}
+
+// telegramUser is the sender of a message or button press
+type telegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+}
+
+// name returns the handle of a user, falling back to the first name and id
+func (u telegramUser) name() string {
+	switch {
+	case u.Username != "":
+		return "@" + u.Username
+	case u.FirstName != "":
+		return u.FirstName
+	}
+	return strconv.FormatInt(u.ID, 10)
+}
+
+// firingAlert is a firing alert condition of an instance
+type firingAlert struct {
+	ID       string
+	Key      string
+	Instance *MonitorInstance
+	Query    string
+	Since    time.Time
+	AckedBy  string
+}
+
+// pollTelegramCommands long-polls the Telegram Bot API for commands and answers them until ctx is done
+func (m *Monitor) pollTelegramCommands(ctx context.Context) {
+	config := m.config.Alerts.Telegram
+	client := &http.Client{Timeout: config.PollTimeout + 10*time.Second}
+	m.logger.Printf("Accepting Telegram commands from chats %s", strings.Join(m.telegramAllowedChats(), ", "))
+
+	var offset int64
+	backoff := time.Second
+	for {
+		updates, err := m.getTelegramUpdates(ctx, client, offset)
+		if ctx.Err() != nil {
+			m.logger.Printf("Stopped accepting Telegram commands")
+			return
+		}
+		if err != nil {
+			m.logger.Printf("Error polling Telegram updates, retrying in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+				m.logger.Printf("Stopped accepting Telegram commands")
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+			continue
+		}
+		backoff = time.Second
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			m.handleTelegramUpdate(update)
+		}
+	}
+}
+
+// getTelegramUpdates waits for updates after offset
+func (m *Monitor) getTelegramUpdates(ctx context.Context, client *http.Client, offset int64) ([]telegramUpdate, error) {
+	params := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(m.config.Alerts.Telegram.PollTimeout.Seconds()))},
+		"allowed_updates": {`["message","callback_query"]`},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.telegramURL("getUpdates")+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create updates request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get updates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode updates (status %d): %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("getUpdates failed with status code %d: %s", resp.StatusCode, result.Description)
+	}
+	return result.Result, nil
+}
+
+// handleTelegramUpdate answers a command message or a button press from an authorised chat
+func (m *Monitor) handleTelegramUpdate(update telegramUpdate) {
+	switch {
+	case update.Message != nil:
+		message := update.Message
+		if !strings.HasPrefix(message.Text, "/") {
+			return
+		}
+		if !m.telegramChatAllowed(message.Chat.ID) {
+			m.logger.Printf("Ignoring Telegram command from unauthorised chat %d (%s)", message.Chat.ID, message.From.name())
+			return
+		}
+		reply := m.executeTelegramCommand(message.Text, message.From.name())
+		if err := m.replyTelegram(message.Chat.ID, reply); err != nil {
+			m.logger.Printf("Error replying to Telegram command %q: %v", message.Text, err)
+		}
+
+	case update.CallbackQuery != nil:
+		callback := update.CallbackQuery
+		if callback.Message == nil || !m.telegramChatAllowed(callback.Message.Chat.ID) {
+			m.logger.Printf("Ignoring Telegram button press from unauthorised user %s", callback.From.name())
+			m.answerTelegramCallback(callback.ID, "Not authorised")
+			return
+		}
+		reply := m.executeTelegramCommand("/"+callback.Data, callback.From.name())
+		m.answerTelegramCallback(callback.ID, firstLine(stripHTML(reply)))
+		if err := m.replyTelegram(callback.Message.Chat.ID, reply); err != nil {
+			m.logger.Printf("Error replying to Telegram button %q: %v", callback.Data, err)
+		}
+	}
+}
+
+// telegramAllowedChats returns the chat IDs allowed to send commands
+func (m *Monitor) telegramAllowedChats() []string {
+	if len(m.config.Alerts.Telegram.AllowedChats) > 0 {
+		return m.config.Alerts.Telegram.AllowedChats
+	}
+	return []string{m.config.Alerts.Telegram.ChatID}
+}
+
+// telegramChatAllowed checks if a chat may send commands
+func (m *Monitor) telegramChatAllowed(chatID int64) bool {
+	id := strconv.FormatInt(chatID, 10)
+	for _, allowed := range m.telegramAllowedChats() {
+		if strings.TrimSpace(allowed) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// executeTelegramCommand runs a bot command and returns the HTML formatted reply
+func (m *Monitor) executeTelegramCommand(text, by string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return telegramHelp
+	}
+	// Commands in groups may be addressed to the bot, e.g. "/status@my_bot"
+	command, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	args := fields[1:]
+	m.logger.Printf("Telegram command /%s %s from %s", command, strings.Join(args, " "), by)
+
+	switch strings.ToLower(command) {
+	case "start", "help":
+		return telegramHelp
+	case "status":
+		return m.telegramStatus()
+	case "ack":
+		if len(args) != 1 {
+			return "Usage: /ack &lt;id&gt;"
+		}
+		return m.acknowledgeAlert(args[0], by)
+	case "silence":
+		if len(args) < 2 {
+			return "Usage: /silence &lt;query, instance/query or id&gt; &lt;duration&gt; [comment]"
+		}
+		return m.silenceFromTelegram(args[0], args[1], strings.Join(args[2:], " "), by)
+	case "run":
+		if len(args) != 1 {
+			return "Usage: /run &lt;query&gt;"
+		}
+		return m.runQueryReport(args[0])
+	}
+	return fmt.Sprintf("Unknown command /%s\n\n%s", escapeHTML(command), telegramHelp)
+}
+
+// telegramHelp lists the bot commands
+const telegramHelp = "<b>Commands</b>\n" +
+	"/status - list firing alerts\n" +
+	"/ack &lt;id&gt; - stop repeat notifications of an alert until it resolves\n" +
+	"/silence &lt;query, instance/query or id&gt; &lt;duration&gt; [comment] - silence a query, e.g. /silence database_size 2h\n" +
+	"/run &lt;query&gt; - run a query now and show its result"
+
+// firingAlerts returns the firing alerts of all instances, oldest first
+func (m *Monitor) firingAlerts() []firingAlert {
+	var alerts []firingAlert
+	for _, instance := range m.instances {
+		for key, since := range instance.alertTracker.FiringAlerts() {
+			query, _, _ := strings.Cut(strings.TrimPrefix(key, instance.dbConfig.Instance+"/"), "/")
+			ackedBy, _ := instance.alertTracker.Acknowledged(key)
+			alerts = append(alerts, firingAlert{
+				ID:       alertID(key),
+				Key:      key,
+				Instance: instance,
+				Query:    query,
+				Since:    since,
+				AckedBy:  ackedBy,
+			})
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].Since.Equal(alerts[j].Since) {
+			return alerts[i].Since.Before(alerts[j].Since)
+		}
+		return alerts[i].Key < alerts[j].Key
+	})
+	return alerts
+}
+
+// findFiringAlert returns the firing alert with the given id
+func (m *Monitor) findFiringAlert(id string) (firingAlert, bool) {
+	for _, alert := range m.firingAlerts() {
+		if strings.EqualFold(alert.ID, id) {
+			return alert, true
+		}
+	}
+	return firingAlert{}, false
+}
+
+// findRule returns the configured rule of a query with the given alert key
+func (m *MonitorInstance) findRule(queryName, key string) (AlertRule, bool) {
+	for _, query := range m.monitor.config.Queries {
+		if query.Name != queryName {
+			continue
+		}
+		for _, rule := range query.AlertRules {
+			if m.alertKey(queryName, rule) == key {
+				return rule, true
+			}
+		}
+	}
+	return AlertRule{}, false
+}
+
+// telegramStatus lists the firing alerts
+func (m *Monitor) telegramStatus() string {
+	alerts := m.firingAlerts()
+	if len(alerts) == 0 {
+		return "✅ No firing alerts"
+	}
+
+	var status strings.Builder
+	fmt.Fprintf(&status, "🔥 <b>Firing alerts: %d</b>\n", len(alerts))
+	for i, alert := range alerts {
+		if i == maxStatusAlerts {
+			fmt.Fprintf(&status, "\n… and %d more", len(alerts)-maxStatusAlerts)
+			break
+		}
+
+		message := "Query error"
+		category := "error"
+		if rule, found := alert.Instance.findRule(alert.Query, alert.Key); found {
+			message = rule.Message
+			category = rule.Category
+		}
+		fmt.Fprintf(&status, "\n<code>%s</code> <b>%s / %s</b> [%s]\n%s\nFiring for %s",
+			alert.ID,
+			escapeHTML(alert.Instance.dbConfig.Instance),
+			escapeHTML(alert.Query),
+			escapeHTML(category),
+			escapeHTML(message),
+			time.Since(alert.Since).Round(time.Second),
+		)
+		if alert.AckedBy != "" {
+			fmt.Fprintf(&status, ", acknowledged by %s", escapeHTML(alert.AckedBy))
+		}
+		status.WriteString("\n")
+	}
+	return status.String()
+}
+
+// acknowledgeAlert acknowledges a firing alert, stopping its repeat notifications until it resolves
+func (m *Monitor) acknowledgeAlert(id, by string) string {
+	alert, found := m.findFiringAlert(id)
+	if !found || !alert.Instance.alertTracker.Acknowledge(alert.Key, by) {
+		return fmt.Sprintf("No firing alert with id <code>%s</code>, see /status", escapeHTML(id))
+	}
+	m.logger.Printf("Alert %s (%s) acknowledged by %s", alert.ID, alert.Key, by)
+	return fmt.Sprintf("✅ Alert <code>%s</code> (%s / %s) acknowledged by %s, repeat notifications stop until it resolves",
+		alert.ID, escapeHTML(alert.Instance.dbConfig.Instance), escapeHTML(alert.Query), escapeHTML(by))
+}
+
+// silenceFromTelegram silences a query on all instances, the query of one instance when target is "instance/query",
+// or the instance and query of a firing alert when target is its id
+func (m *Monitor) silenceFromTelegram(target, durationText, comment, by string) string {
+	duration, err := parseSilenceDuration(durationText)
+	if err != nil {
+		return fmt.Sprintf("Invalid duration %s, e.g. 30m, 2h or 1d", escapeHTML(durationText))
+	}
+	if comment == "" {
+		comment = "Silenced from Telegram"
+	}
+
+	silence := Silence{
+		StartsAt:  time.Now(),
+		Comment:   comment,
+		CreatedBy: by,
+	}
+	silence.EndsAt = silence.StartsAt.Add(duration)
+
+	if alert, found := m.findFiringAlert(target); found {
+		silence.Instance = alert.Instance.dbConfig.Instance
+		silence.Query = alert.Query
+	} else {
+		instance, query, perInstance := strings.Cut(target, "/")
+		if !perInstance {
+			instance, query = "", target
+		}
+		if perInstance && !m.hasInstance(instance) {
+			return fmt.Sprintf("Unknown instance %s", escapeHTML(instance))
+		}
+		known := false
+		for _, queryConfig := range m.config.Queries {
+			if matchesPattern(query, queryConfig.Name) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Sprintf("No query or firing alert matches %s", escapeHTML(target))
+		}
+		silence.Instance = instance
+		silence.Query = query
+	}
+
+	silence, err = m.silences.Add(silence)
+	if err != nil {
+		m.logger.Printf("Error creating silence from Telegram: %v", err)
+		return fmt.Sprintf("Failed to create silence: %s", escapeHTML(err.Error()))
+	}
+	m.logger.Printf("Silence %s created until %s by %s (%s)", silence.ID, silence.EndsAt.Format(time.RFC3339), silence.CreatedBy, silence.Comment)
+	return fmt.Sprintf("🔕 Silence <code>%s</code> for %s on %s until %s, created by %s",
+		silence.ID, escapeHTML(silence.Query), escapeHTML(orAny(silence.Instance)), silence.EndsAt.Format("2006-01-02 15:04 MST"), escapeHTML(by))
+}
+
+// hasInstance checks if an instance with the given name is monitored
+func (m *Monitor) hasInstance(name string) bool {
+	for _, instance := range m.instances {
+		if instance.dbConfig.Instance == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSilenceDuration parses a duration, also accepting days such as "1d"
+func parseSilenceDuration(text string) (time.Duration, error) {
+	var duration time.Duration
+	if days, found := strings.CutSuffix(text, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", text)
+		}
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if duration, err = time.ParseDuration(text); err != nil {
+			return 0, err
+		}
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return duration, nil
+}
+
+// runQueryReport runs a query on every instance and reports its first result rows
+func (m *Monitor) runQueryReport(name string) string {
+	var queryConfig *QueryConfig
+	for i := range m.config.Queries {
+		if strings.EqualFold(m.config.Queries[i].Name, name) {
+			queryConfig = &m.config.Queries[i]
+			break
+		}
+	}
+	if queryConfig == nil {
+		return fmt.Sprintf("Unknown query %s", escapeHTML(name))
+	}
+	if strings.HasPrefix(queryConfig.SQL, "[started]") {
+		return fmt.Sprintf("Query %s is not a SQL query", escapeHTML(queryConfig.Name))
+	}
+
+	instances := make([]*MonitorInstance, 0, len(m.instances))
+	for _, instance := range m.instances {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].dbConfig.Instance+instances[i].dbConfig.Database < instances[j].dbConfig.Instance+instances[j].dbConfig.Database
+	})
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "▶️ <b>%s</b>\n", escapeHTML(queryConfig.Name))
+	for _, instance := range instances {
+		fmt.Fprintf(&report, "\n<b>%s / %s</b>\n", escapeHTML(instance.dbConfig.Instance), escapeHTML(instance.dbConfig.Database))
+		lines, err := instance.runQuery(*queryConfig, maxRunRows)
+		if err != nil {
+			fmt.Fprintf(&report, "Error: %s\n", escapeHTML(err.Error()))
+			continue
+		}
+		fmt.Fprintf(&report, "<pre>%s</pre>\n", escapeHTML(strings.Join(lines, "\n")))
+	}
+	return report.String()
+}
+
+// runQuery runs a query and returns up to limit rows formatted as "column=value" lines
+func (m *MonitorInstance) runQuery(queryConfig QueryConfig, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, queryConfig.SQL)
+	if err != nil {
+		m.monitor.logger.Printf("Error executing query %s: %v", queryConfig.Name, err)
+		return nil, fmt.Errorf("failed to execute query %s: %w", queryConfig.Name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns for query %s: %w", queryConfig.Name, err)
+	}
+
+	var lines []string
+	count := 0
+	for rows.Next() {
+		count++
+		if count > limit {
+			continue
+		}
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row for query %s: %w", queryConfig.Name, err)
+		}
+
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.([]uint8); ok {
+				value = string(b)
+			}
+			fields[i] = fmt.Sprintf("%s=%v", column, value)
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows for query %s: %w", queryConfig.Name, err)
+	}
+
+	switch {
+	case count == 0:
+		lines = append(lines, "(no rows)")
+	case count > limit:
+		lines = append(lines, fmt.Sprintf("… %d more rows", count-limit))
+	}
+	return lines, nil
+}
+
+// replyTelegram sends an HTML formatted reply to a chat
+func (m *Monitor) replyTelegram(chatID int64, text string) error {
+	jsonData, err := json.Marshal(TelegramMessage{
+		ChatID:    strconv.FormatInt(chatID, 10),
+		Text:      text,
+		ParseMode: "HTML",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Telegram message: %w", err)
+	}
+
+	resp, err := m.httpClient.Post(m.telegramURL("sendMessage"), "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to send Telegram reply: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Telegram reply failed with status code: %d (%s)", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// answerTelegramCallback confirms a button press, showing text as a notification to the user
+func (m *Monitor) answerTelegramCallback(id, text string) {
+	jsonData, err := json.Marshal(map[string]string{"callback_query_id": id, "text": text})
+	if err != nil {
+		m.logger.Printf("Error marshaling Telegram callback answer: %v", err)
+		return
+	}
+
+	resp, err := m.httpClient.Post(m.telegramURL("answerCallbackQuery"), "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		m.logger.Printf("Error answering Telegram button press: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// firstLine returns the first line of text, shortened to the 200 characters of a callback answer
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	if runes := []rune(line); len(runes) > 200 {
+		line = string(runes[:199]) + "…"
+	}
+	return line
+}
+
+// stripHTML removes the tags and entities of a Telegram HTML message
+func stripHTML(text string) string {
+	var plain strings.Builder
+	inTag := false
+	for _, r := range text {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			plain.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(plain.String())
+}
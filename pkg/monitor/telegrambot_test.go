@@ -0,0 +1,197 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const telegramTestConfig = `
+alerts:
+  telegram:
+    enabled: true
+    bot_token: "123:abc"
+    chat_id: "-100"
+    commands: true
+    poll_timeout: 1s
+    api_url: %q
+queries:
+  - name: connections
+    sql: "SELECT count(*) FROM pg_stat_activity"
+    interval: 30s
+    alert_rules:
+      - name: too_many
+        condition: gt
+        value: 100
+        message: Too many connections
+  - name: replication_lag
+    sql: "SELECT 0"
+    interval: 30s
+`
+
+func TestParseSilenceDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"30m", 30 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"1d", 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got, err := parseSilenceDuration(tt.text); err != nil || got != tt.want {
+			t.Errorf("parseSilenceDuration(%q) = %s, %v, want %s", tt.text, got, err, tt.want)
+		}
+	}
+	for _, text := range []string{"", "soon", "xd", "0h", "-1d", "-30m"} {
+		if _, err := parseSilenceDuration(text); err == nil {
+			t.Errorf("parseSilenceDuration(%q) accepted", text)
+		}
+	}
+}
+
+func TestExecuteTelegramCommand(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(telegramTestConfig, "http://127.0.0.1")))
+	m := instance.monitor
+	rule := m.config.Queries[0].AlertRules[0]
+	key := instance.alertKey("connections", rule)
+	id := alertID(key)
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"/help", "<b>Commands</b>"},
+		{"/status@my_bot", "No firing alerts"},
+		{"/unknown", "Unknown command /unknown"},
+		{"/ack", "Usage: /ack"},
+		{"/ack " + id, "No firing alert with id"},
+		{"/silence connections", "Usage: /silence"},
+		{"/silence connections soon", "Invalid duration soon"},
+		{"/silence missing 1h", "No query or firing alert matches missing"},
+		{"/silence other/connections 1h", "Unknown instance other"},
+		{"/run missing", "Unknown query missing"},
+	}
+	for _, tt := range tests {
+		if got := m.executeTelegramCommand(tt.command, "@jane"); !strings.Contains(got, tt.want) {
+			t.Errorf("executeTelegramCommand(%q) = %q, want it to contain %q", tt.command, got, tt.want)
+		}
+	}
+
+	instance.alertTracker.MarkFiring(key)
+	if got := m.executeTelegramCommand("/status", "@jane"); !strings.Contains(got, id) || !strings.Contains(got, "Too many connections") {
+		t.Errorf("status = %q, want the firing alert", got)
+	}
+	if got := m.executeTelegramCommand("/ack "+id, "@jane"); !strings.Contains(got, "acknowledged by @jane") {
+		t.Errorf("ack = %q", got)
+	}
+	if ackedBy, _ := instance.alertTracker.Acknowledged(key); ackedBy != "@jane" {
+		t.Errorf("alert acknowledged by %q, want @jane", ackedBy)
+	}
+
+	if got := m.executeTelegramCommand("/silence replication_* 2h planned failover", "@jane"); !strings.Contains(got, "Silence") {
+		t.Fatalf("silence = %q", got)
+	}
+	silences, _ := m.silences.List(false)
+	if len(silences) != 1 || silences[0].Query != "replication_*" || silences[0].Instance != "" || silences[0].Comment != "planned failover" || silences[0].CreatedBy != "@jane" {
+		t.Errorf("silences = %+v", silences)
+	}
+}
+
+func TestTelegramSilenceButtonAfterResolve(t *testing.T) {
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(telegramTestConfig, "http://127.0.0.1")))
+	m := instance.monitor
+	rule := m.config.Queries[0].AlertRules[0]
+
+	keyboard := instance.telegramAlertKeyboard("connections", rule)
+	buttons := keyboard.InlineKeyboard[0]
+	if buttons[1].CallbackData != "silence test/connections 1h" {
+		t.Fatalf("silence button data = %q", buttons[1].CallbackData)
+	}
+
+	// The alert is no longer firing when the button is pressed
+	if got := m.executeTelegramCommand("/"+buttons[2].CallbackData, "@jane"); !strings.Contains(got, "Silence") {
+		t.Fatalf("silence button reply = %q", got)
+	}
+	silences, _ := m.silences.List(false)
+	if len(silences) != 1 || silences[0].Instance != "test" || silences[0].Query != "connections" {
+		t.Fatalf("silences = %+v, want the query on instance test", silences)
+	}
+	if remaining := time.Until(silences[0].EndsAt); remaining < 23*time.Hour || remaining > 24*time.Hour {
+		t.Errorf("silence ends in %s, want 24h", remaining)
+	}
+
+	// Names that do not fit in the callback data fall back to the alert id
+	long := strings.Repeat("q", maxTelegramCallbackData)
+	keyboard = instance.telegramAlertKeyboard(long, rule)
+	if data := keyboard.InlineKeyboard[0][1].CallbackData; data != "silence "+alertID(instance.alertKey(long, rule))+" 1h" {
+		t.Errorf("silence button data = %q, want the alert id", data)
+	}
+}
+
+func TestPollTelegramCommands(t *testing.T) {
+	var mu sync.Mutex
+	var replies []string
+	var polls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+			mu.Lock()
+			polls++
+			first := polls == 1
+			mu.Unlock()
+			if first {
+				fmt.Fprint(w, `{"ok": true, "result": [{"update_id": 7, "callback_query": {"id": "cb", "from": {"username": "jane"},
+					"message": {"chat": {"id": -100}}, "data": "silence test/connections 1h"}}]}`)
+				return
+			}
+			if r.URL.Query().Get("offset") != "8" {
+				t.Errorf("getUpdates offset = %s, want 8", r.URL.Query().Get("offset"))
+			}
+			// Long poll until the monitor stops
+			<-r.Context().Done()
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			var message TelegramMessage
+			json.NewDecoder(r.Body).Decode(&message)
+			mu.Lock()
+			replies = append(replies, message.Text)
+			mu.Unlock()
+			fmt.Fprint(w, `{"ok": true}`)
+		default:
+			fmt.Fprint(w, `{"ok": true}`)
+		}
+	}))
+	defer server.Close()
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(telegramTestConfig, server.URL)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		instance.monitor.pollTelegramCommands(ctx)
+		close(done)
+	}()
+
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replies) == 1 && polls == 2
+	})
+	if !strings.Contains(replies[0], "Silence") {
+		t.Errorf("reply = %q", replies[0])
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("polling did not stop")
+	}
+}
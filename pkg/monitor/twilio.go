@@ -0,0 +1,569 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TwilioConfig holds the Twilio REST API account settings shared by the SMS and voice channels
+type TwilioConfig struct {
+	AccountSID string `yaml:"account_sid"`
+	AuthToken  string `yaml:"auth_token"`
+	FromNumber string `yaml:"from_number"`
+	BaseURL    string `yaml:"base_url,omitempty"` // Twilio compatible API base URL (default https://api.twilio.com)
+}
+
+// SMSConfig holds SMS alert configuration
+type SMSConfig struct {
+	TwilioConfig `yaml:",inline"`
+	Enabled      bool          `yaml:"enabled"`
+	ToNumbers    []string      `yaml:"to_numbers"`             // Recipients, may refer to "list:<name>" and "oncall:<name>"
+	MaxSegments  int           `yaml:"max_segments,omitempty"` // Longer messages are truncated to fit (default 2)
+	Interval     time.Duration `yaml:"interval"`
+}
+
+// VoiceConfig holds voice call alert configuration
+type VoiceConfig struct {
+	TwilioConfig `yaml:",inline"`
+	Enabled      bool          `yaml:"enabled"`
+	ToNumbers    []string      `yaml:"to_numbers"`             // Called in turn until one answers, may refer to "list:<name>" and "oncall:<name>"
+	Voice        string        `yaml:"voice,omitempty"`        // Text-to-speech voice, e.g. "alice" or "Polly.Joanna"
+	Language     string        `yaml:"language,omitempty"`     // Text-to-speech language (default en-US)
+	Repeat       int           `yaml:"repeat,omitempty"`       // Times the message is read (default 2)
+	RingTimeout  time.Duration `yaml:"ring_timeout,omitempty"` // Time a call rings before it is unanswered (default 30s)
+	Interval     time.Duration `yaml:"interval"`
+}
+
+// twilioErrorResponse is the error body of the Twilio REST API
+type twilioErrorResponse struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+}
+
+// twilioCall is the call resource of the Twilio REST API
+type twilioCall struct {
+	SID        string `json:"sid"`
+	Status     string `json:"status"`
+	AnsweredBy string `json:"answered_by"` // Result of answering machine detection, e.g. "human" or "machine_start"
+}
+
+// voiceCall is a placed call whose answer is not known yet
+type voiceCall struct {
+	sid      string
+	number   string
+	instance *MonitorInstance
+	n        *Notification
+	deadline time.Time // The call is unanswered when nobody answered by then
+}
+
+// voiceCalls tracks the placed calls until they are answered or end.
+// With a file, they are persisted so that an unanswered call is still retried after a restart.
+type voiceCalls struct {
+	file     string
+	calls    map[string]*voiceCall
+	restored []voiceCallRecord // Loaded calls waiting for their instance, see restore
+	mu       sync.Mutex
+}
+
+// voiceCallRecord is a placed call as persisted
+type voiceCallRecord struct {
+	SID          string        `json:"sid"`
+	Number       string        `json:"number"`
+	Deadline     time.Time     `json:"deadline"`
+	Notification *Notification `json:"notification"`
+}
+
+// SMS segment sizes, concatenated messages lose a few characters per segment to the header
+const (
+	smsGSMSegment        = 160
+	smsGSMMultiSegment   = 153
+	smsUCS2Segment       = 70
+	smsUCS2MultiSegment  = 67
+	twilioCallPollPeriod = 5 * time.Second
+	voiceCallGrace       = 2 * time.Minute // Time for answering machine detection and status updates after ringing
+)
+
+// gsmCharacters is the GSM 03.38 basic character set, gsmExtended the characters taking two septets
+const (
+	gsmCharacters = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtended   = "^{}\\[~]|€\f"
+)
+
+// sendSMSAlert sends an alert as a text message
+func (m *MonitorInstance) sendSMSAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	text := fmt.Sprintf("DB ALERT [%s] %s/%s: %s (%s)", alertSeverity(rule), m.dbConfig.Instance, queryName, rule.Message, event.Comparison())
+	return deliveryResult(n, m.postSMS(n, queryName, rule, text))
+}
+
+// sendSMSBatch sends a group of alerts as a single text message
+func (m *MonitorInstance) sendSMSBatch(n *Notification) DeliveryResult {
+	batch := n.Batch
+	lines := []string{fmt.Sprintf("%d DB ALERTS", len(batch))}
+	for _, alert := range batch {
+		lines = append(lines, fmt.Sprintf("%s/%s: %s (%s)", alert.Instance, alert.Query, alert.Rule.Message, alert.Event().Comparison()))
+	}
+	return deliveryResult(n, m.postSMS(n, batchQueries(batch), batch[0].Rule, strings.Join(lines, "\n")))
+}
+
+// postSMS sends a text message, truncated to the configured number of segments, to every recipient of a rule
+func (m *MonitorInstance) postSMS(n *Notification, queryName string, rule AlertRule, text string) error {
+	config := m.monitor.config.Alerts.SMS
+	to, err := m.phoneRecipients(rule, "sms", config.ToNumbers)
+	if err != nil {
+		m.monitor.logger.Printf("SMS alert failed for query %s: %v", queryName, err)
+		return fmt.Errorf("failed to resolve SMS recipient for query %s: %w", queryName, err)
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no SMS recipient for query %s", queryName)
+	}
+
+	text = truncateSMS(text, config.MaxSegments)
+
+	return n.sendToTargets(to, func(number string) error {
+		form := url.Values{"To": {number}, "From": {config.FromNumber}, "Body": {text}}
+		if _, err := m.postTwilio(config.TwilioConfig, "Messages.json", form); err != nil {
+			m.monitor.logger.Printf("SMS alert failed for query %s to %s: %v", queryName, number, err)
+			return fmt.Errorf("SMS alert for query %s to %s: %w", queryName, number, err)
+		}
+		m.monitor.logger.Printf("SMS alert sent successfully for query: %s to %s", queryName, number)
+		return nil
+	})
+}
+
+// sendVoiceAlert calls a recipient of a rule to read the alert to them
+func (m *MonitorInstance) sendVoiceAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	speech := fmt.Sprintf("Database alert. Severity %s. Instance %s. Query %s. %s. %s.",
+		alertSeverity(rule), m.dbConfig.Instance, spokenName(queryName), rule.Message, event.Comparison())
+	return deliveryResult(n, m.placeVoiceCall(n, queryName, rule, speech))
+}
+
+// sendVoiceBatch calls a recipient to read a group of alerts to them
+func (m *MonitorInstance) sendVoiceBatch(n *Notification) DeliveryResult {
+	batch := n.Batch
+	sentences := []string{fmt.Sprintf("%d database alerts.", len(batch))}
+	for _, alert := range batch {
+		sentences = append(sentences, fmt.Sprintf("Instance %s, query %s. %s.", alert.Instance, spokenName(alert.Query), alert.Rule.Message))
+	}
+	return deliveryResult(n, m.placeVoiceCall(n, batchQueries(batch), batch[0].Rule, strings.Join(sentences, " ")))
+}
+
+// placeVoiceCall calls the next recipient and returns once the call is placed. Each attempt of the notification
+// calls the next number in turn; the call is tracked until it is answered, and an unanswered call puts the
+// notification back in the outbox for its next attempt.
+func (m *MonitorInstance) placeVoiceCall(n *Notification, queryName string, rule AlertRule, speech string) error {
+	config := m.monitor.config.Alerts.Voice
+	to, err := m.phoneRecipients(rule, "voice", config.ToNumbers)
+	if err != nil {
+		m.monitor.logger.Printf("Voice alert failed for query %s: %v", queryName, err)
+		return fmt.Errorf("failed to resolve voice recipient for query %s: %w", queryName, err)
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no voice recipient for query %s", queryName)
+	}
+
+	number := to[n.Attempts%len(to)]
+	form := url.Values{
+		"To":               {number},
+		"From":             {config.FromNumber},
+		"Twiml":            {voiceTwiML(config, speech)},
+		"Timeout":          {fmt.Sprintf("%d", int(config.RingTimeout.Seconds()))},
+		"MachineDetection": {"Enable"},
+	}
+	body, err := m.postTwilio(config.TwilioConfig, "Calls.json", form)
+	if err != nil {
+		m.monitor.logger.Printf("Voice alert failed for query %s to %s: %v", queryName, number, err)
+		return fmt.Errorf("voice alert for query %s to %s: %w", queryName, number, err)
+	}
+
+	var call twilioCall
+	if err := json.Unmarshal(body, &call); err != nil || call.SID == "" {
+		return fmt.Errorf("unexpected call response: %s", firstLine(string(body)))
+	}
+
+	err = m.monitor.voiceCalls.add(&voiceCall{
+		sid:      call.SID,
+		number:   number,
+		instance: m,
+		n:        n,
+		deadline: time.Now().Add(config.RingTimeout + voiceCallGrace),
+	})
+	if err != nil {
+		m.monitor.logger.Printf("Error saving voice call %s for query %s: %v", call.SID, queryName, err)
+	}
+	m.monitor.logger.Printf("Voice alert for query %s calling %s (call %s)", queryName, number, call.SID)
+	return nil
+}
+
+// newVoiceCalls creates the tracker of placed calls and loads the calls persisted in file.
+// Without a file they are kept in memory only.
+func newVoiceCalls(file string) (*voiceCalls, error) {
+	c := &voiceCalls{file: file, calls: make(map[string]*voiceCall)}
+	if file == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read voice calls: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.restored); err != nil {
+		return nil, fmt.Errorf("failed to parse voice calls: %w", err)
+	}
+	return c, nil
+}
+
+// voiceCallsFile returns the file persisting the placed calls, next to the outbox entries
+func voiceCallsFile(config DeliveryConfig) string {
+	if config.OutboxDir == "" {
+		return ""
+	}
+	return filepath.Join(config.OutboxDir, "voice", "calls.json")
+}
+
+// restore tracks the loaded calls again, on the instances that resolve returns. Their alerts are marked firing
+// until the next check of their query tells otherwise. It returns the number of restored calls.
+func (c *voiceCalls) restore(resolve func(instance, database string) *MonitorInstance) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	restored := 0
+	for _, record := range c.restored {
+		n := record.Notification
+		instance := resolve(n.Instance, n.Database)
+		if instance == nil {
+			continue
+		}
+		for _, alert := range n.alerts() {
+			if alertInstance := resolve(alert.Instance, alert.Database); alertInstance != nil {
+				alertInstance.alertTracker.MarkFiring(alertInstance.alertKey(alert.Query, alert.Rule))
+			}
+		}
+		c.calls[record.SID] = &voiceCall{sid: record.SID, number: record.Number, instance: instance, n: n, deadline: record.Deadline}
+		restored++
+	}
+	c.restored = nil
+	return restored
+}
+
+// add tracks a placed call
+func (c *voiceCalls) add(call *voiceCall) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[call.sid] = call
+	return c.save()
+}
+
+// save persists the placed calls, written to a temporary file first so a crash never leaves a partial file
+func (c *voiceCalls) save() error {
+	if c.file == "" {
+		return nil
+	}
+
+	records := make([]voiceCallRecord, 0, len(c.calls))
+	for _, call := range c.calls {
+		records = append(records, voiceCallRecord{SID: call.sid, Number: call.number, Deadline: call.deadline, Notification: call.n})
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal voice calls: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0700); err != nil {
+		return fmt.Errorf("failed to create voice calls directory: %w", err)
+	}
+	if err := os.WriteFile(c.file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write voice calls: %w", err)
+	}
+	if err := os.Rename(c.file+".tmp", c.file); err != nil {
+		return fmt.Errorf("failed to write voice calls: %w", err)
+	}
+	return nil
+}
+
+// pending returns the calls whose answer is not known yet
+func (c *voiceCalls) pending() []*voiceCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	calls := make([]*voiceCall, 0, len(c.calls))
+	for _, call := range c.calls {
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// remove stops tracking a call
+func (c *voiceCalls) remove(sid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.calls, sid)
+	return c.save()
+}
+
+// trackVoiceCalls checks the placed calls until ctx is done
+func (m *Monitor) trackVoiceCalls(ctx context.Context) {
+	ticker := time.NewTicker(twilioCallPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkVoiceCalls(now)
+		}
+	}
+}
+
+// checkVoiceCalls fetches the status of the placed calls. An answered call completes the alert, a call that is
+// busy, fails, rings out or reaches voicemail is retried through the outbox.
+func (m *Monitor) checkVoiceCalls(now time.Time) {
+	config := m.config.Alerts.Voice
+	for _, placed := range m.voiceCalls.pending() {
+		queryName := placed.n.Query
+		if len(placed.n.Batch) > 0 {
+			queryName = batchQueries(placed.n.Batch)
+		}
+
+		var call twilioCall
+		body, err := placed.instance.getTwilio(config.TwilioConfig, "Calls/"+url.PathEscape(placed.sid)+".json")
+		if err == nil {
+			err = json.Unmarshal(body, &call)
+		}
+		if err != nil {
+			m.logger.Printf("Error checking voice call %s for query %s: %v", placed.sid, queryName, err)
+		}
+
+		answered, done := voiceCallAnswered(call)
+		if !answered && !done && !now.After(placed.deadline) {
+			continue
+		}
+		if err := m.voiceCalls.remove(placed.sid); err != nil {
+			m.logger.Printf("Error saving voice calls: %v", err)
+		}
+		if answered {
+			m.logger.Printf("Voice alert answered for query: %s by %s", queryName, placed.number)
+			continue
+		}
+		reason := call.Status
+		if call.AnsweredBy != "" {
+			reason = "answered by " + call.AnsweredBy
+		}
+		placed.instance.retryVoiceCall(placed.n, fmt.Errorf("voice alert for query %s to %s not answered: %s", queryName, placed.number, reason))
+	}
+}
+
+// voiceCallAnswered reports whether a person answered a call, and whether the call ended without one.
+// Calls reaching voicemail or a fax are not answered.
+func voiceCallAnswered(call twilioCall) (bool, bool) {
+	switch call.Status {
+	case "in-progress", "completed":
+		switch {
+		case call.AnsweredBy == "human", call.AnsweredBy == "unknown":
+			return true, false
+		case call.AnsweredBy != "":
+			return false, true
+		}
+		// Answering machine detection has not decided yet, a call ending before it did was answered
+		return call.Status == "completed", false
+	case "busy", "no-answer", "failed", "canceled":
+		return false, true
+	}
+	return false, false
+}
+
+// retryVoiceCall puts the notification of an unanswered call back in the outbox, so its next attempt calls the
+// next number. Nobody is called again when its alerts cleared or were acknowledged in the meantime.
+func (m *MonitorInstance) retryVoiceCall(n *Notification, err error) {
+	if !m.voiceRetryNeeded(n) {
+		m.monitor.logger.Printf("%v, not calling again as the alert cleared or was acknowledged", err)
+		return
+	}
+
+	// The alert reached nobody, so its retry is not held back by the channel interval
+	for _, alert := range n.alerts() {
+		if instance := m.monitor.instanceFor(alert.Instance, alert.Database); instance != nil {
+			instance.alertTracker.ReleaseAlert(alert.Query, alert.Channel, time.Time{})
+		}
+	}
+
+	result := deliveryResult(n, err)
+	m.monitor.deliveries.Record(result)
+	m.monitor.logger.Printf("%v", err)
+
+	retry, addErr := m.monitor.outbox.Add(n)
+	if addErr != nil {
+		m.monitor.logger.Printf("Error saving outbox entry for %s alert of query %s: %v", n.Channel, n.Query, addErr)
+	}
+	if retry == nil {
+		// A newer alert for the same rule is pending and calls out itself
+		return
+	}
+	m.failDelivery(retry, result)
+}
+
+// voiceRetryNeeded checks if an alert of a notification still fires without being acknowledged
+func (m *MonitorInstance) voiceRetryNeeded(n *Notification) bool {
+	for _, alert := range n.alerts() {
+		instance := m.monitor.instanceFor(alert.Instance, alert.Database)
+		if instance == nil {
+			continue
+		}
+		key := instance.alertKey(alert.Query, alert.Rule)
+		if _, firing := instance.alertTracker.FiringSince(key); !firing {
+			continue
+		}
+		if _, acked := instance.alertTracker.Acknowledged(key); !acked {
+			return true
+		}
+	}
+	return false
+}
+
+// voiceTwiML returns the instructions reading speech to the callee
+func voiceTwiML(config VoiceConfig, speech string) string {
+	var attrs strings.Builder
+	if config.Voice != "" {
+		fmt.Fprintf(&attrs, ` voice="%s"`, html.EscapeString(config.Voice))
+	}
+	fmt.Fprintf(&attrs, ` language="%s" loop="%d"`, html.EscapeString(config.Language), config.Repeat)
+	return fmt.Sprintf(`<Response><Say%s>%s</Say></Response>`, attrs.String(), html.EscapeString(speech))
+}
+
+// spokenName makes an identifier such as "database_size" readable for text-to-speech
+func spokenName(name string) string {
+	return strings.NewReplacer("_", " ", "-", " ", ".", " ").Replace(name)
+}
+
+// phoneRecipients returns the numbers to message or call for a rule: its own recipients when it targets
+// specific recipients, otherwise the configured numbers
+func (m *MonitorInstance) phoneRecipients(rule AlertRule, channel string, configured []string) ([]string, error) {
+	recipients, err := m.monitor.channelRecipients(rule, channel, configured)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lists may hold email addresses for other channels, only numbers can be messaged
+	var numbers []string
+	for _, recipient := range recipients {
+		if !strings.Contains(recipient, "@") {
+			numbers = append(numbers, recipient)
+		}
+	}
+	return numbers, nil
+}
+
+// truncateSMS shortens text to fit in maxSegments SMS segments, which hold fewer characters when the text
+// needs UCS-2 encoding because of characters outside the GSM 03.38 alphabet
+func truncateSMS(text string, maxSegments int) string {
+	gsm := true
+	for _, r := range text {
+		if !strings.ContainsRune(gsmCharacters, r) && !strings.ContainsRune(gsmExtended, r) {
+			gsm = false
+			break
+		}
+	}
+
+	single, multi, ellipsis := smsGSMSegment, smsGSMMultiSegment, "..."
+	if !gsm {
+		single, multi, ellipsis = smsUCS2Segment, smsUCS2MultiSegment, "…"
+	}
+	limit := single
+	if maxSegments > 1 {
+		limit = maxSegments * multi
+	}
+	if smsLength(text, gsm) <= limit {
+		return text
+	}
+
+	budget := limit - smsLength(ellipsis, gsm)
+	length := 0
+	for i, r := range text {
+		width := smsLength(string(r), gsm)
+		if length+width > budget {
+			return text[:i] + ellipsis
+		}
+		length += width
+	}
+	return text
+}
+
+// smsLength returns the length of text in GSM septets, where extended characters take two, or in UTF-16 code
+// units for UCS-2, where characters outside the basic plane take two
+func smsLength(text string, gsm bool) int {
+	length := 0
+	for _, r := range text {
+		switch {
+		case gsm && strings.ContainsRune(gsmExtended, r), !gsm && r > 0xFFFF:
+			length += 2
+		default:
+			length++
+		}
+	}
+	return length
+}
+
+// twilioURL returns the URL of a resource of the account
+func (c TwilioConfig) twilioURL(resource string) string {
+	return fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s", strings.TrimRight(c.BaseURL, "/"), url.PathEscape(c.AccountSID), resource)
+}
+
+// postTwilio creates a resource through the Twilio REST API and returns the response body
+func (m *MonitorInstance) postTwilio(config TwilioConfig, resource string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, config.twilioURL(resource), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Twilio request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return m.doTwilio(config, req)
+}
+
+// getTwilio fetches a resource through the Twilio REST API and returns the response body
+func (m *MonitorInstance) getTwilio(config TwilioConfig, resource string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, config.twilioURL(resource), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Twilio request: %w", err)
+	}
+	return m.doTwilio(config, req)
+}
+
+// doTwilio performs an authenticated Twilio request, describing API errors by their code and message
+func (m *MonitorInstance) doTwilio(config TwilioConfig, req *http.Request) ([]byte, error) {
+	req.SetBasicAuth(config.AccountSID, config.AuthToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.monitor.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send Twilio request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp twilioErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Code != 0 {
+			return nil, newHTTPStatusError(resp, body, "Twilio request failed with status code: %d: %s (error %d, %s)", resp.StatusCode, errResp.Message, errResp.Code, errResp.MoreInfo)
+		}
+		return nil, newHTTPStatusError(resp, body, "Twilio request failed with status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTruncateSMS(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		maxSegments int
+		want        string
+	}{
+		{"fits one segment", strings.Repeat("a", 160), 1, strings.Repeat("a", 160)},
+		{"one segment", strings.Repeat("a", 161), 1, strings.Repeat("a", 157) + "..."},
+		{"two segments", strings.Repeat("a", 307), 2, strings.Repeat("a", 303) + "..."},
+		{"extended characters count twice", strings.Repeat("{", 81), 1, strings.Repeat("{", 78) + "..."},
+		{"UCS-2", "⚠" + strings.Repeat("a", 70), 1, "⚠" + strings.Repeat("a", 68) + "…"},
+		{"UCS-2 surrogate pairs", strings.Repeat("🔥", 36), 1, strings.Repeat("🔥", 34) + "…"},
+		{"UCS-2 two segments", "⚠" + strings.Repeat("a", 134), 2, "⚠" + strings.Repeat("a", 132) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateSMS(tt.text, tt.maxSegments); got != tt.want {
+				t.Errorf("truncateSMS() = %q (%d runes), want %q", got, len([]rune(got)), tt.want)
+			}
+		})
+	}
+}
+
+// twilioServer returns a stub of the Twilio calls API placing call CA1 and reporting it with status and
+// answeredBy, recording the numbers called
+func twilioServer(t *testing.T, status, answeredBy string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var called []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"sid": "CA1", "status": %q, "answered_by": %q}`, status, answeredBy)
+			return
+		}
+
+		if got := r.FormValue("MachineDetection"); got != "Enable" {
+			t.Errorf("MachineDetection = %q, want Enable", got)
+		}
+		mu.Lock()
+		called = append(called, r.FormValue("To"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sid": "CA1", "status": "queued"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return called
+	}
+}
+
+// voiceTestInstance returns an instance calling two numbers through the stub server
+func voiceTestInstance(t *testing.T, server *httptest.Server) *MonitorInstance {
+	return newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  voice:
+    enabled: true
+    account_sid: "AC1"
+    auth_token: "token"
+    from_number: "+15550000"
+    to_numbers: ["+15550001", "+15550002"]
+    base_url: %q
+`, server.URL)))
+}
+
+func TestVoiceCallVoicemailRetriesNextNumber(t *testing.T) {
+	server, called := twilioServer(t, "completed", "machine_end_beep")
+	instance := voiceTestInstance(t, server)
+	outbox := instance.monitor.outbox
+
+	event := testEvent()
+	instance.alertTracker.MarkFiring(instance.alertKey(event.Query, event.Rule))
+	n := instance.newNotification("voice", event)
+	sending, _ := outbox.Add(n)
+	instance.deliver(sending)
+
+	// The delivery returns once the call is placed
+	if outbox.Len() != 0 || len(instance.monitor.voiceCalls.pending()) != 1 {
+		t.Fatalf("outbox holds %d notifications and %d calls are tracked, want 0 and 1", outbox.Len(), len(instance.monitor.voiceCalls.pending()))
+	}
+
+	instance.monitor.checkVoiceCalls(time.Now())
+
+	pending, exists := outbox.Pending(n.ID)
+	if !exists {
+		t.Fatal("call answered by voicemail was not retried")
+	}
+	if pending.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", pending.Attempts)
+	}
+	if len(instance.monitor.voiceCalls.pending()) != 0 {
+		t.Error("unanswered call is still tracked")
+	}
+
+	instance.deliver(outbox.Due(pending.NextAttempt)[0])
+	if got := called(); len(got) != 2 || got[0] != "+15550001" || got[1] != "+15550002" {
+		t.Errorf("called %v, want the next number on retry", got)
+	}
+}
+
+func TestVoiceCallNotRetriedAfterAlertEnds(t *testing.T) {
+	server, called := twilioServer(t, "no-answer", "")
+	instance := voiceTestInstance(t, server)
+	outbox := instance.monitor.outbox
+	event := testEvent()
+	key := instance.alertKey(event.Query, event.Rule)
+
+	tests := map[string]func(){
+		"cleared":      func() { instance.alertTracker.ClearFiring(key) },
+		"acknowledged": func() { instance.alertTracker.Acknowledge(key, "@jane") },
+	}
+	for name, end := range tests {
+		instance.alertTracker.MarkFiring(key)
+		sending, _ := outbox.Add(instance.newNotification("voice", event))
+		instance.deliver(sending)
+		end()
+		instance.monitor.checkVoiceCalls(time.Now())
+
+		if outbox.Len() != 0 || len(instance.monitor.voiceCalls.pending()) != 0 {
+			t.Errorf("%s: outbox holds %d notifications and %d calls are tracked, want no retry", name, outbox.Len(), len(instance.monitor.voiceCalls.pending()))
+		}
+		instance.alertTracker.ClearFiring(key)
+	}
+	if got := called(); len(got) != 2 {
+		t.Errorf("called %v, want one call per alert", got)
+	}
+}
+
+func TestVoiceCallsSurviveRestart(t *testing.T) {
+	server, _ := twilioServer(t, "ringing", "")
+	instance := voiceTestInstance(t, server)
+	file := filepath.Join(t.TempDir(), "voice", "calls.json")
+	calls, err := newVoiceCalls(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance.monitor.voiceCalls = calls
+
+	event := testEvent()
+	key := instance.alertKey(event.Query, event.Rule)
+	instance.alertTracker.MarkFiring(key)
+	n := instance.newNotification("voice", event)
+	sending, _ := instance.monitor.outbox.Add(n)
+	instance.deliver(sending)
+
+	// A restart loads the call with a new alert tracker
+	instance.alertTracker = NewAlertTracker()
+	reloaded, err := newVoiceCalls(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored := reloaded.restore(instance.monitor.instanceFor); restored != 1 {
+		t.Fatalf("restore() = %d, want 1", restored)
+	}
+	pending := reloaded.pending()
+	if pending[0].instance != instance || pending[0].n.ID != n.ID || pending[0].number != "+15550001" {
+		t.Errorf("restored call = %+v, want the placed call", pending[0])
+	}
+	if _, firing := instance.alertTracker.FiringSince(key); !firing {
+		t.Error("alert of the restored call is not marked firing")
+	}
+}
+
+func TestVoiceCallAnswered(t *testing.T) {
+	server, called := twilioServer(t, "in-progress", "human")
+	instance := voiceTestInstance(t, server)
+	outbox := instance.monitor.outbox
+
+	n := instance.newNotification("voice", testEvent())
+	sending, _ := outbox.Add(n)
+	instance.deliver(sending)
+	instance.monitor.checkVoiceCalls(time.Now())
+
+	if outbox.Len() != 0 || len(instance.monitor.voiceCalls.pending()) != 0 {
+		t.Errorf("outbox holds %d notifications and %d calls are tracked after the answer, want 0 and 0", outbox.Len(), len(instance.monitor.voiceCalls.pending()))
+	}
+	if got := called(); len(got) != 1 {
+		t.Errorf("called %v, want one call", got)
+	}
+}
+
+func TestVoiceCallAnsweredStatus(t *testing.T) {
+	tests := []struct {
+		call     twilioCall
+		answered bool
+		done     bool
+	}{
+		{twilioCall{Status: "ringing"}, false, false},
+		{twilioCall{Status: "in-progress"}, false, false},
+		{twilioCall{Status: "in-progress", AnsweredBy: "human"}, true, false},
+		{twilioCall{Status: "in-progress", AnsweredBy: "machine_start"}, false, true},
+		{twilioCall{Status: "completed", AnsweredBy: "fax"}, false, true},
+		{twilioCall{Status: "completed", AnsweredBy: "unknown"}, true, false},
+		{twilioCall{Status: "completed"}, true, false},
+		{twilioCall{Status: "no-answer"}, false, true},
+		{twilioCall{Status: "busy"}, false, true},
+	}
+
+	for _, tt := range tests {
+		answered, done := voiceCallAnswered(tt.call)
+		if answered != tt.answered || done != tt.done {
+			t.Errorf("voiceCallAnswered(%+v) = %v, %v, want %v, %v", tt.call, answered, done, tt.answered, tt.done)
+		}
+	}
+}
@@ -3,16 +3,21 @@ package monitor
 import (
 	"database/sql"
 	"log"
+	"net/http"
 	"os"
 	"time"
 )
 
 // Config represents the YAML configuration structure
 type Config struct {
-	Database []DatabaseConfig `yaml:"databases"`
-	Logging  LoggingConfig    `yaml:"logging"`
-	Queries  []QueryConfig    `yaml:"queries"`
-	Alerts   AlertsConfig     `yaml:"alerts"`
+	Database []DatabaseConfig          `yaml:"databases"`
+	Logging  LoggingConfig             `yaml:"logging"`
+	Queries  []QueryConfig             `yaml:"queries"`
+	Alerts   AlertsConfig              `yaml:"alerts"`
+	Silences SilencesConfig            `yaml:"silences"`
+	API      APIConfig                 `yaml:"api"`
+	OnCall   map[string]OnCallSchedule `yaml:"oncall,omitempty"` // On-call schedules by name, referenced as "oncall:<name>"
+	Lists    map[string][]string       `yaml:"lists,omitempty"`  // Distribution lists by name, referenced as "list:<name>"
 }
 
 // DatabaseConfig holds database connection details
@@ -42,54 +47,128 @@ type QueryConfig struct {
 
 // AlertRule defines conditions for triggering alerts
 type AlertRule struct {
-	Condition      string      `yaml:"condition"` // "gt", "lt", "eq", "ne", "gte", "lte"
-	Value          interface{} `yaml:"value"`
-	Message        string      `yaml:"message"`
-	ResolutionNote string      `yaml:"resolution_note,omitempty"` // Optional note for resolution
-	Category       string      `yaml:"category"`
-	To             string      `yaml:"to"`
-	Channels       []string    `yaml:"channels,omitempty"`
-	Instances      []string    `yaml:"instances,omitempty"`      // Optional list of instances to apply this rule
-	ExecuteAction  string      `yaml:"execute_action,omitempty"` // Optional action to execute on alert
-	AlertHours     *AlertHours `yaml:"alert_hours,omitempty"`    // Optional time range for alerts
+	Name           string              `yaml:"name,omitempty"` // Optional identifier, used to build deduplication keys
+	Condition      string              `yaml:"condition"`      // "gt", "lt", "eq", "ne", "gte", "lte"
+	Value          interface{}         `yaml:"value"`
+	Message        string              `yaml:"message"`
+	ResolutionNote string              `yaml:"resolution_note,omitempty"` // Optional note for resolution
+	Category       string              `yaml:"category"`
+	Severity       string              `yaml:"severity,omitempty"`   // Optional: "critical", "error", "warning", "info" (derived from category if empty)
+	To             string              `yaml:"to"`                   // Recipients, comma separated, may refer to "list:<name>" and "oncall:<name>"
+	CC             []string            `yaml:"cc,omitempty"`         // Email CC recipients
+	BCC            []string            `yaml:"bcc,omitempty"`        // Email BCC recipients
+	Recipients     map[string][]string `yaml:"recipients,omitempty"` // Per channel recipients overriding to, e.g. WhatsApp numbers
+	Channels       []string            `yaml:"channels,omitempty"`
+	Instances      []string            `yaml:"instances,omitempty"`      // Optional list of instances to apply this rule
+	ExecuteAction  string              `yaml:"execute_action,omitempty"` // Optional action to execute on alert
+	AlertHours     *AlertHours         `yaml:"alert_hours,omitempty"`    // Optional time range for alerts
+	Runbook        string              `yaml:"runbook,omitempty"`        // Optional runbook URL linked from alerts
 
 }
 
 // AlertHours defines time range when alerts should be sent
 type AlertHours struct {
-	Start    string   `yaml:"start"`              // Start time in HH:MM format (24-hour)
-	End      string   `yaml:"end"`                // End time in HH:MM format (24-hour)
-	Timezone string   `yaml:"timezone,omitempty"` // Timezone (e.g., "UTC", "America/New_York")
-	Days     []string `yaml:"days,omitempty"`     // Days of week (optional: "mon", "tue", etc.)
+	Start       string              `yaml:"start"`                 // Start time in HH:MM format (24-hour)
+	End         string              `yaml:"end"`                   // End time in HH:MM format (24-hour)
+	Timezone    string              `yaml:"timezone,omitempty"`    // Timezone (e.g., "UTC", "America/New_York")
+	Days        []string            `yaml:"days,omitempty"`        // Days of week (optional: "mon", "tue", etc.)
+	Windows     []AlertWindow       `yaml:"windows,omitempty"`     // Additional windows, alerts are sent inside any of them
+	Exceptions  []DateException     `yaml:"exceptions,omitempty"`  // Dates without alerts (public holidays, freeze periods)
+	Maintenance []MaintenanceWindow `yaml:"maintenance,omitempty"` // One-off periods without alerts
+	Calendar    string              `yaml:"calendar,omitempty"`    // iCalendar (.ics) file, no alerts are sent during its events
+	Defer       bool                `yaml:"defer,omitempty"`       // Hold back alerts outside the alert hours and deliver those still firing once they begin
+}
+
+// AlertWindow defines a recurring daily time range
+type AlertWindow struct {
+	Start string   `yaml:"start"`          // Start time in HH:MM format (24-hour)
+	End   string   `yaml:"end"`            // End time in HH:MM format (24-hour), before start for overnight windows
+	Days  []string `yaml:"days,omitempty"` // Days of week (optional: "mon", "tue", etc.)
+}
+
+// DateException defines whole days without alerts
+type DateException struct {
+	Date    string `yaml:"date"`               // Date in YYYY-MM-DD format
+	EndDate string `yaml:"end_date,omitempty"` // Optional last date (inclusive) for multi-day periods
+	Name    string `yaml:"name,omitempty"`     // Description, e.g. "Christmas"
+}
+
+// MaintenanceWindow defines a one-off period without alerts
+type MaintenanceWindow struct {
+	Start string `yaml:"start"`          // Start in "YYYY-MM-DD HH:MM" format
+	End   string `yaml:"end"`            // End in "YYYY-MM-DD HH:MM" format
+	Name  string `yaml:"name,omitempty"` // Description, e.g. "PG 16 upgrade"
 }
 
 // AlertsConfig holds all alert configurations
 type AlertsConfig struct {
-	Webhook  WebhookConfig  `yaml:"webhook"`
-	Telegram TelegramConfig `yaml:"telegram"`
-	Discord  DiscordConfig  `yaml:"discord"`
-	Teams    TeamsConfig    `yaml:"teams"`
-	Email    EmailConfig    `yaml:"email"`
-	WhatsApp WhatsAppConfig `yaml:"whatsapp"`
+	Webhook      WebhookConfig      `yaml:"webhook"`
+	Telegram     TelegramConfig     `yaml:"telegram"`
+	Discord      DiscordConfig      `yaml:"discord"`
+	Teams        TeamsConfig        `yaml:"teams"`
+	Email        EmailConfig        `yaml:"email"`
+	WhatsApp     WhatsAppConfig     `yaml:"whatsapp"`
+	SMS          SMSConfig          `yaml:"sms"`
+	Voice        VoiceConfig        `yaml:"voice"`
+	Ntfy         NtfyConfig         `yaml:"ntfy"`
+	Gotify       GotifyConfig       `yaml:"gotify"`
+	Pushover     PushoverConfig     `yaml:"pushover"`
+	Matrix       MatrixConfig       `yaml:"matrix"`
+	Mattermost   MattermostConfig   `yaml:"mattermost"`
+	RocketChat   RocketChatConfig   `yaml:"rocketchat"`
+	GoogleChat   GoogleChatConfig   `yaml:"googlechat"`
+	Syslog       SyslogConfig       `yaml:"syslog"`
+	Journald     JournaldConfig     `yaml:"journald"`
+	JSONLog      JSONLogConfig      `yaml:"jsonlog"`
+	MQTT         MQTTConfig         `yaml:"mqtt"`
+	NATS         NATSConfig         `yaml:"nats"`
+	Kafka        KafkaConfig        `yaml:"kafka"`
+	PagerDuty    PagerDutyConfig    `yaml:"pagerduty"`
+	Opsgenie     OpsgenieConfig     `yaml:"opsgenie"`
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+	Delivery     DeliveryConfig     `yaml:"delivery"`
+	Grouping     GroupingConfig     `yaml:"grouping"`
+	Digest       DigestConfig       `yaml:"digest"`
 }
 
 // AlertPayload represents the alert message structure
 type AlertPayload struct {
-	Type     string      `json:"type"`
-	To       string      `json:"to"`
-	Message  string      `json:"message"`
-	Category string      `json:"category"`
-	Instance string      `json:"instance"`
-	Value    interface{} `json:"value"`
-	Note     string      `json:"note"`
+	Type       string                 `json:"type"`
+	To         string                 `json:"to"`
+	Message    string                 `json:"message"`
+	Category   string                 `json:"category"`
+	Instance   string                 `json:"instance"`
+	Value      interface{}            `json:"value"` // Threshold of the rule, kept for existing consumers
+	Observed   interface{}            `json:"observed,omitempty"`
+	Threshold  interface{}            `json:"threshold"`
+	Operator   string                 `json:"operator,omitempty"`
+	Comparison string                 `json:"comparison"` // e.g. "observed 143 > threshold 100"
+	Row        map[string]interface{} `json:"row,omitempty"`
+	Note       string                 `json:"note"`
 }
 
 // Monitor represents the database monitor
 type Monitor struct {
-	config    *Config
-	logger    *log.Logger
-	osSignal  chan os.Signal
-	instances map[string]*MonitorInstance
+	config         *Config
+	logger         *log.Logger
+	osSignal       chan os.Signal
+	instances      map[string]*MonitorInstance
+	outbox         *Outbox
+	dispatcher     *Dispatcher
+	httpClient     *http.Client
+	grouper        *Grouper
+	digest         *Digest
+	silences       *SilenceStore
+	deferred       *DeferredAlerts
+	templates      *emailTemplates
+	deliveries     *DeliveryHistory
+	teamsGraph     *teamsGraphToken
+	discordThreads *discordThreads
+	voiceCalls     *voiceCalls
+	receipts       *pushoverReceipts
+	syslog         *syslogConn
+	jsonLog        *jsonLogWriter
+	buses          map[string]*messageBus
 }
 
 type MonitorInstance struct {
@@ -2,58 +2,219 @@ package monitor
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+	"text/template"
 	"time"
 )
 
+// WebhookConfig holds the generic webhook configuration.
+// The target fields at the top level configure a single webhook, Targets adds further ones.
 type WebhookConfig struct {
-	Enabled  bool          `yaml:"enabled"`
-	URL      string        `yaml:"url"`
-	Interval time.Duration `yaml:"interval"`
+	Enabled       bool `yaml:"enabled"`
+	WebhookTarget `yaml:",inline"`
+	Targets       []WebhookTarget `yaml:"targets,omitempty"`
+	Interval      time.Duration   `yaml:"interval"`
 }
 
-// sendWebhookAlert sends an alert to the configured webhook
-func (m *MonitorInstance) sendWebhookAlert(queryName string, rule AlertRule) error {
-	if m.monitor.config.Alerts.Webhook.Interval > 0 && !m.alertTracker.CanSendAlert(queryName, "webhook", m.monitor.config.Alerts.Webhook.Interval) {
-		m.monitor.logger.Printf("%s alert for query %s skipped due to interval limit", "webhook", queryName)
-		return fmt.Errorf("%s alert for query %s skipped due to interval limit", "webhook", queryName)
+// WebhookTarget holds the settings of a single webhook endpoint
+type WebhookTarget struct {
+	Name             string            `yaml:"name,omitempty"`               // Name used in logs, defaults to the URL
+	URL              string            `yaml:"url"`                          // Endpoint URL
+	Method           string            `yaml:"method,omitempty"`             // HTTP method, defaults to POST
+	Headers          map[string]string `yaml:"headers,omitempty"`            // Custom request headers
+	BearerToken      string            `yaml:"bearer_token,omitempty"`       // Sent as "Authorization: Bearer <token>"
+	Username         string            `yaml:"username,omitempty"`           // Basic auth username
+	Password         string            `yaml:"password,omitempty"`           // Basic auth password
+	Secret           string            `yaml:"secret,omitempty"`             // Signs the body with HMAC-SHA256 when set
+	SignatureHeader  string            `yaml:"signature_header,omitempty"`   // Header carrying the signature, defaults to X-Signature-256
+	Timeout          time.Duration     `yaml:"timeout,omitempty"`            // Request timeout, defaults to the delivery send timeout
+	BodyTemplate     string            `yaml:"body_template,omitempty"`      // Go template rendering the body instead of the default payload
+	BodyTemplateFile string            `yaml:"body_template_file,omitempty"` // File holding the body template
+
+	body *template.Template // Parsed body template, nil when the default payload is sent
+}
+
+// WebhookTemplateData holds the values available to webhook body templates
+type WebhookTemplateData struct {
+	AlertPayload
+	Query     string
+	Condition string
+	Severity  string
+	Time      time.Time
+}
+
+// webhookTemplateFuncs are the functions available to webhook body templates
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// webhookTargets returns all configured webhook targets
+func (c WebhookConfig) webhookTargets() []WebhookTarget {
+	var targets []WebhookTarget
+	if c.URL != "" {
+		targets = append(targets, c.WebhookTarget)
 	}
+	return append(targets, c.Targets...)
+}
+
+// sendWebhookAlert sends an alert to the configured webhooks
+func (m *MonitorInstance) sendWebhookAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
 	payload := AlertPayload{
-		Type:     "database_alert",
-		To:       rule.To,
-		Message:  fmt.Sprintf("[%s] %s", queryName, rule.Message),
-		Category: rule.Category,
-		Value:    rule.Value,
-		Instance: m.dbConfig.Instance,
-		Note:     rule.ResolutionNote,
+		Type:       "database_alert",
+		To:         m.monitor.displayRecipients(rule, "webhook"),
+		Message:    fmt.Sprintf("[%s] %s", queryName, rule.Message),
+		Category:   rule.Category,
+		Instance:   m.dbConfig.Instance,
+		Value:      rule.Value,
+		Observed:   event.Observed,
+		Threshold:  event.Threshold(),
+		Operator:   event.Operator(),
+		Comparison: event.Comparison(),
+		Row:        event.Row,
+		Note:       rule.ResolutionNote,
+	}
+	data := WebhookTemplateData{
+		AlertPayload: payload,
+		Query:        queryName,
+		Condition:    rule.Condition,
+		Severity:     alertSeverity(rule),
+		Time:         time.Now(),
+	}
+
+	targets := make(map[string]WebhookTarget)
+	var names []string
+	for _, target := range m.monitor.config.Alerts.Webhook.webhookTargets() {
+		targets[target.name()] = target
+		names = append(names, target.name())
+	}
+	return deliveryResult(n, n.sendToTargets(names, func(name string) error {
+		return m.sendWebhookTarget(queryName, targets[name], payload, data)
+	}))
+}
+
+// name returns the name of a webhook target, its URL when it has none
+func (t WebhookTarget) name() string {
+	if t.Name != "" {
+		return t.Name
 	}
+	return t.URL
+}
+
+// sendWebhookTarget sends an alert to a single webhook target
+func (m *MonitorInstance) sendWebhookTarget(queryName string, target WebhookTarget, payload AlertPayload, data WebhookTemplateData) error {
+	name := target.name()
 
-	jsonData, err := json.Marshal(payload)
+	body, err := renderWebhookBody(target, payload, data)
 	if err != nil {
-		m.monitor.logger.Printf("Error marshaling webhook payload: %v", err)
-		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+		// The template renders the same data the same way on every attempt
+		m.monitor.logger.Printf("Error rendering webhook %s body: %v", name, err)
+		return &permanentError{err: fmt.Errorf("failed to render webhook %s body: %w", name, err)}
 	}
 
-	resp, err := http.Post(m.monitor.config.Alerts.Webhook.URL, "application/json", bytes.NewBuffer(jsonData))
+	method := strings.ToUpper(target.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, target.URL, bytes.NewBuffer(body))
 	if err != nil {
-		m.monitor.logger.Printf("Error sending webhook alert: %v", err)
-		return fmt.Errorf("failed to send webhook alert: %w", err)
+		m.monitor.logger.Printf("Error creating webhook %s request: %v", name, err)
+		return fmt.Errorf("failed to create webhook %s request: %w", name, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for header, value := range target.Headers {
+		req.Header.Set(header, value)
+	}
+	if target.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+target.BearerToken)
+	} else if target.Username != "" {
+		req.SetBasicAuth(target.Username, target.Password)
+	}
+	if target.Secret != "" {
+		signatureHeader := target.SignatureHeader
+		if signatureHeader == "" {
+			signatureHeader = "X-Signature-256"
+		}
+		req.Header.Set(signatureHeader, signWebhookBody(target.Secret, body))
+	}
+
+	client := m.monitor.httpClient
+	if target.Timeout > 0 {
+		client = &http.Client{Timeout: target.Timeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		m.monitor.logger.Printf("Error sending webhook %s alert: %v", name, err)
+		return fmt.Errorf("failed to send webhook %s alert: %w", name, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		m.monitor.logger.Printf("Webhook alert sent successfully for query: %s", queryName)
-
+		m.monitor.logger.Printf("Webhook %s alert sent successfully for query: %s", name, queryName)
 	} else {
-		m.monitor.logger.Printf("Webhook alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
-		return fmt.Errorf("webhook alert failed with status code: %d for query: %s", resp.StatusCode, queryName)
+		respBody, _ := io.ReadAll(resp.Body)
+		m.monitor.logger.Printf("Webhook %s alert failed with status code: %d (%s) for query: %s", name, resp.StatusCode, string(respBody), queryName)
+		return newHTTPStatusError(resp, respBody, "webhook %s alert failed with status code: %d for query: %s", name, resp.StatusCode, queryName)
 	}
 	return nil
 }
 
+// parseBodyTemplate reads and parses the body template of a target, if configured
+func (t *WebhookTarget) parseBodyTemplate() error {
+	text := t.BodyTemplate
+	if t.BodyTemplateFile != "" {
+		b, err := os.ReadFile(t.BodyTemplateFile)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return nil
+	}
+
+	tmpl, err := template.New("webhook").Funcs(webhookTemplateFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+	t.body = tmpl
+	return nil
+}
+
+// renderWebhookBody renders the body of a webhook request, using the target template if configured
+func renderWebhookBody(target WebhookTarget, payload AlertPayload, data WebhookTemplateData) ([]byte, error) {
+	if target.body == nil {
+		return json.Marshal(payload)
+	}
+
+	var buf bytes.Buffer
+	if err := target.body.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// signWebhookBody returns the HMAC-SHA256 signature of a body as "sha256=<hex>"
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 func escapeHTML(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
 	s = strings.ReplaceAll(s, "<", "&lt;")
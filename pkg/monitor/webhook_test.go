@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookTargets(t *testing.T) {
+	signed, signedRequests := recordingServer(t, http.StatusOK, ``)
+	templated, templatedRequests := recordingServer(t, http.StatusOK, ``)
+	templateFile := filepath.Join(t.TempDir(), "body.tmpl")
+	os.WriteFile(templateFile, []byte(`{"text": {{json .Message}}, "severity": "{{.Severity}}", "query": "{{.Query}}"}`), 0600)
+
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  webhook:
+    enabled: true
+    name: signed
+    url: %q
+    secret: "s3cret"
+    bearer_token: "token"
+    headers:
+      X-Source: monitor
+    targets:
+      - name: templated
+        url: %q
+        method: put
+        username: "user"
+        password: "pass"
+        signature_header: "X-Hub-Signature-256"
+        secret: "other"
+        body_template_file: %q
+`, signed.URL, templated.URL, templateFile)))
+
+	if result := instance.sendWebhookAlert(instance.newNotification("webhook", testEvent())); result.Status != DeliverySent {
+		t.Fatalf("sendWebhookAlert() = %+v", result)
+	}
+
+	r := signedRequests()[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(r.Body)
+	if got, want := r.Header.Get("X-Signature-256"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Source") != "monitor" {
+		t.Errorf("request %s with headers %v, want a POST with the bearer token and custom header", r.Method, r.Header)
+	}
+	var payload AlertPayload
+	if err := json.Unmarshal(r.Body, &payload); err != nil || payload.Type != "database_alert" || payload.Comparison != "observed 143 > threshold 100" {
+		t.Errorf("default payload = %s (%v)", r.Body, err)
+	}
+
+	r = templatedRequests()[0]
+	if user, password, ok := (&http.Request{Header: r.Header}).BasicAuth(); r.Method != http.MethodPut || !ok || user != "user" || password != "pass" {
+		t.Errorf("request %s as %q, want a PUT with basic auth", r.Method, user)
+	}
+	if got := string(r.Body); got != `{"text": "[connections] Too many connections", "severity": "warning", "query": "connections"}` {
+		t.Errorf("templated body = %s", got)
+	}
+	if r.Header.Get("X-Hub-Signature-256") != signWebhookBody("other", r.Body) {
+		t.Errorf("signature %q does not sign the rendered body", r.Header.Get("X-Hub-Signature-256"))
+	}
+}
+
+func TestWebhookBodyTemplateErrors(t *testing.T) {
+	if _, err := loadConfig(writeTestConfig(t, "alerts:\n  webhook:\n    enabled: true\n    url: http://localhost\n    body_template: '{{.Message'\n")); err == nil {
+		t.Error("loadConfig() accepted a template with a syntax error")
+	}
+	if _, err := loadConfig(writeTestConfig(t, "alerts:\n  webhook:\n    enabled: true\n    url: http://localhost\n    body_template_file: /nonexistent/body.tmpl\n")); err == nil {
+		t.Error("loadConfig() accepted a missing template file")
+	}
+
+	// A template failing on the alert data fails the same way on every attempt
+	server, requests := recordingServer(t, http.StatusOK, ``)
+	instance := newTestInstance(t, loadTestConfig(t, fmt.Sprintf("alerts:\n  webhook:\n    enabled: true\n    url: %q\n    body_template: '{{.Missing}}'\n", server.URL)))
+	result := instance.sendWebhookAlert(instance.newNotification("webhook", testEvent()))
+	if result.Status != DeliveryFailed || !result.Permanent || len(requests()) != 0 {
+		t.Errorf("sendWebhookAlert() = %+v, want a permanent failure without a request", result)
+	}
+}
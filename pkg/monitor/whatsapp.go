@@ -6,22 +6,37 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"text/template"
 	"time"
 )
 
 type WhatsAppConfig struct {
-	Enabled       bool          `yaml:"enabled"`
-	AccessToken   string        `yaml:"access_token"`
-	PhoneNumberID string        `yaml:"phone_number_id"`
-	ToNumber      string        `yaml:"to_number"`
-	Interval      time.Duration `yaml:"interval"`
+	Enabled       bool                   `yaml:"enabled"`
+	AccessToken   string                 `yaml:"access_token"`
+	PhoneNumberID string                 `yaml:"phone_number_id"`
+	ToNumber      string                 `yaml:"to_number"`              // Recipient numbers, comma separated
+	ToNumbers     []string               `yaml:"to_numbers,omitempty"`   // More recipients, may refer to "list:<name>" and "oncall:<name>"
+	APIBaseURL    string                 `yaml:"api_base_url,omitempty"` // Graph API base URL (default https://graph.facebook.com)
+	APIVersion    string                 `yaml:"api_version,omitempty"`  // Graph API version (default v22.0)
+	Template      WhatsAppTemplateConfig `yaml:"template,omitempty"`     // Approved message template, free-form text is sent when not set
+	Interval      time.Duration          `yaml:"interval"`
+}
+
+// WhatsAppTemplateConfig selects an approved message template and renders its body parameters
+type WhatsAppTemplateConfig struct {
+	Name       string   `yaml:"name"`
+	Language   string   `yaml:"language,omitempty"`   // Language code of the template (default en_US)
+	Parameters []string `yaml:"parameters,omitempty"` // Go templates rendering the body parameters {{1}}, {{2}}, ... in order
 }
 
 type WhatsAppMessage struct {
-	MessagingProduct string               `json:"messaging_product"`
-	To               string               `json:"to"`
-	Type             string               `json:"type"`
-	Text             *WhatsAppTextMessage `json:"text,omitempty"`
+	MessagingProduct string                   `json:"messaging_product"`
+	To               string                   `json:"to"`
+	Type             string                   `json:"type"`
+	Text             *WhatsAppTextMessage     `json:"text,omitempty"`
+	Template         *WhatsAppTemplateMessage `json:"template,omitempty"`
 }
 
 // WhatsAppTextMessage represents WhatsApp text message content
@@ -29,41 +44,256 @@ type WhatsAppTextMessage struct {
 	Body string `json:"body"`
 }
 
+// WhatsAppTemplateMessage represents WhatsApp template message content
+type WhatsAppTemplateMessage struct {
+	Name       string                      `json:"name"`
+	Language   WhatsAppTemplateLanguage    `json:"language"`
+	Components []WhatsAppTemplateComponent `json:"components,omitempty"`
+}
+
+// WhatsAppTemplateLanguage is the language of a template message
+type WhatsAppTemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+// WhatsAppTemplateComponent holds the parameters of a part of a template message
+type WhatsAppTemplateComponent struct {
+	Type       string                      `json:"type"` // "body"
+	Parameters []WhatsAppTemplateParameter `json:"parameters"`
+}
+
+// WhatsAppTemplateParameter is a text parameter of a template message
+type WhatsAppTemplateParameter struct {
+	Type string `json:"type"` // "text"
+	Text string `json:"text"`
+}
+
+// WhatsAppTemplateData is the data available to template parameters
+type WhatsAppTemplateData struct {
+	Instance   string
+	Query      string
+	Category   string
+	Severity   string
+	Message    string
+	Comparison string      // e.g. "observed 143 > threshold 100", one entry per alert for groups
+	Observed   interface{} // Value the query returned, nil when unknown
+	Threshold  interface{}
+	Note       string
+	Time       string
+	Count      int // Number of alerts, more than one for groups
+}
+
+// whatsAppErrorResponse is the error body of the Graph API
+type whatsAppErrorResponse struct {
+	Error struct {
+		Message      string `json:"message"`
+		Type         string `json:"type"`
+		Code         int    `json:"code"`
+		ErrorSubcode int    `json:"error_subcode"`
+		ErrorData    struct {
+			Details string `json:"details"`
+		} `json:"error_data"`
+		FBTraceID string `json:"fbtrace_id"`
+	} `json:"error"`
+}
+
 // sendWhatsAppAlert sends an alert via WhatsApp Business API
-func (m *MonitorInstance) sendWhatsAppAlert(queryName string, rule AlertRule) error {
-	// Check if enough time has passed since last alert
-	if !m.alertTracker.CanSendAlert(queryName, "whatsapp", m.monitor.config.Alerts.WhatsApp.Interval) {
-		m.monitor.logger.Printf("WhatsApp alert for query %s skipped due to interval limit", queryName)
-		return fmt.Errorf("WhatsApp alert for query %s skipped due to interval limit", queryName)
+func (m *MonitorInstance) sendWhatsAppAlert(n *Notification) DeliveryResult {
+	event := n.Event()
+	queryName, rule := event.Query, event.Rule
+	messageText := m.formatAlert(event).WhatsAppText()
+
+	to, err := m.whatsAppRecipients(rule)
+	if err != nil {
+		m.monitor.logger.Printf("WhatsApp alert failed for query %s: %v", queryName, err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve WhatsApp recipient for query %s: %w", queryName, err))
+	}
+
+	data := WhatsAppTemplateData{
+		Instance:   m.dbConfig.Instance,
+		Query:      queryName,
+		Category:   rule.Category,
+		Severity:   alertSeverity(rule),
+		Message:    rule.Message,
+		Comparison: event.Comparison(),
+		Observed:   event.Observed,
+		Threshold:  event.Threshold(),
+		Note:       rule.ResolutionNote,
+		Time:       time.Now().Format("2006-01-02 15:04:05"),
+		Count:      1,
+	}
+	return deliveryResult(n, m.postWhatsAppMessage(n, queryName, to, messageText, data))
+}
+
+// sendWhatsAppBatch sends a group of alerts via WhatsApp as a single list
+func (m *MonitorInstance) sendWhatsAppBatch(n *Notification) DeliveryResult {
+	batch := n.Batch
+	f := formatBatch(batch)
+
+	to, err := m.whatsAppRecipients(batch[0].Rule)
+	if err != nil {
+		m.monitor.logger.Printf("WhatsApp alert failed for queries %s: %v", batchQueries(batch), err)
+		return deliveryResult(n, fmt.Errorf("failed to resolve WhatsApp recipient for queries %s: %w", batchQueries(batch), err))
 	}
 
+	data := WhatsAppTemplateData{
+		Instance: batch[0].Instance,
+		Query:    batchQueries(batch),
+		Category: batch[0].Rule.Category,
+		Severity: f.Severity,
+		Message:  fmt.Sprintf("%d database alerts", len(batch)),
+		Time:     time.Now().Format("2006-01-02 15:04:05"),
+		Count:    len(batch),
+	}
+	var comparisons []string
+	for _, alert := range batch {
+		if alert.Instance != data.Instance {
+			data.Instance = "multiple instances"
+		}
+		comparisons = append(comparisons, fmt.Sprintf("%s/%s: %s (%s)", alert.Instance, alert.Query, alert.Rule.Message, alert.Event().Comparison()))
+	}
+	data.Comparison = strings.Join(comparisons, "; ")
+	return deliveryResult(n, m.postWhatsAppMessage(n, batchQueries(batch), to, f.WhatsAppText(), data))
+}
+
+// WhatsAppText renders the alert as a WhatsApp text message, which marks bold with asterisks and italic with
+// underscores
+func (f alertFormat) WhatsAppText() string {
+	return f.markup(
+		func(s string) string { return "*" + s + "*" },
+		func(s string) string { return "_" + s + "_" },
+		func(s string) string { return s },
+	)
+}
+
+// whatsAppRecipients returns the numbers to message for a rule: its own recipients when it targets
+// specific recipients, otherwise the configured numbers
+func (m *MonitorInstance) whatsAppRecipients(rule AlertRule) ([]string, error) {
 	config := m.monitor.config.Alerts.WhatsApp
+	return m.phoneRecipients(rule, "whatsapp", append([]string{config.ToNumber}, config.ToNumbers...))
+}
 
-	// Create message content
-	messageText := fmt.Sprintf("🚨 *Database Alert* 🚨\n\n"+
-		"*Instance:* %s\n"+
-		"*Query:* %s\n"+
-		"*Category:* %s\n"+
-		"*Message:* %s\n"+
-		"*Time:* %s\n"+
-		"*Value:* %s"+
-		"\n\n %s",
-		m.dbConfig.Instance,
-		queryName,
-		rule.Category,
-		rule.Message,
-		time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf("%v", rule.Value), rule.ResolutionNote)
-
-	// Create WhatsApp message
-	whatsappMsg := WhatsAppMessage{
-		MessagingProduct: "whatsapp",
-		To:               config.ToNumber,
-		Type:             "text",
-		Text: &WhatsAppTextMessage{
-			Body: messageText,
-		},
+// postWhatsAppMessage sends an alert via the WhatsApp Business API to each recipient that did not receive it yet,
+// as the configured template message or as free-form text
+func (m *MonitorInstance) postWhatsAppMessage(n *Notification, queryName string, to []string, messageText string, data WhatsAppTemplateData) error {
+	if len(to) == 0 {
+		return fmt.Errorf("no WhatsApp recipient for query %s", queryName)
 	}
 
+	var tmpl *WhatsAppTemplateMessage
+	if m.monitor.config.Alerts.WhatsApp.Template.Name != "" {
+		var err error
+		if tmpl, err = m.monitor.whatsAppTemplateMessage(data); err != nil {
+			m.monitor.logger.Printf("Error rendering WhatsApp template for query %s: %v", queryName, err)
+			return fmt.Errorf("failed to render WhatsApp template for query %s: %w", queryName, err)
+		}
+	}
+
+	return n.sendToTargets(to, func(number string) error {
+		whatsappMsg := WhatsAppMessage{MessagingProduct: "whatsapp", To: number}
+		if tmpl != nil {
+			whatsappMsg.Type = "template"
+			whatsappMsg.Template = tmpl
+		} else {
+			whatsappMsg.Type = "text"
+			whatsappMsg.Text = &WhatsAppTextMessage{Body: messageText}
+		}
+		return m.postWhatsAppMessageTo(queryName, whatsappMsg)
+	})
+}
+
+// whatsAppTemplateMessage renders the configured template message with the parameters of an alert
+func (m *Monitor) whatsAppTemplateMessage(data WhatsAppTemplateData) (*WhatsAppTemplateMessage, error) {
+	config := m.config.Alerts.WhatsApp.Template
+	msg := &WhatsAppTemplateMessage{
+		Name:     config.Name,
+		Language: WhatsAppTemplateLanguage{Code: config.Language},
+	}
+	if len(config.Parameters) == 0 {
+		return msg, nil
+	}
+
+	body := WhatsAppTemplateComponent{Type: "body"}
+	for i, parameter := range config.Parameters {
+		tmpl, err := template.New("whatsapp").Parse(parameter)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		body.Parameters = append(body.Parameters, WhatsAppTemplateParameter{Type: "text", Text: whatsAppParameterText(buf.String())})
+	}
+	msg.Components = []WhatsAppTemplateComponent{body}
+	return msg, nil
+}
+
+// whatsAppParameterText makes text acceptable as a template parameter, which may not be empty nor contain
+// new lines, tabs or more than four consecutive spaces
+func whatsAppParameterText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return "-"
+	}
+	return truncateText(text, 1024)
+}
+
+// whatsAppMessagesURL returns the messages endpoint of the configured phone number
+func (c WhatsAppConfig) whatsAppMessagesURL() string {
+	return fmt.Sprintf("%s/%s/%s/messages", strings.TrimRight(c.APIBaseURL, "/"), c.APIVersion, c.PhoneNumberID)
+}
+
+// whatsAppThrottleCodes are the Graph API error codes of rate limits, which come with status 400
+var whatsAppThrottleCodes = []int{4, 80007, 130429, 131048, 131056}
+
+// whatsAppError describes a Graph API error response, with a hint for the common causes, and reports whether
+// it is a rate limit
+func whatsAppError(body []byte) (string, bool, bool) {
+	var errResp whatsAppErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Code == 0 {
+		return "", false, false
+	}
+	e := errResp.Error
+
+	description := fmt.Sprintf("%s (code %d", e.Message, e.Code)
+	if e.ErrorSubcode != 0 {
+		description += fmt.Sprintf(", subcode %d", e.ErrorSubcode)
+	}
+	description += ")"
+	if e.ErrorData.Details != "" {
+		description += ": " + e.ErrorData.Details
+	}
+
+	switch e.Code {
+	case 190:
+		description += "; the access token expired or is invalid, renew access_token"
+	case 131047:
+		description += "; the recipient did not message in the last 24 hours, configure an approved template"
+	case 131026:
+		description += "; the recipient cannot receive WhatsApp messages, check the number"
+	case 131030:
+		description += "; the recipient is not in the allowed list of the test number"
+	case 132000:
+		description += "; the number of template parameters does not match the template"
+	case 132001:
+		description += "; the template does not exist in this language or is not approved"
+	}
+	throttled := slices.Contains(whatsAppThrottleCodes, e.Code)
+	if throttled {
+		description += "; rate limit reached, the alert is retried later"
+	}
+	if e.FBTraceID != "" {
+		description += fmt.Sprintf(" [fbtrace_id %s]", e.FBTraceID)
+	}
+	return description, throttled, true
+}
+
+// postWhatsAppMessageTo sends a message to a single number
+func (m *MonitorInstance) postWhatsAppMessageTo(queryName string, whatsappMsg WhatsAppMessage) error {
+	config := m.monitor.config.Alerts.WhatsApp
+	to := whatsappMsg.To
+
 	jsonData, err := json.Marshal(whatsappMsg)
 	if err != nil {
 		m.monitor.logger.Printf("Error marshaling WhatsApp message: %v", err)
@@ -71,9 +301,7 @@ func (m *MonitorInstance) sendWhatsAppAlert(queryName string, rule AlertRule) er
 	}
 
 	// Send via WhatsApp Business API
-	url := fmt.Sprintf("https://graph.facebook.com/v22.0/%s/messages", config.PhoneNumberID)
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", config.whatsAppMessagesURL(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		m.monitor.logger.Printf("Error creating WhatsApp request: %v", err)
 		return fmt.Errorf("failed to create WhatsApp request: %w", err)
@@ -82,8 +310,7 @@ func (m *MonitorInstance) sendWhatsAppAlert(queryName string, rule AlertRule) er
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+config.AccessToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := m.monitor.httpClient.Do(req)
 	if err != nil {
 		m.monitor.logger.Printf("Error sending WhatsApp alert: %v", err)
 		return fmt.Errorf("failed to send WhatsApp alert: %w", err)
@@ -91,16 +318,25 @@ func (m *MonitorInstance) sendWhatsAppAlert(queryName string, rule AlertRule) er
 	defer resp.Body.Close()
 
 	bodyText := ""
+	var respBody []byte
 	if resp.Body != nil {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyText = string(bodyBytes)
+		respBody, _ = io.ReadAll(resp.Body)
+		bodyText = string(respBody)
 	}
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		m.monitor.logger.Printf("WhatsApp alert sent successfully for query: %s -> %s", queryName, bodyText)
-		m.alertTracker.RecordAlert(queryName, "whatsapp")
 	} else {
-		m.monitor.logger.Printf("WhatsApp alert failed with status code: %d for query: %s -> %s", resp.StatusCode, queryName, bodyText)
-		return fmt.Errorf("WhatsApp alert failed with status code: %d for query: %s -> %s", resp.StatusCode, queryName, bodyText)
+		description, throttled, ok := whatsAppError(respBody)
+		if ok {
+			bodyText = description
+		}
+		m.monitor.logger.Printf("WhatsApp alert failed with status code: %d for query: %s to %s -> %s", resp.StatusCode, queryName, to, bodyText)
+		statusErr := newHTTPStatusError(resp, respBody, "WhatsApp alert failed with status code: %d for query: %s to %s -> %s", resp.StatusCode, queryName, to, bodyText)
+		if throttled {
+			// Retry rate limited messages instead of failing them permanently like other 4xx errors
+			statusErr.StatusCode = http.StatusTooManyRequests
+		}
+		return statusErr
 	}
 
 	return nil
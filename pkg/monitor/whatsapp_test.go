@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// whatsAppServer returns a stub of the Graph API answering every message with status and body,
+// recording the requests it received
+func whatsAppServer(t *testing.T, status int, body string) (*httptest.Server, func() []*http.Request, func() []WhatsAppMessage) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	var messages []WhatsAppMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var msg WhatsAppMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Errorf("invalid message %s: %v", data, err)
+		}
+
+		mu.Lock()
+		requests = append(requests, r)
+		messages = append(messages, msg)
+		mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []*http.Request {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}, func() []WhatsAppMessage {
+			mu.Lock()
+			defer mu.Unlock()
+			return messages
+		}
+}
+
+// whatsAppTestConfig returns a WhatsApp configuration sending to the stub server
+func whatsAppTestConfig(t *testing.T, server *httptest.Server, extra string) *Config {
+	return loadTestConfig(t, fmt.Sprintf(`
+alerts:
+  whatsapp:
+    enabled: true
+    access_token: "token"
+    phone_number_id: "1234"
+    to_number: "+15550001,+15550002"
+    api_base_url: %q
+%s`, server.URL, extra))
+}
+
+func TestWhatsAppTemplateParameters(t *testing.T) {
+	server, requests, messages := whatsAppServer(t, http.StatusOK, `{"messages": [{"id": "wamid.1"}]}`)
+	instance := newTestInstance(t, whatsAppTestConfig(t, server, `    template:
+      name: "db_alert"
+      parameters:
+        - "{{ .Instance }}/{{ .Query }}"
+        - "{{ .Comparison }}"
+        - "{{ .Note }}"
+        - "line one\n\tline two"
+`))
+
+	if result := instance.sendWhatsAppAlert(instance.newNotification("whatsapp", testEvent())); result.Status != DeliverySent {
+		t.Fatalf("alert %s: %s", result.Status, result.Error)
+	}
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("Graph API received %d requests, want one per recipient", len(got))
+	}
+	if got[0].URL.Path != "/v22.0/1234/messages" || got[0].Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("request to %s with %q", got[0].URL.Path, got[0].Header.Get("Authorization"))
+	}
+
+	msg := messages()[0]
+	if msg.Type != "template" || msg.Template == nil || msg.Template.Name != "db_alert" || msg.Template.Language.Code != "en_US" {
+		t.Fatalf("message = %+v, want the db_alert template in en_US", msg)
+	}
+	var params []string
+	for _, parameter := range msg.Template.Components[0].Parameters {
+		params = append(params, parameter.Text)
+	}
+	want := []string{"test/connections", "observed 143 > threshold 100", "-", "line one line two"}
+	if strings.Join(params, "|") != strings.Join(want, "|") {
+		t.Errorf("template parameters = %q, want %q", params, want)
+	}
+}
+
+func TestWhatsAppErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		permanent  bool
+		contains   string
+	}{
+		{
+			name:       "outside the 24 hour window",
+			body:       `{"error": {"message": "Re-engagement message", "type": "OAuthException", "code": 131047, "error_data": {"details": "More than 24 hours have passed"}, "fbtrace_id": "Az8or"}}`,
+			statusCode: http.StatusBadRequest,
+			permanent:  true,
+			contains:   "Re-engagement message (code 131047): More than 24 hours have passed; the recipient did not message in the last 24 hours, configure an approved template [fbtrace_id Az8or]",
+		},
+		{
+			name:       "rate limit",
+			body:       `{"error": {"message": "Rate limit hit", "code": 130429}}`,
+			statusCode: http.StatusTooManyRequests,
+			contains:   "Rate limit hit (code 130429); rate limit reached, the alert is retried later",
+		},
+		{
+			name:       "not a Graph error",
+			body:       `Bad Request`,
+			statusCode: http.StatusBadRequest,
+			permanent:  true,
+			contains:   "-> Bad Request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, _ := whatsAppServer(t, http.StatusBadRequest, tt.body)
+			instance := newTestInstance(t, whatsAppTestConfig(t, server, ""))
+
+			result := instance.sendWhatsAppAlert(instance.newNotification("whatsapp", testEvent()))
+			if result.Status != DeliveryFailed || result.StatusCode != tt.statusCode || result.Permanent != tt.permanent {
+				t.Errorf("result = %s, status code %d, permanent %v; want failed, %d, %v", result.Status, result.StatusCode, result.Permanent, tt.statusCode, tt.permanent)
+			}
+			if !strings.Contains(result.Error, tt.contains) {
+				t.Errorf("error %q does not contain %q", result.Error, tt.contains)
+			}
+			if len(result.Targets) != 2 || result.Targets[1].Target != "+15550002" {
+				t.Errorf("failed targets = %+v, want both recipients", result.Targets)
+			}
+		})
+	}
+}